@@ -1,18 +1,60 @@
 import json
 import re
+import time
+import uuid
 import logging
-from typing import Dict, Any, Optional, List
+from typing import Callable, Dict, Any, Optional, List, Tuple, Union
 
-from openai import OpenAI
+from pydantic import BaseModel
 from llm.config import llm_config
+from llm.schemas import TokenUsage
+from llm.providers import get_provider, ChatRequest, ToolCall
+from llm.retry import RetryPolicy, call_with_retry
+from llm.circuit_breaker import get_breaker
+from llm.concurrency import llm_slot
+from llm.errors import AuthError, BadJSONError
+from llm.cost import estimate_cost_usd
+from llm.call_log import emit_call_record, redact_messages, redact_text
+from llm.response_cache import get_response_cache, prompt_cache_key
+from llm.prompt_templates import JSON_REPAIR
+from llm.run_context import RunContext, RunCancelledError
+from llm.tracing import annotate, span
+from llm.metrics import LLM_ERRORS, LLM_FAILOVERS, LLM_TOKENS
 
 logger = logging.getLogger(__name__)
 
-# Initialize single OpenAI client
-client = OpenAI(
-    api_key=llm_config.api_key,
-    base_url=llm_config.base_url,
-)
+
+class LLMResponse(BaseModel):
+    """Parsed result of a single LLM call."""
+    data: Dict[str, Any]
+    usage: TokenUsage = TokenUsage()
+    model: Optional[str] = None
+    provider: Optional[str] = None
+    tool_calls: List[ToolCall] = []
+    finish_reason: Optional[str] = None
+    cached: bool = False  # Served from llm.response_cache; usage is zero
+    raw_content: Optional[str] = None  # Completion text exactly as returned (None when cached)
+
+
+# max_tokens to retry with when a truncated call had no explicit limit
+TRUNCATION_RETRY_MIN_TOKENS = 2048
+
+
+def json_prefill(response_format: Optional[Dict[str, Any]]) -> Optional[str]:
+    """
+    Opening of the JSON a response_format asks for, to prime the assistant turn:
+    '{"<first property>":' for a JSON schema (properties are emitted in schema
+    order), '{' for plain JSON mode, None when the output isn't JSON.
+    """
+    if not response_format:
+        return None
+    if response_format.get("type") == "json_object":
+        return "{"
+    properties = ((response_format.get("json_schema") or {}).get("schema") or {}).get("properties") or {}
+    if not properties:
+        return "{" if response_format.get("type") == "json_schema" else None
+    return '{"' + next(iter(properties)) + '":'
+
 
 def extract_json_from_text(text: str) -> Optional[Dict[str, Any]]:
     """
@@ -48,52 +90,485 @@ def extract_json_from_text(text: str) -> Optional[Dict[str, Any]]:
     
     return None
 
+def _parse_json_content(content: str) -> Tuple[Optional[Dict[str, Any]], str]:
+    """
+    Parse a model response as JSON, falling back to extraction from prose.
+    Returns (data, error) where error describes why parsing failed.
+    """
+    try:
+        data = json.loads(content)
+        if isinstance(data, dict):
+            return data, ""
+        error = f"Expected a JSON object, got {type(data).__name__}"
+    except json.JSONDecodeError as e:
+        error = f"JSONDecodeError: {e}"
+
+    extracted = extract_json_from_text(content)
+    if extracted:
+        return extracted, ""
+    return None, error
+
+
+def _call_model(
+    request: ChatRequest,
+    provider_name: str,
+    step_name: str,
+    retry_policy: Optional[RetryPolicy],
+    ctx: Optional[RunContext],
+    pool: Optional[str] = None,
+) -> LLMResponse:
+    """
+    Call a single provider/model (with retries) and parse its JSON output.
+    Output cut off at max_tokens is regenerated with a larger limit (up to
+    LLMConfig.truncation_max_tokens) rather than parsed as half a JSON object.
+    Malformed JSON is sent back to the model with the parse error for
+    correction, up to LLMConfig.json_repair_attempts times.
+    """
+    llm_logger = logging.getLogger("llm")
+    llm_provider = get_provider(provider_name)
+    breaker = get_breaker(provider_name, pool)
+    policy = retry_policy or RetryPolicy.from_config()
+
+    def _create(chat_request: ChatRequest):
+        if ctx is not None:
+            ctx.check()
+            remaining = ctx.remaining()
+            if remaining is not None:
+                # One slow attempt must not outlive the run's budget
+                chat_request = chat_request.model_copy(update={"timeout": min(llm_config.http_timeout, remaining)})
+
+        with llm_slot(provider_name, ctx, pool):
+            # Fail fast (into the fallback chain) while the provider is known to be down
+            breaker.before_call()
+            try:
+                chat_response = llm_provider.chat(chat_request)
+            except Exception as e:
+                # Only provider-health failures count towards tripping the breaker;
+                # any other error means the provider answered (the request was bad)
+                if policy.is_retryable(e):
+                    breaker.record_failure()
+                else:
+                    breaker.record_success()
+                raise
+        breaker.record_success()
+        return chat_response
+
+    def _complete(chat_request: ChatRequest):
+        start_time = time.time()
+        try:
+            chat_response = call_with_retry(
+                lambda: _create(chat_request),
+                policy=policy,
+                step_name=step_name,
+                ctx=ctx,
+            )
+        except Exception as e:
+            emit_call_record(
+                step_name, provider_name, chat_request.model, chat_request.messages,
+                latency_ms=int((time.time() - start_time) * 1000), error=e,
+                request_id=chat_request.request_id,
+            )
+            raise
+        chat_response.usage.cost_usd = estimate_cost_usd(chat_response.model or chat_request.model, chat_response.usage)
+        emit_call_record(
+            step_name, provider_name, chat_response.model or chat_request.model, chat_request.messages,
+            latency_ms=int((time.time() - start_time) * 1000),
+            response=chat_response.content,
+            usage=chat_response.usage,
+            request_id=chat_request.request_id,
+        )
+        return chat_response
+
+    def _complete_untruncated(chat_request: ChatRequest):
+        """_complete, re-run with a higher max_tokens while the output is truncated."""
+        chat_response = _complete(chat_request)
+        call_usage = chat_response.usage
+        for _ in range(llm_config.truncation_retries):
+            if not chat_response.truncated or chat_response.tool_calls:
+                break
+            current = chat_request.max_tokens
+            raised = min(current * 2 if current else TRUNCATION_RETRY_MIN_TOKENS, llm_config.truncation_max_tokens)
+            if current and raised <= current:
+                break
+            logger.warning(
+                f"{step_name}: Output truncated at max_tokens={current} ({chat_response.finish_reason}). "
+                f"Retrying with max_tokens={raised}"
+            )
+            chat_request = chat_request.model_copy(update={
+                "max_tokens": raised,
+                "idempotency_key": f"{chat_request.idempotency_key}:max{raised}",
+            })
+            chat_response = _complete(chat_request)
+            call_usage = call_usage + chat_response.usage
+        return chat_response, chat_request, call_usage
+
+    response, request, usage = _complete_untruncated(request)
+    repairs_left = llm_config.json_repair_attempts
+
+    while True:
+        content = response.content
+
+        # Log the raw response
+        llm_logger.info(
+            f"[{step_name}] [req {request.request_id}] RESPONSE ({provider_name}/{request.model}, "
+            f"finish={response.finish_reason}):\n{redact_text(content)}"
+        )
+        llm_logger.info(
+            f"[{step_name}] USAGE: prompt={response.usage.prompt_tokens} "
+            f"completion={response.usage.completion_tokens} total={response.usage.total_tokens} "
+            f"cached={response.usage.cached_tokens} cost=${response.usage.cost_usd:.6f}"
+        )
+
+        if response.tool_calls:
+            # The model answered through tools; any accompanying text is optional
+            llm_logger.info(f"[{step_name}] TOOL CALLS: {[call.name for call in response.tool_calls]}")
+            data, _ = _parse_json_content(content) if content.strip() else (None, "")
+            return LLMResponse(
+                data=data or {},
+                usage=usage,
+                model=response.model,
+                provider=llm_provider.name,
+                tool_calls=response.tool_calls,
+                finish_reason=response.finish_reason,
+                raw_content=content,
+            )
+
+        data, parse_error = _parse_json_content(content)
+        if data is not None:
+            return LLMResponse(
+                data=data,
+                usage=usage,
+                model=response.model,
+                provider=llm_provider.name,
+                finish_reason=response.finish_reason,
+                raw_content=content,
+            )
+
+        if repairs_left <= 0:
+            raise BadJSONError(
+                f"{step_name}: Could not parse JSON from response: {content[:100]}...",
+                raw_content=content,
+                provider=llm_provider.name,
+            )
+
+        # Re-prompt with the broken output and the parser's complaint
+        repairs_left -= 1
+        logger.warning(f"{step_name}: Malformed JSON ({parse_error}). Asking model to repair it")
+        repair_request = request.model_copy(update={
+            "messages": request.messages + [
+                {"role": "assistant", "content": content},
+                {"role": "user", "content": JSON_REPAIR.render(parse_error=parse_error)},
+            ],
+            # A different prompt, so it must not be de-duplicated against the original
+            "idempotency_key": f"{request.idempotency_key}:repair{llm_config.json_repair_attempts - repairs_left}",
+        })
+        response, _, repair_usage = _complete_untruncated(repair_request)
+        usage = usage + repair_usage
+
+
 def make_api_call(
     messages: List[Dict[str, str]],
     response_format: Optional[Dict[str, Any]] = None,
     temperature: float = 0.7,
     max_tokens: Optional[int] = None,
-    step_name: str = "LLM"
-) -> Dict[str, Any]:
+    step_name: str = "LLM",
+    retry_policy: Optional[RetryPolicy] = None,
+    ctx: Optional[RunContext] = None,
+    provider: Optional[str] = None,
+    model: Optional[str] = None,
+    fallbacks: Optional[List[Tuple[str, str]]] = None,
+    tools: Optional[List[Dict[str, Any]]] = None,
+    tool_choice: Optional[Union[str, Dict[str, Any]]] = None,
+    cache_prompt: Optional[bool] = None,
+    cache: Optional[bool] = None,
+    cache_scope: Optional[str] = None,
+    prefill: Optional[str] = None,
+    pool: Optional[str] = None,
+    idempotency_suffix: Optional[str] = None,
+) -> LLMResponse:
     """
-    Execute LLM API call without retries.
+    Execute LLM API call, retrying transient failures (429s, timeouts, 5xx)
+    with exponential backoff and jitter.
+    If ctx is given, the call aborts once it is cancelled and each HTTP
+    request is bounded by the time remaining until its deadline.
+    provider/model default to the step's configuration (see LLMConfig.provider_for).
+    If the primary model still fails, each (provider, model) in fallbacks is
+    tried in order (default: LLMConfig.fallbacks_for(step_name)).
+    tools/tool_choice (OpenAI format, see llm.providers.function_tool) let the
+    model answer through function calls, returned in LLMResponse.tool_calls.
+    cache_prompt (default LLMConfig.prompt_caching) marks the system prompt and
+    history for provider-side prompt caching.
+    Every request carries ctx.request_id (or a fresh ID) for tracing, and an
+    idempotency key that stays the same across retries of that call.
+    idempotency_suffix (e.g. "reask1") tells apart calls a step makes more than
+    once in a run, which would otherwise share a key and get the first answer back.
+    cache (default: step listed in LLMConfig.response_cache_steps) reuses a
+    stored response for an identical normalized prompt; cache_scope (e.g. the
+    organization ID) keeps entries from being shared across tenants. Only the
+    primary model's responses are stored.
+    prefill seeds the assistant turn on providers that support it; by default
+    (LLMConfig.response_prefill) it is the opening of the JSON response_format
+    asks for (see json_prefill). Pass "" to disable.
+    pool (e.g. "shadow") gives the call circuit breakers and concurrency slots
+    apart from production's (see get_breaker, llm_slot).
+    With LLMConfig.tracing, the call is an "llm.call" span carrying the model and tokens (llm.tracing).
     
     Returns:
-        Parsed JSON response dict
+        LLMResponse with the parsed JSON dict and token usage
     """
     llm_logger = logging.getLogger("llm")
+    request_id = ctx.request_id if ctx is not None else uuid.uuid4().hex
+
+    # Log the request
+    llm_logger.info(
+        f"[{step_name}] [req {request_id}] REQUEST:\n"
+        f"{json.dumps(redact_messages(messages), indent=2, ensure_ascii=False)}"
+    )
+
+    with span("llm.call", step=step_name, request_id=request_id) as call_span:
+        primary = (provider or llm_config.provider_for(step_name), model or llm_config.model_for(step_name))
+        chain = [primary]
+        for target in (llm_config.fallbacks_for(step_name) if fallbacks is None else fallbacks):
+            if target not in chain:
+                chain.append(target)
+
+        response_cache = get_response_cache()
+        use_cache = step_name in llm_config.response_cache_steps if cache is None else cache
+        cache_key = None
+        # Tool calls act on the world, so their responses are never reused
+        if response_cache is not None and use_cache and not tools:
+            cache_key = prompt_cache_key(messages, primary[0], primary[1], temperature, response_format, cache_scope)
+            hit = response_cache.get(cache_key)
+            if hit is not None:
+                llm_logger.info(f"[{step_name}] [req {request_id}] CACHE HIT")
+                annotate(call_span, provider=primary[0], model=primary[1], cache_hit=True)
+                return LLMResponse(**hit, cached=True)
+
+        if prefill is None and llm_config.response_prefill and not tools:
+            prefill = json_prefill(response_format)
+
+        key_prefix = f"{request_id}:{step_name}" + (f":{idempotency_suffix}" if idempotency_suffix else "")
+        last_error: Optional[Exception] = None
+        for index, (provider_name, model_name) in enumerate(chain):
+            request = ChatRequest(
+                model=model_name,
+                messages=messages,
+                temperature=temperature,
+                max_tokens=max_tokens,
+                response_format=response_format,
+                tools=tools,
+                tool_choice=tool_choice,
+                cache_prompt=llm_config.prompt_caching if cache_prompt is None else cache_prompt,
+                request_id=request_id,
+                idempotency_key=f"{key_prefix}:{index}",
+                prefill=prefill or None,
+            )
+            try:
+                result = _call_model(request, provider_name, step_name, retry_policy, ctx, pool)
+            except RunCancelledError:
+                raise
+            except Exception as e:
+                last_error = e
+                LLM_ERRORS.inc(step=step_name, provider=provider_name, error=type(e).__name__)
+                if index < len(chain) - 1:
+                    next_provider, next_model = chain[index + 1]
+                    logger.warning(
+                        f"{step_name}: {provider_name}/{model_name} failed ({e}). "
+                        f"Failing over to {next_provider}/{next_model}"
+                    )
+                continue
+            # Keyed by the primary model: a fallback's answer must not be served as the primary's
+            if cache_key is not None and not result.tool_calls and index == 0:
+                response_cache.set(
+                    cache_key,
+                    result.model_dump(mode="json", include={"data", "model", "provider", "finish_reason"}),
+                    llm_config.response_cache_ttl,
+                )
+            if index:
+                LLM_FAILOVERS.inc(step=step_name, provider=provider_name)
+            LLM_TOKENS.inc(result.usage.prompt_tokens, step=step_name, provider=provider_name, kind="prompt")
+            LLM_TOKENS.inc(result.usage.completion_tokens, step=step_name, provider=provider_name, kind="completion")
+            annotate(
+                call_span,
+                provider=provider_name,
+                model=model_name,
+                fallback_index=index,
+                finish_reason=result.finish_reason,
+                prompt_tokens=result.usage.prompt_tokens,
+                completion_tokens=result.usage.completion_tokens,
+                cached_tokens=result.usage.cached_tokens,
+                cost_usd=result.usage.cost_usd,
+            )
+            return result
+
+        logger.error(f"{step_name} API call failed: {last_error}")
+        raise last_error
+
+
+class HealthStatus(BaseModel):
+    """Result of a provider health-check ping."""
+    healthy: bool
+    provider: str
+    model: Optional[str] = None
+    latency_ms: int = 0
+    auth_ok: Optional[bool] = None  # None when the failure says nothing about the key
+    error: Optional[str] = None
+
+
+def health_check(
+    provider: Optional[str] = None,
+    model: Optional[str] = None,
+    step_name: str = "Brain",
+    timeout: float = 10.0,
+) -> HealthStatus:
+    """
+    Send a tiny completion to a provider and report latency and key validity.
+    Bypasses retries, fallbacks and the circuit breaker so the result reflects
+    the provider itself. Intended for readiness probes (see llm.health).
+    """
+    provider_name = provider or llm_config.provider_for(step_name)
+    model_name = model or llm_config.model_for(step_name)
+    request = ChatRequest(
+        model=model_name,
+        messages=[{"role": "user", "content": "ping"}],
+        temperature=0.0,
+        max_tokens=5,
+        timeout=timeout,
+    )
+
+    start_time = time.time()
     try:
-        # Log the request
-        llm_logger.info(f"[{step_name}] REQUEST:\n{json.dumps(messages, indent=2, ensure_ascii=False)}")
-
-        kwargs = {
-            "model": llm_config.model,
-            "messages": messages,
-            "temperature": temperature,
-        }
-        if response_format:
-            kwargs["response_format"] = response_format
-        if max_tokens:
-            kwargs["max_tokens"] = max_tokens
-
-        response = client.chat.completions.create(**kwargs)
-        content = response.choices[0].message.content
+        get_provider(provider_name).chat(request)
+    except AuthError as e:
+        return HealthStatus(
+            healthy=False, provider=provider_name, model=model_name,
+            latency_ms=int((time.time() - start_time) * 1000), auth_ok=False, error=str(e),
+        )
+    except Exception as e:
+        return HealthStatus(
+            healthy=False, provider=provider_name, model=model_name,
+            latency_ms=int((time.time() - start_time) * 1000), error=str(e),
+        )
+    return HealthStatus(
+        healthy=True, provider=provider_name, model=model_name,
+        latency_ms=int((time.time() - start_time) * 1000), auth_ok=True,
+    )
 
-        # Log the raw response
-        llm_logger.info(f"[{step_name}] RESPONSE:\n{content}")
 
-        # Try direct JSON parse
-        try:
-            return json.loads(content)
-        except json.JSONDecodeError:
-            # Try extraction from text
-            extracted = extract_json_from_text(content)
-            if extracted:
-                logger.info(f"{step_name}: Extracted JSON from text response")
-                return extracted
-            raise ValueError(f"{step_name}: Could not parse JSON from response: {content[:100]}...")
-            
+class StreamResult(BaseModel):
+    """Outcome of a streamed LLM call."""
+    content: str = ""
+    usage: TokenUsage = TokenUsage()
+    model: Optional[str] = None
+    provider: Optional[str] = None
+    finish_reason: Optional[str] = None
+    first_token_latency_ms: Optional[int] = None  # None if no text was produced
+    latency_ms: int = 0
+
+
+def make_streaming_api_call(
+    messages: List[Dict[str, str]],
+    on_token: Optional[Callable[[str], None]] = None,
+    temperature: float = 0.7,
+    max_tokens: Optional[int] = None,
+    step_name: str = "LLM",
+    ctx: Optional[RunContext] = None,
+    provider: Optional[str] = None,
+    model: Optional[str] = None,
+    pool: Optional[str] = None,
+) -> StreamResult:
+    """
+    Execute a streaming LLM call (server-sent events).
+    on_token is invoked with each text delta as it arrives, e.g. to start the
+    WhatsApp typing indicator on the first token.
+    Streams are not retried: a partially delivered response cannot be replayed.
+    pool works as in make_api_call.
+
+    Returns:
+        StreamResult with the full text, usage, and first-token vs total latency
+    """
+    llm_logger = logging.getLogger("llm")
+    request_id = ctx.request_id if ctx is not None else uuid.uuid4().hex
+    llm_logger.info(
+        f"[{step_name}] [req {request_id}] STREAM REQUEST:\n"
+        f"{json.dumps(redact_messages(messages), indent=2, ensure_ascii=False)}"
+    )
+
+    provider_name = provider or llm_config.provider_for(step_name)
+    llm_provider = get_provider(provider_name)
+    breaker = get_breaker(provider_name, pool)
+
+    request = ChatRequest(
+        model=model or llm_config.model_for(step_name),
+        messages=messages,
+        temperature=temperature,
+        max_tokens=max_tokens,
+        request_id=request_id,
+        idempotency_key=f"{request_id}:{step_name}:stream",
+    )
+    if ctx is not None:
+        ctx.check()
+        remaining = ctx.remaining()
+        if remaining is not None:
+            request = request.model_copy(update={"timeout": min(llm_config.http_timeout, remaining)})
+
+    result = StreamResult(provider=llm_provider.name, model=request.model)
+    parts: List[str] = []
+    start_time = time.time()
+
+    try:
+        with llm_slot(provider_name, ctx, pool):
+            # As in make_api_call: every call that passes the breaker reports back to it
+            breaker.before_call()
+            try:
+                for chunk in llm_provider.stream(request):
+                    if ctx is not None:
+                        ctx.check()
+                    if chunk.delta:
+                        if result.first_token_latency_ms is None:
+                            result.first_token_latency_ms = int((time.time() - start_time) * 1000)
+                        parts.append(chunk.delta)
+                        if on_token:
+                            on_token(chunk.delta)
+                    if chunk.usage is not None:
+                        result.usage = chunk.usage
+                    if chunk.finish_reason:
+                        result.finish_reason = chunk.finish_reason
+                    if chunk.model:
+                        result.model = chunk.model
+            except RunCancelledError:
+                # Says nothing about the provider, but must not hold a half-open trial forever
+                breaker.release_trial()
+                raise
+            except Exception as e:
+                if RetryPolicy.from_config().is_retryable(e):
+                    breaker.record_failure()
+                else:
+                    breaker.record_success()
+                raise
+        breaker.record_success()
+    except RunCancelledError:
+        raise
     except Exception as e:
-        logger.error(f"{step_name} API call failed: {e}")
+        logger.error(f"{step_name} streaming call failed: {e}")
+        emit_call_record(
+            step_name, provider_name, request.model, messages,
+            latency_ms=int((time.time() - start_time) * 1000), error=e,
+            request_id=request_id,
+        )
         raise
 
+    result.usage.cost_usd = estimate_cost_usd(result.model, result.usage)
+    result.content = "".join(parts)
+    result.latency_ms = int((time.time() - start_time) * 1000)
+
+    llm_logger.info(
+        f"[{step_name}] [req {request_id}] STREAM RESPONSE ({provider_name}/{result.model}, "
+        f"first token {result.first_token_latency_ms}ms, total {result.latency_ms}ms):\n{redact_text(result.content)}"
+    )
+    emit_call_record(
+        step_name, provider_name, result.model, messages,
+        latency_ms=result.latency_ms, response=result.content, usage=result.usage,
+        request_id=request_id,
+    )
+    return result
@@ -0,0 +1,248 @@
+"""
+Batch Completions.
+Submits many independent LLM requests to a provider's batch API (OpenAI/Groq
+batches, Anthropic message batches) at a discount, in exchange for results
+arriving asynchronously (up to 24h). Meant for non-urgent sweeps such as
+nightly follow-ups; live replies keep using make_api_call.
+
+Usage (e.g. from a scheduled task):
+    queue = BatchQueue(step_name="Followup")
+    for conversation in due:
+        queue.enqueue(BatchItem(custom_id=str(conversation["id"]), messages=build_messages(conversation)))
+    queue.flush()
+
+    # Later, on every scheduler tick:
+    for result in queue.poll():
+        handle(result.custom_id, result.response or result.error)
+"""
+import logging
+import threading
+import time
+from abc import ABC, abstractmethod
+from collections import Counter
+from typing import Any, Dict, List, Optional
+
+from pydantic import BaseModel, Field
+
+from llm.api_helpers import LLMResponse, _parse_json_content
+from llm.config import llm_config
+from llm.cost import estimate_cost_usd
+from llm.providers import get_provider, ChatRequest
+from llm.providers.base import BATCH_COMPLETED, BATCH_FAILED, ChatResponse
+
+logger = logging.getLogger(__name__)
+
+
+class BatchItem(BaseModel):
+    """One request in a batch. custom_id links the result back (e.g. a conversation ID)."""
+    custom_id: str
+    messages: List[Dict[str, str]]
+    response_format: Optional[Dict[str, Any]] = None
+    temperature: float = 0.7
+    max_tokens: Optional[int] = None
+
+
+class BatchJob(BaseModel):
+    """A submitted batch awaiting results."""
+    batch_id: str
+    provider: str
+    model: str
+    step_name: str
+    custom_ids: List[str] = []
+    submitted_at: float = Field(default_factory=time.time)
+
+
+class BatchItemResult(BaseModel):
+    """Outcome of one batch item: a parsed response or an error message."""
+    custom_id: str
+    response: Optional[LLMResponse] = None
+    error: Optional[str] = None
+
+
+# ============================================================
+# Job Persistence
+# ============================================================
+
+class BatchJobStore(ABC):
+    """Where submitted-but-unfinished batches are remembered between scheduler ticks."""
+
+    @abstractmethod
+    def save(self, job: BatchJob) -> None:
+        raise NotImplementedError
+
+    @abstractmethod
+    def pending(self) -> List[BatchJob]:
+        raise NotImplementedError
+
+    @abstractmethod
+    def remove(self, batch_id: str) -> None:
+        raise NotImplementedError
+
+
+class InMemoryBatchJobStore(BatchJobStore):
+    """Process-local store. Use a shared store (DB/Redis) when polling from another process."""
+
+    def __init__(self) -> None:
+        self._jobs: Dict[str, BatchJob] = {}
+        self._lock = threading.Lock()
+
+    def save(self, job: BatchJob) -> None:
+        with self._lock:
+            self._jobs[job.batch_id] = job
+
+    def pending(self) -> List[BatchJob]:
+        with self._lock:
+            return list(self._jobs.values())
+
+    def remove(self, batch_id: str) -> None:
+        with self._lock:
+            self._jobs.pop(batch_id, None)
+
+
+# ============================================================
+# Submit / Collect
+# ============================================================
+
+def submit_batch(
+    items: List[BatchItem],
+    step_name: str = "Batch",
+    provider: Optional[str] = None,
+    model: Optional[str] = None,
+) -> BatchJob:
+    """
+    Submit items as one provider batch. provider/model default to the step's
+    configuration. custom_ids must be unique: results are matched back by them.
+    """
+    counts = Counter(item.custom_id for item in items)
+    duplicates = sorted(custom_id for custom_id, count in counts.items() if count > 1)
+    if duplicates:
+        raise ValueError(f"{step_name}: duplicate batch custom_ids {duplicates}")
+    provider_name = provider or llm_config.provider_for(step_name)
+    model_name = model or llm_config.model_for(step_name)
+    requests = {
+        item.custom_id: ChatRequest(
+            model=model_name,
+            messages=item.messages,
+            temperature=item.temperature,
+            max_tokens=item.max_tokens,
+            response_format=item.response_format,
+        )
+        for item in items
+    }
+    batch_id = get_provider(provider_name).submit_batch(requests)
+    logger.info(f"{step_name}: submitted batch {batch_id} ({len(items)} requests) to {provider_name}/{model_name}")
+    return BatchJob(
+        batch_id=batch_id,
+        provider=provider_name,
+        model=model_name,
+        step_name=step_name,
+        custom_ids=list(requests),
+    )
+
+
+def collect_batch(job: BatchJob) -> Optional[List[BatchItemResult]]:
+    """Results of a finished batch, or None while it is still running."""
+    llm_provider = get_provider(job.provider)
+    status = llm_provider.batch_status(job.batch_id)
+    if status == BATCH_FAILED:
+        logger.error(f"{job.step_name}: batch {job.batch_id} failed")
+        return [BatchItemResult(custom_id=custom_id, error="batch failed") for custom_id in job.custom_ids]
+    if status != BATCH_COMPLETED:
+        return None
+
+    outcomes = llm_provider.batch_results(job.batch_id)
+    results = []
+    for custom_id in job.custom_ids:
+        outcome = outcomes.get(custom_id)
+        if outcome is None:
+            results.append(BatchItemResult(custom_id=custom_id, error="missing from batch output"))
+        elif isinstance(outcome, ChatResponse):
+            results.append(_to_item_result(custom_id, outcome, job))
+        else:
+            results.append(BatchItemResult(custom_id=custom_id, error=str(outcome)))
+    logger.info(f"{job.step_name}: collected batch {job.batch_id} ({len(results)} results)")
+    return results
+
+
+def _to_item_result(custom_id: str, chat_response: ChatResponse, job: BatchJob) -> BatchItemResult:
+    """Parse a batch response's JSON. There is no repair loop: the batch has already finished."""
+    data, parse_error = _parse_json_content(chat_response.content)
+    if data is None:
+        return BatchItemResult(custom_id=custom_id, error=f"Could not parse JSON: {parse_error}")
+    usage = chat_response.usage
+    usage.cost_usd = estimate_cost_usd(chat_response.model or job.model, usage) * llm_config.batch_discount
+    return BatchItemResult(
+        custom_id=custom_id,
+        response=LLMResponse(
+            data=data,
+            usage=usage,
+            model=chat_response.model or job.model,
+            provider=job.provider,
+            finish_reason=chat_response.finish_reason,
+        ),
+    )
+
+
+# ============================================================
+# Queue
+# ============================================================
+
+class BatchQueue:
+    """
+    Buffers items for one step and submits them in batches of up to
+    max_batch_size; poll() returns the results of every batch that finished.
+    """
+
+    def __init__(
+        self,
+        step_name: str = "Batch",
+        provider: Optional[str] = None,
+        model: Optional[str] = None,
+        max_batch_size: Optional[int] = None,
+        store: Optional[BatchJobStore] = None,
+    ) -> None:
+        self.step_name = step_name
+        self.provider = provider
+        self.model = model
+        self.max_batch_size = max_batch_size or llm_config.batch_max_size
+        self.store = store or InMemoryBatchJobStore()
+        self._buffer: List[BatchItem] = []
+        self._lock = threading.Lock()
+
+    def enqueue(self, item: BatchItem) -> Optional[BatchJob]:
+        """Add an item; submits the buffer as a batch once it is full. Raises ValueError if its custom_id is queued."""
+        with self._lock:
+            if any(queued.custom_id == item.custom_id for queued in self._buffer):
+                raise ValueError(f"{self.step_name}: custom_id {item.custom_id!r} is already queued")
+            self._buffer.append(item)
+            full = len(self._buffer) >= self.max_batch_size
+        return self.flush() if full else None
+
+    def flush(self) -> Optional[BatchJob]:
+        """Submit whatever is buffered. If the submit fails, the items stay queued for the next flush."""
+        with self._lock:
+            items, self._buffer = self._buffer, []
+        if not items:
+            return None
+        try:
+            job = submit_batch(items, step_name=self.step_name, provider=self.provider, model=self.model)
+        except Exception:
+            with self._lock:
+                self._buffer[:0] = items
+            raise
+        self.store.save(job)
+        return job
+
+    def poll(self) -> List[BatchItemResult]:
+        """Collect finished batches. Jobs that are still running stay in the store."""
+        results: List[BatchItemResult] = []
+        for job in self.store.pending():
+            try:
+                job_results = collect_batch(job)
+            except Exception as e:
+                logger.error(f"{self.step_name}: polling batch {job.batch_id} failed: {e}")
+                continue
+            if job_results is not None:
+                results.extend(job_results)
+                self.store.remove(job.batch_id)
+        return results
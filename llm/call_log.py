@@ -0,0 +1,100 @@
+"""
+LLM Call Logging.
+Every completion is reported as a CallRecord to an optional hook (debug
+store, analytics...). Phone numbers and user message content can be redacted
+first so bad generations can be investigated without leaking lead PII.
+"""
+import logging
+import re
+import time
+from typing import Callable, Dict, List, Optional
+
+from pydantic import BaseModel, Field
+
+from llm.config import llm_config
+from llm.schemas import TokenUsage
+
+logger = logging.getLogger(__name__)
+
+# 10-15 digit numbers with optional separators, e.g. "+91 98765 43210", "(415) 555-0100"
+PHONE_PATTERN = re.compile(r"\+?\(?\d(?:[\s\-().]{0,2}\d){9,14}")
+PHONE_PLACEHOLDER = "[PHONE]"
+
+
+class CallRecord(BaseModel):
+    """One LLM call, as seen by the logging hook (already redacted)."""
+    step_name: str
+    request_id: Optional[str] = None
+    provider: Optional[str] = None
+    model: Optional[str] = None
+    messages: List[Dict[str, str]] = []
+    response: Optional[str] = None
+    error: Optional[str] = None
+    latency_ms: int = 0
+    usage: TokenUsage = TokenUsage()
+    timestamp: float = Field(default_factory=time.time)
+
+
+CallLogHook = Callable[[CallRecord], None]
+
+_hook: Optional[CallLogHook] = None
+
+
+def set_call_log_hook(hook: Optional[CallLogHook]) -> None:
+    """Install (or with None, remove) the hook receiving every CallRecord."""
+    global _hook
+    _hook = hook
+
+
+def redact_text(text: Optional[str]) -> Optional[str]:
+    """Mask phone numbers if LLM_LOG_REDACT_PHONES is enabled."""
+    if not text or not llm_config.log_redact_phones:
+        return text
+    return PHONE_PATTERN.sub(PHONE_PLACEHOLDER, text)
+
+
+def redact_messages(messages: List[Dict[str, str]]) -> List[Dict[str, str]]:
+    """
+    Redacted copy of a chat transcript. With LLM_LOG_REDACT_USER_CONTENT the
+    user turns (which carry the lead's messages) are replaced by their length.
+    """
+    redacted = []
+    for message in messages:
+        content = message.get("content") or ""
+        if message.get("role") == "user" and llm_config.log_redact_user_content:
+            content = f"[REDACTED {len(content)} chars]"
+        else:
+            content = redact_text(content)
+        redacted.append({**message, "content": content})
+    return redacted
+
+
+def emit_call_record(
+    step_name: str,
+    provider: Optional[str],
+    model: Optional[str],
+    messages: List[Dict[str, str]],
+    latency_ms: int,
+    response: Optional[str] = None,
+    usage: Optional[TokenUsage] = None,
+    error: Optional[BaseException] = None,
+    request_id: Optional[str] = None,
+) -> None:
+    """Redact and hand a call to the hook. Hook failures are logged, never raised."""
+    if _hook is None:
+        return
+    record = CallRecord(
+        step_name=step_name,
+        request_id=request_id,
+        provider=provider,
+        model=model,
+        messages=redact_messages(messages),
+        response=redact_text(response),
+        error=redact_text(str(error)) if error is not None else None,
+        latency_ms=latency_ms,
+        usage=usage or TokenUsage(),
+    )
+    try:
+        _hook(record)
+    except Exception as e:
+        logger.error(f"LLM call log hook failed: {e}")
@@ -0,0 +1,124 @@
+"""
+Circuit Breaker for LLM providers.
+Trips after N consecutive transient failures and short-circuits calls for a
+cool-down period, so a dead provider fails fast into the fallback chain
+instead of burning the full request timeout on every pipeline run.
+"""
+import logging
+import threading
+import time
+from typing import Callable, Dict, Optional
+
+from llm.config import llm_config
+
+logger = logging.getLogger(__name__)
+
+CLOSED = "closed"
+OPEN = "open"
+HALF_OPEN = "half_open"
+
+
+class CircuitOpenError(Exception):
+    """Raised when a call is short-circuited because the provider's breaker is open."""
+
+    def __init__(self, provider_name: str, retry_in: float):
+        self.provider_name = provider_name
+        self.retry_in = retry_in
+        super().__init__(f"Circuit open for provider '{provider_name}' (retry in {retry_in:.0f}s)")
+
+
+class CircuitBreaker:
+    """
+    Consecutive-failure circuit breaker.
+
+    closed    -> calls pass through; failures are counted
+    open      -> calls are rejected until cooldown_seconds elapse
+    half_open -> a single trial call is allowed; success closes, failure re-opens
+    """
+
+    def __init__(
+        self,
+        name: str,
+        failure_threshold: int = 5,
+        cooldown_seconds: float = 30.0,
+        clock: Callable[[], float] = time.monotonic,
+    ) -> None:
+        self.name = name
+        self.failure_threshold = failure_threshold
+        self.cooldown_seconds = cooldown_seconds
+        self._clock = clock
+        self._lock = threading.Lock()
+        self._state = CLOSED
+        self._failures = 0
+        self._opened_at = 0.0
+        self._trial_in_flight = False
+
+    @property
+    def state(self) -> str:
+        with self._lock:
+            return self._current_state()
+
+    def _current_state(self) -> str:
+        if self._state == OPEN and self._clock() - self._opened_at >= self.cooldown_seconds:
+            self._state = HALF_OPEN
+            self._trial_in_flight = False
+        return self._state
+
+    def before_call(self) -> None:
+        """Raise CircuitOpenError if the call should be short-circuited."""
+        with self._lock:
+            state = self._current_state()
+            if state == CLOSED:
+                return
+            if state == HALF_OPEN and not self._trial_in_flight:
+                self._trial_in_flight = True
+                return
+            retry_in = max(0.0, self.cooldown_seconds - (self._clock() - self._opened_at))
+            raise CircuitOpenError(self.name, retry_in)
+
+    def record_success(self) -> None:
+        with self._lock:
+            if self._state != CLOSED:
+                logger.info(f"Circuit for '{self.name}' closed after successful trial call")
+            self._state = CLOSED
+            self._failures = 0
+            self._trial_in_flight = False
+
+    def release_trial(self) -> None:
+        """Free a half-open trial call that ended without a verdict on the provider (e.g. cancelled)."""
+        with self._lock:
+            self._trial_in_flight = False
+
+    def record_failure(self) -> None:
+        with self._lock:
+            state = self._current_state()
+            self._failures += 1
+            if state == HALF_OPEN or self._failures >= self.failure_threshold:
+                if state != OPEN:
+                    logger.warning(
+                        f"Circuit for '{self.name}' opened after {self._failures} consecutive failures "
+                        f"(cool-down {self.cooldown_seconds:.0f}s)"
+                    )
+                self._state = OPEN
+                self._opened_at = self._clock()
+                self._trial_in_flight = False
+
+
+_breakers: Dict[str, CircuitBreaker] = {}
+_registry_lock = threading.Lock()
+
+
+def get_breaker(provider_name: str, pool: Optional[str] = None) -> CircuitBreaker:
+    """
+    Shared breaker for a provider, created from LLMConfig on first use. A pool
+    (e.g. "shadow") gets breakers of its own, so its failures never trip production's.
+    """
+    name = f"{pool}_{provider_name}" if pool else provider_name
+    with _registry_lock:
+        if name not in _breakers:
+            _breakers[name] = CircuitBreaker(
+                name,
+                failure_threshold=llm_config.circuit_failure_threshold,
+                cooldown_seconds=llm_config.circuit_cooldown_seconds,
+            )
+        return _breakers[name]
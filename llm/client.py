@@ -0,0 +1,126 @@
+"""
+LLM Client interface.
+Steps talk to the model through an LLMClient so the pipeline can be driven by
+canned responses in tests instead of a real endpoint.
+"""
+import json
+from abc import ABC, abstractmethod
+from typing import Any, Dict, List, Optional, Union
+
+from llm.api_helpers import LLMResponse, make_api_call
+from llm.schemas import RawCapture, TokenUsage
+
+
+class LLMClient(ABC):
+    """Anything that can turn chat messages into a parsed LLMResponse."""
+
+    @abstractmethod
+    def complete(self, messages: List[Dict[str, str]], **kwargs: Any) -> LLMResponse:
+        """Same keyword arguments as llm.api_helpers.make_api_call."""
+        raise NotImplementedError
+
+
+class APILLMClient(LLMClient):
+    """Production client: retries, fallbacks, circuit breaking via make_api_call."""
+
+    def complete(self, messages: List[Dict[str, str]], **kwargs: Any) -> LLMResponse:
+        return make_api_call(messages, **kwargs)
+
+
+class PinnedLLMClient(LLMClient):
+    """
+    Production client sending every step to one provider/model (e.g. a shadow
+    candidate), optionally in its own breaker/concurrency pool (make_api_call's pool).
+    """
+
+    def __init__(self, provider: Optional[str] = None, model: Optional[str] = None, pool: Optional[str] = None):
+        self.provider = provider
+        self.model = model
+        self.pool = pool
+
+    def complete(self, messages: List[Dict[str, str]], **kwargs: Any) -> LLMResponse:
+        if self.provider:
+            kwargs["provider"] = self.provider
+        if self.model:
+            kwargs["model"] = self.model
+        if self.pool:
+            kwargs["pool"] = self.pool
+        return make_api_call(messages, **kwargs)
+
+
+CannedResponse = Union[Dict[str, Any], LLMResponse, Exception]
+
+
+class CannedLLMClient(LLMClient):
+    """
+    Test double returning queued responses per step name ("Brain", "Mouth", ...).
+    Dicts become LLMResponse.data; exceptions are raised. Every call is recorded
+    in .calls as (step_name, messages, kwargs).
+
+    Usage:
+        client = CannedLLMClient({"Brain": [{"action": "send_now", ...}], "Mouth": [{"message_text": "Hi"}]})
+        result = run_pipeline(context, "Hello", client=client)
+    """
+
+    def __init__(self, responses: Dict[str, List[CannedResponse]]):
+        self.responses = {step: list(queue) for step, queue in responses.items()}
+        self.calls: List[tuple] = []
+
+    def complete(self, messages: List[Dict[str, str]], **kwargs: Any) -> LLMResponse:
+        step_name = kwargs.get("step_name", "LLM")
+        self.calls.append((step_name, messages, kwargs))
+        queue = self.responses.get(step_name)
+        if not queue:
+            raise AssertionError(f"CannedLLMClient: no response queued for step '{step_name}'")
+        item = queue.pop(0)
+        if isinstance(item, Exception):
+            raise item
+        if isinstance(item, LLMResponse):
+            return item
+        return LLMResponse(data=item, usage=TokenUsage(), model="canned", provider="canned")
+
+    def steps_called(self) -> List[str]:
+        return [step_name for step_name, _, _ in self.calls]
+
+
+class CapturingLLMClient(LLMClient):
+    """
+    Wraps a client and records every call's rendered prompt and raw completion
+    in .captures (see run_pipeline's capture_raw). Failed calls are recorded too.
+    """
+
+    def __init__(self, inner: LLMClient):
+        self.inner = inner
+        self.captures: List[RawCapture] = []
+
+    def complete(self, messages: List[Dict[str, str]], **kwargs: Any) -> LLMResponse:
+        step_name = kwargs.get("step_name", "LLM")
+        try:
+            response = self.inner.complete(messages, **kwargs)
+        except Exception as e:
+            self.captures.append(RawCapture(
+                step=step_name,
+                messages=list(messages),
+                raw_response=getattr(e, "raw_content", None) or None,
+                error=str(e),
+            ))
+            raise
+        raw = response.raw_content
+        if raw is None:
+            # Cached or canned responses have no completion text; the parsed data is the closest thing
+            raw = json.dumps(response.data, ensure_ascii=False)
+        self.captures.append(RawCapture(
+            step=step_name,
+            messages=list(messages),
+            raw_response=raw,
+            model=response.model,
+            provider=response.provider,
+        ))
+        return response
+
+
+default_client: LLMClient = APILLMClient()
+
+
+def resolve_client(client: Optional[LLMClient]) -> LLMClient:
+    return client or default_client
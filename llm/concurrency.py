@@ -0,0 +1,87 @@
+"""
+Concurrency Limiter for LLM calls.
+Caps in-flight requests globally and per provider. Callers beyond the limit
+queue for a slot (bounded wait) instead of firing more requests into a
+provider that is already rate-limiting us.
+"""
+import logging
+import os
+import threading
+from contextlib import contextmanager
+from typing import Dict, Iterator, Optional
+
+from llm.config import llm_config
+from llm.errors import LLMError
+from llm.run_context import RunContext
+
+logger = logging.getLogger(__name__)
+
+
+class ConcurrencyLimitError(LLMError):
+    """No slot freed up within the wait timeout. Not retried; the fallback chain moves on."""
+
+
+class ConcurrencyLimiter:
+    """Semaphore with a bounded acquire. A limit <= 0 means unlimited."""
+
+    def __init__(self, name: str, limit: int):
+        self.name = name
+        self.limit = limit
+        self._semaphore = threading.BoundedSemaphore(limit) if limit > 0 else None
+
+    def acquire(self, timeout: Optional[float]) -> bool:
+        if self._semaphore is None:
+            return True
+        return self._semaphore.acquire(timeout=timeout)
+
+    def release(self) -> None:
+        if self._semaphore is not None:
+            self._semaphore.release()
+
+
+_global_limiter = ConcurrencyLimiter("global", llm_config.max_concurrency)
+_provider_limiters: Dict[str, ConcurrencyLimiter] = {}
+_registry_lock = threading.Lock()
+
+
+def get_provider_limiter(provider_name: str) -> ConcurrencyLimiter:
+    """Shared limiter for a provider, sized by LLM_MAX_CONCURRENCY_<PROVIDER> (default unlimited)."""
+    with _registry_lock:
+        if provider_name not in _provider_limiters:
+            limit = int(os.getenv(f"LLM_MAX_CONCURRENCY_{provider_name.upper()}", "0"))
+            _provider_limiters[provider_name] = ConcurrencyLimiter(provider_name, limit)
+        return _provider_limiters[provider_name]
+
+
+@contextmanager
+def llm_slot(provider_name: str, ctx: Optional[RunContext] = None, pool: Optional[str] = None) -> Iterator[None]:
+    """
+    Hold a global and a per-provider slot for the duration of one request.
+    The wait is capped by LLM_CONCURRENCY_WAIT_TIMEOUT and by ctx's deadline.
+    A pool (e.g. "shadow") has slots of its own instead, LLM_MAX_CONCURRENCY_<POOL>
+    and LLM_MAX_CONCURRENCY_<POOL>_<PROVIDER>, so it never takes production's.
+    """
+    timeout = llm_config.concurrency_wait_timeout
+    if ctx is not None:
+        remaining = ctx.remaining()
+        if remaining is not None:
+            timeout = min(timeout, remaining)
+
+    acquired = []
+    try:
+        if pool:
+            limiters = (get_provider_limiter(pool), get_provider_limiter(f"{pool}_{provider_name}"))
+        else:
+            limiters = (_global_limiter, get_provider_limiter(provider_name))
+        for limiter in limiters:
+            if not limiter.acquire(timeout):
+                logger.warning(f"No free LLM slot ({limiter.name}, limit {limiter.limit}) after {timeout:.1f}s")
+                raise ConcurrencyLimitError(
+                    f"Timed out waiting for a {limiter.name} LLM slot (limit {limiter.limit})",
+                    provider=provider_name,
+                )
+            acquired.append(limiter)
+        yield
+    finally:
+        for limiter in reversed(acquired):
+            limiter.release()
@@ -2,8 +2,10 @@
 LLM Configuration for HTL Pipeline.
 Uses Groq for fast, cost-effective inference.
 """
+import json
 import os
 from pathlib import Path
+from typing import Any, Dict, List, Optional, Tuple
 from dotenv import load_dotenv
 
 # Load environment variables
@@ -14,11 +16,263 @@ env_path = root_dir / ".env.dev"
 if env_path.exists():
     load_dotenv(dotenv_path=env_path, override=True)
 
+# Sampling defaults per step; max_tokens None leaves the limit to the provider
+STEP_SAMPLING_DEFAULTS: Dict[str, Dict[str, Any]] = {
+    "Brain": {"temperature": 0.3, "max_tokens": None},
+    "Mouth": {"temperature": 0.7, "max_tokens": None},
+    "Variation": {"temperature": 0.9, "max_tokens": None},
+    "Verify": {"temperature": 0.0, "max_tokens": 300},
+    "Memory": {"temperature": 0.7, "max_tokens": 1000},
+    "MemoryCompact": {"temperature": 0.7, "max_tokens": 1000},
+}
+DEFAULT_SAMPLING: Dict[str, Any] = {"temperature": 0.7, "max_tokens": None}
+
+
+def _load_step_settings(path: Optional[str]) -> Dict[str, Dict[str, Any]]:
+    """{"mouth": {"temperature": 0.5}, ...} from a JSON file; keys are matched case-insensitively."""
+    if not path:
+        return {}
+    with open(path) as f:
+        return {step.lower(): settings for step, settings in json.load(f).items()}
+
 class LLMConfig:
-    def __init__(self)-> None:  
+    def __init__(self)-> None:
         self.api_key=os.getenv("GROQ_API_KEY")
         self.model=os.getenv("LLM_MODEL")
         self.base_url=os.getenv("LLM_BASE_URL")
 
+        # Provider selection: groq | openai | anthropic | gemini | ollama
+        # Override per step with LLM_PROVIDER_<STEP> / LLM_MODEL_<STEP> (e.g. LLM_PROVIDER_MOUTH)
+        self.provider=os.getenv("LLM_PROVIDER", "groq")
+        self.openai_api_key=os.getenv("OPENAI_API_KEY")
+        self.openai_base_url=os.getenv("OPENAI_BASE_URL")
+        self.anthropic_api_key=os.getenv("ANTHROPIC_API_KEY")
+        self.anthropic_base_url=os.getenv("ANTHROPIC_BASE_URL", "https://api.anthropic.com")
+        self.google_api_key=os.getenv("GOOGLE_API_KEY")
+        self.gemini_base_url=os.getenv("GEMINI_BASE_URL", "https://generativelanguage.googleapis.com/v1beta")
+        self.ollama_base_url=os.getenv("OLLAMA_BASE_URL", "http://localhost:11434")
+
+        # Retry policy for transient failures (429s, timeouts, 5xx)
+        self.max_retries=int(os.getenv("LLM_MAX_RETRIES", "3"))
+        self.retry_base_delay=float(os.getenv("LLM_RETRY_BASE_DELAY", "0.5"))
+        self.retry_max_delay=float(os.getenv("LLM_RETRY_MAX_DELAY", "8.0"))
+        self.retry_max_retry_after=float(os.getenv("LLM_RETRY_MAX_RETRY_AFTER", "30"))
+        self.retry_on_status=[
+            int(code) for code in os.getenv("LLM_RETRY_ON_STATUS", "408,409,429,500,502,503,504").split(",")
+            if code.strip()
+        ]
+
+        # Total time budget per pipeline run, shared by all retries and fallbacks.
+        # Inbound replies must feel live; scheduled follow-ups can afford to wait.
+        # Each HTTP attempt is capped at what is left of it (never LLM_HTTP_TIMEOUT
+        # beyond); a step that runs out falls back instead of failing the run.
+        self.inbound_budget_seconds=float(os.getenv("LLM_INBOUND_BUDGET_SECONDS", "15"))
+        self.followup_budget_seconds=float(os.getenv("LLM_FOLLOWUP_BUDGET_SECONDS", "60"))
+
+        # Sampling per step (see sampling_for): LLM_TEMPERATURE_<STEP> / LLM_MAX_TOKENS_<STEP>
+        # win over the step's entry in the JSON file at LLM_STEP_SETTINGS_FILE, which wins
+        # over STEP_SAMPLING_DEFAULTS
+        self.step_settings_file=os.getenv("LLM_STEP_SETTINGS_FILE")
+        self.step_settings=_load_step_settings(self.step_settings_file)
+
+        # Circuit breaker: trip after N consecutive failures, short-circuit for the cool-down
+        self.circuit_failure_threshold=int(os.getenv("LLM_CIRCUIT_FAILURE_THRESHOLD", "5"))
+        self.circuit_cooldown_seconds=float(os.getenv("LLM_CIRCUIT_COOLDOWN_SECONDS", "30"))
+
+        # Concurrency limits on in-flight requests (see llm.concurrency). 0 = unlimited.
+        # Per provider: LLM_MAX_CONCURRENCY_<PROVIDER> (e.g. LLM_MAX_CONCURRENCY_GROQ=4)
+        self.max_concurrency=int(os.getenv("LLM_MAX_CONCURRENCY", "16"))
+        self.concurrency_wait_timeout=float(os.getenv("LLM_CONCURRENCY_WAIT_TIMEOUT", "30"))
+
+        # Send the Mouth's conversation history as real user/assistant turns instead of
+        # flattening it into the prompt (better replies, enables provider prompt caching)
+        self.mouth_chat_history=os.getenv("LLM_MOUTH_CHAT_HISTORY", "false").lower() == "true"
+        # Organization example conversations added to the Mouth prompt (current stage first)
+        self.mouth_max_examples=int(os.getenv("LLM_MOUTH_MAX_EXAMPLES", "2"))
+        # Replies over max_words / questions_per_message are re-asked with a corrective
+        # instruction this many times, then truncated (see llm.message_constraints)
+        self.mouth_constraint_retries=int(os.getenv("LLM_MOUTH_CONSTRAINT_RETRIES", "1"))
+        # Replies whose script doesn't match the lead's language (llm.language) are
+        # regenerated this many times, then sent as-is with a violation recorded
+        self.mouth_language_retries=int(os.getenv("LLM_MOUTH_LANGUAGE_RETRIES", "1"))
+        # Replies making an organization's forbidden claims (llm.guardrails) are regenerated
+        # with the claim cited this many times, then withheld and flagged for a human
+        self.mouth_guardrail_retries=int(os.getenv("LLM_MOUTH_GUARDRAIL_RETRIES", "1"))
+
+        # Self-consistency (llm.steps.brain): in these stages the Brain samples this many
+        # candidates and keeps the decision most agree on (1 disables)
+        self.self_consistency_samples=int(os.getenv("LLM_SELF_CONSISTENCY_SAMPLES", "1"))
+        self.self_consistency_stages=[
+            stage.strip() for stage in os.getenv("LLM_SELF_CONSISTENCY_STAGES", "pricing,cta").split(",") if stage.strip()
+        ]
+        self.self_consistency_temperature=float(os.getenv("LLM_SELF_CONSISTENCY_TEMPERATURE", "0.7"))
+
+        # Follow-up variation (llm.steps.variation): follow-ups scoring above this similarity
+        # to an earlier bot message are paraphrased, and dropped if still too similar
+        self.followup_variation=os.getenv("LLM_FOLLOWUP_VARIATION", "true").lower() == "true"
+        self.followup_max_similarity=float(os.getenv("LLM_FOLLOWUP_MAX_SIMILARITY", "0.7"))
+        self.followup_variation_attempts=int(os.getenv("LLM_FOLLOWUP_VARIATION_ATTEMPTS", "2"))
+
+        # Hallucination check (llm.steps.verify): off | rules | llm. "rules" compares the reply's
+        # prices, percentages, times and durations with the business info and conversation;
+        # "llm" also has the model fact-check the reply. Ungrounded replies are withheld.
+        self.hallucination_check=os.getenv("LLM_HALLUCINATION_CHECK", "off").lower()
+
+        # Opt-in: replies of LLM_SPLIT_MIN_CHARS or more are sent as up to LLM_SPLIT_MAX_PARTS bubbles
+        # (llm.message_parts), each delayed by its typing time: LLM_BUBBLE_MS_PER_CHAR, clamped
+        self.split_messages=os.getenv("LLM_SPLIT_MESSAGES", "false").lower() == "true"
+        self.split_min_chars=int(os.getenv("LLM_SPLIT_MIN_CHARS", "160"))
+        self.split_max_parts=int(os.getenv("LLM_SPLIT_MAX_PARTS", "3"))
+        self.bubble_ms_per_char=int(os.getenv("LLM_BUBBLE_MS_PER_CHAR", "25"))
+        self.bubble_min_delay_ms=int(os.getenv("LLM_BUBBLE_MIN_DELAY_MS", "800"))
+        self.bubble_max_delay_ms=int(os.getenv("LLM_BUBBLE_MAX_DELAY_MS", "3000"))
+
+        # Estimated prompt tokens a step may send; longer prompts are trimmed by
+        # priority (llm.prompt_budget). 0 disables trimming.
+        self.prompt_token_budget=int(os.getenv("LLM_PROMPT_TOKEN_BUDGET", "12000"))
+
+        # Mark the stable prompt prefix for provider-side caching (Anthropic cache_control)
+        self.prompt_caching=os.getenv("LLM_PROMPT_CACHING", "true").lower() == "true"
+
+        # Output cut off at max_tokens: re-run with a doubled limit, up to the ceiling
+        self.truncation_retries=int(os.getenv("LLM_TRUNCATION_RETRIES", "1"))
+        self.truncation_max_tokens=int(os.getenv("LLM_TRUNCATION_MAX_TOKENS", "4096"))
+
+        # Batch API (llm.batch): requests per submitted batch, and the price multiplier
+        # vendors apply to batch traffic
+        self.batch_max_size=int(os.getenv("LLM_BATCH_MAX_SIZE", "1000"))
+        self.batch_discount=float(os.getenv("LLM_BATCH_DISCOUNT", "0.5"))
+
+        # Response cache (llm.response_cache): none | memory | redis. Only steps listed in
+        # LLM_RESPONSE_CACHE_STEPS (e.g. "Brain") are cached unless a call opts in explicitly.
+        self.response_cache_backend=os.getenv("LLM_RESPONSE_CACHE", "none").lower()
+        self.response_cache_redis_url=os.getenv("LLM_RESPONSE_CACHE_REDIS_URL", "redis://localhost:6379/0")
+        self.response_cache_ttl=int(os.getenv("LLM_RESPONSE_CACHE_TTL", "3600"))
+        self.response_cache_steps=[
+            step.strip() for step in os.getenv("LLM_RESPONSE_CACHE_STEPS", "").split(",") if step.strip()
+        ]
+
+        # Who runs the Memory step: "worker" (caller, after acting on the result), "inline"
+        # (run_pipeline, before returning), "async" (run_pipeline, on a background thread)
+        # or "queue" (llm.memory_queue, per-conversation serialized with retries)
+        self.memory_mode=os.getenv("LLM_MEMORY_MODE", "worker").lower()
+        self.memory_workers=int(os.getenv("LLM_MEMORY_WORKERS", "4"))
+        self.memory_max_attempts=int(os.getenv("LLM_MEMORY_MAX_ATTEMPTS", "3"))
+        # Rolling summaries longer than this are compacted into key facts + a short narrative
+        self.memory_summary_max_chars=int(os.getenv("LLM_MEMORY_SUMMARY_MAX_CHARS", "1500"))
+        # Hard cap, enforced without an LLM call: oldest narrative is dropped, key facts kept
+        self.memory_summary_max_tokens=int(os.getenv("LLM_MEMORY_SUMMARY_MAX_TOKENS", "450"))
+
+        # Attach every call's rendered prompt and raw completion to PipelineResult.raw_captures.
+        # Debugging only: captures are unredacted and can be large.
+        self.capture_raw=os.getenv("LLM_CAPTURE_RAW", "false").lower() == "true"
+
+        # Seed the assistant turn with the opening of the expected JSON ('{"thought_process":')
+        # on providers that support prefill (Anthropic), so replies can't start with chatter
+        self.response_prefill=os.getenv("LLM_RESPONSE_PREFILL", "true").lower() == "true"
+
+        # Prompt store (llm.prompt_store): none | file | api. "file" reads LLM_PROMPT_STORE_PATH;
+        # "api" serves the active version published through the internal API (worker only).
+        # The store is re-checked at most every LLM_PROMPT_RELOAD_SECONDS.
+        self.prompt_store_backend=os.getenv("LLM_PROMPT_STORE", "none").lower()
+        self.prompt_store_path=os.getenv("LLM_PROMPT_STORE_PATH")
+        self.prompt_reload_seconds=float(os.getenv("LLM_PROMPT_RELOAD_SECONDS", "60"))
+
+        # Re-prompts allowed when parsed output would fall back to defaults for a critical
+        # field (unknown Brain action/stage, empty Mouth reply); the model is told what was wrong
+        self.validation_retries=int(os.getenv("LLM_VALIDATION_RETRIES", "1"))
+
+        # Re-prompts allowed when the model returns malformed JSON (0 disables repair)
+        self.json_repair_attempts=int(os.getenv("LLM_JSON_REPAIR_ATTEMPTS", "1"))
+
+        # Shared HTTP client (see llm.http_client). LLM_HTTP_PROXY also accepts socks5:// URLs;
+        # LLM_HTTP_VERIFY is "true", "false" or a path to a CA bundle.
+        self.http_timeout=float(os.getenv("LLM_HTTP_TIMEOUT", "90"))
+        self.http_connect_timeout=float(os.getenv("LLM_HTTP_CONNECT_TIMEOUT", "10"))
+        self.http_proxy=os.getenv("LLM_HTTP_PROXY")
+        self.http_verify=os.getenv("LLM_HTTP_VERIFY", "true")
+        self.http_max_connections=int(os.getenv("LLM_HTTP_MAX_CONNECTIONS", "100"))
+        self.http_max_keepalive_connections=int(os.getenv("LLM_HTTP_MAX_KEEPALIVE_CONNECTIONS", "20"))
+        self.http_keepalive_expiry=float(os.getenv("LLM_HTTP_KEEPALIVE_EXPIRY", "30"))
+        # Set to an httpx.Client to bypass the options above entirely
+        self.http_client=None
+
+        # OpenTelemetry spans for pipeline runs, steps and LLM calls (llm.tracing); needs
+        # opentelemetry-api installed and an SDK/exporter configured by the process
+        self.tracing=os.getenv("LLM_TRACING", "false").lower() == "true"
+
+        # Port the worker serves Prometheus metrics on (llm.metrics, GET /metrics); 0 = not served
+        self.metrics_port=int(os.getenv("LLM_METRICS_PORT", "0"))
+
+        # Shadow runs (llm.shadow): with LLM_SHADOW_MODE=compare the worker re-runs a
+        # LLM_SHADOW_SAMPLE_RATE share of messages in the background as shadow runs (never sent)
+        # on LLM_SHADOW_PROVIDER / LLM_SHADOW_MODEL, and reports how they differ from production.
+        # Candidate prompts: LLM_SHADOW_PROMPT_VERSION (a published version, see llm.prompt_store)
+        # or LLM_SHADOW_PROMPT_PATH (a bundle file); unset, shadow runs use production's prompts
+        self.shadow_mode=os.getenv("LLM_SHADOW_MODE", "off").lower()
+        self.shadow_sample_rate=float(os.getenv("LLM_SHADOW_SAMPLE_RATE", "1.0"))
+        self.shadow_provider=os.getenv("LLM_SHADOW_PROVIDER")
+        self.shadow_model=os.getenv("LLM_SHADOW_MODEL")
+        self.shadow_workers=int(os.getenv("LLM_SHADOW_WORKERS", "2"))
+        self.shadow_prompt_version=os.getenv("LLM_SHADOW_PROMPT_VERSION")
+        self.shadow_prompt_path=os.getenv("LLM_SHADOW_PROMPT_PATH")
+
+        # Record every run's full input and result for replay (llm.replay). Off by default:
+        # recordings hold the conversation unredacted
+        self.record_runs=os.getenv("LLM_RECORD_RUNS", "false").lower() == "true"
+
+        # Redaction applied to the llm log and the call log hook (see llm.call_log)
+        self.log_redact_phones=os.getenv("LLM_LOG_REDACT_PHONES", "true").lower() == "true"
+        self.log_redact_user_content=os.getenv("LLM_LOG_REDACT_USER_CONTENT", "false").lower() == "true"
+
+    def provider_for(self, step_name: str) -> str:
+        """Provider name for a pipeline step, falling back to the global provider."""
+        return os.getenv(f"LLM_PROVIDER_{step_name.upper()}") or self.provider
+
+    def model_for(self, step_name: str) -> Optional[str]:
+        """Model name for a pipeline step, falling back to the global model."""
+        return os.getenv(f"LLM_MODEL_{step_name.upper()}") or self.model
+
+    def temperature_for(self, step_name: str) -> float:
+        raw = os.getenv(f"LLM_TEMPERATURE_{step_name.upper()}")
+        if raw:
+            return float(raw)
+        settings = self.step_settings.get(step_name.lower(), {})
+        if "temperature" in settings:
+            return float(settings["temperature"])
+        return STEP_SAMPLING_DEFAULTS.get(step_name, DEFAULT_SAMPLING)["temperature"]
+
+    def max_tokens_for(self, step_name: str) -> Optional[int]:
+        """Output token limit for a step; None (or 0 in an override) leaves it to the provider."""
+        raw = os.getenv(f"LLM_MAX_TOKENS_{step_name.upper()}")
+        if raw:
+            return int(raw) or None
+        settings = self.step_settings.get(step_name.lower(), {})
+        if "max_tokens" in settings:
+            return int(settings["max_tokens"] or 0) or None
+        return STEP_SAMPLING_DEFAULTS.get(step_name, DEFAULT_SAMPLING)["max_tokens"]
+
+    def sampling_for(self, step_name: str) -> Dict[str, Any]:
+        """temperature and max_tokens keyword arguments for a step's LLM calls."""
+        return {"temperature": self.temperature_for(step_name), "max_tokens": self.max_tokens_for(step_name)}
+
+    def fallbacks_for(self, step_name: str) -> List[Tuple[str, str]]:
+        """
+        Ordered (provider, model) fallbacks tried when the primary model fails.
+        Configured as LLM_FALLBACKS (or LLM_FALLBACKS_<STEP>), e.g.
+        "openai:gpt-4o-mini,anthropic:claude-3-5-haiku-latest".
+        """
+        raw = os.getenv(f"LLM_FALLBACKS_{step_name.upper()}") or os.getenv("LLM_FALLBACKS", "")
+        chain = []
+        for entry in raw.split(","):
+            entry = entry.strip()
+            if not entry:
+                continue
+            # Split on the first colon only; model names may contain colons (e.g. "llama3:8b")
+            provider, _, model = entry.partition(":")
+            if provider and model:
+                chain.append((provider.strip(), model.strip()))
+        return chain
+
 # Exported configuration object
 llm_config = LLMConfig()
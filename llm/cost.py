@@ -0,0 +1,129 @@
+"""
+LLM Cost Tracking.
+Converts token usage into USD/INR using a per-model pricing table, and defines
+the hook used to persist per-organization spend.
+"""
+import json
+import logging
+import os
+from abc import ABC, abstractmethod
+from typing import Dict, Optional, Tuple
+from uuid import UUID
+
+from llm.schemas import TokenUsage
+
+logger = logging.getLogger(__name__)
+
+# USD per 1M tokens: (input, output). Matched by exact name, then longest prefix,
+# so dated snapshots ("claude-3-5-haiku-20241022") resolve to their family.
+PRICING_PER_MILLION: Dict[str, Tuple[float, float]] = {
+    # Groq
+    "llama-3.3-70b-versatile": (0.59, 0.79),
+    "llama-3.1-8b-instant": (0.05, 0.08),
+    "openai/gpt-oss-120b": (0.15, 0.75),
+    "openai/gpt-oss-20b": (0.10, 0.50),
+    "qwen/qwen3-32b": (0.29, 0.59),
+    # OpenAI
+    "gpt-4o-mini": (0.15, 0.60),
+    "gpt-4o": (2.50, 10.00),
+    "gpt-4.1-mini": (0.40, 1.60),
+    "gpt-4.1": (2.00, 8.00),
+    # Anthropic
+    "claude-3-5-haiku": (0.80, 4.00),
+    "claude-3-5-sonnet": (3.00, 15.00),
+    "claude-3-7-sonnet": (3.00, 15.00),
+    # Gemini
+    "gemini-1.5-flash": (0.075, 0.30),
+    "gemini-2.0-flash": (0.10, 0.40),
+    "gemini-2.5-flash": (0.30, 2.50),
+}
+
+# Deployments can add or override prices without a release:
+# LLM_PRICING_JSON='{"my-finetune": [0.2, 0.4]}'
+_overrides = os.getenv("LLM_PRICING_JSON")
+if _overrides:
+    try:
+        PRICING_PER_MILLION.update({name: tuple(prices) for name, prices in json.loads(_overrides).items()})
+    except (ValueError, TypeError) as e:
+        logger.error(f"Ignoring invalid LLM_PRICING_JSON: {e}")
+
+USD_TO_INR = float(os.getenv("LLM_USD_TO_INR", "83.0"))
+
+# Cached prompt tokens are billed at a fraction of the input price. Vendors differ
+# (OpenAI 0.5, Anthropic 0.1 for reads); the conservative value is used for all.
+CACHED_INPUT_RATIO = float(os.getenv("LLM_CACHED_INPUT_RATIO", "0.5"))
+
+
+def get_model_pricing(model: Optional[str]) -> Optional[Tuple[float, float]]:
+    """(input, output) USD per 1M tokens for a model, or None if unknown."""
+    if not model:
+        return None
+    if model in PRICING_PER_MILLION:
+        return PRICING_PER_MILLION[model]
+    matches = [name for name in PRICING_PER_MILLION if model.startswith(name)]
+    if matches:
+        return PRICING_PER_MILLION[max(matches, key=len)]
+    return None
+
+
+def estimate_cost_usd(model: Optional[str], usage: TokenUsage) -> float:
+    """USD cost of a call. Unknown models are logged and counted as free."""
+    pricing = get_model_pricing(model)
+    if pricing is None:
+        if usage.total_tokens:
+            logger.warning(f"No pricing for model '{model}'; cost recorded as 0")
+        return 0.0
+    input_price, output_price = pricing
+    uncached_tokens = usage.prompt_tokens - usage.cached_tokens
+    input_cost = uncached_tokens * input_price + usage.cached_tokens * input_price * CACHED_INPUT_RATIO
+    return (input_cost + usage.completion_tokens * output_price) / 1_000_000
+
+
+def usd_to_inr(amount_usd: float) -> float:
+    return amount_usd * USD_TO_INR
+
+
+# ============================================================
+# Spend Persistence
+# ============================================================
+
+class SpendRecorder(ABC):
+    """Persists LLM spend per organization (DB, billing service, metrics...)."""
+
+    @abstractmethod
+    def record(
+        self,
+        organization_id: UUID,
+        usage_by_step: Dict[str, TokenUsage],
+        conversation_id: Optional[UUID] = None,
+    ) -> None:
+        raise NotImplementedError
+
+
+class LoggingSpendRecorder(SpendRecorder):
+    """Default recorder: writes spend to the llm log."""
+
+    def record(
+        self,
+        organization_id: UUID,
+        usage_by_step: Dict[str, TokenUsage],
+        conversation_id: Optional[UUID] = None,
+    ) -> None:
+        total_usd = sum(usage.cost_usd for usage in usage_by_step.values())
+        breakdown = ", ".join(f"{step}=${usage.cost_usd:.6f}" for step, usage in usage_by_step.items())
+        logging.getLogger("llm").info(
+            f"SPEND org={organization_id} conversation={conversation_id} "
+            f"total=${total_usd:.6f} (INR {usd_to_inr(total_usd):.4f}) [{breakdown}]"
+        )
+
+
+_spend_recorder: SpendRecorder = LoggingSpendRecorder()
+
+
+def set_spend_recorder(recorder: SpendRecorder) -> None:
+    global _spend_recorder
+    _spend_recorder = recorder
+
+
+def get_spend_recorder() -> SpendRecorder:
+    return _spend_recorder
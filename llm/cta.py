@@ -0,0 +1,77 @@
+"""
+CTA Actions.
+Builds a validated CTAAction from the loose CTA fields the Brain and Mouth
+return (selected_cta_id, cta_params, and the time resolved by
+llm.datetime_parsing), using the type and configured params of the
+organization's CTA. Anything that doesn't check out is dropped with a warning
+rather than executed.
+"""
+import logging
+from datetime import datetime
+from typing import Any, Dict, List, Optional
+
+from pydantic import ValidationError
+
+from server.enums import CTAType
+from llm.schemas import CTAAction, ClassifyOutput, GenerateOutput
+from llm.utils import normalize_enum
+
+logger = logging.getLogger(__name__)
+
+
+def parse_params(raw: Any) -> Dict[str, str]:
+    """The Brain sends [{"key": ..., "value": ...}] (strict schemas can't express maps); a plain object is accepted too."""
+    if isinstance(raw, dict):
+        items = raw.items()
+    elif isinstance(raw, list):
+        items = [(item.get("key"), item.get("value")) for item in raw if isinstance(item, dict)]
+    else:
+        return {}
+    return {str(key).strip(): str(value).strip() for key, value in items if key and value is not None}
+
+
+def build_cta_action(
+    cta_id: Any,
+    available_ctas: List[Dict[str, Any]],
+    params: Optional[Dict[str, str]] = None,
+    scheduled_at: Optional[datetime] = None,
+) -> Optional[CTAAction]:
+    """
+    CTAAction for one of the organization's CTAs, or None if the id is unknown
+    or the parameters fail validation. Configured params win over the model's.
+    """
+    if not cta_id:
+        return None
+    cta = next((cta for cta in available_ctas if str(cta.get("id")) == str(cta_id)), None)
+    if cta is None:
+        logger.warning(f"Selected CTA {cta_id} is not one of the organization's CTAs, ignoring")
+        return None
+    try:
+        return CTAAction(
+            cta_id=cta["id"],
+            type=normalize_enum(cta.get("type"), CTAType, CTAType.BOOKING),
+            params={**(params or {}), **(cta.get("params") or {})},
+            scheduled_at=scheduled_at,
+        )
+    except ValidationError as e:
+        logger.warning(f"Invalid action for CTA {cta_id}: {e}")
+        return None
+
+
+def resolve_cta_action(
+    classification: ClassifyOutput,
+    response: Optional[GenerateOutput],
+    available_ctas: List[Dict[str, Any]],
+) -> Optional[CTAAction]:
+    """The Brain's CTA action, unless the Mouth selected a different CTA (which keeps the Brain's time)."""
+    action = classification.cta_action
+    if response is None or response.selected_cta_id is None:
+        return action
+    if action is not None and action.cta_id == response.selected_cta_id:
+        return action
+    if action:
+        scheduled_at = action.scheduled_at
+    else:
+        # Already resolved and normalized to RFC 3339 by the Brain
+        scheduled_at = datetime.fromisoformat(classification.cta_scheduled_at) if classification.cta_scheduled_at else None
+    return build_cta_action(response.selected_cta_id, available_ctas, scheduled_at=scheduled_at)
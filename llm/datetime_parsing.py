@@ -0,0 +1,159 @@
+"""
+Datetime Parsing.
+Resolves the times the model writes for cta_scheduled_at and follow-ups
+("2025-01-31T17:00:00+05:30", "tomorrow 5pm", "in 2 hours", "next friday
+at 11:30") against Timing.now_local, which is in the organization's
+timezone. Past times are rejected; resolved times are timezone-aware and are
+written out as RFC 3339 (to_rfc3339).
+"""
+import logging
+import re
+from datetime import datetime, time, timedelta, timezone
+from typing import Any, Optional, Tuple
+
+logger = logging.getLogger(__name__)
+
+# Used when only a day is given ("tomorrow") or a part of the day ("evening")
+DEFAULT_TIME = time(10, 0)
+PARTS_OF_DAY = {
+    "morning": time(10, 0),
+    "noon": time(12, 0),
+    "afternoon": time(15, 0),
+    "evening": time(18, 0),
+    "night": time(20, 0),
+    "tonight": time(20, 0),
+}
+WEEKDAYS = ["monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"]
+UNIT_MINUTES = {"minute": 1, "min": 1, "hour": 60, "hr": 60, "day": 1440, "week": 10080}
+
+_DURATION = re.compile(r"^(?:in\s+)?(\d+|an?|one|half an?)\s*(minute|min|hour|hr|day|week)s?(?:\s+from now)?$")
+_DAY = re.compile(
+    r"\b(day after tomorrow|tomorrow|today|tonight|(?:next |this )?(?:" + "|".join(WEEKDAYS) + r"))\b"
+)
+_CLOCK = re.compile(r"^(?:at\s+)?(\d{1,2})(?:[:.](\d{2}))?\s*(am|pm)?$")
+
+
+def parse_now(now_local: str) -> datetime:
+    """Timing.now_local as an aware datetime; a naive value is taken as UTC."""
+    now = datetime.fromisoformat(now_local)
+    return now if now.utcoffset() is not None else now.replace(tzinfo=timezone.utc)
+
+
+def to_rfc3339(value: datetime) -> str:
+    return value.isoformat(timespec="seconds")
+
+
+def _duration_minutes(text: str) -> Optional[int]:
+    match = _DURATION.match(text)
+    if not match:
+        return None
+    amount, unit = match.groups()
+    if amount.startswith("half"):
+        return UNIT_MINUTES[unit] // 2
+    count = 1 if amount in ("a", "an", "one") else int(amount)
+    return count * UNIT_MINUTES[unit]
+
+
+def _clock(text: str) -> Optional[time]:
+    if text in PARTS_OF_DAY:
+        return PARTS_OF_DAY[text]
+    match = _CLOCK.match(text)
+    if not match:
+        return None
+    hour, minute, meridiem = int(match.group(1)), int(match.group(2) or 0), match.group(3)
+    if meridiem:
+        if not 1 <= hour <= 12:
+            return None
+        hour = hour % 12 + (12 if meridiem == "pm" else 0)
+    if hour > 23 or minute > 59:
+        return None
+    return time(hour, minute)
+
+
+def _day_offset(day: str, now: datetime) -> Tuple[int, bool]:
+    """(days from today, whether the phrase pins an exact day that must not roll forward)."""
+    if day in ("today", "tonight"):
+        return 0, True
+    if day == "tomorrow":
+        return 1, True
+    if day == "day after tomorrow":
+        return 2, True
+    explicit_next = day.startswith("next ")
+    weekday = WEEKDAYS.index(day.split()[-1])
+    offset = (weekday - now.weekday()) % 7
+    if explicit_next and offset == 0:
+        offset = 7
+    return offset, explicit_next
+
+
+def _parse_natural(text: str, now: datetime) -> Optional[datetime]:
+    minutes = _duration_minutes(text)
+    if minutes is not None:
+        return now + timedelta(minutes=minutes)
+
+    day_match = _DAY.search(text)
+    day = day_match.group(1) if day_match else None
+    rest = _DAY.sub(" ", text) if day else text
+    rest = " ".join(rest.replace(",", " ").split())
+    rest = re.sub(r"^(?:in the|at)\s+", "", rest)
+
+    clock = _clock(rest) if rest else None
+    if rest and clock is None:
+        return None
+    if day is None and clock is None:
+        return None
+    if day == "tonight" and clock is None:
+        clock = PARTS_OF_DAY["tonight"]
+
+    offset, pinned = _day_offset(day, now) if day else (0, False)
+    resolved = datetime.combine(now.date() + timedelta(days=offset), clock or DEFAULT_TIME, tzinfo=now.tzinfo)
+    if resolved <= now and not pinned:
+        # "5pm" after 5pm means tomorrow; "friday" on a Friday afternoon means next week
+        resolved += timedelta(days=7 if day else 1)
+    return resolved
+
+
+def resolve_datetime(value: Any, now: datetime) -> Optional[datetime]:
+    """
+    An aware datetime in the future, or None if value can't be parsed or is in the past.
+    ISO timestamps without an offset are taken to be in now's timezone.
+    """
+    if not value or not isinstance(value, str):
+        return None
+    text = " ".join(value.strip().lower().rstrip(".").split())
+    try:
+        resolved = datetime.fromisoformat(value.strip())
+        if resolved.utcoffset() is None:
+            resolved = resolved.replace(tzinfo=now.tzinfo)
+    except ValueError:
+        resolved = _parse_natural(text, now)
+    if resolved is None:
+        logger.warning(f"Could not parse time: {value!r}")
+        return None
+    if resolved <= now:
+        logger.warning(f"Rejecting past time {value!r} (resolved to {to_rfc3339(resolved)}, now {to_rfc3339(now)})")
+        return None
+    return resolved
+
+
+def resolve_minutes(value: Any, now: datetime) -> int:
+    """
+    Follow-up delay in minutes from a number, a duration ("2 hours") or a time
+    ("tomorrow 10am"); 0 (use the default schedule) when it can't be resolved.
+    """
+    if isinstance(value, bool):
+        return 0
+    if isinstance(value, (int, float)):
+        return max(0, int(value))
+    if not isinstance(value, str) or not value.strip():
+        return 0
+    text = " ".join(value.strip().lower().split())
+    if text.isdigit():
+        return int(text)
+    minutes = _duration_minutes(text)
+    if minutes is not None:
+        return minutes
+    resolved = resolve_datetime(value, now)
+    if resolved is None:
+        return 0
+    return int((resolved - now).total_seconds() // 60)
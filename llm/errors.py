@@ -0,0 +1,125 @@
+"""
+Typed LLM errors.
+Providers translate vendor-specific failures into these so the pipeline can
+choose between retrying, failing over to another model, or escalating.
+"""
+import time
+from email.utils import parsedate_to_datetime
+from typing import Mapping, Optional
+
+# Substrings vendors use when the prompt does not fit the model's context window
+CONTEXT_LENGTH_MARKERS = (
+    "context_length_exceeded",
+    "maximum context length",
+    "context window",
+    "prompt is too long",
+    "too many tokens",
+    "exceeds the maximum number of tokens",
+    "reduce the length",
+)
+
+
+class LLMError(Exception):
+    """Base class for LLM call failures."""
+
+    def __init__(
+        self,
+        message: str,
+        provider: Optional[str] = None,
+        status_code: Optional[int] = None,
+        provider_message: Optional[str] = None,
+        body: Optional[str] = None,
+        retry_after: Optional[float] = None,
+    ):
+        self.provider = provider
+        self.status_code = status_code
+        self.provider_message = provider_message
+        self.body = body                # Raw response body, for debugging
+        self.retry_after = retry_after  # Seconds the provider asked us to wait, if any
+        super().__init__(message)
+
+
+class RateLimitedError(LLMError):
+    """429 / quota exhausted. Retry later or fail over."""
+
+
+class AuthError(LLMError):
+    """401/403: missing, invalid or unauthorised API key. Retrying will not help."""
+
+
+class ContextTooLongError(LLMError):
+    """The prompt exceeds the model's context window. Trim the prompt or use a larger model."""
+
+
+class BadJSONError(LLMError, ValueError):
+    """The model answered, but not with parseable JSON."""
+
+    def __init__(self, message: str, raw_content: str = "", **kwargs):
+        self.raw_content = raw_content
+        super().__init__(message, **kwargs)
+
+
+class ProviderUnavailableError(LLMError):
+    """Timeouts, dropped connections and 5xx responses."""
+
+
+class BadRequestError(LLMError):
+    """Any other 4xx: the request itself was rejected."""
+
+
+def is_context_length_message(message: str) -> bool:
+    lowered = (message or "").lower()
+    return any(marker in lowered for marker in CONTEXT_LENGTH_MARKERS)
+
+
+def parse_retry_after(headers: Mapping[str, str]) -> Optional[float]:
+    """
+    Seconds to wait according to Retry-After (delta-seconds or HTTP-date)
+    or the non-standard retry-after-ms header. None if absent or unparseable.
+    """
+    retry_after_ms = headers.get("retry-after-ms")
+    if retry_after_ms:
+        try:
+            return max(0.0, float(retry_after_ms) / 1000)
+        except ValueError:
+            pass
+
+    retry_after = headers.get("retry-after")
+    if not retry_after:
+        return None
+    try:
+        return max(0.0, float(retry_after))
+    except ValueError:
+        pass
+    try:
+        return max(0.0, parsedate_to_datetime(retry_after).timestamp() - time.time())
+    except (TypeError, ValueError):
+        return None
+
+
+def error_from_status(
+    status_code: int,
+    provider_message: str,
+    provider: Optional[str] = None,
+    body: Optional[str] = None,
+    retry_after: Optional[float] = None,
+) -> LLMError:
+    """Map an HTTP status + vendor error message to the matching typed error."""
+    summary = f"{provider or 'LLM'} returned HTTP {status_code}: {provider_message}"
+    kwargs = {
+        "provider": provider,
+        "status_code": status_code,
+        "provider_message": provider_message,
+        "body": body,
+        "retry_after": retry_after,
+    }
+
+    if status_code == 429:
+        return RateLimitedError(summary, **kwargs)
+    if status_code in (401, 403):
+        return AuthError(summary, **kwargs)
+    if status_code in (400, 413, 422) and is_context_length_message(provider_message):
+        return ContextTooLongError(summary, **kwargs)
+    if status_code >= 500 or status_code == 408:
+        return ProviderUnavailableError(summary, **kwargs)
+    return BadRequestError(summary, **kwargs)
@@ -0,0 +1,86 @@
+"""
+Message Formatting.
+Enforces an organization's emoji and WhatsApp formatting preferences
+(PromptOverrides.emoji_style / whatsapp_formatting) on the final reply. The
+Mouth prompt asks for the same style; this makes it hold for businesses that
+need strictly formal messages. Markdown the model slips in (**bold**, # headings)
+is normalized to WhatsApp markup, or stripped with the rest when formatting is off.
+"""
+import re
+from typing import Optional
+
+# Emoji allowed per message in the "light" style
+LIGHT_MAX_EMOJI = 1
+
+_EMOJI_CHAR = "[\U0001F000-\U0001FAFF\u2300-\u23FF\u2600-\u27BF\u2B00-\u2BFF]"
+# Modifiers that belong to the emoji before them: variation selector, skin tones
+_EMOJI_MODIFIERS = "[\uFE0F\U0001F3FB-\U0001F3FF]*"
+# Flags are pairs of regional indicators; ZWJ sequences (family, profession emoji) count as one emoji
+_EMOJI = re.compile(
+    "[\U0001F1E6-\U0001F1FF]{2}"
+    f"|{_EMOJI_CHAR}{_EMOJI_MODIFIERS}(?:\u200D{_EMOJI_CHAR}{_EMOJI_MODIFIERS})*"
+)
+
+# Markdown -> WhatsApp: **bold** / __italic__ / ~~strike~~ take a single marker
+_MARKDOWN_DOUBLE = re.compile(r"(\*\*|__|~~)(?!\s)(.+?)(?<!\s)\1")
+_MARKDOWN_HEADING = re.compile(r"(?m)^#{1,6}\s+(.+?)\s*$")
+
+# WhatsApp markup, only where the markers wrap a phrase (so snake_case, 2*3 and URLs survive)
+_MONOSPACE = re.compile(r"```(.+?)```", re.DOTALL)
+_INLINE_CODE = re.compile(r"`([^`\n]+)`")
+_WHATSAPP_MARKUP = re.compile(r"(?<![\w*_~])([*_~])(?!\s)([^\n]+?)(?<!\s)\1(?![\w*_~])")
+
+_SPACE_BEFORE_PUNCTUATION = re.compile(r"[ \t]+([,.!?])")
+_REPEATED_SPACES = re.compile(r"[ \t]{2,}")
+
+
+def count_emoji(text: str) -> int:
+    return len(_EMOJI.findall(text))
+
+
+def _tidy(text: str) -> str:
+    """Whitespace left behind by removed emoji."""
+    text = _SPACE_BEFORE_PUNCTUATION.sub(r"\1", text)
+    text = _REPEATED_SPACES.sub(" ", text)
+    return "\n".join(line.strip() for line in text.split("\n")).strip()
+
+
+def limit_emoji(text: str, limit: int) -> str:
+    """Keep the first `limit` emoji and drop the rest."""
+    kept = 0
+
+    def replace(match: re.Match) -> str:
+        nonlocal kept
+        kept += 1
+        return match.group(0) if kept <= limit else ""
+
+    return _tidy(_EMOJI.sub(replace, text)) if count_emoji(text) > limit else text
+
+
+def normalize_markdown(text: str) -> str:
+    """Markdown the model habitually writes, as WhatsApp markup (headings become bold lines)."""
+    text = _MARKDOWN_HEADING.sub(r"*\1*", text)
+    return _MARKDOWN_DOUBLE.sub(lambda match: f"{match.group(1)[0]}{match.group(2)}{match.group(1)[0]}", text)
+
+
+def strip_markup(text: str) -> str:
+    """Plain text: markup markers removed, the text they wrapped kept."""
+    text = normalize_markdown(text)
+    text = _MONOSPACE.sub(r"\1", text)
+    text = _INLINE_CODE.sub(r"\1", text)
+    return _WHATSAPP_MARKUP.sub(r"\2", text)
+
+
+def apply_style(text: str, emoji_style: Optional[str], whatsapp_formatting: Optional[bool]) -> str:
+    """
+    text in the organization's style. emoji_style: "none" strips emoji, "light"
+    keeps at most LIGHT_MAX_EMOJI, "heavy" or None leaves them. whatsapp_formatting:
+    False strips markup, True or None only normalizes Markdown.
+    """
+    if emoji_style == "none":
+        text = limit_emoji(text, 0)
+    elif emoji_style == "light":
+        text = limit_emoji(text, LIGHT_MAX_EMOJI)
+    if whatsapp_formatting is False:
+        return strip_markup(text)
+    return normalize_markdown(text)
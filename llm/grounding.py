@@ -0,0 +1,101 @@
+"""
+Claim Grounding.
+Deterministic check that the concrete facts in a reply (prices, percentages,
+times of day, durations) appear in what the bot actually knows: the business
+description, flow prompt, CTAs, the lead's own messages and profile. Numbers are
+compared normalized ("Rs 1,499" == "1499/-", "6 pm" == "18:00"), so rewording
+passes but an invented figure does not. Used by llm.steps.verify.
+"""
+import re
+from typing import List, Set, Tuple
+
+from llm.schemas import PipelineInput
+
+_NUMBER = r"\d[\d,]*(?:\.\d+)?"
+_PRICE = re.compile(
+    rf"(?:₹|\brs\.?|\binr|\$|\busd)\s*({_NUMBER})"
+    rf"|({_NUMBER})\s*(?:/-|\brupees\b|\brs\b|\binr\b)",
+    re.IGNORECASE,
+)
+_PERCENT = re.compile(rf"({_NUMBER})\s*%")
+_TIME_OF_DAY = re.compile(r"\b(\d{1,2})(?:[:.](\d{2}))?\s*([ap])\.?\s*m\b\.?", re.IGNORECASE)
+_CLOCK_TIME = re.compile(r"\b([01]?\d|2[0-3]):([0-5]\d)\b(?!\s*[ap]\.?\s*m\b)", re.IGNORECASE)  # 24-hour "18:00"
+_DURATION = re.compile(
+    r"\b(\d+)\s*(min(?:ute)?s?|h(?:ou)?rs?|hours?|days?|weeks?|months?|years?)\b", re.IGNORECASE
+)
+_ANY_NUMBER = re.compile(_NUMBER)
+
+_DURATION_UNITS = {"min": "minute", "hr": "hour", "hour": "hour", "day": "day", "week": "week", "month": "month", "year": "year"}
+
+Claim = Tuple[str, str, str]  # (kind, text as written, normalized value)
+
+
+def _number(raw: str) -> str:
+    """ "1,499.00" -> "1499" """
+    value = raw.replace(",", "")
+    if "." in value:
+        value = value.rstrip("0").rstrip(".")
+    return value
+
+
+def _duration_unit(raw: str) -> str:
+    unit = raw.lower()
+    for prefix, name in _DURATION_UNITS.items():
+        if unit.startswith(prefix):
+            return name
+    return unit
+
+
+def extract_claims(text: str) -> List[Claim]:
+    claims: List[Claim] = []
+    for match in _PRICE.finditer(text):
+        claims.append(("price", match.group(0).strip(), _number(match.group(1) or match.group(2))))
+    for match in _PERCENT.finditer(text):
+        claims.append(("percentage", match.group(0), _number(match.group(1)) + "%"))
+    for match in _TIME_OF_DAY.finditer(text):
+        hour = int(match.group(1)) % 12 + (12 if match.group(3).lower() == "p" else 0)
+        claims.append(("time", match.group(0).strip(), f"{hour:02d}:{match.group(2) or '00'}"))
+    for match in _CLOCK_TIME.finditer(text):
+        claims.append(("time", match.group(0), f"{int(match.group(1)):02d}:{match.group(2)}"))
+    for match in _DURATION.finditer(text):
+        claims.append(("duration", match.group(0), f"{int(match.group(1))} {_duration_unit(match.group(2))}"))
+    return claims
+
+
+def knowledge_text(context: PipelineInput) -> str:
+    """
+    What a reply's facts may come from. Lead messages and the lead profile count
+    (repeating the lead's own budget is not a hallucination); earlier bot messages
+    and the rolling summary, which restates them, don't, or one invented price
+    would ground itself from then on.
+    """
+    parts = [context.business_description, context.flow_prompt]
+    profile = context.lead_profile
+    for field in ("budget", "location", "product_interest", "timeline"):
+        parts.append(getattr(profile, field))
+    parts.extend(profile.objections)
+    parts.extend(f"{key} {value}" for key, value in profile.custom.items())
+    for cta in context.available_ctas:
+        parts.append(str(cta.get("name", "")))
+        parts.extend(f"{key} {value}" for key, value in (cta.get("params") or {}).items())
+    parts.extend(message.text for message in context.last_messages if message.sender == "lead")
+    return "\n".join(part for part in parts if part)
+
+
+def _known_values(knowledge: str) -> Set[str]:
+    known = {_number(number) for number in _ANY_NUMBER.findall(knowledge)}
+    known.update(value for kind, _, value in extract_claims(knowledge) if kind != "price")
+    return known
+
+
+def find_ungrounded(text: str, knowledge: str) -> List[str]:
+    """
+    Descriptions of the reply's claims whose value the knowledge never states.
+    Prices only need the amount to appear ("999/month" grounds "Rs 999").
+    """
+    known = _known_values(knowledge)
+    return [
+        f'{kind} "{written}" is not in the business information'
+        for kind, written, value in extract_claims(text)
+        if value not in known
+    ]
@@ -0,0 +1,44 @@
+"""
+Claim Guardrails.
+Organizations list claims a reply must never make (PipelineInput.forbidden_claims):
+plain phrases ("lowest price", "100% cure"), matched case-insensitively on word
+boundaries, or regexes prefixed with "re:" ("re:\\d+\\s*% off"). The Mouth scans
+every reply; see llm.steps.mouth._enforce_checks for what happens on a hit.
+"""
+import logging
+import re
+from functools import lru_cache
+from typing import List, Optional, Pattern, Tuple
+
+logger = logging.getLogger(__name__)
+
+REGEX_PREFIX = "re:"
+
+
+@lru_cache(maxsize=512)
+def compile_claim(claim: str) -> Optional[Pattern]:
+    """None (logged) for an invalid regex, so one bad entry doesn't disable the rest."""
+    if claim.startswith(REGEX_PREFIX):
+        try:
+            return re.compile(claim[len(REGEX_PREFIX):], re.IGNORECASE)
+        except re.error as e:
+            logger.warning(f"Invalid forbidden claim pattern {claim!r}: {e}")
+            return None
+    words = [re.escape(word) for word in claim.split()]
+    if not words:
+        return None
+    # Whitespace-tolerant, and \b only where the phrase starts/ends with a word character
+    start = r"\b" if re.match(r"\w", claim.strip()) else ""
+    end = r"\b" if re.search(r"\w$", claim.strip()) else ""
+    return re.compile(start + r"\s+".join(words) + end, re.IGNORECASE)
+
+
+def find_claim_hits(text: str, claims: List[str]) -> List[Tuple[str, str]]:
+    """(claim, matched text) for every forbidden claim found in text."""
+    hits = []
+    for claim in claims:
+        pattern = compile_claim(claim)
+        match = pattern.search(text) if pattern else None
+        if match:
+            hits.append((claim, match.group(0)))
+    return hits
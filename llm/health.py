@@ -0,0 +1,44 @@
+"""
+LLM Readiness Probe.
+Pings the primary provider/model of every pipeline step and exits non-zero if
+any is unreachable or rejects our API key, so orchestrators keep live WhatsApp
+traffic away from a worker with broken LLM credentials.
+
+Usage:
+    python -m llm.health
+"""
+import logging
+import sys
+from typing import Dict, List, Tuple
+
+from llm.api_helpers import HealthStatus, health_check
+from llm.config import llm_config
+
+logger = logging.getLogger(__name__)
+
+PIPELINE_STEPS = ("Brain", "Mouth", "Memory")
+
+
+def check_pipeline_health() -> List[HealthStatus]:
+    """One ping per distinct (provider, model) used by the pipeline steps."""
+    targets: Dict[Tuple[str, str], str] = {}
+    for step_name in PIPELINE_STEPS:
+        target = (llm_config.provider_for(step_name), llm_config.model_for(step_name))
+        targets.setdefault(target, step_name)
+    return [health_check(provider, model, step_name=step_name) for (provider, model), step_name in targets.items()]
+
+
+def main() -> int:
+    logging.basicConfig(level=logging.INFO)
+    statuses = check_pipeline_health()
+    for status in statuses:
+        if status.healthy:
+            logger.info(f"OK {status.provider}/{status.model} ({status.latency_ms}ms)")
+        else:
+            reason = "invalid API key" if status.auth_ok is False else status.error
+            logger.error(f"FAIL {status.provider}/{status.model} ({status.latency_ms}ms): {reason}")
+    return 0 if all(status.healthy for status in statuses) else 1
+
+
+if __name__ == "__main__":
+    sys.exit(main())
@@ -0,0 +1,95 @@
+"""
+Pipeline Middleware.
+Lets integrators plug into every pipeline step (logging, metrics, custom
+guardrails, context enrichment) without forking llm.pipeline. Middleware sees
+each step's context and inputs before it runs and its output after, and may
+replace either:
+
+    class BlockCompetitors(PipelineMiddleware):
+        def after_step(self, step, context, inputs, output):
+            if step == "mouth" and "CompetitorCo" in output.message_text:
+                return output.model_copy(update={"message_text": ""})
+
+    add_middleware(BlockCompetitors())
+
+Steps: "brain", "mouth", "variation", "verify", and "memory" when the pipeline
+runs Memory itself (memory_mode "inline" or "async"). A middleware that raises
+is logged and skipped; it never breaks the run.
+"""
+import logging
+from typing import Any, Dict, List, Optional, Sequence
+
+from llm.schemas import PipelineInput
+
+logger = logging.getLogger(__name__)
+
+PIPELINE_STEPS = ("brain", "mouth", "variation", "verify", "memory")
+
+
+class PipelineMiddleware:
+    """Base class: override the hooks you need; both default to changing nothing."""
+
+    def before_step(self, step: str, context: PipelineInput, inputs: Dict[str, Any]) -> Optional[PipelineInput]:
+        """
+        Called before a step runs. inputs holds the step's other arguments
+        (user_message, classification, response). Return a context to run this
+        step, and every later step, with it; None keeps the current one.
+        """
+        return None
+
+    def after_step(
+        self, step: str, context: PipelineInput, inputs: Dict[str, Any], output: Any
+    ) -> Optional[Any]:
+        """
+        Called with a step's output (ClassifyOutput, GenerateOutput or SummaryOutput).
+        Return a replacement output, or None to keep it.
+        """
+        return None
+
+
+_middleware: List[PipelineMiddleware] = []
+
+
+def add_middleware(middleware: PipelineMiddleware) -> None:
+    """Register middleware for every run; it runs after the middleware added before it."""
+    _middleware.append(middleware)
+
+
+def remove_middleware(middleware: PipelineMiddleware) -> None:
+    if middleware in _middleware:
+        _middleware.remove(middleware)
+
+
+def clear_middleware() -> None:
+    _middleware.clear()
+
+
+def get_middleware() -> List[PipelineMiddleware]:
+    return list(_middleware)
+
+
+def before_step(
+    middleware: Sequence[PipelineMiddleware], step: str, context: PipelineInput, inputs: Dict[str, Any]
+) -> PipelineInput:
+    """Run every before_step hook in order; returns the context the step should use."""
+    for item in middleware:
+        try:
+            context = item.before_step(step, context, inputs) or context
+        except Exception as e:
+            logger.error(f"Middleware {type(item).__name__}.before_step({step}) failed: {e}", exc_info=True)
+    return context
+
+
+def after_step(
+    middleware: Sequence[PipelineMiddleware], step: str, context: PipelineInput, inputs: Dict[str, Any], output: Any
+) -> Any:
+    """Run every after_step hook in order; returns the (possibly replaced) output."""
+    for item in middleware:
+        try:
+            replaced = item.after_step(step, context, inputs, output)
+        except Exception as e:
+            logger.error(f"Middleware {type(item).__name__}.after_step({step}) failed: {e}", exc_info=True)
+            continue
+        if replaced is not None:
+            output = replaced
+    return output
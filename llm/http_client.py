@@ -0,0 +1,50 @@
+"""
+Shared HTTP client for LLM providers.
+One pooled httpx.Client is reused across calls and providers. Timeouts, proxy,
+TLS verification and connection limits come from LLMConfig; deployments can
+also inject a fully custom client via llm_config.http_client.
+"""
+import threading
+from typing import Optional, Union
+
+import httpx
+
+from llm.config import llm_config
+
+_client: Optional[httpx.Client] = None
+_lock = threading.Lock()
+
+
+def _verify_option() -> Union[bool, str]:
+    """LLM_HTTP_VERIFY: "true"/"false", or a path to a CA bundle."""
+    value = llm_config.http_verify
+    if value.lower() in ("true", "1", "yes"):
+        return True
+    if value.lower() in ("false", "0", "no"):
+        return False
+    return value
+
+
+def build_http_client() -> httpx.Client:
+    """Construct a new client from the LLM_HTTP_* settings."""
+    return httpx.Client(
+        timeout=httpx.Timeout(llm_config.http_timeout, connect=llm_config.http_connect_timeout),
+        limits=httpx.Limits(
+            max_connections=llm_config.http_max_connections,
+            max_keepalive_connections=llm_config.http_max_keepalive_connections,
+            keepalive_expiry=llm_config.http_keepalive_expiry,
+        ),
+        proxy=llm_config.http_proxy or None,
+        verify=_verify_option(),
+    )
+
+
+def get_http_client() -> httpx.Client:
+    """The shared client: the injected one if set, otherwise built once from config."""
+    global _client
+    if llm_config.http_client is not None:
+        return llm_config.http_client
+    with _lock:
+        if _client is None:
+            _client = build_http_client()
+        return _client
@@ -0,0 +1,115 @@
+"""
+Language Detection.
+Script-based checks for the language of a reply. Detecting the script
+(Devanagari, Tamil, Latin, ...) is reliable on short WhatsApp messages where
+word-level language identification is not; romanized replies ("Hinglish") are
+told apart from English by the language the Mouth declares (message_language).
+"""
+from collections import Counter
+from typing import Iterable, Optional
+
+# Unicode blocks of the scripts our leads write in
+SCRIPT_RANGES = {
+    "devanagari": (0x0900, 0x097F),
+    "bengali": (0x0980, 0x09FF),
+    "gurmukhi": (0x0A00, 0x0A7F),
+    "gujarati": (0x0A80, 0x0AFF),
+    "oriya": (0x0B00, 0x0B7F),
+    "tamil": (0x0B80, 0x0BFF),
+    "telugu": (0x0C00, 0x0C7F),
+    "kannada": (0x0C80, 0x0CFF),
+    "malayalam": (0x0D00, 0x0D7F),
+    "arabic": (0x0600, 0x06FF),
+}
+
+LANGUAGE_SCRIPTS = {
+    "en": "latin",
+    "hi": "devanagari",
+    "mr": "devanagari",
+    "ne": "devanagari",
+    "bn": "bengali",
+    "pa": "gurmukhi",
+    "gu": "gujarati",
+    "or": "oriya",
+    "ta": "tamil",
+    "te": "telugu",
+    "kn": "kannada",
+    "ml": "malayalam",
+    "ur": "arabic",
+    "ar": "arabic",
+}
+
+# Language assumed for a lead writing in a script shared by several languages
+SCRIPT_LANGUAGES = {
+    "latin": "en",
+    "devanagari": "hi",
+    "bengali": "bn",
+    "gurmukhi": "pa",
+    "gujarati": "gu",
+    "oriya": "or",
+    "tamil": "ta",
+    "telugu": "te",
+    "kannada": "kn",
+    "malayalam": "ml",
+    "arabic": "ur",
+}
+
+LANGUAGE_NAMES = {
+    "en": "English", "hi": "Hindi", "mr": "Marathi", "ne": "Nepali", "bn": "Bengali",
+    "pa": "Punjabi", "gu": "Gujarati", "or": "Odia", "ta": "Tamil", "te": "Telugu",
+    "kn": "Kannada", "ml": "Malayalam", "ur": "Urdu", "ar": "Arabic",
+}
+
+
+def base_language(code: str) -> str:
+    """Language code without the region: "hi_IN" / "en-US" -> "hi" / "en"."""
+    return code.replace("-", "_").split("_")[0].strip().lower()
+
+
+def language_name(code: str) -> str:
+    return LANGUAGE_NAMES.get(base_language(code), code)
+
+
+def _char_script(char: str) -> Optional[str]:
+    if not char.isalpha():
+        return None
+    if char.isascii():
+        return "latin"
+    point = ord(char)
+    for script, (low, high) in SCRIPT_RANGES.items():
+        if low <= point <= high:
+            return script
+    # Accented Latin (é, ñ) counts as Latin; other scripts are not tracked
+    return "latin" if point < 0x0250 else None
+
+
+def detect_script(text: str) -> Optional[str]:
+    """The script most letters are written in; None when there are no letters (emoji, numbers)."""
+    counts = Counter(script for script in map(_char_script, text) if script)
+    if not counts:
+        return None
+    return counts.most_common(1)[0][0]
+
+
+def infer_language(texts: Iterable[str], default: str = "en") -> str:
+    """Language code for the most recent text that has letters (texts oldest first)."""
+    for text in reversed(list(texts)):
+        script = detect_script(text)
+        if script:
+            return SCRIPT_LANGUAGES[script]
+    return default
+
+
+def language_mismatch(text: str, declared: str, expected: str) -> Optional[str]:
+    """
+    Why a reply is not in the expected language, or None if it is (or can't be
+    told). A reply in Latin script passes for a non-Latin language only when the
+    Mouth declares it as that language (romanized, e.g. Hinglish), not English.
+    """
+    expected_script = LANGUAGE_SCRIPTS.get(base_language(expected))
+    detected = detect_script(text)
+    if expected_script is None or detected is None or detected == expected_script:
+        return None
+    if detected == "latin" and base_language(declared) == base_language(expected):
+        return None
+    return f"language: reply is in {detected} script ({declared}), lead writes {language_name(expected)} ({expected_script})"
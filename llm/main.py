@@ -11,6 +11,8 @@ Usage:
     result = run_pipeline(context, user_message)
 """
 from llm.pipeline import run_pipeline, run_followup_pipeline
+from llm.run_context import RunContext, RunCancelledError, DeadlineExceededError
+from llm.client import LLMClient, CannedLLMClient
 from llm.schemas import (
     PipelineInput,
     PipelineResult,
@@ -23,6 +25,11 @@ from llm.schemas import (
 __all__ = [
     "run_pipeline",
     "run_followup_pipeline",
+    "RunContext",
+    "RunCancelledError",
+    "DeadlineExceededError",
+    "LLMClient",
+    "CannedLLMClient",
     "PipelineInput",
     "PipelineResult",
     "AnalyzeOutput",
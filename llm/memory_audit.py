@@ -0,0 +1,91 @@
+"""
+Memory Audit Trail.
+Every rolling-summary revision is reported with a diff and the exchange that
+triggered it, so a fact the bot "forgot" can be traced to the update that lost it.
+"""
+import difflib
+import logging
+import time
+from abc import ABC, abstractmethod
+from typing import Optional
+
+from pydantic import BaseModel, Field
+
+from llm.schemas import PipelineInput, SummaryOutput
+
+logger = logging.getLogger(__name__)
+
+
+class SummaryRevision(BaseModel):
+    """One change to a conversation's rolling summary."""
+    conversation_id: Optional[str] = None
+    request_id: Optional[str] = None
+    source: str = "llm"  # SummaryOutput.source: llm | compacted | fallback
+    trigger_message: str = ""
+    bot_message: str = ""
+    previous_summary: str = ""
+    new_summary: str = ""
+    diff: str = ""
+    created_at: float = Field(default_factory=time.time)
+
+
+def summary_diff(previous: str, new: str) -> str:
+    """Line diff of two summaries ("-" lost, "+" added), without the unified-diff headers."""
+    lines = difflib.unified_diff(previous.splitlines(), new.splitlines(), lineterm="", n=0)
+    return "\n".join(line for line in lines if not line.startswith(("---", "+++", "@@")))
+
+
+class MemoryAuditSink(ABC):
+    """Persists summary revisions (DB, log pipeline, ...)."""
+
+    @abstractmethod
+    def record(self, revision: SummaryRevision) -> None:
+        raise NotImplementedError
+
+
+class LoggingMemoryAuditSink(MemoryAuditSink):
+    """Default sink: writes the diff to the llm log."""
+
+    def record(self, revision: SummaryRevision) -> None:
+        logging.getLogger("llm").info(
+            f"SUMMARY REVISION conversation={revision.conversation_id} [req {revision.request_id}] "
+            f"source={revision.source}:\n{revision.diff}"
+        )
+
+
+_audit_sink: MemoryAuditSink = LoggingMemoryAuditSink()
+
+
+def set_memory_audit_sink(sink: MemoryAuditSink) -> None:
+    global _audit_sink
+    _audit_sink = sink
+
+
+def get_memory_audit_sink() -> MemoryAuditSink:
+    return _audit_sink
+
+
+def record_summary_revision(
+    context: PipelineInput,
+    summary: SummaryOutput,
+    user_message: str,
+    bot_message: str,
+    request_id: Optional[str] = None,
+) -> None:
+    """Report a revision if the summary changed. Audit failures never block the Memory step."""
+    previous = context.rolling_summary or ""
+    if summary.updated_rolling_summary == previous:
+        return
+    try:
+        get_memory_audit_sink().record(SummaryRevision(
+            conversation_id=context.conversation_id,
+            request_id=request_id,
+            source=summary.source,
+            trigger_message=user_message,
+            bot_message=bot_message,
+            previous_summary=previous,
+            new_summary=summary.updated_rolling_summary,
+            diff=summary_diff(previous, summary.updated_rolling_summary),
+        ))
+    except Exception as e:
+        logger.error(f"Failed to record summary revision: {e}")
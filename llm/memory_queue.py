@@ -0,0 +1,310 @@
+"""
+Memory Queue.
+Decouples the Memory step from the reply path: the pipeline enqueues a job per
+exchange and MemoryWorker threads update the rolling summary afterwards.
+
+Per conversation there is at most one pending and one in-flight job. Exchanges
+arriving while a job is pending are appended to it, and a job only starts once
+the previous one for its conversation has finished. When it starts it is rebased
+on the summary that one left, even if it was enqueued later by a pipeline run
+that loaded the conversation before, so every update builds on the latest
+summary. Failed jobs are retried with backoff.
+
+Usage:
+    worker = MemoryWorker(get_memory_queue(), handler=save_summary)
+    worker.start()
+    run_pipeline(context, message, memory_mode="queue", conversation_id=str(conversation_id))
+"""
+import logging
+import threading
+import time
+from abc import ABC, abstractmethod
+from collections import OrderedDict, deque
+from typing import Callable, Dict, List, Optional, Tuple
+
+from pydantic import BaseModel, Field
+
+from llm.client import LLMClient
+from llm.config import llm_config
+from llm.run_context import RunContext
+from llm.schemas import ClassifyOutput, LeadProfile, PipelineInput, StepMetrics, SummaryOutput
+from llm.memory_audit import record_summary_revision
+from llm.steps.memory import fallback_summary, run_memory
+
+logger = logging.getLogger(__name__)
+
+RETRY_BASE_DELAY_SECONDS = 2.0
+SEEN_REQUEST_IDS = 10000
+# A finished job's summary is what later jobs of the conversation start from for
+# this long: longer than a pipeline run, whose job may carry a summary loaded
+# before that job finished. After that the job's own (persisted) one is current.
+LATEST_SUMMARY_TTL_SECONDS = 300.0
+LATEST_SUMMARIES = 10000
+
+
+class MemoryExchange(BaseModel):
+    """One lead message and the bot's reply to it."""
+    user_message: str
+    bot_message: str = ""
+    classification: ClassifyOutput
+
+
+class MemoryJob(BaseModel):
+    """Pending summary update for one conversation. Serializable for external queues."""
+    conversation_id: str
+    request_id: Optional[str] = None
+    context: PipelineInput  # Summary and lead profile to build on
+    exchanges: List[MemoryExchange] = Field(default_factory=list)
+    metadata: Dict[str, str] = Field(default_factory=dict)  # Caller data for the handler (e.g. lead_id)
+    attempts: int = 0
+    not_before: float = 0.0  # time.time() before which a retry must not start
+
+
+class MemoryQueue(ABC):
+    """Work queue of memory jobs, serialized per conversation."""
+
+    @abstractmethod
+    def enqueue(self, job: MemoryJob) -> bool:
+        """Add a job. Returns False if it was a duplicate (same request_id) and dropped."""
+        raise NotImplementedError
+
+    @abstractmethod
+    def claim(self, timeout: Optional[float] = None) -> Optional[MemoryJob]:
+        """Take the next runnable job, waiting up to timeout seconds. None if there is none."""
+        raise NotImplementedError
+
+    @abstractmethod
+    def complete(self, job: MemoryJob, summary: SummaryOutput) -> None:
+        """Mark a claimed job done; later jobs of the conversation build on summary."""
+        raise NotImplementedError
+
+    @abstractmethod
+    def fail(self, job: MemoryJob, max_attempts: int) -> bool:
+        """Mark a claimed job failed. Returns True if it was re-queued for another attempt."""
+        raise NotImplementedError
+
+
+class InMemoryMemoryQueue(MemoryQueue):
+    """Process-local queue. Jobs are lost on restart; use an external queue for durability."""
+
+    def __init__(self) -> None:
+        self._pending: "OrderedDict[str, MemoryJob]" = OrderedDict()
+        self._in_flight: set = set()
+        self._seen_request_ids: deque = deque(maxlen=SEEN_REQUEST_IDS)
+        # conversation_id -> (time.time(), rolling summary, lead profile) its last job left
+        self._latest: "OrderedDict[str, Tuple[float, Optional[str], LeadProfile]]" = OrderedDict()
+        self._condition = threading.Condition()
+
+    def enqueue(self, job: MemoryJob) -> bool:
+        with self._condition:
+            if job.request_id and job.request_id in self._seen_request_ids:
+                logger.info(f"Dropping duplicate memory job [req {job.request_id}]")
+                return False
+            if job.request_id:
+                self._seen_request_ids.append(job.request_id)
+            self._add(job)
+            self._condition.notify()
+            return True
+
+    def _add(self, job: MemoryJob) -> None:
+        pending = self._pending.get(job.conversation_id)
+        if pending is None:
+            self._pending[job.conversation_id] = job
+            return
+        # Older exchanges first; the earlier job's context is the right base
+        first, second = (job, pending) if job.attempts else (pending, job)
+        first.exchanges = first.exchanges + second.exchanges
+        first.not_before = max(first.not_before, second.not_before)
+        self._pending[job.conversation_id] = first
+
+    def _next_runnable(self) -> Optional[MemoryJob]:
+        now = time.time()
+        for conversation_id, job in self._pending.items():
+            if conversation_id not in self._in_flight and job.not_before <= now:
+                del self._pending[conversation_id]
+                self._in_flight.add(conversation_id)
+                self._rebase(job)
+                return job
+        return None
+
+    def _rebase(self, job: MemoryJob) -> None:
+        """Start the job from the summary its conversation's previous job left."""
+        latest = self._latest.get(job.conversation_id)
+        if latest is None:
+            return
+        finished_at, rolling_summary, lead_profile = latest
+        if time.time() - finished_at > LATEST_SUMMARY_TTL_SECONDS:
+            del self._latest[job.conversation_id]
+            return
+        job.context = job.context.model_copy(update={
+            "rolling_summary": rolling_summary,
+            "lead_profile": lead_profile,
+        })
+
+    def _remember(self, conversation_id: str, rolling_summary: Optional[str], lead_profile: LeadProfile) -> None:
+        self._latest[conversation_id] = (time.time(), rolling_summary, lead_profile)
+        self._latest.move_to_end(conversation_id)
+        while len(self._latest) > LATEST_SUMMARIES:
+            self._latest.popitem(last=False)
+
+    def claim(self, timeout: Optional[float] = None) -> Optional[MemoryJob]:
+        deadline = None if timeout is None else time.monotonic() + timeout
+        with self._condition:
+            while True:
+                job = self._next_runnable()
+                if job is not None:
+                    return job
+                remaining = None if deadline is None else deadline - time.monotonic()
+                if remaining is not None and remaining <= 0:
+                    return None
+                # Wake up periodically for retries whose backoff has elapsed
+                self._condition.wait(min(remaining, 1.0) if remaining is not None else 1.0)
+
+    def complete(self, job: MemoryJob, summary: SummaryOutput) -> None:
+        with self._condition:
+            self._in_flight.discard(job.conversation_id)
+            if summary is not None:
+                self._remember(job.conversation_id, summary.updated_rolling_summary, summary.lead_profile)
+            self._condition.notify_all()
+
+    def fail(self, job: MemoryJob, max_attempts: int) -> bool:
+        with self._condition:
+            self._in_flight.discard(job.conversation_id)
+            # Exchanges folded in before the failure are kept (and already handed to the handler)
+            self._remember(job.conversation_id, job.context.rolling_summary, job.context.lead_profile)
+            job.attempts += 1
+            retry = job.attempts < max_attempts
+            if retry:
+                job.not_before = time.time() + RETRY_BASE_DELAY_SECONDS * (2 ** (job.attempts - 1))
+                self._add(job)
+            self._condition.notify_all()
+            return retry
+
+    def __len__(self) -> int:
+        with self._condition:
+            return len(self._pending) + len(self._in_flight)
+
+
+MemoryHandler = Callable[[MemoryJob, SummaryOutput], None]
+
+
+class MemoryWorker:
+    """Consumes a MemoryQueue on background threads and passes each new summary to handler."""
+
+    def __init__(
+        self,
+        queue: MemoryQueue,
+        handler: MemoryHandler,
+        client: Optional[LLMClient] = None,
+        max_attempts: Optional[int] = None,
+    ) -> None:
+        self.queue = queue
+        self.handler = handler
+        self.client = client
+        self.max_attempts = max_attempts or llm_config.memory_max_attempts
+        self._stop = threading.Event()
+        self._threads: List[threading.Thread] = []
+
+    def run_once(self, timeout: Optional[float] = None) -> bool:
+        """Process one job. Returns False if none became available within timeout."""
+        job = self.queue.claim(timeout=timeout)
+        if job is None:
+            return False
+
+        summary: Optional[SummaryOutput] = None
+        metrics = StepMetrics()  # Summed over the exchanges folded in this attempt
+        try:
+            # Exchanges are folded in order, each building on the previous summary
+            while job.exchanges:
+                exchange = job.exchanges[0]
+                summary = run_memory(
+                    job.context,
+                    exchange.user_message,
+                    exchange.bot_message,
+                    exchange.classification,
+                    ctx=RunContext(request_id=job.request_id),
+                    client=self.client,
+                    raise_errors=True,
+                )
+                metrics = metrics + summary.metrics
+                summary.metrics = metrics
+                job.context = job.context.model_copy(update={
+                    "rolling_summary": summary.updated_rolling_summary,
+                    "lead_profile": summary.lead_profile,
+                })
+                job.exchanges = job.exchanges[1:]
+        except Exception as e:
+            if job.attempts + 1 < self.max_attempts:
+                # Progress so far stays in job.context; only unprocessed exchanges are retried
+                self.queue.fail(job, self.max_attempts)
+                logger.error(
+                    f"Memory job for conversation {job.conversation_id} failed "
+                    f"(attempt {job.attempts}), retrying: {e}"
+                )
+                if summary is not None:
+                    self._handle(job, summary)
+                return True
+
+            # Out of attempts: fold the remaining exchanges in without the LLM
+            logger.error(
+                f"Memory job for conversation {job.conversation_id} failed "
+                f"{self.max_attempts} times, using fallback summary: {e}"
+            )
+            for exchange in job.exchanges:
+                summary = fallback_summary(
+                    job.context, exchange.user_message, exchange.bot_message, exchange.classification
+                )
+                record_summary_revision(
+                    job.context, summary, exchange.user_message, exchange.bot_message, job.request_id
+                )
+                job.context = job.context.model_copy(update={"rolling_summary": summary.updated_rolling_summary})
+            job.exchanges = []
+
+        self.queue.complete(job, summary)
+        if summary is not None:
+            self._handle(job, summary)
+        return True
+
+    def _handle(self, job: MemoryJob, summary: SummaryOutput) -> None:
+        try:
+            self.handler(job, summary)
+        except Exception as e:
+            logger.error(f"Memory handler failed for conversation {job.conversation_id}: {e}", exc_info=True)
+
+    def _loop(self) -> None:
+        while not self._stop.is_set():
+            try:
+                self.run_once(timeout=1.0)
+            except Exception as e:
+                logger.error(f"Memory worker error: {e}", exc_info=True)
+
+    def start(self, threads: Optional[int] = None) -> None:
+        for index in range(threads or llm_config.memory_workers):
+            thread = threading.Thread(target=self._loop, name=f"memory-worker-{index}", daemon=True)
+            thread.start()
+            self._threads.append(thread)
+
+    def stop(self, timeout: Optional[float] = None) -> None:
+        self._stop.set()
+        for thread in self._threads:
+            thread.join(timeout)
+        self._threads = []
+
+
+_queue: Optional[MemoryQueue] = None
+_queue_lock = threading.Lock()
+
+
+def get_memory_queue() -> MemoryQueue:
+    global _queue
+    with _queue_lock:
+        if _queue is None:
+            _queue = InMemoryMemoryQueue()
+        return _queue
+
+
+def set_memory_queue(queue: Optional[MemoryQueue]) -> None:
+    """Install a different queue implementation (e.g. backed by SQS or Redis)."""
+    global _queue
+    with _queue_lock:
+        _queue = queue
@@ -0,0 +1,70 @@
+"""
+Message Constraints.
+Deterministic checks for the limits the Mouth prompt only asks for
+(PipelineInput.max_words, PipelineInput.questions_per_message), and a graceful
+truncation used when the model still violates them after a corrective re-ask.
+"""
+import re
+from typing import List
+
+# "??" or "?!" is one question; ？ is the full-width question mark
+_QUESTION = re.compile(r"[?？]+")
+# A terminator only ends a sentence before whitespace, so "Rs 9.99" stays whole; ।: Devanagari danda
+_SENTENCE = re.compile(r".+?(?:[.!?？।]+(?=\s|$)|(?=\n)|$)")
+ELLIPSIS = "..."
+
+
+def count_words(text: str) -> int:
+    return len(text.split())
+
+
+def count_questions(text: str) -> int:
+    return len(_QUESTION.findall(text))
+
+
+def find_violations(text: str, max_words: int, max_questions: int) -> List[str]:
+    """Human-readable violations, used in the corrective prompt and GenerateOutput.violations."""
+    violations = []
+    words = count_words(text)
+    if max_words and words > max_words:
+        violations.append(f"max_words: {words} words, limit is {max_words}")
+    questions = count_questions(text)
+    if max_questions and questions > max_questions:
+        violations.append(f"questions_per_message: {questions} questions, limit is {max_questions}")
+    return violations
+
+
+def split_sentences(text: str) -> List[str]:
+    """text's sentences, each with its closing punctuation."""
+    return [match.group(0).strip() for match in _SENTENCE.finditer(text) if match.group(0).strip()]
+
+
+def enforce_constraints(text: str, max_words: int, max_questions: int) -> str:
+    """
+    Bring a message within limits without cutting mid-sentence where possible:
+    questions beyond the limit are dropped, then trailing sentences until the
+    word limit is met. A single over-long sentence is cut at the limit.
+    """
+    if not find_violations(text, max_words, max_questions):
+        return text
+
+    kept: List[str] = []
+    questions = 0
+    for sentence in split_sentences(text):
+        if _QUESTION.search(sentence):
+            if max_questions and questions >= max_questions:
+                continue
+            questions += 1
+        kept.append(sentence)
+
+    if max_words:
+        fitted: List[str] = []
+        for sentence in kept:
+            if count_words(" ".join(fitted + [sentence])) > max_words:
+                break
+            fitted.append(sentence)
+        if not fitted and kept:
+            return " ".join(kept[0].split()[:max_words]).rstrip(".,;:!?") + ELLIPSIS
+        kept = fitted
+
+    return " ".join(kept)
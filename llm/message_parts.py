@@ -0,0 +1,57 @@
+"""
+Message Parts.
+On WhatsApp people send several short messages rather than one wall of text.
+A long reply is split on natural boundaries (paragraphs, else sentences) into
+at most LLMConfig.split_max_parts bubbles, each with a suggested delay before
+sending it, scaled to its length as if it were being typed. message_text keeps
+the whole reply for the transcript and the Memory step.
+"""
+import re
+from typing import List, Tuple
+
+from llm.config import llm_config
+from llm.message_constraints import split_sentences
+
+_PARAGRAPH_BREAK = re.compile(r"\n\s*\n")
+
+
+def _merge_shortest(units: List[str], max_parts: int, separator: str) -> List[str]:
+    """Join the adjacent pair with the fewest characters until at most max_parts remain."""
+    units = list(units)
+    while len(units) > max_parts:
+        index = min(range(len(units) - 1), key=lambda i: len(units[i]) + len(units[i + 1]))
+        units[index:index + 2] = [units[index] + separator + units[index + 1]]
+    return units
+
+
+def split_message(text: str, max_parts: int, min_chars: int) -> List[str]:
+    """
+    text as 1 to max_parts bubbles. Texts under min_chars stay whole; so do lists
+    and other multi-line paragraphs, which read as one message.
+    """
+    text = text.strip()
+    if not text:
+        return []
+    if len(text) < min_chars or max_parts <= 1:
+        return [text]
+    paragraphs = [paragraph.strip() for paragraph in _PARAGRAPH_BREAK.split(text) if paragraph.strip()]
+    if len(paragraphs) > 1:
+        return _merge_shortest(paragraphs, max_parts, "\n\n")
+    if "\n" in text:
+        return [text]
+    return _merge_shortest(split_sentences(text), max_parts, " ")
+
+
+def typing_delay_ms(part: str) -> int:
+    """Pause before sending a bubble, as if it were being typed, within the configured bounds."""
+    delay = len(part) * llm_config.bubble_ms_per_char
+    return int(min(max(delay, llm_config.bubble_min_delay_ms), llm_config.bubble_max_delay_ms))
+
+
+def split_reply(text: str) -> Tuple[List[str], List[int]]:
+    """
+    (parts, delays_ms) for a reply, per LLMConfig. delays_ms[i] is the wait before
+    sending parts[i]; the first part goes out immediately.
+    """
+    parts = split_message(text, llm_config.split_max_parts, llm_config.split_min_chars)
+    return parts, [0] + [typing_delay_ms(part) for part in parts[1:]]
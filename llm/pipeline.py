@@ -1,63 +1,306 @@
 import logging
-from llm.schemas import PipelineInput, PipelineResult, ClassifyOutput
+import threading
+from concurrent.futures import ThreadPoolExecutor
+from typing import Callable, Dict, List, Optional, Sequence
+from llm.schemas import PipelineInput, PipelineResult, ClassifyOutput, SummaryOutput, StepMetrics
+from llm.config import llm_config
+from llm.run_context import RunContext, RunCancelledError
+from llm.client import LLMClient, CapturingLLMClient, resolve_client
+from llm.cost import usd_to_inr
+from llm.cta import resolve_cta_action
+from llm.hooks import PipelineMiddleware, after_step, before_step, get_middleware
+from llm.message_parts import split_reply
+from llm.prompt_store import maybe_reload_prompts
+from llm.tracing import annotate, span
+from llm.metrics import PIPELINE_LATENCY, PIPELINE_RUNS, STEP_LATENCY
 from llm.steps.brain import run_brain
 from llm.steps.mouth import run_mouth
-from server.enums import DecisionAction
+from llm.steps.variation import run_variation
+from llm.steps.verify import run_verify
+from llm.steps.memory import run_memory
+from llm.memory_queue import MemoryExchange, MemoryJob, get_memory_queue
+from server.enums import DecisionAction, RiskLevel
 
 logger = logging.getLogger(__name__)
 
-def run_pipeline(context: PipelineInput, user_message: str) -> PipelineResult:
+MEMORY_MODES = ("worker", "inline", "async", "queue")
+
+# The "user message" of a scheduled follow-up run
+FOLLOWUP_TRIGGER_MESSAGE = "[System: Scheduled follow-up triggered]"
+
+_memory_executor: Optional[ThreadPoolExecutor] = None
+_memory_executor_lock = threading.Lock()
+
+
+def _get_memory_executor() -> ThreadPoolExecutor:
+    global _memory_executor
+    with _memory_executor_lock:
+        if _memory_executor is None:
+            _memory_executor = ThreadPoolExecutor(
+                max_workers=llm_config.memory_workers, thread_name_prefix="llm-memory"
+            )
+        return _memory_executor
+
+
+def _update_memory(
+    context: PipelineInput,
+    user_message: str,
+    result: PipelineResult,
+    ctx: RunContext,
+    client: Optional[LLMClient],
+    on_summary: Optional[Callable[[SummaryOutput], None]],
+    middleware: Sequence[PipelineMiddleware] = (),
+) -> Optional[SummaryOutput]:
+    """Run the Memory step for a finished run and hand the new summary to on_summary."""
+    bot_message = result.response.message_text if result.would_send_message else ""
+    inputs = {"user_message": user_message, "bot_message": bot_message, "classification": result.classification}
+    with span("pipeline.memory", request_id=ctx.request_id):
+        context = before_step(middleware, "memory", context, inputs)
+        summary = run_memory(
+            context, user_message, bot_message, result.classification, ctx=ctx, client=client, audit=not result.shadow
+        )
+        if summary:
+            summary = after_step(middleware, "memory", context, inputs, summary)
+            STEP_LATENCY.observe(summary.metrics.latency_ms / 1000, step="memory")
+    if summary and on_summary is not None:
+        try:
+            on_summary(summary)
+        except Exception as e:
+            logger.error(f"on_summary callback failed [req {ctx.request_id}]: {e}", exc_info=True)
+    return summary
+
+def run_pipeline(
+    context: PipelineInput,
+    user_message: str,
+    ctx: Optional[RunContext] = None,
+    client: Optional[LLMClient] = None,
+    memory_mode: Optional[str] = None,
+    on_summary: Optional[Callable[[SummaryOutput], None]] = None,
+    conversation_id: Optional[str] = None,
+    memory_metadata: Optional[Dict[str, str]] = None,
+    vary_response: bool = False,
+    capture_raw: Optional[bool] = None,
+    middleware: Optional[List[PipelineMiddleware]] = None,
+    shadow: bool = False,
+) -> PipelineResult:
     """
     Run the Brain-Mouth-Memory pipeline.
     
     Steps:
     1. BRAIN: Analyze & Decide
-    2. MOUTH: Write Message (if Brain says so)
-    3. Return Result (Memory is backgrounded)
+    2. MOUTH: Write Message (if Brain says so); with vary_response, a message too
+       similar to an earlier bot message is paraphrased or dropped (llm.steps.variation).
+       With LLMConfig.hallucination_check, a reply whose prices, timings or availability
+       aren't grounded in the business info is withheld (llm.steps.verify).
+       A long reply is split into WhatsApp bubbles (response.message_parts, llm.message_parts)
+    3. MEMORY: Update the rolling summary, per memory_mode (default LLMConfig.memory_mode):
+       - "worker": skipped; needs_background_summary tells the caller to run it
+       - "inline": run before returning; result.summary is populated
+       - "async": run on a background thread after returning
+       - "queue": enqueue a job on llm.memory_queue (needs conversation_id); the
+         MemoryWorker's handler persists it, receiving memory_metadata with the job
+       In "inline" and "async" modes on_summary receives the SummaryOutput for persisting.
+
+    Raises RunCancelledError if ctx is cancelled. A step that runs past ctx's
+    deadline falls back (Brain: stay silent; Mouth: a canned reply) instead.
+    client overrides the LLM client (e.g. llm.client.CannedLLMClient in tests).
+    capture_raw (default LLMConfig.capture_raw) attaches every call's rendered
+    prompt and raw completion to result.raw_captures, including on the emergency result.
+    Newly published prompts (llm.prompt_store) are picked up at the start of a run.
+    middleware runs around each step after the globally registered middleware (llm.hooks).
+    shadow runs every step, Memory inline, but marks the result as a shadow run: it
+    never sends (should_send_message is False) and on_summary is not called (llm.shadow).
     """
+    memory_mode = memory_mode or llm_config.memory_mode
+    if memory_mode not in MEMORY_MODES:
+        raise ValueError(f"Unknown memory_mode {memory_mode!r}; expected one of {MEMORY_MODES}")
+    if memory_mode == "queue" and not conversation_id:
+        raise ValueError("memory_mode 'queue' requires a conversation_id")
+    if shadow:
+        # Nothing from a shadow run may reach the conversation
+        memory_mode, on_summary = "inline", None
+
+    # Every run gets a context so its LLM calls share one request ID
+    ctx = ctx or RunContext()
+    prompt_version = maybe_reload_prompts()
+    capture = None
+    if llm_config.capture_raw if capture_raw is None else capture_raw:
+        capture = CapturingLLMClient(resolve_client(client))
+        client = capture
     total_latency_ms = 0
     total_tokens = 0
+    token_usage = {}
+    step_metrics = {}
+    hooks = get_middleware() + list(middleware or [])
     
-    try:
-        # ========================================
-        # Step 1: BRAIN
-        # ========================================
-        logger.info("Running Step 1: Brain")
-        classification, latency, tokens = run_brain(context)
-        total_latency_ms += latency
-        total_tokens += tokens
-        
-        # ========================================
-        # Step 2: MOUTH
-        # ========================================
-        response_output = None
-        
-        if classification.should_respond:
-            logger.info(f"Running Step 2: Mouth - Action: {classification.action.value}")
-            response_output, latency, tokens = run_mouth(context, classification)
+    with span(
+        "pipeline.run",
+        request_id=ctx.request_id,
+        conversation_id=conversation_id,
+        stage=context.conversation_stage.value,
+        prompt_version=prompt_version,
+        shadow=shadow,
+    ) as run_span:
+        try:
+            # ========================================
+            # Step 1: BRAIN
+            # ========================================
+            logger.info("Running Step 1: Brain")
+            with span("pipeline.brain"):
+                inputs = {"user_message": user_message}
+                context = before_step(hooks, "brain", context, inputs)
+                classification, latency, usage = run_brain(context, ctx=ctx, client=client)
+                classification = after_step(hooks, "brain", context, inputs, classification)
             total_latency_ms += latency
-            total_tokens += tokens
-        else:
-            logger.info("Skipping Mouth (Brain decided not to respond)")
-
-        # ========================================
-        # Build Result
-        # ========================================
-        result = PipelineResult(
-            classification=classification,
-            response=response_output,
-            summary=None, # To be filled by background worker
-            pipeline_latency_ms=total_latency_ms,
-            total_tokens_used=total_tokens,
-            needs_background_summary=True # Signal to worker
-        )
+            total_tokens += usage.total_tokens
+            token_usage["brain"] = usage
+            step_metrics["brain"] = StepMetrics(latency_ms=latency, usage=usage)
+        
+            # ========================================
+            # Step 2: MOUTH
+            # ========================================
+            response_output = None
         
-        logger.info(f"Pipeline Complete: {total_latency_ms}ms. Response: {bool(response_output)}")
-        return result
+            if classification.should_respond:
+                logger.info(f"Running Step 2: Mouth - Action: {classification.action.value}")
+                with span("pipeline.mouth", action=classification.action.value):
+                    inputs = {"user_message": user_message, "classification": classification}
+                    context = before_step(hooks, "mouth", context, inputs)
+                    response_output, latency, usage = run_mouth(context, classification, ctx=ctx, client=client)
+                    response_output = after_step(hooks, "mouth", context, inputs, response_output)
+                total_latency_ms += latency
+                total_tokens += usage.total_tokens
+                token_usage["mouth"] = usage
+                step_metrics["mouth"] = StepMetrics(latency_ms=latency, usage=usage)
+
+                if response_output.guardrail_hits and not response_output.message_text:
+                    # The reply was withheld for making a forbidden claim: a human should answer instead
+                    classification = classification.model_copy(update={"needs_human_attention": True})
+
+                if vary_response and response_output.message_text and not response_output.template_message:
+                    with span("pipeline.variation"):
+                        inputs = {"classification": classification, "response": response_output}
+                        context = before_step(hooks, "variation", context, inputs)
+                        response_output, latency, usage = run_variation(
+                            context, response_output, ctx=ctx, client=client
+                        )
+                        response_output = after_step(hooks, "variation", context, inputs, response_output)
+                    total_latency_ms += latency
+                    total_tokens += usage.total_tokens
+                    if usage.total_tokens or latency:
+                        token_usage["variation"] = usage
+                        step_metrics["variation"] = StepMetrics(latency_ms=latency, usage=usage)
+
+                with span("pipeline.verify") as verify_span:
+                    inputs = {"classification": classification, "response": response_output}
+                    context = before_step(hooks, "verify", context, inputs)
+                    response_output, latency, usage = run_verify(context, response_output, ctx=ctx, client=client)
+                    response_output = after_step(hooks, "verify", context, inputs, response_output)
+                    annotate(verify_span, ungrounded_claims=len(response_output.ungrounded_claims))
+                total_latency_ms += latency
+                total_tokens += usage.total_tokens
+                if usage.total_tokens:
+                    token_usage["verify"] = usage
+                    step_metrics["verify"] = StepMetrics(latency_ms=latency, usage=usage)
+                if response_output.ungrounded_claims:
+                    # The reply stated facts the business never gave: withheld, a human should answer
+                    risk_flags = classification.risk_flags.model_copy(update={"hallucination_risk": RiskLevel.HIGH})
+                    classification = classification.model_copy(
+                        update={"risk_flags": risk_flags, "needs_human_attention": True}
+                    )
 
-    except Exception as e:
-        logger.error(f"Pipeline Critical Error: {e}", exc_info=True)
-        return _get_emergency_result()
+                if llm_config.split_messages and response_output.message_text and not response_output.template_message:
+                    parts, delays_ms = split_reply(response_output.message_text)
+                    response_output = response_output.model_copy(
+                        update={"message_parts": parts, "message_part_delays_ms": delays_ms}
+                    )
+            else:
+                logger.info("Skipping Mouth (Brain decided not to respond)")
+
+            # ========================================
+            # Build Result
+            # ========================================
+            total_cost_usd = sum(usage.cost_usd for usage in token_usage.values())
+            result = PipelineResult(
+                classification=classification,
+                response=response_output,
+                summary=None, # To be filled by background worker
+                cta_action=resolve_cta_action(classification, response_output, context.available_ctas),
+                request_id=ctx.request_id,
+                prompt_version=prompt_version,
+                pipeline_latency_ms=total_latency_ms,
+                total_tokens_used=total_tokens,
+                token_usage=token_usage,
+                step_metrics=step_metrics,
+                total_cost_usd=total_cost_usd,
+                total_cost_inr=usd_to_inr(total_cost_usd),
+                needs_background_summary=memory_mode == "worker", # Signal to worker
+                shadow=shadow,
+            )
+            if capture:
+                # The same list, so calls made later (async Memory) still show up
+                result.raw_captures = capture.captures
+
+            # ========================================
+            # Step 3: MEMORY
+            # ========================================
+            if memory_mode == "inline":
+                logger.info("Running Step 3: Memory")
+                result.summary = _update_memory(context, user_message, result, ctx, client, on_summary, hooks)
+                if result.summary:
+                    result.record_step("memory", result.summary.metrics)
+                    result.total_cost_inr = usd_to_inr(result.total_cost_usd)
+            elif memory_mode == "async":
+                # The reply must not wait for the summary, nor be bound by its deadline
+                memory_ctx = RunContext(request_id=ctx.request_id)
+                _get_memory_executor().submit(
+                    _update_memory, context, user_message, result, memory_ctx, client, on_summary, hooks
+                )
+            elif memory_mode == "queue":
+                get_memory_queue().enqueue(MemoryJob(
+                    conversation_id=conversation_id,
+                    request_id=ctx.request_id,
+                    context=context,
+                    exchanges=[MemoryExchange(
+                        user_message=user_message,
+                        bot_message=response_output.message_text if result.should_send_message else "",
+                        classification=classification,
+                    )],
+                    metadata=memory_metadata or {},
+                ))
+
+            for step, metrics in step_metrics.items():
+                STEP_LATENCY.observe(metrics.latency_ms / 1000, step=step)
+            PIPELINE_LATENCY.observe(total_latency_ms / 1000)
+            PIPELINE_RUNS.inc(
+                organization_id=context.organization_id or "unknown",
+                outcome="shadow" if shadow else "sent" if result.should_send_message else "silent",
+            )
+            annotate(
+                run_span,
+                action=classification.action.value,
+                new_stage=classification.new_stage.value,
+                should_send=result.should_send_message,
+                latency_ms=total_latency_ms,
+                total_tokens=total_tokens,
+                cost_usd=total_cost_usd,
+            )
+            logger.info(f"Pipeline Complete [req {ctx.request_id}]: {total_latency_ms}ms. Response: {bool(response_output)}")
+            return result
+
+        except RunCancelledError:
+            logger.warning("Pipeline cancelled before completion")
+            raise
+        except Exception as e:
+            logger.error(f"Pipeline Critical Error: {e}", exc_info=True)
+            run_span.record_exception(e)
+            annotate(run_span, emergency=True)
+            PIPELINE_RUNS.inc(organization_id=context.organization_id or "unknown", outcome="emergency")
+            result = _get_emergency_result()
+            result.shadow = shadow
+            if capture:
+                result.raw_captures = capture.captures
+            return result
 
 
 def _get_emergency_result() -> PipelineResult:
@@ -93,9 +336,21 @@ def _get_emergency_result() -> PipelineResult:
     )
 
 
-def run_followup_pipeline(context: PipelineInput) -> PipelineResult:
+def run_followup_pipeline(
+    context: PipelineInput,
+    ctx: Optional[RunContext] = None,
+    client: Optional[LLMClient] = None,
+    memory_mode: Optional[str] = None,
+    on_summary: Optional[Callable[[SummaryOutput], None]] = None,
+    conversation_id: Optional[str] = None,
+    memory_metadata: Optional[Dict[str, str]] = None,
+) -> PipelineResult:
     """
     Run pipeline for scheduled follow-ups.
+    Follow-ups repeating an earlier bot message are paraphrased or dropped (LLMConfig.followup_variation).
     """
-    synthetic_message = "[System: Scheduled follow-up triggered]"
-    return run_pipeline(context, synthetic_message)
+    return run_pipeline(
+        context, FOLLOWUP_TRIGGER_MESSAGE, ctx=ctx, client=client, memory_mode=memory_mode, on_summary=on_summary,
+        conversation_id=conversation_id, memory_metadata=memory_metadata,
+        vary_response=llm_config.followup_variation,
+    )
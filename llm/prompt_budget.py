@@ -0,0 +1,114 @@
+"""
+Prompt Budget.
+Keeps a step's prompt under LLMConfig.prompt_token_budget (estimated with
+llm.utils.estimate_tokens) by trimming the context it is built from, lowest
+priority first:
+    1. organization example conversations
+    2. business_description (the business knowledge)
+    3. oldest messages (the last MIN_RECENT_MESSAGES are always kept)
+    4. rolling_summary (key facts come first, so the end is cut)
+Flow instructions, persona/overrides, CTAs and the Brain's decision are never trimmed.
+"""
+import logging
+from typing import Callable, Dict, List, Optional
+
+from llm.schemas import PipelineInput
+from llm.utils import estimate_tokens
+
+logger = logging.getLogger(__name__)
+
+MIN_RECENT_MESSAGES = 2
+# Per-message overhead of the chat format (role markers, separators)
+MESSAGE_OVERHEAD_TOKENS = 4
+# Text shorter than this is dropped rather than halved again
+MIN_TRIM_WORDS = 20
+TRIM_MARKER = " [...]"
+
+Messages = List[Dict[str, str]]
+
+
+def estimate_messages(messages: Messages) -> int:
+    return sum(estimate_tokens(message["content"]) + MESSAGE_OVERHEAD_TOKENS for message in messages)
+
+
+def section_tokens(context: PipelineInput) -> Dict[str, int]:
+    """Estimated size of each trimmable section, for logging what made a prompt large."""
+    return {
+        "examples": sum(estimate_tokens(turn.text) for example in context.prompt_examples for turn in example.turns),
+        "business_description": estimate_tokens(context.business_description),
+        "last_messages": sum(estimate_tokens(msg.text) for msg in context.last_messages),
+        "rolling_summary": estimate_tokens(context.rolling_summary),
+    }
+
+
+def _halve(text: str) -> str:
+    words = text.split()
+    if len(words) < MIN_TRIM_WORDS:
+        return ""
+    return " ".join(words[:len(words) // 2]) + TRIM_MARKER
+
+
+def _drop_example(context: PipelineInput) -> Optional[PipelineInput]:
+    if not context.prompt_examples:
+        return None
+    return context.model_copy(update={"prompt_examples": context.prompt_examples[:-1]})
+
+
+def _shorten_description(context: PipelineInput) -> Optional[PipelineInput]:
+    if not context.business_description:
+        return None
+    return context.model_copy(update={"business_description": _halve(context.business_description)})
+
+
+def _drop_oldest_message(context: PipelineInput) -> Optional[PipelineInput]:
+    if len(context.last_messages) <= MIN_RECENT_MESSAGES:
+        return None
+    return context.model_copy(update={"last_messages": context.last_messages[1:]})
+
+
+def _shorten_summary(context: PipelineInput) -> Optional[PipelineInput]:
+    if not context.rolling_summary:
+        return None
+    return context.model_copy(update={"rolling_summary": _halve(context.rolling_summary)})
+
+
+# Lowest priority first; each returns a smaller context, or None when its section is exhausted
+TRIMMERS: List[Callable[[PipelineInput], Optional[PipelineInput]]] = [
+    _drop_example,
+    _shorten_description,
+    _drop_oldest_message,
+    _shorten_summary,
+]
+
+
+def fit_to_budget(
+    context: PipelineInput,
+    build: Callable[[PipelineInput], Messages],
+    budget: int,
+    step_name: str = "LLM",
+) -> PipelineInput:
+    """
+    Context whose prompt, as built by build(context), fits budget tokens
+    (0 disables). If trimming every section is not enough, the smallest
+    context reached is returned and a warning logged.
+    """
+    if budget <= 0:
+        return context
+    total = estimate_messages(build(context))
+    if total <= budget:
+        return context
+
+    logger.warning(f"{step_name}: prompt ~{total} tokens exceeds budget {budget}, trimming (sections: {section_tokens(context)})")
+    for trim in TRIMMERS:
+        while total > budget:
+            trimmed = trim(context)
+            if trimmed is None:
+                break
+            context = trimmed
+            total = estimate_messages(build(context))
+        if total <= budget:
+            break
+
+    if total > budget:
+        logger.warning(f"{step_name}: prompt still ~{total} tokens after trimming every section")
+    return context
@@ -0,0 +1,191 @@
+"""
+Prompt Store.
+Serves prompt text from outside the code, so prompt iterations ship without
+redeploying the worker. A store returns a PromptBundle: a version plus
+replacement text for registered templates (llm.prompt_templates.TEMPLATES,
+keyed by name, e.g. "mouth_system" or "mouth_stage_pricing"). Templates the
+bundle leaves out use their built-in text.
+
+reload_prompts() validates a new bundle against every template's declared
+fields before swapping any text in; a bad edit is logged and the current
+prompts stay live. maybe_reload_prompts() (called at the start of each
+pipeline run) checks the store every LLMConfig.prompt_reload_seconds.
+
+use_bundle() applies a bundle to the runs inside a block only, e.g. to shadow
+a candidate version while production keeps the active one.
+
+Usage:
+    set_prompt_store(FilePromptStore("/etc/htl/prompts.json"))
+    reload_prompts()  # -> "2024-06-01"
+"""
+import hashlib
+import json
+import logging
+import threading
+import time
+from abc import ABC, abstractmethod
+from contextlib import contextmanager
+from contextvars import ContextVar
+from typing import Dict, Iterator, Optional
+
+from pydantic import BaseModel, Field
+
+from llm.config import llm_config
+from llm.prompt_templates import TEMPLATES, PromptTemplate, PromptTemplateError, override_texts
+
+logger = logging.getLogger(__name__)
+
+BUILTIN_VERSION = "builtin"
+
+# Text shipped with the code, restored for templates a bundle does not override
+_BUILTIN_TEXT: Dict[str, str] = {name: template.text for name, template in TEMPLATES.items()}
+
+
+class PromptBundle(BaseModel):
+    """One published version of the prompts."""
+    version: str
+    prompts: Dict[str, str] = Field(default_factory=dict)  # Template name -> text
+
+
+class PromptStore(ABC):
+    """Where published prompt bundles come from (file, internal API, ...)."""
+
+    @abstractmethod
+    def load(self) -> Optional[PromptBundle]:
+        """The active bundle, or None to use the built-in prompts."""
+        raise NotImplementedError
+
+
+class FilePromptStore(PromptStore):
+    """
+    A JSON file: {"version": "2024-06-01", "prompts": {"mouth_system": "..."}}.
+    Without a version, one is derived from the content, so any edit is picked up.
+    A missing file means the built-in prompts.
+    """
+
+    def __init__(self, path: str) -> None:
+        self.path = path
+
+    def load(self) -> Optional[PromptBundle]:
+        try:
+            with open(self.path) as f:
+                raw = f.read()
+        except FileNotFoundError:
+            return None
+        data = json.loads(raw)
+        version = data.get("version") or hashlib.sha256(raw.encode()).hexdigest()[:12]
+        return PromptBundle(version=str(version), prompts=data.get("prompts") or {})
+
+
+def bundle_texts(bundle: Optional[PromptBundle]) -> Dict[str, str]:
+    """
+    Every template's text under the bundle (built-in where it has none).
+    Raises PromptTemplateError if any template is unknown or invalid.
+    """
+    prompts = bundle.prompts if bundle else {}
+    errors = [f"{name}: unknown template" for name in prompts if name not in TEMPLATES]
+    texts = {name: prompts.get(name, _BUILTIN_TEXT[name]) for name in TEMPLATES}
+    for name, template in TEMPLATES.items():
+        try:
+            PromptTemplate(name, texts[name], template.fields).validate()
+        except PromptTemplateError as e:
+            errors.append(str(e))
+    if errors:
+        raise PromptTemplateError("Invalid prompt bundle:\n" + "\n".join(errors))
+    return texts
+
+
+def apply_bundle(bundle: Optional[PromptBundle]) -> None:
+    """
+    Swap every template to the bundle's text (built-in where it has none).
+    Raises PromptTemplateError, changing nothing, if any template is unknown or invalid.
+    """
+    texts = bundle_texts(bundle)
+    for name, template in TEMPLATES.items():
+        template.text = texts[name]
+
+
+_store: Optional[PromptStore] = None
+_active_version = BUILTIN_VERSION
+_last_check = 0.0
+_reload_lock = threading.Lock()
+# Version of the bundle use_bundle() applied in the current context, if any
+_bundle_version: ContextVar[Optional[str]] = ContextVar("prompt_bundle_version", default=None)
+
+
+@contextmanager
+def use_bundle(bundle: PromptBundle) -> Iterator[None]:
+    """
+    Run the block on the bundle's prompts; other runs keep the active ones, and
+    pipeline results inside report the bundle's version. Raises
+    PromptTemplateError before the block if the bundle is invalid.
+    """
+    texts = bundle_texts(bundle)
+    token = _bundle_version.set(bundle.version)
+    try:
+        with override_texts(texts):
+            yield
+    finally:
+        _bundle_version.reset(token)
+
+
+def set_prompt_store(store: Optional[PromptStore]) -> None:
+    """Install a store (e.g. the worker's internal-API store); None falls back to LLM_PROMPT_STORE."""
+    global _store, _last_check
+    with _reload_lock:
+        _store = store
+        _last_check = 0.0
+
+
+def get_prompt_store() -> Optional[PromptStore]:
+    """The installed store, else the file store when LLM_PROMPT_STORE=file, else None."""
+    if _store is not None:
+        return _store
+    if llm_config.prompt_store_backend == "file" and llm_config.prompt_store_path:
+        return FilePromptStore(llm_config.prompt_store_path)
+    return None
+
+
+def active_prompt_version() -> str:
+    """Version of the prompts currently in use (BUILTIN_VERSION without a store)."""
+    return _active_version
+
+
+def reload_prompts() -> str:
+    """
+    Load the store's bundle and apply it if its version differs from the active one.
+    Store failures and invalid bundles are logged and the current prompts kept.
+    Returns the active version.
+    """
+    global _active_version, _last_check
+    store = get_prompt_store()
+    with _reload_lock:
+        _last_check = time.monotonic()
+        if store is None:
+            return _active_version
+        try:
+            bundle = store.load()
+        except Exception as e:
+            logger.error(f"Prompt store load failed, keeping prompts {_active_version}: {e}")
+            return _active_version
+        version = bundle.version if bundle else BUILTIN_VERSION
+        if version == _active_version:
+            return _active_version
+        try:
+            apply_bundle(bundle)
+        except PromptTemplateError as e:
+            logger.error(f"Rejected prompts {version}, keeping {_active_version}: {e}")
+            return _active_version
+        logger.info(f"Prompts reloaded: {_active_version} -> {version}")
+        _active_version = version
+        return _active_version
+
+
+def maybe_reload_prompts() -> str:
+    """
+    reload_prompts() if LLMConfig.prompt_reload_seconds have passed since the last check.
+    Returns the version this context renders: use_bundle()'s, else the active one.
+    """
+    if time.monotonic() - _last_check >= llm_config.prompt_reload_seconds:
+        reload_prompts()
+    return _bundle_version.get() or _active_version
@@ -0,0 +1,189 @@
+"""
+Prompt Templates.
+Named-field rendering for the templates in llm.prompts. Each template declares
+the fields it expects; rendering with a missing or unknown field raises instead
+of producing a silently wrong prompt, and validate_templates() (run at worker
+startup) checks every template's placeholders against its declared fields.
+override_texts() swaps in other text for one run only (e.g. a shadow run's
+candidate prompts) without touching what concurrent runs render.
+
+Usage:
+    MOUTH_USER.render(business_name=..., rolling_summary=..., ...)
+"""
+import logging
+from contextlib import contextmanager
+from contextvars import ContextVar
+from string import Formatter
+from typing import Any, Dict, FrozenSet, Iterable, Iterator, List
+
+from llm import prompts
+
+logger = logging.getLogger(__name__)
+
+# Template name -> text rendered instead of template.text in the current context
+_text_overrides: ContextVar[Dict[str, str]] = ContextVar("prompt_text_overrides", default={})
+
+
+class PromptTemplateError(ValueError):
+    """A template does not match its declared fields, or was rendered with the wrong ones."""
+
+
+class PromptTemplate:
+    """A str.format template with a declared, checked set of named fields."""
+
+    def __init__(self, name: str, text: str, fields: Iterable[str]) -> None:
+        self.name = name
+        self.text = text
+        self.fields: FrozenSet[str] = frozenset(fields)
+
+    def placeholders(self) -> FrozenSet[str]:
+        """Field names used in the text. Raises PromptTemplateError on malformed braces or positional fields."""
+        try:
+            names = {field for _, field, _, _ in Formatter().parse(self.text) if field is not None}
+        except ValueError as e:
+            raise PromptTemplateError(f"{self.name}: {e}") from e
+        # "{user.name}" or "{items[0]}" reference the field before the accessor
+        names = {name.split(".")[0].split("[")[0] for name in names}
+        if "" in names or any(name.isdigit() for name in names):
+            raise PromptTemplateError(f"{self.name}: positional placeholders are not allowed")
+        return frozenset(names)
+
+    def validate(self) -> None:
+        placeholders = self.placeholders()
+        if placeholders != self.fields:
+            raise PromptTemplateError(
+                f"{self.name}: undeclared placeholders {sorted(placeholders - self.fields)}, "
+                f"unused fields {sorted(self.fields - placeholders)}"
+            )
+
+    def render(self, **values: Any) -> str:
+        missing = self.fields - values.keys()
+        unknown = values.keys() - self.fields
+        if missing or unknown:
+            raise PromptTemplateError(
+                f"{self.name}: missing fields {sorted(missing)}, unknown fields {sorted(unknown)}"
+            )
+        return _text_overrides.get().get(self.name, self.text).format(**values)
+
+    def __repr__(self) -> str:
+        return f"PromptTemplate({self.name!r}, fields={sorted(self.fields)})"
+
+
+BRAIN_SYSTEM = PromptTemplate("brain_system", prompts.BRAIN_SYSTEM_PROMPT, ["flow_prompt"])
+BRAIN_USER = PromptTemplate("brain_user", prompts.BRAIN_USER_TEMPLATE, [
+    "history_section", "available_ctas", "conversation_stage", "conversation_mode",
+    "intent_level", "user_sentiment", "active_cta_id", "now_local",
+    "whatsapp_window_open", "followup_count_24h",
+])
+BRAIN_USER_HISTORY = PromptTemplate(
+    "brain_user_history", prompts.BRAIN_USER_HISTORY_TEMPLATE, ["last_messages", "rolling_summary"]
+)
+
+MOUTH_SYSTEM = PromptTemplate("mouth_system", prompts.MOUTH_SYSTEM_PROMPT, [
+    "persona", "business_name", "business_description", "flow_prompt",
+    "tone", "style", "language_style", "forbidden_topics", "max_words",
+])
+MOUTH_DEFAULT_PERSONA = PromptTemplate("mouth_default_persona", prompts.MOUTH_DEFAULT_PERSONA, ["business_name"])
+MOUTH_FORBIDDEN_TOPICS = PromptTemplate(
+    "mouth_forbidden_topics", prompts.MOUTH_FORBIDDEN_TOPICS_PROMPT, ["forbidden_topics"]
+)
+MOUTH_EXAMPLES = PromptTemplate("mouth_examples", prompts.MOUTH_EXAMPLES_PROMPT, ["examples"])
+MOUTH_USER = PromptTemplate("mouth_user", prompts.MOUTH_USER_TEMPLATE, [
+    "business_name", "rolling_summary", "lead_profile", "last_messages",
+    "available_ctas", "decision_json", "conversation_stage",
+])
+MOUTH_TEMPLATE_SYSTEM = PromptTemplate(
+    "mouth_template_system", prompts.MOUTH_TEMPLATE_SYSTEM_PROMPT, ["business_name", "templates"]
+)
+MOUTH_CONSTRAINT_REPAIR = PromptTemplate(
+    "mouth_constraint_repair", prompts.MOUTH_CONSTRAINT_REPAIR_PROMPT,
+    ["violations", "max_words", "max_questions"],
+)
+MOUTH_LANGUAGE_REPAIR = PromptTemplate(
+    "mouth_language_repair", prompts.MOUTH_LANGUAGE_REPAIR_PROMPT, ["language", "language_code"]
+)
+MOUTH_GUARDRAIL_REPAIR = PromptTemplate("mouth_guardrail_repair", prompts.MOUTH_GUARDRAIL_REPAIR_PROMPT, ["hits"])
+VALIDATION_REPAIR = PromptTemplate("validation_repair", prompts.VALIDATION_REPAIR_PROMPT, ["problems"])
+MOUTH_CHAT_USER = PromptTemplate("mouth_chat_user", prompts.MOUTH_CHAT_USER_TEMPLATE, [
+    "business_name", "rolling_summary", "lead_profile",
+    "available_ctas", "decision_json", "conversation_stage",
+])
+
+VARIATION_SYSTEM = PromptTemplate("variation_system", prompts.VARIATION_SYSTEM_PROMPT, ["max_words"])
+VARIATION_USER = PromptTemplate(
+    "variation_user", prompts.VARIATION_USER_TEMPLATE, ["previous_messages", "draft"]
+)
+
+VERIFY_SYSTEM = PromptTemplate("verify_system", prompts.VERIFY_SYSTEM_PROMPT, [])
+VERIFY_USER = PromptTemplate("verify_user", prompts.VERIFY_USER_TEMPLATE, ["knowledge", "reply"])
+
+MEMORY_USER = PromptTemplate(
+    "memory_user", prompts.MEMORY_USER_TEMPLATE,
+    ["rolling_summary", "lead_profile", "user_message", "bot_message"],
+)
+MEMORY_BUSINESS_FOCUS = PromptTemplate(
+    "memory_business_focus", prompts.MEMORY_BUSINESS_FOCUS_PROMPT, ["memory_prompt"]
+)
+MEMORY_CUSTOM_FACTS = PromptTemplate("memory_custom_facts", prompts.MEMORY_CUSTOM_FACTS_PROMPT, ["fact_fields"])
+MEMORY_COMPACT_SYSTEM = PromptTemplate(
+    "memory_compact_system", prompts.MEMORY_COMPACT_SYSTEM_PROMPT, ["max_facts", "max_words"]
+)
+MEMORY_COMPACT_USER = PromptTemplate(
+    "memory_compact_user", prompts.MEMORY_COMPACT_USER_TEMPLATE, ["rolling_summary"]
+)
+
+JSON_REPAIR = PromptTemplate("json_repair", prompts.JSON_REPAIR_PROMPT, ["parse_error"])
+
+# Stage rules are templates too (no fields) so the prompt store can replace them
+MOUTH_STAGE_RULES = {
+    stage: PromptTemplate(f"mouth_stage_{stage.value}", text, [])
+    for stage, text in prompts.MOUTH_SYSTEM_STAGE_RULES.items()
+}
+BRAIN_STAGE_RULES = {
+    stage: PromptTemplate(f"brain_stage_{stage.value}", text, [])
+    for stage, text in prompts.BRAIN_SYSTEM_STAGE_RULES.items()
+}
+
+TEMPLATES: Dict[str, PromptTemplate] = {
+    template.name: template
+    for template in (
+        BRAIN_SYSTEM, BRAIN_USER, BRAIN_USER_HISTORY,
+        MOUTH_SYSTEM, MOUTH_DEFAULT_PERSONA, MOUTH_FORBIDDEN_TOPICS, MOUTH_EXAMPLES,
+        MOUTH_USER, MOUTH_CHAT_USER, MOUTH_CONSTRAINT_REPAIR,
+        MOUTH_LANGUAGE_REPAIR, MOUTH_GUARDRAIL_REPAIR, MOUTH_TEMPLATE_SYSTEM,
+        VALIDATION_REPAIR,
+        VARIATION_SYSTEM, VARIATION_USER,
+        VERIFY_SYSTEM, VERIFY_USER,
+        MEMORY_USER, MEMORY_BUSINESS_FOCUS, MEMORY_CUSTOM_FACTS,
+        MEMORY_COMPACT_SYSTEM, MEMORY_COMPACT_USER,
+        JSON_REPAIR,
+        *MOUTH_STAGE_RULES.values(), *BRAIN_STAGE_RULES.values(),
+    )
+}
+
+
+@contextmanager
+def override_texts(texts: Dict[str, str]) -> Iterator[None]:
+    """
+    Render templates with texts (name -> text) inside the block, in this context
+    only. Threads started inside need a copy of it (contextvars.copy_context).
+    Texts are not validated here; see llm.prompt_store.use_bundle.
+    """
+    token = _text_overrides.set(texts)
+    try:
+        yield
+    finally:
+        _text_overrides.reset(token)
+
+
+def validate_templates() -> None:
+    """Check every registered template; raises PromptTemplateError listing all problems."""
+    errors: List[str] = []
+    for template in TEMPLATES.values():
+        try:
+            template.validate()
+        except PromptTemplateError as e:
+            errors.append(str(e))
+    if errors:
+        raise PromptTemplateError("Invalid prompt templates:\n" + "\n".join(errors))
+    logger.info(f"Validated {len(TEMPLATES)} prompt templates")
@@ -1,67 +1,170 @@
 """
 Prompt Registry: Dynamic System Prompts for Router-Agent Architecture.
 This module provides factory functions to assemble prompts from constants in llm.prompts.
+
+Prompts are assembled most-stable first (base + business context, then stage
+rules, then per-turn notes) so provider prompt caches can reuse the prefix.
+Stage guidance lives in per-stage fragments composed at build time, so a prompt
+only carries the rules for the stage it is in; organizations can replace the
+fragment for any stage (PromptOverrides.stage_rules / brain_stage_rules).
 """
 from server.enums import ConversationStage
+from typing import Dict, List, Optional
+from llm.config import llm_config
 from llm.prompts import (
-    MOUTH_SYSTEM_PROMPT,
-    MOUTH_SYSTEM_STAGE_RULES,
-    BRAIN_SYSTEM_PROMPT,
-    BRAIN_SYSTEM_STAGE_RULES
+    MOUTH_DEFAULT_TONE,
+    MOUTH_DEFAULT_STYLE,
+    MOUTH_DEFAULT_LANGUAGE_STYLE,
+    MOUTH_QUICK_REPLIES_PROMPT,
+    MOUTH_EMOJI_RULES,
+    MOUTH_FORMATTING_RULES,
+    MEMORY_SYSTEM_PROMPT,
+)
+from llm.prompt_templates import (
+    BRAIN_SYSTEM,
+    MOUTH_SYSTEM,
+    MOUTH_DEFAULT_PERSONA,
+    MOUTH_FORBIDDEN_TOPICS,
+    MOUTH_EXAMPLES,
+    MOUTH_STAGE_RULES,
+    BRAIN_STAGE_RULES,
+    PromptTemplate,
+    MEMORY_BUSINESS_FOCUS,
+    MEMORY_CUSTOM_FACTS,
 )
+from llm.schemas import PromptOverrides, PromptExample
+
+# Stages where the lead is answering a concrete question, so tappable options help
+MOUTH_QUICK_REPLY_STAGES = frozenset({
+    ConversationStage.GREETING,
+    ConversationStage.QUALIFICATION,
+    ConversationStage.PRICING,
+    ConversationStage.CTA,
+})
 
 # ============================================================
 # Factory Functions
 # ============================================================
 
+def _section(override: Optional[str]) -> str:
+    """An organization's override for a prompt section; blank means use the default."""
+    return (override or "").strip()
+
+
+def _stage_fragment(
+    stage: ConversationStage,
+    defaults: Dict[ConversationStage, PromptTemplate],
+    overrides: Dict[ConversationStage, str],
+    header: str,
+) -> str:
+    """The organization's rules for this stage, else the default ones (Qualification if the stage has none)."""
+    override = _section(overrides.get(stage))
+    if override:
+        return f"\n{header.format(stage=stage.value.upper())}\n{override}\n"
+    return defaults.get(stage, defaults[ConversationStage.QUALIFICATION]).render()
+
+
+def _style_section(overrides: PromptOverrides) -> str:
+    """The style section, with the organization's emoji and formatting rules appended."""
+    rules = [_section(overrides.style) or MOUTH_DEFAULT_STYLE]
+    if overrides.emoji_style:
+        rules.append(MOUTH_EMOJI_RULES[overrides.emoji_style])
+    if overrides.whatsapp_formatting is not None:
+        rules.append(MOUTH_FORMATTING_RULES[overrides.whatsapp_formatting])
+    return "\n".join(rules)
+
+
 def get_mouth_system_prompt(
     stage: ConversationStage, 
     business_name: str, 
     business_description: str = "", 
     flow_prompt: str = "", 
-    max_words: int = 80
+    max_words: int = 80,
+    overrides: Optional[PromptOverrides] = None,
+    examples: Optional[List[PromptExample]] = None,
 ) -> str:
     """
     Dynamically build the system prompt for Step 2 (Mouth).
-    Enriched with business context (The Mouth).
+    Enriched with business context (The Mouth). Organization overrides replace
+    the persona, tone, style and language sections and the rules of any stage;
+    unset ones use the defaults.
     """
+    overrides = overrides or PromptOverrides()
+    forbidden_topics = [topic.strip() for topic in overrides.forbidden_topics if topic.strip()]
+
     # 1. Base instructions (Identity & Persona)
-    base = MOUTH_SYSTEM_PROMPT.format(
+    base = MOUTH_SYSTEM.render(
+        persona=_section(overrides.persona) or MOUTH_DEFAULT_PERSONA.render(business_name=business_name),
         business_name=business_name, 
         business_description=business_description,
         flow_prompt=flow_prompt,
+        tone=_section(overrides.tone) or MOUTH_DEFAULT_TONE,
+        style=_style_section(overrides),
+        language_style=_section(overrides.language_style) or MOUTH_DEFAULT_LANGUAGE_STYLE,
+        forbidden_topics=MOUTH_FORBIDDEN_TOPICS.render(
+            forbidden_topics="\n".join(f"  - {topic}" for topic in forbidden_topics)
+        ) if forbidden_topics else "",
         max_words=max_words
     )
     
     # 2. Stage-specific instructions (The Mouth)
-    # Fallback to Qualification if stage missing
-    instruction_template = MOUTH_SYSTEM_STAGE_RULES.get(
-        stage, 
-        MOUTH_SYSTEM_STAGE_RULES[ConversationStage.QUALIFICATION]
+    stage_rules = _stage_fragment(
+        stage, MOUTH_STAGE_RULES, overrides.stage_rules, "=== CURRENT STAGE: {stage} ==="
     )
-    
-    return f"{base}\n\n{instruction_template}"
+    prompt = f"{base}\n\n{stage_rules}"
+    if stage in MOUTH_QUICK_REPLY_STAGES:
+        prompt += MOUTH_QUICK_REPLIES_PROMPT
+
+    # 3. Organization examples (stage-dependent, so after the stage rules)
+    selected = select_examples(examples or [], stage)
+    if selected:
+        prompt += MOUTH_EXAMPLES.render(examples=format_examples(selected))
+    return prompt
+
+
+def select_examples(
+    examples: List[PromptExample],
+    stage: ConversationStage,
+    limit: Optional[int] = None,
+) -> List[PromptExample]:
+    """Examples for this stage first, then stage-agnostic ones, up to LLMConfig.mouth_max_examples."""
+    limit = llm_config.mouth_max_examples if limit is None else limit
+    usable = [example for example in examples if example.turns]
+    matching = [example for example in usable if example.stage == stage]
+    general = [example for example in usable if example.stage is None]
+    return (matching + general)[:limit]
+
+
+def format_examples(examples: List[PromptExample]) -> str:
+    blocks = []
+    for index, example in enumerate(examples, start=1):
+        header = f"--- Example {index}" + (f": {example.title}" if example.title else "") + " ---"
+        lines = [f"{'Lead' if turn.sender == 'lead' else 'You'}: {turn.text}" for turn in example.turns]
+        blocks.append("\n".join([header] + lines))
+    return "\n\n".join(blocks)
 
 
 def get_brain_system_prompt(
     stage: ConversationStage, 
     is_opening: bool = False, 
-    flow_prompt: str = ""
+    flow_prompt: str = "",
+    overrides: Optional[PromptOverrides] = None,
 ) -> str:
     """
     Build the system prompt for Step 1 (Brain).
     Enforces stage-based isolation to eliminate context pollution (The Brain).
+    Organizations can replace the transition rules of any stage (brain_stage_rules).
     """
+    overrides = overrides or PromptOverrides()
     # 1. Base instructions (Strategy Rules)
-    base = BRAIN_SYSTEM_PROMPT.format(flow_prompt=flow_prompt)
+    base = BRAIN_SYSTEM.render(flow_prompt=flow_prompt)
     
     # 2. Stage-specific rules (The Router)
     # If opening message, force GREETING instructions regardless of input stage
     target_stage = ConversationStage.GREETING if is_opening else stage
     
-    stage_rules = BRAIN_SYSTEM_STAGE_RULES.get(
-        target_stage, 
-        BRAIN_SYSTEM_STAGE_RULES[ConversationStage.QUALIFICATION]
+    stage_rules = _stage_fragment(
+        target_stage, BRAIN_STAGE_RULES, overrides.brain_stage_rules, "EVALUATING STAGE: {stage}"
     )
     
     # 3. Combine
@@ -71,3 +174,20 @@ def get_brain_system_prompt(
     if is_opening:
         prompt += "\nATTENTION: This is an OPENING message from a new lead. Do not reference any prior history."
     return prompt
+
+
+def get_memory_system_prompt(
+    memory_prompt: str = "",
+    fact_fields: Optional[List[str]] = None,
+) -> str:
+    """
+    Build the system prompt for Step 3 (Memory).
+    Organizations can steer what the summary emphasizes and add fact fields;
+    the default prompt (and its JSON contract) stays in place underneath.
+    """
+    prompt = MEMORY_SYSTEM_PROMPT
+    if memory_prompt.strip():
+        prompt += MEMORY_BUSINESS_FOCUS.render(memory_prompt=memory_prompt.strip())
+    if fact_fields:
+        prompt += MEMORY_CUSTOM_FACTS.render(fact_fields="\n".join(f"- {field}" for field in fact_fields))
+    return prompt
@@ -0,0 +1,97 @@
+"""
+LLM Provider Registry.
+Resolves provider names from config ("groq", "openai", "anthropic", "gemini",
+"ollama") to lazily-constructed, shared adapter instances.
+"""
+import logging
+import threading
+from typing import Callable, Dict, Iterable, List, Optional, Set, Tuple
+
+from llm.config import STEP_SAMPLING_DEFAULTS, llm_config
+from llm.providers.base import Provider, ChatRequest, ChatResponse, ToolCall, function_tool
+from llm.providers.openai_compat import OpenAICompatibleProvider
+from llm.providers.anthropic import AnthropicProvider
+from llm.providers.gemini import GeminiProvider
+from llm.providers.ollama import OllamaProvider
+
+GROQ_BASE_URL = "https://api.groq.com/openai/v1"
+
+_FACTORIES: Dict[str, Callable[[], Provider]] = {
+    "groq": lambda: OpenAICompatibleProvider(
+        "groq", llm_config.api_key, llm_config.base_url or GROQ_BASE_URL
+    ),
+    "openai": lambda: OpenAICompatibleProvider(
+        "openai", llm_config.openai_api_key, llm_config.openai_base_url
+    ),
+    "anthropic": lambda: AnthropicProvider(
+        llm_config.anthropic_api_key, llm_config.anthropic_base_url
+    ),
+    "gemini": lambda: GeminiProvider(
+        llm_config.google_api_key, llm_config.gemini_base_url
+    ),
+    "ollama": lambda: OllamaProvider(llm_config.ollama_base_url),
+}
+
+logger = logging.getLogger(__name__)
+
+_instances: Dict[str, Provider] = {}
+_lock = threading.Lock()
+
+
+def register_provider(name: str, factory: Callable[[], Provider]) -> None:
+    """Register (or replace) a provider factory under a config name."""
+    with _lock:
+        _FACTORIES[name] = factory
+        _instances.pop(name, None)
+
+
+def get_provider(name: str) -> Provider:
+    """Return the shared provider instance for a config name."""
+    with _lock:
+        if name not in _instances:
+            factory = _FACTORIES.get(name)
+            if factory is None:
+                raise ValueError(f"Unknown LLM provider: {name!r} (known: {sorted(_FACTORIES)})")
+            _instances[name] = factory()
+        return _instances[name]
+
+
+# Providers serving models that must be installed locally before use
+SELF_HOSTED_PROVIDERS = {"ollama"}
+
+
+def _models_for(step_name: str) -> List[Tuple[str, Optional[str]]]:
+    """(provider, model) pairs a step can call: its own, its fallbacks and, in shadow mode, the shadow model."""
+    provider_name, model = llm_config.provider_for(step_name), llm_config.model_for(step_name)
+    models = [(provider_name, model)] + llm_config.fallbacks_for(step_name)
+    if llm_config.shadow_mode == "compare":
+        models.append((llm_config.shadow_provider or provider_name, llm_config.shadow_model or model))
+    return models
+
+
+def verify_configured_models(step_names: Iterable[str] = tuple(STEP_SAMPLING_DEFAULTS)) -> None:
+    """
+    Startup check: every model the steps can call on a self-hosted provider,
+    fallbacks included, must be available. Raises ModelNotAvailableError on the
+    first missing one.
+    """
+    checked: Set[Tuple[str, str]] = set()
+    for step_name in step_names:
+        for provider_name, model in _models_for(step_name):
+            if provider_name not in SELF_HOSTED_PROVIDERS or not model or (provider_name, model) in checked:
+                continue
+            get_provider(provider_name).ensure_model_available(model)
+            checked.add((provider_name, model))
+            logger.info(f"{step_name}: model {provider_name}/{model} is available")
+
+
+__all__ = [
+    "Provider",
+    "ChatRequest",
+    "ChatResponse",
+    "ToolCall",
+    "function_tool",
+    "register_provider",
+    "get_provider",
+    "verify_configured_models",
+]
@@ -0,0 +1,258 @@
+"""
+Anthropic provider (native Messages API).
+"""
+import json
+from typing import Any, Dict, Iterator, List, Optional, Union
+
+import httpx
+
+from llm.http_client import get_http_client
+from llm.errors import LLMError, ProviderUnavailableError, error_from_status
+from llm.providers.base import (
+    Provider, ChatRequest, ChatResponse, StreamChunk, ToolCall,
+    split_system_messages, iter_sse_events, raise_for_http_error, forced_tool_name, tracing_headers,
+    BATCH_PENDING, BATCH_COMPLETED, BATCH_FAILED,
+)
+from llm.schemas import TokenUsage
+
+ANTHROPIC_VERSION = "2023-06-01"
+DEFAULT_MAX_TOKENS = 1024  # Messages API requires max_tokens
+CACHE_CONTROL = {"type": "ephemeral"}
+# Error types in batch results (which carry no HTTP status) -> the status the API would return
+ERROR_TYPE_STATUS = {
+    "invalid_request_error": 400,
+    "authentication_error": 401,
+    "permission_error": 403,
+    "not_found_error": 404,
+    "request_too_large": 413,
+    "rate_limit_error": 429,
+    "api_error": 500,
+    "overloaded_error": 529,
+}
+
+
+class AnthropicProvider(Provider):
+    """Adapter for Anthropic's /v1/messages endpoint."""
+
+    name = "anthropic"
+    supports_prefill = True
+
+    def __init__(
+        self,
+        api_key: Optional[str],
+        base_url: str = "https://api.anthropic.com",
+        http_client: Optional[httpx.Client] = None,
+    ) -> None:
+        self.url = f"{base_url.rstrip('/')}/v1/messages"
+        self.headers = {
+            "x-api-key": api_key or "",
+            "anthropic-version": ANTHROPIC_VERSION,
+            "content-type": "application/json",
+        }
+        self.client = http_client or get_http_client()
+
+    def _build_body(self, request: ChatRequest) -> Dict[str, Any]:
+        system_prompt, turns = split_system_messages(request.messages)
+        body: Dict[str, Any] = {
+            "model": request.model,
+            "messages": [
+                {"role": message["role"], "content": message["content"]}
+                for message in turns
+            ],
+            "temperature": request.temperature,
+            "max_tokens": request.max_tokens or DEFAULT_MAX_TOKENS,
+        }
+        if system_prompt:
+            body["system"] = system_prompt
+        # No native JSON mode; the prompts already demand strict JSON output.
+
+        if request.cache_prompt:
+            # Breakpoints: the system prompt (business context + stage rules), and the
+            # history before the final turn, which repeats verbatim on the next call
+            if system_prompt:
+                body["system"] = [{"type": "text", "text": system_prompt, "cache_control": CACHE_CONTROL}]
+            if len(body["messages"]) > 1:
+                prefix_end = body["messages"][-2]
+                prefix_end["content"] = [{"type": "text", "text": prefix_end["content"], "cache_control": CACHE_CONTROL}]
+
+        if request.tools and request.tool_choice != "none":
+            body["tools"] = [
+                {
+                    "name": tool["function"]["name"],
+                    "description": tool["function"].get("description", ""),
+                    "input_schema": tool["function"].get("parameters") or {"type": "object", "properties": {}},
+                }
+                for tool in request.tools
+            ]
+            forced = forced_tool_name(request.tool_choice)
+            if forced:
+                body["tool_choice"] = {"type": "tool", "name": forced}
+            elif request.tool_choice == "required":
+                body["tool_choice"] = {"type": "any"}
+
+        prefill = _prefill(request)
+        if prefill:
+            # After the cache breakpoint, which must stay on the last turn of the shared prefix
+            body["messages"].append({"role": "assistant", "content": prefill})
+        return body
+
+    def chat(self, request: ChatRequest) -> ChatResponse:
+        kwargs = {}
+        if request.timeout is not None:
+            kwargs["timeout"] = request.timeout
+
+        try:
+            response = self.client.post(
+                self.url,
+                headers={**self.headers, **tracing_headers(request)},
+                json=self._build_body(request),
+                **kwargs,
+            )
+        except httpx.TransportError as e:
+            raise ProviderUnavailableError(f"{self.name} unreachable: {e}", provider=self.name) from e
+        raise_for_http_error(response, self.name)
+        return _to_chat_response(response.json(), prefill=_prefill(request))
+
+    def _send(self, method: str, url: str, **kwargs: Any) -> httpx.Response:
+        try:
+            response = self.client.request(method, url, headers=self.headers, **kwargs)
+        except httpx.TransportError as e:
+            raise ProviderUnavailableError(f"{self.name} unreachable: {e}", provider=self.name) from e
+        raise_for_http_error(response, self.name)
+        return response
+
+    def submit_batch(self, requests: Dict[str, ChatRequest]) -> str:
+        body = {
+            "requests": [
+                # Results come back without their request, so there is no prefill to rejoin
+                {"custom_id": custom_id, "params": self._build_body(request.model_copy(update={"prefill": None}))}
+                for custom_id, request in requests.items()
+            ]
+        }
+        return self._send("POST", f"{self.url}/batches", json=body).json()["id"]
+
+    def batch_status(self, batch_id: str) -> str:
+        payload = self._send("GET", f"{self.url}/batches/{batch_id}").json()
+        status = payload.get("processing_status")
+        if status == "canceling":
+            return BATCH_FAILED
+        if status == "ended":
+            # A batch canceled or expired before any request ran also ends
+            if not (payload.get("request_counts") or {}).get("succeeded"):
+                return BATCH_FAILED
+            return BATCH_COMPLETED
+        return BATCH_PENDING
+
+    def batch_results(self, batch_id: str) -> Dict[str, Union[ChatResponse, LLMError]]:
+        results_url = self._send("GET", f"{self.url}/batches/{batch_id}").json().get("results_url")
+        if not results_url:
+            raise LLMError(f"{self.name} batch {batch_id} has no results yet", provider=self.name)
+
+        results: Dict[str, Union[ChatResponse, LLMError]] = {}
+        for line in self._send("GET", results_url).text.splitlines():
+            if not line.strip():
+                continue
+            item = json.loads(line)
+            result = item.get("result") or {}
+            result_type = result.get("type")
+            if result_type == "succeeded":
+                results[item["custom_id"]] = _to_chat_response(result.get("message") or {})
+            elif result_type == "errored":
+                error = (result.get("error") or {}).get("error") or {}
+                results[item["custom_id"]] = error_from_status(
+                    ERROR_TYPE_STATUS.get(error.get("type"), 500),
+                    error.get("message", "batch request failed"),
+                    self.name,
+                    body=line,
+                )
+            else:
+                # canceled / expired: never ran, so it can be submitted again
+                results[item["custom_id"]] = ProviderUnavailableError(
+                    f"{self.name} batch request {result_type or 'missing a result'}",
+                    provider=self.name,
+                    body=line,
+                )
+        return results
+
+    def stream(self, request: ChatRequest) -> Iterator[StreamChunk]:
+        body = self._build_body(request)
+        body["stream"] = True
+        kwargs = {"headers": {**self.headers, **tracing_headers(request)}}
+        if request.timeout is not None:
+            kwargs["timeout"] = request.timeout
+
+        prefill = _prefill(request)
+        if prefill:
+            yield StreamChunk(delta=prefill, model=request.model)
+        try:
+            yield from self._iter_stream(body, request.model, kwargs)
+        except httpx.TransportError as e:
+            raise ProviderUnavailableError(f"{self.name} unreachable: {e}", provider=self.name) from e
+
+    def _iter_stream(self, body: Dict[str, Any], model: str, kwargs: Dict[str, Any]) -> Iterator[StreamChunk]:
+        input_usage: Dict[str, Any] = {}
+        with self.client.stream("POST", self.url, json=body, **kwargs) as response:
+            raise_for_http_error(response, self.name)
+            for event in iter_sse_events(response.iter_lines()):
+                event_type = event.get("type")
+                if event_type == "message_start":
+                    message = event.get("message") or {}
+                    model = message.get("model") or model
+                    input_usage = message.get("usage") or {}
+                elif event_type == "content_block_delta":
+                    delta = event.get("delta") or {}
+                    if delta.get("type") == "text_delta":
+                        yield StreamChunk(delta=delta.get("text", ""), model=model)
+                elif event_type == "message_delta":
+                    output_usage = {"output_tokens": (event.get("usage") or {}).get("output_tokens", 0)}
+                    yield StreamChunk(
+                        usage=_parse_usage({**input_usage, **output_usage}),
+                        finish_reason=(event.get("delta") or {}).get("stop_reason"),
+                        model=model,
+                    )
+
+
+def _prefill(request: ChatRequest) -> str:
+    """
+    The assistant prefill to send, or "". The API rejects a final assistant turn
+    ending in whitespace, and a prefilled turn can't also open with a tool call.
+    """
+    if not request.prefill or (request.tools and request.tool_choice != "none"):
+        return ""
+    return request.prefill.rstrip()
+
+
+def _to_chat_response(payload: Dict[str, Any], prefill: str = "") -> ChatResponse:
+    """Decode a Messages API message (text and tool_use blocks), rejoined with the prefill it continues."""
+    blocks: List[Dict[str, Any]] = payload.get("content") or []
+    text = prefill + "".join(block.get("text", "") for block in blocks if block.get("type") == "text")
+    tool_calls = [
+        ToolCall(id=block.get("id"), name=block.get("name", ""), arguments=block.get("input") or {})
+        for block in blocks
+        if block.get("type") == "tool_use"
+    ]
+
+    return ChatResponse(
+        content=text,
+        usage=_parse_usage(payload.get("usage") or {}),
+        model=payload.get("model"),
+        finish_reason=payload.get("stop_reason"),
+        tool_calls=tool_calls,
+    )
+
+
+def _parse_usage(usage: Dict[str, Any]) -> TokenUsage:
+    """
+    Decode a Messages API usage block. input_tokens excludes cached tokens,
+    so cache reads and writes are added back into prompt_tokens.
+    """
+    cache_read = usage.get("cache_read_input_tokens", 0) or 0
+    cache_write = usage.get("cache_creation_input_tokens", 0) or 0
+    prompt_tokens = (usage.get("input_tokens", 0) or 0) + cache_read + cache_write
+    completion_tokens = usage.get("output_tokens", 0) or 0
+    return TokenUsage(
+        prompt_tokens=prompt_tokens,
+        completion_tokens=completion_tokens,
+        total_tokens=prompt_tokens + completion_tokens,
+        cached_tokens=cache_read,
+    )
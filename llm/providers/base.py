@@ -0,0 +1,219 @@
+"""
+Provider interface for LLM backends.
+Each adapter translates a ChatRequest into its vendor's wire format and back.
+"""
+import json
+from abc import ABC, abstractmethod
+from typing import Any, Dict, Iterator, List, Optional, Union
+
+import httpx
+from pydantic import BaseModel
+
+from llm.errors import LLMError, error_from_status, parse_retry_after
+from llm.schemas import TokenUsage
+
+
+class ChatRequest(BaseModel):
+    """Vendor-neutral chat completion request."""
+    model: str
+    messages: List[Dict[str, Any]]
+    temperature: float = 0.7
+    max_tokens: Optional[int] = None
+    response_format: Optional[Dict[str, Any]] = None
+    timeout: Optional[float] = None  # seconds, per HTTP request
+    # Ask providers with explicit prompt caching (Anthropic) to cache the system prompt
+    # and conversation prefix. OpenAI, Groq and Gemini cache shared prefixes automatically.
+    cache_prompt: bool = False
+
+    # Tracing: request_id is shared by every call of a pipeline run; idempotency_key
+    # is stable across retries of the same call so providers can de-duplicate them
+    request_id: Optional[str] = None
+    idempotency_key: Optional[str] = None
+
+    # Tool calling, in OpenAI format:
+    #   tools=[{"type": "function", "function": {"name", "description", "parameters"}}]
+    #   tool_choice="auto" | "none" | "required" | {"type": "function", "function": {"name": ...}}
+    tools: Optional[List[Dict[str, Any]]] = None
+    tool_choice: Optional[Union[str, Dict[str, Any]]] = None
+
+    # Text the assistant turn is seeded with (e.g. '{"thought_process":') so the model
+    # continues it instead of starting with chatter. Only providers with supports_prefill
+    # send it; their ChatResponse.content includes it, so callers always see the full text.
+    prefill: Optional[str] = None
+
+
+class ToolCall(BaseModel):
+    """A function call requested by the model."""
+    id: Optional[str] = None
+    name: str
+    arguments: Dict[str, Any] = {}
+
+
+# Vendor-neutral batch job states
+BATCH_PENDING = "pending"
+BATCH_COMPLETED = "completed"
+BATCH_FAILED = "failed"
+
+# finish_reason values meaning the output hit the max_tokens limit (OpenAI, Anthropic, Gemini)
+TRUNCATION_FINISH_REASONS = {"length", "max_tokens", "MAX_TOKENS"}
+
+
+class ChatResponse(BaseModel):
+    """Vendor-neutral chat completion response."""
+    content: str = ""
+    usage: TokenUsage = TokenUsage()
+    model: Optional[str] = None
+    finish_reason: Optional[str] = None  # Vendor value, passed through unchanged
+    tool_calls: List[ToolCall] = []
+
+    @property
+    def truncated(self) -> bool:
+        return self.finish_reason in TRUNCATION_FINISH_REASONS
+
+
+class StreamChunk(BaseModel):
+    """One increment of a streamed completion."""
+    delta: str = ""
+    usage: Optional[TokenUsage] = None       # Usually only on the final chunk
+    finish_reason: Optional[str] = None
+    model: Optional[str] = None
+
+
+class Provider(ABC):
+    """A chat-completion backend (Groq, OpenAI, Anthropic, Gemini, ...)."""
+
+    name: str = "provider"
+    # Whether the vendor continues a trailing assistant message (see ChatRequest.prefill)
+    supports_prefill: bool = False
+
+    @abstractmethod
+    def chat(self, request: ChatRequest) -> ChatResponse:
+        """Run a single chat completion. Raises on transport or HTTP failure."""
+        raise NotImplementedError
+
+    def stream(self, request: ChatRequest) -> Iterator[StreamChunk]:
+        """Run a chat completion, yielding text as it is generated."""
+        raise NotImplementedError(f"Provider '{self.name}' does not support streaming")
+
+    # Asynchronous batch API (discounted, results within 24h). See llm.batch.
+
+    def submit_batch(self, requests: Dict[str, ChatRequest]) -> str:
+        """Submit requests keyed by custom ID. Returns the vendor batch ID."""
+        raise NotImplementedError(f"Provider '{self.name}' does not support batch completions")
+
+    def batch_status(self, batch_id: str) -> str:
+        """BATCH_PENDING, BATCH_COMPLETED or BATCH_FAILED."""
+        raise NotImplementedError(f"Provider '{self.name}' does not support batch completions")
+
+    def batch_results(self, batch_id: str) -> Dict[str, Union[ChatResponse, LLMError]]:
+        """Per custom ID: the response, or the error that request failed with."""
+        raise NotImplementedError(f"Provider '{self.name}' does not support batch completions")
+
+
+def split_system_messages(messages: List[Dict[str, Any]]) -> "tuple[str, List[Dict[str, Any]]]":
+    """
+    Separate system messages from the conversation turns.
+    Needed by vendors that take the system prompt as a top-level field.
+    """
+    system_parts = []
+    turns = []
+    for message in messages:
+        if message.get("role") == "system":
+            system_parts.append(message.get("content", ""))
+        else:
+            turns.append(message)
+    return "\n\n".join(system_parts), turns
+
+
+def function_tool(name: str, description: str, parameters: Dict[str, Any]) -> Dict[str, Any]:
+    """Build an OpenAI-format tool definition from a JSON schema."""
+    return {
+        "type": "function",
+        "function": {"name": name, "description": description, "parameters": parameters},
+    }
+
+
+def forced_tool_name(tool_choice: Optional[Union[str, Dict[str, Any]]]) -> Optional[str]:
+    """Name of the function a tool_choice forces, if it forces a specific one."""
+    if isinstance(tool_choice, dict):
+        return (tool_choice.get("function") or {}).get("name")
+    return None
+
+
+def parse_tool_arguments(raw: Any) -> Dict[str, Any]:
+    """Tool arguments arrive as a JSON string (OpenAI) or an object (Anthropic, Gemini)."""
+    if isinstance(raw, dict):
+        return raw
+    if not raw:
+        return {}
+    try:
+        parsed = json.loads(raw)
+    except (TypeError, json.JSONDecodeError):
+        return {}
+    return parsed if isinstance(parsed, dict) else {}
+
+
+def iter_sse_events(lines: Iterator[str]) -> Iterator[Dict[str, Any]]:
+    """
+    Decode a server-sent events stream into JSON payloads.
+    Multi-line data fields are joined; the OpenAI-style "[DONE]" sentinel ends the stream.
+    """
+    data_lines: List[str] = []
+    for line in lines:
+        if line == "":
+            if data_lines:
+                data = "\n".join(data_lines)
+                data_lines = []
+                if data.strip() == "[DONE]":
+                    return
+                yield json.loads(data)
+            continue
+        if line.startswith(":"):
+            continue  # comment / keep-alive
+        field, _, value = line.partition(":")
+        if field == "data":
+            data_lines.append(value[1:] if value.startswith(" ") else value)
+    if data_lines:
+        data = "\n".join(data_lines)
+        if data.strip() != "[DONE]":
+            yield json.loads(data)
+
+
+def extract_error_message(response: httpx.Response) -> str:
+    """Pull the human-readable message out of a vendor error body."""
+    try:
+        payload = response.json()
+    except ValueError:
+        return response.text[:500]
+    if isinstance(payload, list) and payload:
+        payload = payload[0]
+    error = payload.get("error") if isinstance(payload, dict) else None
+    if isinstance(error, dict):
+        return error.get("message") or json.dumps(error)
+    if isinstance(error, str):
+        return error
+    return response.text[:500]
+
+
+def raise_for_http_error(response: httpx.Response, provider: str) -> None:
+    """Raise the typed LLMError matching a non-2xx response."""
+    if response.status_code < 400:
+        return
+    response.read()  # streamed responses have not loaded the body yet
+    raise error_from_status(
+        response.status_code,
+        extract_error_message(response),
+        provider,
+        body=response.text,
+        retry_after=parse_retry_after(response.headers),
+    )
+
+
+def tracing_headers(request: ChatRequest, idempotency: bool = False) -> Dict[str, str]:
+    """Request-ID (and, where the vendor honours it, Idempotency-Key) headers."""
+    headers = {}
+    if request.request_id:
+        headers["X-Request-ID"] = request.request_id
+    if idempotency and request.idempotency_key:
+        headers["Idempotency-Key"] = request.idempotency_key
+    return headers
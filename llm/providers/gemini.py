@@ -0,0 +1,172 @@
+"""
+Gemini provider (Google Generative Language API).
+"""
+from typing import Any, Dict, Iterator, List, Optional
+
+import httpx
+
+from llm.http_client import get_http_client
+from llm.errors import ProviderUnavailableError
+from llm.providers.base import (
+    Provider, ChatRequest, ChatResponse, StreamChunk, ToolCall,
+    split_system_messages, iter_sse_events, raise_for_http_error, forced_tool_name, tracing_headers,
+)
+from llm.schemas import TokenUsage
+
+# Gemini calls the assistant role "model"
+ROLE_MAP = {"user": "user", "assistant": "model"}
+
+
+class GeminiProvider(Provider):
+    """Adapter for Gemini's generateContent endpoint."""
+
+    name = "gemini"
+
+    def __init__(
+        self,
+        api_key: Optional[str],
+        base_url: str = "https://generativelanguage.googleapis.com/v1beta",
+        http_client: Optional[httpx.Client] = None,
+    ) -> None:
+        self.base_url = base_url.rstrip("/")
+        self.headers = {
+            "x-goog-api-key": api_key or "",
+            "content-type": "application/json",
+        }
+        self.client = http_client or get_http_client()
+
+    def _build_body(self, request: ChatRequest) -> Dict[str, Any]:
+        system_prompt, turns = split_system_messages(request.messages)
+
+        generation_config: Dict[str, Any] = {"temperature": request.temperature}
+        if request.max_tokens:
+            generation_config["maxOutputTokens"] = request.max_tokens
+        if request.response_format:
+            generation_config["responseMimeType"] = "application/json"
+
+        body: Dict[str, Any] = {
+            "contents": [
+                {
+                    "role": ROLE_MAP.get(message["role"], "user"),
+                    "parts": [{"text": message["content"]}],
+                }
+                for message in turns
+            ],
+            "generationConfig": generation_config,
+        }
+        if system_prompt:
+            body["systemInstruction"] = {"parts": [{"text": system_prompt}]}
+
+        if request.tools:
+            body["tools"] = [{
+                "functionDeclarations": [
+                    {
+                        "name": tool["function"]["name"],
+                        "description": tool["function"].get("description", ""),
+                        "parameters": tool["function"].get("parameters") or {"type": "object", "properties": {}},
+                    }
+                    for tool in request.tools
+                ]
+            }]
+            forced = forced_tool_name(request.tool_choice)
+            if forced:
+                body["toolConfig"] = {"functionCallingConfig": {"mode": "ANY", "allowedFunctionNames": [forced]}}
+            elif request.tool_choice in ("required", "none"):
+                mode = "ANY" if request.tool_choice == "required" else "NONE"
+                body["toolConfig"] = {"functionCallingConfig": {"mode": mode}}
+            # JSON mime type cannot be combined with function calling
+            generation_config.pop("responseMimeType", None)
+        return body
+
+    def chat(self, request: ChatRequest) -> ChatResponse:
+        kwargs = {}
+        if request.timeout is not None:
+            kwargs["timeout"] = request.timeout
+
+        try:
+            response = self.client.post(
+                f"{self.base_url}/models/{request.model}:generateContent",
+                headers={**self.headers, **tracing_headers(request)},
+                json=self._build_body(request),
+                **kwargs,
+            )
+        except httpx.TransportError as e:
+            raise ProviderUnavailableError(f"{self.name} unreachable: {e}", provider=self.name) from e
+        raise_for_http_error(response, self.name)
+        payload = response.json()
+
+        text, finish_reason = _parse_candidate(payload)
+        return ChatResponse(
+            content=text,
+            usage=_parse_usage(payload) or TokenUsage(),
+            model=payload.get("modelVersion") or request.model,
+            finish_reason=finish_reason,
+            tool_calls=_parse_tool_calls(payload),
+        )
+
+    def stream(self, request: ChatRequest) -> Iterator[StreamChunk]:
+        kwargs = {}
+        if request.timeout is not None:
+            kwargs["timeout"] = request.timeout
+
+        try:
+            yield from self._iter_stream(request, kwargs)
+        except httpx.TransportError as e:
+            raise ProviderUnavailableError(f"{self.name} unreachable: {e}", provider=self.name) from e
+
+    def _iter_stream(self, request: ChatRequest, kwargs: Dict[str, Any]) -> Iterator[StreamChunk]:
+        with self.client.stream(
+            "POST",
+            f"{self.base_url}/models/{request.model}:streamGenerateContent",
+            params={"alt": "sse"},
+            headers={**self.headers, **tracing_headers(request)},
+            json=self._build_body(request),
+            **kwargs,
+        ) as response:
+            raise_for_http_error(response, self.name)
+            for payload in iter_sse_events(response.iter_lines()):
+                text, finish_reason = _parse_candidate(payload)
+                yield StreamChunk(
+                    delta=text,
+                    usage=_parse_usage(payload),
+                    finish_reason=finish_reason,
+                    model=payload.get("modelVersion") or request.model,
+                )
+
+
+def _parse_candidate(payload: Dict[str, Any]) -> "tuple[str, Optional[str]]":
+    """Text and finish reason of the first candidate."""
+    candidates: List[Dict[str, Any]] = payload.get("candidates") or []
+    if not candidates:
+        return "", None
+    parts = (candidates[0].get("content") or {}).get("parts") or []
+    text = "".join(part.get("text", "") for part in parts)
+    return text, candidates[0].get("finishReason")
+
+
+def _parse_tool_calls(payload: Dict[str, Any]) -> List[ToolCall]:
+    """functionCall parts of the first candidate."""
+    candidates: List[Dict[str, Any]] = payload.get("candidates") or []
+    if not candidates:
+        return []
+    parts = (candidates[0].get("content") or {}).get("parts") or []
+    return [
+        ToolCall(name=part["functionCall"].get("name", ""), arguments=part["functionCall"].get("args") or {})
+        for part in parts
+        if "functionCall" in part
+    ]
+
+
+def _parse_usage(payload: Dict[str, Any]) -> Optional[TokenUsage]:
+    """Decode usageMetadata (absent on intermediate stream chunks)."""
+    usage = payload.get("usageMetadata")
+    if not usage:
+        return None
+    prompt_tokens = usage.get("promptTokenCount", 0) or 0
+    completion_tokens = usage.get("candidatesTokenCount", 0) or 0
+    return TokenUsage(
+        prompt_tokens=prompt_tokens,
+        completion_tokens=completion_tokens,
+        total_tokens=usage.get("totalTokenCount", 0) or (prompt_tokens + completion_tokens),
+        cached_tokens=usage.get("cachedContentTokenCount", 0) or 0,
+    )
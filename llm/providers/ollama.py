@@ -0,0 +1,143 @@
+"""
+Ollama provider (self-hosted models via the native /api/chat endpoint).
+"""
+import json
+from typing import Any, Dict, Iterator, List, Optional
+
+import httpx
+
+from llm.http_client import get_http_client
+from llm.errors import LLMError, ProviderUnavailableError
+from llm.providers.base import (
+    Provider, ChatRequest, ChatResponse, StreamChunk, ToolCall,
+    raise_for_http_error, parse_tool_arguments, tracing_headers,
+)
+from llm.schemas import TokenUsage
+
+
+class ModelNotAvailableError(LLMError):
+    """The configured model has not been pulled on the Ollama server."""
+
+
+class OllamaProvider(Provider):
+    """Adapter for a local Ollama server."""
+
+    name = "ollama"
+
+    def __init__(self, base_url: str = "http://localhost:11434", http_client: Optional[httpx.Client] = None) -> None:
+        self.base_url = base_url.rstrip("/")
+        self.client = http_client or get_http_client()
+
+    def _build_body(self, request: ChatRequest, stream: bool) -> Dict[str, Any]:
+        options: Dict[str, Any] = {"temperature": request.temperature}
+        if request.max_tokens:
+            options["num_predict"] = request.max_tokens
+
+        body: Dict[str, Any] = {
+            "model": request.model,
+            "messages": [
+                {"role": message["role"], "content": message["content"]}
+                for message in request.messages
+            ],
+            "stream": stream,
+            "options": options,
+        }
+        if request.response_format:
+            # Ollama accepts "json" or a JSON schema to constrain decoding to
+            schema = (request.response_format.get("json_schema") or {}).get("schema")
+            body["format"] = schema or "json"
+        if request.tools and request.tool_choice != "none":
+            body["tools"] = request.tools
+            body.pop("format", None)
+        return body
+
+    def _post(self, path: str, **kwargs: Any) -> httpx.Response:
+        try:
+            return self.client.post(f"{self.base_url}{path}", **kwargs)
+        except httpx.TransportError as e:
+            raise ProviderUnavailableError(f"{self.name} unreachable: {e}", provider=self.name) from e
+
+    def chat(self, request: ChatRequest) -> ChatResponse:
+        kwargs: Dict[str, Any] = {"headers": tracing_headers(request)}
+        if request.timeout is not None:
+            kwargs["timeout"] = request.timeout
+
+        response = self._post("/api/chat", json=self._build_body(request, stream=False), **kwargs)
+        raise_for_http_error(response, self.name)
+        payload = response.json()
+
+        message = payload.get("message") or {}
+        return ChatResponse(
+            content=message.get("content", ""),
+            usage=_parse_usage(payload),
+            model=payload.get("model") or request.model,
+            finish_reason=payload.get("done_reason"),
+            tool_calls=[
+                ToolCall(
+                    name=(call.get("function") or {}).get("name", ""),
+                    arguments=parse_tool_arguments((call.get("function") or {}).get("arguments")),
+                )
+                for call in message.get("tool_calls") or []
+            ],
+        )
+
+    def stream(self, request: ChatRequest) -> Iterator[StreamChunk]:
+        kwargs: Dict[str, Any] = {"headers": tracing_headers(request)}
+        if request.timeout is not None:
+            kwargs["timeout"] = request.timeout
+
+        try:
+            yield from self._iter_stream(request, kwargs)
+        except httpx.TransportError as e:
+            raise ProviderUnavailableError(f"{self.name} unreachable: {e}", provider=self.name) from e
+
+    def _iter_stream(self, request: ChatRequest, kwargs: Dict[str, Any]) -> Iterator[StreamChunk]:
+        # Ollama streams newline-delimited JSON objects rather than SSE
+        with self.client.stream(
+            "POST",
+            f"{self.base_url}/api/chat",
+            json=self._build_body(request, stream=True),
+            **kwargs,
+        ) as response:
+            raise_for_http_error(response, self.name)
+            for line in response.iter_lines():
+                if not line.strip():
+                    continue
+                payload = json.loads(line)
+                done = payload.get("done", False)
+                yield StreamChunk(
+                    delta=(payload.get("message") or {}).get("content", ""),
+                    usage=_parse_usage(payload) if done else None,
+                    finish_reason=payload.get("done_reason") if done else None,
+                    model=payload.get("model") or request.model,
+                )
+
+    def list_models(self) -> List[str]:
+        """Names of the models pulled on the server (e.g. "llama3.1:8b")."""
+        try:
+            response = self.client.get(f"{self.base_url}/api/tags")
+        except httpx.TransportError as e:
+            raise ProviderUnavailableError(f"{self.name} unreachable: {e}", provider=self.name) from e
+        raise_for_http_error(response, self.name)
+        return [model.get("name", "") for model in response.json().get("models") or []]
+
+    def ensure_model_available(self, model: str) -> None:
+        """Raise ModelNotAvailableError unless the model is pulled. "llama3" matches "llama3:latest"."""
+        available = self.list_models()
+        wanted = model if ":" in model else f"{model}:latest"
+        if model not in available and wanted not in available:
+            raise ModelNotAvailableError(
+                f"Ollama model '{model}' is not pulled (available: {available}). Run `ollama pull {model}`",
+                provider=self.name,
+            )
+
+
+def _parse_usage(payload: Dict[str, Any]) -> TokenUsage:
+    """Ollama reports prompt_eval_count / eval_count on the final message."""
+    prompt_tokens = payload.get("prompt_eval_count", 0) or 0
+    completion_tokens = payload.get("eval_count", 0) or 0
+    return TokenUsage(
+        prompt_tokens=prompt_tokens,
+        completion_tokens=completion_tokens,
+        total_tokens=prompt_tokens + completion_tokens,
+    )
@@ -0,0 +1,224 @@
+"""
+OpenAI-compatible provider (OpenAI, Groq and any /chat/completions endpoint).
+"""
+import json
+from typing import Any, Dict, Iterator, Optional, Union
+
+import httpx
+import openai
+from openai import OpenAI
+from openai.types.chat import ChatCompletion
+
+from llm.config import llm_config
+from llm.http_client import get_http_client
+from llm.errors import LLMError, ProviderUnavailableError, error_from_status, parse_retry_after
+from llm.providers.base import (
+    Provider, ChatRequest, ChatResponse, StreamChunk, ToolCall, parse_tool_arguments, tracing_headers,
+    BATCH_PENDING, BATCH_COMPLETED, BATCH_FAILED,
+)
+from llm.schemas import TokenUsage
+
+
+def _parse_usage(response: Any) -> TokenUsage:
+    """Decode the usage block of a chat completion (missing on some providers)."""
+    usage = getattr(response, "usage", None)
+    if usage is None:
+        return TokenUsage()
+    prompt_tokens = getattr(usage, "prompt_tokens", 0) or 0
+    completion_tokens = getattr(usage, "completion_tokens", 0) or 0
+    details = getattr(usage, "prompt_tokens_details", None)
+    return TokenUsage(
+        prompt_tokens=prompt_tokens,
+        completion_tokens=completion_tokens,
+        total_tokens=getattr(usage, "total_tokens", 0) or (prompt_tokens + completion_tokens),
+        cached_tokens=getattr(details, "cached_tokens", 0) or 0,
+    )
+
+
+def _sdk_error_message(error: openai.APIStatusError) -> str:
+    """Vendor message from an SDK status error body, falling back to the SDK's summary."""
+    body = error.body
+    if isinstance(body, dict):
+        inner = body.get("error", body)
+        if isinstance(inner, dict) and inner.get("message"):
+            return inner["message"]
+    return error.message
+
+
+class OpenAICompatibleProvider(Provider):
+    """Adapter for OpenAI's chat completions API and compatible vendors."""
+
+    def __init__(
+        self,
+        name: str,
+        api_key: Optional[str],
+        base_url: Optional[str] = None,
+        http_client: Optional[httpx.Client] = None,
+    ) -> None:
+        self.name = name
+        # SDK retries are disabled; retries are governed by llm.retry.RetryPolicy
+        self.client = OpenAI(
+            api_key=api_key,
+            base_url=base_url,
+            max_retries=0,
+            timeout=llm_config.http_timeout,
+            http_client=http_client or get_http_client(),
+        )
+
+    def _build_kwargs(self, request: ChatRequest) -> Dict[str, Any]:
+        kwargs: Dict[str, Any] = {
+            "model": request.model,
+            "messages": request.messages,
+            "temperature": request.temperature,
+        }
+        if request.response_format:
+            kwargs["response_format"] = request.response_format
+        if request.max_tokens:
+            kwargs["max_tokens"] = request.max_tokens
+        if request.timeout is not None:
+            kwargs["timeout"] = request.timeout
+        if request.tools:
+            kwargs["tools"] = request.tools
+            if request.tool_choice is not None:
+                kwargs["tool_choice"] = request.tool_choice
+        headers = tracing_headers(request, idempotency=True)
+        if request.request_id:
+            # OpenAI echoes this in its own logs, linking our trace to theirs
+            headers["X-Client-Request-Id"] = request.request_id
+        if headers:
+            kwargs["extra_headers"] = headers
+        return kwargs
+
+    def _translate_error(self, error: Exception) -> Exception:
+        """Map SDK exceptions to typed LLM errors; anything else passes through."""
+        if isinstance(error, openai.APIStatusError):
+            return error_from_status(
+                error.status_code,
+                _sdk_error_message(error),
+                self.name,
+                body=error.response.text,
+                retry_after=parse_retry_after(error.response.headers),
+            )
+        if isinstance(error, (openai.APITimeoutError, openai.APIConnectionError)):
+            return ProviderUnavailableError(f"{self.name} unreachable: {error}", provider=self.name)
+        return error
+
+    def chat(self, request: ChatRequest) -> ChatResponse:
+        try:
+            response = self.client.chat.completions.create(**self._build_kwargs(request))
+        except openai.OpenAIError as e:
+            raise self._translate_error(e) from e
+        return self._to_chat_response(response)
+
+    def _to_chat_response(self, response: Any) -> ChatResponse:
+        if not response.choices:
+            # Some gateways answer 200 with an error payload instead of choices
+            raise LLMError(
+                f"{self.name} returned no choices",
+                provider=self.name,
+                body=response.model_dump_json() if hasattr(response, "model_dump_json") else str(response),
+            )
+        choice = response.choices[0]
+
+        tool_calls = [
+            ToolCall(
+                id=call.id,
+                name=call.function.name,
+                arguments=parse_tool_arguments(call.function.arguments),
+            )
+            for call in (getattr(choice.message, "tool_calls", None) or [])
+            if getattr(call, "function", None) is not None
+        ]
+
+        return ChatResponse(
+            content=choice.message.content or "",
+            usage=_parse_usage(response),
+            model=getattr(response, "model", None),
+            finish_reason=getattr(choice, "finish_reason", None),
+            tool_calls=tool_calls,
+        )
+
+    def stream(self, request: ChatRequest) -> Iterator[StreamChunk]:
+        kwargs = self._build_kwargs(request)
+        kwargs["stream"] = True
+        kwargs["stream_options"] = {"include_usage": True}
+
+        try:
+            yield from self._iter_stream(kwargs)
+        except openai.OpenAIError as e:
+            raise self._translate_error(e) from e
+
+    def submit_batch(self, requests: Dict[str, ChatRequest]) -> str:
+        lines = []
+        for custom_id, request in requests.items():
+            body = self._build_kwargs(request)
+            body.pop("timeout", None)
+            body.pop("extra_headers", None)
+            lines.append(json.dumps({"custom_id": custom_id, "method": "POST", "url": "/v1/chat/completions", "body": body}))
+        try:
+            batch_file = self.client.files.create(file=("batch.jsonl", "\n".join(lines).encode()), purpose="batch")
+            batch = self.client.batches.create(
+                input_file_id=batch_file.id,
+                endpoint="/v1/chat/completions",
+                completion_window="24h",
+            )
+        except openai.OpenAIError as e:
+            raise self._translate_error(e) from e
+        return batch.id
+
+    def batch_status(self, batch_id: str) -> str:
+        try:
+            status = self.client.batches.retrieve(batch_id).status
+        except openai.OpenAIError as e:
+            raise self._translate_error(e) from e
+        if status == "completed":
+            return BATCH_COMPLETED
+        if status in ("failed", "expired", "cancelled"):
+            return BATCH_FAILED
+        return BATCH_PENDING
+
+    def batch_results(self, batch_id: str) -> Dict[str, Union[ChatResponse, LLMError]]:
+        results: Dict[str, Union[ChatResponse, LLMError]] = {}
+        try:
+            batch = self.client.batches.retrieve(batch_id)
+            contents = [
+                self.client.files.content(file_id).text
+                for file_id in (batch.output_file_id, batch.error_file_id)
+                if file_id
+            ]
+        except openai.OpenAIError as e:
+            raise self._translate_error(e) from e
+
+        for line in "\n".join(contents).splitlines():
+            if not line.strip():
+                continue
+            item = json.loads(line)
+            response = item.get("response") or {}
+            status_code = response.get("status_code")
+            if status_code == 200:
+                try:
+                    results[item["custom_id"]] = self._to_chat_response(ChatCompletion.model_validate(response["body"]))
+                except LLMError as e:
+                    results[item["custom_id"]] = e
+                continue
+            error = item.get("error") or (response.get("body") or {}).get("error") or {}
+            results[item["custom_id"]] = error_from_status(
+                status_code or 500, error.get("message", "batch request failed"), self.name, body=line,
+            )
+        return results
+
+    def _iter_stream(self, kwargs: Dict[str, Any]) -> Iterator[StreamChunk]:
+        for chunk in self.client.chat.completions.create(**kwargs):
+            delta = ""
+            finish_reason = None
+            if chunk.choices:
+                choice = chunk.choices[0]
+                delta = getattr(choice.delta, "content", None) or ""
+                finish_reason = choice.finish_reason
+            usage = _parse_usage(chunk) if getattr(chunk, "usage", None) else None
+            yield StreamChunk(
+                delta=delta,
+                usage=usage,
+                finish_reason=finish_reason,
+                model=getattr(chunk, "model", None),
+            )
@@ -0,0 +1,150 @@
+"""
+Pipeline Replay.
+With LLM_RECORD_RUNS on, every pipeline run's full input (PipelineInput and
+the lead's message) and result are handed to the installed RecordingSink (the
+worker stores them through the internal API). replay() re-runs a recorded
+turn with the current prompts and models as a shadow run (nothing is sent or
+saved) and compares it with what production did, so a regression can be
+debugged against the real case that exposed it.
+
+Usage:
+    replayed = replay(recording)
+    replayed.comparison.differences  # ["action: send_now -> wait_schedule"]
+
+From the command line: python -m whatsapp_worker.replay <recording_id>
+"""
+import json
+import logging
+import time
+import uuid
+from abc import ABC, abstractmethod
+from typing import List, Optional
+
+from pydantic import BaseModel, Field
+
+from llm.client import LLMClient
+from llm.config import llm_config
+from llm.pipeline import run_pipeline
+from llm.run_context import RunContext
+from llm.schemas import PipelineInput, PipelineResult
+from llm.shadow import ShadowComparison, compare_results
+
+logger = logging.getLogger(__name__)
+
+# LoggingRecordingSink writes each recording after this marker
+RECORDING_LOG_MARKER = "PIPELINE RECORDING "
+
+
+class PipelineRecording(BaseModel):
+    """Everything needed to re-run one pipeline turn."""
+    id: Optional[str] = None  # Set once stored
+    conversation_id: Optional[str] = None
+    organization_id: Optional[str] = None
+    request_id: Optional[str] = None
+    user_message: str
+    context: PipelineInput
+    result: PipelineResult
+    prompt_version: Optional[str] = None
+    created_at: float = Field(default_factory=time.time)
+
+
+class ReplayResult(BaseModel):
+    """A recorded turn re-run now, next to what production did."""
+    recording_id: Optional[str] = None
+    recorded_prompt_version: Optional[str] = None
+    replayed_prompt_version: Optional[str] = None
+    result: PipelineResult
+    comparison: ShadowComparison
+
+
+class RecordingSink(ABC):
+    """Persists pipeline recordings (DB via the internal API, files...)."""
+
+    @abstractmethod
+    def record(self, recording: PipelineRecording) -> None:
+        raise NotImplementedError
+
+
+class LoggingRecordingSink(RecordingSink):
+    """Default sink: writes the recording to the llm log as one JSON line."""
+
+    def record(self, recording: PipelineRecording) -> None:
+        logging.getLogger("llm").info(f"{RECORDING_LOG_MARKER}{recording.model_dump_json()}")
+
+
+_recording_sink: RecordingSink = LoggingRecordingSink()
+
+
+def set_recording_sink(sink: RecordingSink) -> None:
+    global _recording_sink
+    _recording_sink = sink
+
+
+def get_recording_sink() -> RecordingSink:
+    return _recording_sink
+
+
+def parse_recordings(text: str) -> List[PipelineRecording]:
+    """
+    Read recordings from a JSON recording or from llm log lines written by
+    LoggingRecordingSink (whatever the log formatter put before the marker).
+    """
+    if RECORDING_LOG_MARKER not in text:
+        return [PipelineRecording(**json.loads(text))]
+    return [
+        PipelineRecording(**json.loads(line.rsplit(RECORDING_LOG_MARKER, 1)[1]))
+        for line in text.splitlines()
+        if RECORDING_LOG_MARKER in line
+    ]
+
+
+def record_run(context: PipelineInput, user_message: str, result: PipelineResult) -> Optional[PipelineRecording]:
+    """
+    Record a finished run when LLMConfig.record_runs is on (shadow runs never are).
+    Recording failures never affect the conversation.
+    """
+    if not llm_config.record_runs or result.shadow:
+        return None
+    recording = PipelineRecording(
+        conversation_id=context.conversation_id,
+        organization_id=context.organization_id,
+        request_id=result.request_id,
+        user_message=user_message,
+        context=context,
+        result=result,
+        prompt_version=result.prompt_version,
+    )
+    try:
+        get_recording_sink().record(recording)
+    except Exception as e:
+        logger.error(f"Failed to record pipeline run [req {result.request_id}]: {e}", exc_info=True)
+    return recording
+
+
+def replay(recording: PipelineRecording, client: Optional[LLMClient] = None) -> ReplayResult:
+    """
+    Re-run a recorded turn with the current prompts and models (client overrides
+    the LLM client, e.g. to pin a model). The context is replayed as recorded,
+    including its clock, so relative times resolve as they did in production.
+    The run gets a fresh request ID: under the recorded one its idempotency keys
+    would match production's and a vendor could replay its cached responses.
+    The comparison keeps the recorded request ID.
+    """
+    request_id = uuid.uuid4().hex
+    logger.info(f"Replaying recording {recording.id} [req {recording.request_id}] as [req {request_id}]")
+    replayed = run_pipeline(
+        recording.context,
+        recording.user_message,
+        ctx=RunContext(request_id=request_id),
+        client=client,
+        shadow=True,
+    )
+    return ReplayResult(
+        recording_id=recording.id,
+        recorded_prompt_version=recording.prompt_version,
+        replayed_prompt_version=replayed.prompt_version,
+        result=replayed,
+        comparison=compare_results(
+            recording.result, replayed, recording.conversation_id, recording.user_message
+        ),
+    )
@@ -0,0 +1,143 @@
+"""
+LLM Response Cache.
+Reuses parsed responses for prompts that are identical after normalization
+(whitespace, case, timestamps), so repeated questions within an organization
+do not pay for the same completion twice. Backends: in-memory or Redis.
+"""
+import hashlib
+import json
+import logging
+import re
+import threading
+import time
+from abc import ABC, abstractmethod
+from typing import Any, Dict, List, Optional, Tuple
+
+from llm.config import llm_config
+
+logger = logging.getLogger(__name__)
+
+# ISO-8601 timestamps and clock times change on every call without changing the question
+_TIMESTAMP_PATTERN = re.compile(r"\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?([+-]\d{2}:?\d{2}|Z)?")
+_WHITESPACE_PATTERN = re.compile(r"\s+")
+
+
+def normalize_prompt(text: str) -> str:
+    text = _TIMESTAMP_PATTERN.sub("<ts>", text)
+    return _WHITESPACE_PATTERN.sub(" ", text).strip().lower()
+
+
+def prompt_cache_key(
+    messages: List[Dict[str, str]],
+    provider: str,
+    model: Optional[str],
+    temperature: float,
+    response_format: Optional[Dict[str, Any]] = None,
+    scope: Optional[str] = None,
+) -> str:
+    """
+    Hash of the normalized prompt plus everything else that shapes the output.
+    scope (e.g. an organization ID) keeps tenants from sharing entries.
+    """
+    payload = json.dumps(
+        {
+            "messages": [[m.get("role"), normalize_prompt(m.get("content") or "")] for m in messages],
+            "provider": provider,
+            "model": model,
+            "temperature": temperature,
+            "response_format": response_format,
+            "scope": scope,
+        },
+        sort_keys=True,
+    )
+    return "llm:response:" + hashlib.sha256(payload.encode()).hexdigest()
+
+
+class ResponseCache(ABC):
+    """Stores JSON-serializable response payloads with a TTL."""
+
+    @abstractmethod
+    def get(self, key: str) -> Optional[Dict[str, Any]]:
+        raise NotImplementedError
+
+    @abstractmethod
+    def set(self, key: str, value: Dict[str, Any], ttl_seconds: int) -> None:
+        raise NotImplementedError
+
+
+class InMemoryResponseCache(ResponseCache):
+    """Process-local cache with lazy expiry and a size cap (oldest entries evicted first)."""
+
+    def __init__(self, max_entries: int = 10000, clock=time.monotonic) -> None:
+        self.max_entries = max_entries
+        self._clock = clock
+        self._entries: Dict[str, Tuple[float, Dict[str, Any]]] = {}
+        self._lock = threading.Lock()
+
+    def get(self, key: str) -> Optional[Dict[str, Any]]:
+        with self._lock:
+            entry = self._entries.get(key)
+            if entry is None:
+                return None
+            expires_at, value = entry
+            if self._clock() >= expires_at:
+                del self._entries[key]
+                return None
+            return value
+
+    def set(self, key: str, value: Dict[str, Any], ttl_seconds: int) -> None:
+        with self._lock:
+            if key not in self._entries and len(self._entries) >= self.max_entries:
+                self._entries.pop(next(iter(self._entries)))
+            self._entries[key] = (self._clock() + ttl_seconds, value)
+
+
+class RedisResponseCache(ResponseCache):
+    """Shared cache across workers. Errors degrade to cache misses."""
+
+    def __init__(self, url: str) -> None:
+        import redis  # Optional dependency, only needed for this backend
+
+        self.client = redis.Redis.from_url(url)
+
+    def get(self, key: str) -> Optional[Dict[str, Any]]:
+        try:
+            raw = self.client.get(key)
+        except Exception as e:
+            logger.warning(f"Response cache read failed: {e}")
+            return None
+        return json.loads(raw) if raw else None
+
+    def set(self, key: str, value: Dict[str, Any], ttl_seconds: int) -> None:
+        try:
+            self.client.set(key, json.dumps(value), ex=ttl_seconds)
+        except Exception as e:
+            logger.warning(f"Response cache write failed: {e}")
+
+
+_cache: Optional[ResponseCache] = None
+_cache_lock = threading.Lock()
+
+
+def get_response_cache() -> Optional[ResponseCache]:
+    """The configured cache (LLM_RESPONSE_CACHE=memory|redis), or None when disabled."""
+    global _cache
+    backend = llm_config.response_cache_backend
+    if backend in ("", "none"):
+        return None
+    with _cache_lock:
+        if _cache is None:
+            if backend == "redis":
+                _cache = RedisResponseCache(llm_config.response_cache_redis_url)
+            elif backend == "memory":
+                _cache = InMemoryResponseCache()
+            else:
+                raise ValueError(f"Unknown LLM_RESPONSE_CACHE backend: {backend!r}")
+        return _cache
+
+
+def set_response_cache(cache: Optional[ResponseCache]) -> None:
+    """Install a specific cache instance (tests, custom backends)."""
+    global _cache
+    with _cache_lock:
+        _cache = cache
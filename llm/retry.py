@@ -0,0 +1,120 @@
+"""
+Retry Policy for LLM API calls.
+Exponential backoff with full jitter for transient provider failures.
+"""
+import logging
+import random
+import time
+from typing import Callable, List, Optional, TypeVar
+
+import httpx
+import openai
+from pydantic import BaseModel
+
+from llm.config import llm_config
+from llm.errors import LLMError, ProviderUnavailableError
+from llm.run_context import RunContext
+
+logger = logging.getLogger(__name__)
+
+T = TypeVar("T")
+
+
+class RetryPolicy(BaseModel):
+    """How many times and how patiently to retry a failed LLM call."""
+    max_attempts: int = 4
+    base_delay: float = 0.5   # seconds
+    max_delay: float = 8.0    # seconds, cap for a single sleep
+    retry_on_status: List[int] = [408, 409, 429, 500, 502, 503, 504]
+    max_retry_after: float = 30.0  # Longer Retry-After hints are left to the caller/scheduler
+
+    @classmethod
+    def from_config(cls) -> "RetryPolicy":
+        """Build the default policy from LLMConfig."""
+        return cls(
+            max_attempts=max(1, llm_config.max_retries + 1),
+            base_delay=llm_config.retry_base_delay,
+            max_delay=llm_config.retry_max_delay,
+            retry_on_status=llm_config.retry_on_status,
+            max_retry_after=llm_config.retry_max_retry_after,
+        )
+
+    def backoff_delay(self, attempt: int) -> float:
+        """
+        Full-jitter exponential backoff.
+        attempt is 0-based (0 = delay after the first failure).
+        """
+        ceiling = min(self.max_delay, self.base_delay * (2 ** attempt))
+        return random.uniform(0, ceiling)
+
+    def is_retryable(self, error: Exception) -> bool:
+        """Transient errors only: timeouts, dropped connections, retryable HTTP statuses."""
+        # Typed errors raised by the built-in providers
+        if isinstance(error, LLMError):
+            if error.status_code is None:
+                # No HTTP response at all: timeout or dropped connection
+                return isinstance(error, ProviderUnavailableError)
+            return error.status_code in self.retry_on_status
+        # Raw SDK / HTTP errors from custom providers
+        # OpenAI-compatible providers (SDK errors)
+        if isinstance(error, (openai.APITimeoutError, openai.APIConnectionError)):
+            return True
+        if isinstance(error, openai.APIStatusError):
+            return error.status_code in self.retry_on_status
+        # Native HTTP providers (Anthropic, Gemini)
+        if isinstance(error, httpx.TransportError):
+            return True
+        if isinstance(error, httpx.HTTPStatusError):
+            return error.response.status_code in self.retry_on_status
+        return False
+
+
+def call_with_retry(
+    fn: Callable[[], T],
+    policy: Optional[RetryPolicy] = None,
+    step_name: str = "LLM",
+    sleep: Callable[[float], None] = time.sleep,
+    ctx: Optional[RunContext] = None,
+) -> T:
+    """
+    Invoke fn, retrying transient failures according to policy.
+    Non-retryable errors and the final failure are re-raised unchanged.
+    Stops retrying as soon as ctx is cancelled or past its deadline, and does
+    not start a backoff sleep that would outlast the remaining budget.
+    """
+    policy = policy or RetryPolicy.from_config()
+
+    for attempt in range(policy.max_attempts):
+        if ctx is not None:
+            ctx.check()
+        try:
+            return fn()
+        except Exception as e:
+            is_last = attempt == policy.max_attempts - 1
+            if is_last or not policy.is_retryable(e):
+                raise
+
+            delay = policy.backoff_delay(attempt)
+            retry_after = getattr(e, "retry_after", None)
+            if retry_after is not None:
+                if retry_after > policy.max_retry_after:
+                    # Provider wants us gone for longer than a live reply can wait
+                    raise
+                delay = max(delay, retry_after)
+            if ctx is not None:
+                remaining = ctx.remaining()
+                if remaining is not None and delay >= remaining:
+                    # Leave what is left of the budget to the fallback chain
+                    logger.warning(
+                        f"{step_name}: transient failure ({e}) with {remaining:.2f}s of run budget left. "
+                        f"Not retrying"
+                    )
+                    raise
+            logger.warning(
+                f"{step_name}: transient failure (attempt {attempt + 1}/{policy.max_attempts}): {e}. "
+                f"Retrying in {delay:.2f}s"
+            )
+            sleep(delay)
+
+    # Unreachable: the loop either returns or raises
+    raise RuntimeError(f"{step_name}: retry loop exited unexpectedly")
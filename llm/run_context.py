@@ -0,0 +1,93 @@
+"""
+Run Context for HTL Pipeline.
+Carries cancellation, deadlines and the run's request ID through the pipeline
+into every LLM call, so callers (webhook handlers, Celery tasks) can abort work
+they no longer need and trace a WhatsApp message back to its LLM calls.
+"""
+import threading
+import time
+import uuid
+from typing import Optional
+
+
+class RunCancelledError(Exception):
+    """Raised when a pipeline run is cancelled or its deadline passes."""
+
+
+class DeadlineExceededError(RunCancelledError):
+    """Raised when a pipeline run outlives its deadline."""
+
+
+def raise_if_cancelled(error: BaseException) -> None:
+    """
+    Re-raise error if it is an explicit cancellation. Running out of time is
+    not one: a step that hits its deadline falls back (a canned reply, or
+    staying silent) like on any other failure, so the lead still gets a timely
+    answer instead of the message being redelivered.
+    """
+    if isinstance(error, RunCancelledError) and not isinstance(error, DeadlineExceededError):
+        raise error
+
+
+class RunContext:
+    """
+    Cancellation + deadline carrier for a single pipeline run.
+
+    request_id identifies the run in logs and provider headers. Pass a stable
+    value (e.g. the WhatsApp message ID) so redeliveries reuse the same ID.
+
+    Usage:
+        ctx = RunContext(timeout=15, request_id=wamid)
+        result = run_pipeline(context, user_message, ctx=ctx)
+
+        # From another thread:
+        ctx.cancel()
+    """
+
+    def __init__(
+        self,
+        timeout: Optional[float] = None,
+        deadline: Optional[float] = None,
+        request_id: Optional[str] = None,
+        _cancel_event: Optional[threading.Event] = None,
+    ) -> None:
+        # deadline is a time.monotonic() timestamp
+        if timeout is not None:
+            timeout_deadline = time.monotonic() + timeout
+            deadline = timeout_deadline if deadline is None else min(deadline, timeout_deadline)
+        self.deadline = deadline
+        self.request_id = request_id or uuid.uuid4().hex
+        self._cancel_event = _cancel_event or threading.Event()
+
+    def with_timeout(self, timeout: float) -> "RunContext":
+        """Derive a child context with a tighter deadline. Cancelling the parent cancels the child."""
+        return RunContext(
+            timeout=timeout,
+            deadline=self.deadline,
+            request_id=self.request_id,
+            _cancel_event=self._cancel_event,
+        )
+
+    def cancel(self) -> None:
+        self._cancel_event.set()
+
+    @property
+    def cancelled(self) -> bool:
+        return self._cancel_event.is_set()
+
+    @property
+    def expired(self) -> bool:
+        return self.deadline is not None and time.monotonic() >= self.deadline
+
+    def remaining(self) -> Optional[float]:
+        """Seconds until the deadline (never negative), or None if unbounded."""
+        if self.deadline is None:
+            return None
+        return max(0.0, self.deadline - time.monotonic())
+
+    def check(self) -> None:
+        """Raise if the run has been cancelled or has run out of time."""
+        if self.cancelled:
+            raise RunCancelledError("Pipeline run cancelled")
+        if self.expired:
+            raise DeadlineExceededError("Pipeline run deadline exceeded")
@@ -2,10 +2,13 @@
 Pydantic schemas for HTL Pipeline I/O.
 Strict JSON schemas ensure LLM outputs are validated and typed.
 """
-from typing import Optional, List, Literal, Dict
+from datetime import datetime
+from typing import Any, Optional, List, Literal, Dict
+from urllib.parse import urlparse
 from uuid import UUID
-from pydantic import BaseModel, Field
+from pydantic import BaseModel, Field, field_validator, model_validator
 from server.enums import (
+    CTAType,
     ConversationStage,
     IntentLevel,
     UserSentiment,
@@ -39,22 +42,109 @@ class NudgeContext(BaseModel):
     total_nudges: int = 0
 
 
+class LeadProfile(BaseModel):
+    """Structured facts about a lead, extracted by the Memory step and persisted on the lead."""
+    name: Optional[str] = None
+    budget: Optional[str] = None
+    location: Optional[str] = None
+    product_interest: Optional[str] = None
+    timeline: Optional[str] = None
+    objections: List[str] = Field(default_factory=list)
+    custom: Dict[str, str] = Field(default_factory=dict)  # Per-organization facts (PipelineInput.memory_fact_fields)
+
+    def merge(self, update: "LeadProfile") -> "LeadProfile":
+        """New non-empty values win; objections accumulate without duplicates."""
+        merged = self.model_copy(deep=True)
+        for field in ("name", "budget", "location", "product_interest", "timeline"):
+            value = getattr(update, field)
+            if value and value.strip():
+                setattr(merged, field, value.strip())
+        for field, value in update.custom.items():
+            if value and value.strip():
+                merged.custom[field] = value.strip()
+        known = {objection.lower() for objection in merged.objections}
+        for objection in update.objections:
+            if objection.strip() and objection.strip().lower() not in known:
+                merged.objections.append(objection.strip())
+                known.add(objection.strip().lower())
+        return merged
+
+    def format_for_prompt(self) -> str:
+        lines = [
+            f"{field.replace('_', ' ').title()}: {value}"
+            for field, value in self.model_dump(exclude={"objections", "custom"}).items()
+            if value
+        ]
+        lines.extend(f"{field.replace('_', ' ').title()}: {value}" for field, value in self.custom.items())
+        if self.objections:
+            lines.append(f"Objections: {'; '.join(self.objections)}")
+        return "\n".join(lines) or "Nothing known yet"
+
+
+class PromptOverrides(BaseModel):
+    """
+    Per-organization replacements for sections of the Mouth system prompt,
+    and for the stage rules of the Mouth and Brain. Unset sections keep the
+    defaults in llm.prompts.
+    """
+    persona: Optional[str] = None  # Who the bot is, replaces the opening identity paragraph
+    tone: Optional[str] = None
+    style: Optional[str] = None
+    language_style: Optional[str] = None
+    forbidden_topics: List[str] = Field(default_factory=list)
+    stage_rules: Dict[ConversationStage, str] = Field(default_factory=dict)  # How to reply in a stage
+    brain_stage_rules: Dict[ConversationStage, str] = Field(default_factory=dict)  # When to enter/leave a stage
+    # Enforced on the reply as well as asked for (llm.formatting); None keeps the default style
+    emoji_style: Optional[Literal["none", "light", "heavy"]] = None
+    whatsapp_formatting: Optional[bool] = None  # *bold* / _italics_ allowed
+
+
+class TemplateOption(BaseModel):
+    """An approved WhatsApp template the Mouth may pick when the 24h window is closed."""
+    name: str
+    language: str = "en_US"
+    body: str  # Body text with {{1}}, {{2}}... placeholders
+    parameter_count: int = 0
+
+
+class ExampleTurn(BaseModel):
+    sender: Literal["lead", "bot"]
+    text: str
+
+
+class PromptExample(BaseModel):
+    """An organization's exemplar conversation, shown to the Mouth as a model reply."""
+    title: str = ""  # e.g. "Good qualification"
+    stage: Optional[ConversationStage] = None  # None: usable at any stage
+    turns: List[ExampleTurn] = Field(default_factory=list)
+
+
 class PipelineInput(BaseModel):
     """
     Complete input context for the HTL pipeline.
     Kept minimal for token efficiency.
     """
+    conversation_id: Optional[str] = None  # For tracing/audit only; never sent to the LLM
+    organization_id: Optional[str] = None  # For metrics only; never sent to the LLM
+
     # Business context
     business_name: str
     business_description: str = ""
     flow_prompt: str = ""  # Conversation flow/sales script instructions
+    memory_prompt: str = ""  # What summaries should emphasize for this business (overrides the default focus)
+    memory_fact_fields: List[str] = []  # Extra lead facts to extract, e.g. ["symptoms", "preferred_doctor"]
+    prompt_overrides: PromptOverrides = Field(default_factory=PromptOverrides)
+    prompt_examples: List[PromptExample] = Field(default_factory=list)
+    forbidden_claims: List[str] = []  # Checked on every reply (llm.guardrails), e.g. ["lowest price", "re:\d+% off"]
     
     # CTAs
-    available_ctas: List[Dict[str, str]] = [] # [{id: UUID, name: str}]
+    available_ctas: List[Dict[str, Any]] = [] # [{id: UUID, name: str, type: CTAType value, params: {str: str}}]
+    available_templates: List[TemplateOption] = []  # Approved templates, used when the window is closed
     
     # Conversation context
     rolling_summary: str = ""
     last_messages: List[MessageContext] = []
+    lead_profile: LeadProfile = Field(default_factory=LeadProfile)
     
     # Current state
     conversation_stage: ConversationStage
@@ -84,6 +174,39 @@ class RiskFlags(BaseModel):
     hallucination_risk: RiskLevel = RiskLevel.LOW
 
 
+class CTAAction(BaseModel):
+    """
+    A selected CTA, checked against the organization's CTAs and typed for execution.
+    params holds the CTA's configured parameters plus any the Brain filled in.
+    """
+    cta_id: UUID
+    type: CTAType
+    params: Dict[str, str] = Field(default_factory=dict)  # e.g. {"url": ...} for link, {"amount": ...} for payment
+    scheduled_at: Optional[datetime] = None  # Always timezone-aware
+
+    @field_validator("scheduled_at")
+    @classmethod
+    def _require_timezone(cls, value: Optional[datetime]) -> Optional[datetime]:
+        if value is not None and value.utcoffset() is None:
+            raise ValueError("scheduled_at must include a timezone")
+        return value
+
+    @model_validator(mode="after")
+    def _check_params(self) -> "CTAAction":
+        if self.type == CTAType.LINK:
+            url = urlparse(self.params.get("url", ""))
+            if url.scheme not in ("http", "https") or not url.netloc:
+                raise ValueError("link CTA needs an http(s) url param")
+        if self.type == CTAType.PAYMENT and "amount" in self.params:
+            try:
+                amount = float(self.params["amount"])
+            except ValueError:
+                raise ValueError(f"payment amount is not a number: {self.params['amount']!r}")
+            if amount <= 0:
+                raise ValueError("payment amount must be positive")
+        return self
+
+
 class ClassifyOutput(BaseModel):
     """
     Output from Step 1: Classify (The Brain).
@@ -104,6 +227,7 @@ class ClassifyOutput(BaseModel):
     # Action Payload
     selected_cta_id: Optional[UUID] = None
     cta_scheduled_at: Optional[str] = None # ISO format if LLM picks a time
+    cta_action: Optional[CTAAction] = None  # Typed, validated form of the two fields above
     followup_in_minutes: int = 0
     followup_reason: str = ""
     
@@ -116,18 +240,89 @@ class ClassifyOutput(BaseModel):
 # Step 2: Generate Output ( The Mouth )
 # ============================================================
 
+class TemplateMessage(BaseModel):
+    """A filled WhatsApp template, sent instead of free-form text outside the 24h window."""
+    template_name: str
+    language: str
+    parameters: List[str] = Field(default_factory=list)  # Body parameters, {{1}} first
+
+
+class ReplyOption(BaseModel):
+    """One quick-reply button or list row. The lead's choice comes back with this id."""
+    id: str = Field(description="Short unique id, e.g. book_demo")
+    title: str = Field(description="Label shown to the lead: at most 20 characters for buttons, 24 for list rows")
+    cta_id: Optional[UUID] = Field(None, description="UUID of the CTA this option leads to, or null")
+    stage: Optional[ConversationStage] = Field(None, description="Stage this option moves the conversation to, or null")
+
+
+class InteractiveOptions(BaseModel):
+    """Tappable answers sent with message_text: up to 3 buttons, or a list menu of up to 10 rows."""
+    type: Literal["buttons", "list"]
+    button_text: str = Field("Options", description="List menus only: label of the button that opens the list")
+    options: List[ReplyOption]
+
+
 class GenerateOutput(BaseModel):
     """
     Output from Step 2: Generate.
     The actual message to send.
     """
-    message_text: str = ""  # The generated response
-    message_language: str = "en"
-    selected_cta_id: Optional[UUID] = None
-    next_followup_in_minutes: int = 0  # Optional override from generator
+    # Descriptions are sent to the model (llm.utils.get_generate_schema)
+    message_text: str = Field("", description="The message to send to the lead")
+    message_language: str = Field("en", description="ISO 639-1 code of the message language")
+    selected_cta_id: Optional[UUID] = Field(None, description="UUID of the CTA to select, or null")
+    next_followup_in_minutes: int = Field(0, description="Minutes until the next follow-up, 0 to keep the default")
+    interactive: Optional[InteractiveOptions] = Field(
+        None, description="Quick-reply buttons or a list menu for a question with clear choices, otherwise null"
+    )
+    # Set in template mode; message_text then holds the rendered body for the transcript
+    template_message: Optional[TemplateMessage] = None
     
     self_check_passed: bool = True
     violations: List[str] = Field(default_factory=list)
+    guardrail_hits: List[str] = Field(default_factory=list)  # Forbidden claims the model made, even if a retry fixed them
+    ungrounded_claims: List[str] = Field(default_factory=list)  # Claims llm.steps.verify found no support for
+    # message_text as WhatsApp bubbles (llm.message_parts); empty means send message_text as is
+    message_parts: List[str] = Field(default_factory=list)
+    message_part_delays_ms: List[int] = Field(default_factory=list)  # Wait before sending each part
+
+
+# GenerateOutput fields set by our checks, never by the model
+GENERATE_INTERNAL_FIELDS = frozenset({
+    "self_check_passed", "violations", "template_message", "guardrail_hits", "ungrounded_claims",
+    "message_parts", "message_part_delays_ms",
+})
+
+
+# ============================================================
+# Token Usage & Step Metrics
+# ============================================================
+
+class TokenUsage(BaseModel):
+    """Token counts reported by the provider for one or more LLM calls."""
+    prompt_tokens: int = 0
+    completion_tokens: int = 0
+    total_tokens: int = 0
+    cached_tokens: int = 0  # Subset of prompt_tokens served from the provider's prompt cache
+    cost_usd: float = 0.0  # Priced via llm.cost at call time
+
+    def __add__(self, other: "TokenUsage") -> "TokenUsage":
+        return TokenUsage(
+            prompt_tokens=self.prompt_tokens + other.prompt_tokens,
+            completion_tokens=self.completion_tokens + other.completion_tokens,
+            total_tokens=self.total_tokens + other.total_tokens,
+            cached_tokens=self.cached_tokens + other.cached_tokens,
+            cost_usd=self.cost_usd + other.cost_usd,
+        )
+
+
+class StepMetrics(BaseModel):
+    """Latency and token usage of one pipeline step (all of its LLM calls)."""
+    latency_ms: int = 0
+    usage: TokenUsage = Field(default_factory=TokenUsage)
+
+    def __add__(self, other: "StepMetrics") -> "StepMetrics":
+        return StepMetrics(latency_ms=self.latency_ms + other.latency_ms, usage=self.usage + other.usage)
 
 
 # ============================================================
@@ -141,12 +336,25 @@ class SummaryOutput(BaseModel):
     """
     updated_rolling_summary: str = Field(..., max_length=2000)
     needs_recursive_summary: bool = False  # If true, this summary is partial/queued
+    lead_profile: LeadProfile = Field(default_factory=LeadProfile)  # Input profile merged with new facts
+    source: Literal["llm", "compacted", "fallback"] = "llm"  # How this revision was produced
+    metrics: StepMetrics = Field(default_factory=StepMetrics)  # Memory runs after the result is built
 
 
 # ============================================================
 # Complete Pipeline Result
 # ============================================================
 
+class RawCapture(BaseModel):
+    """One LLM call exactly as sent and received, for reproducing a bad output (PipelineResult.raw_captures)."""
+    step: str
+    messages: List[Dict[str, Any]]  # The rendered prompt
+    raw_response: Optional[str] = None  # Completion text before parsing; None if the call failed without one
+    model: Optional[str] = None
+    provider: Optional[str] = None
+    error: Optional[str] = None
+
+
 class PipelineResult(BaseModel):
     """
     Complete result from running the Router-Agent pipeline.
@@ -155,18 +363,40 @@ class PipelineResult(BaseModel):
     classification: ClassifyOutput
     response: Optional[GenerateOutput] = None
     summary: Optional[SummaryOutput] = None
+    cta_action: Optional[CTAAction] = None  # CTA to execute, from the Brain or the Mouth's selection
     
     # Metadata
+    request_id: Optional[str] = None  # Shared by all LLM calls of this run (see RunContext)
+    prompt_version: Optional[str] = None  # Prompts the run used (llm.prompt_store)
     pipeline_latency_ms: int = 0
     total_tokens_used: int = 0
+    total_cost_usd: float = 0.0
+    total_cost_inr: float = 0.0
+    token_usage: Dict[str, TokenUsage] = Field(default_factory=dict)  # Per-step breakdown, keyed by step name
+    step_metrics: Dict[str, StepMetrics] = Field(default_factory=dict)  # Same keys, with latency
+    raw_captures: List[RawCapture] = Field(default_factory=list)  # Every LLM call, when capture_raw is on
+    shadow: bool = False  # Evaluation run (llm.shadow): the reply is never sent, the summary never saved
     
     # Async Flags
     needs_background_summary: bool = True
     
+    def record_step(self, step: str, metrics: StepMetrics) -> None:
+        """Add a step that ran after the result was built (e.g. inline Memory) to the totals."""
+        self.step_metrics[step] = metrics
+        self.token_usage[step] = metrics.usage
+        self.pipeline_latency_ms += metrics.latency_ms
+        self.total_tokens_used += metrics.usage.total_tokens
+        self.total_cost_usd += metrics.usage.cost_usd
+
     # Computed actions helpers
     @property
-    def should_send_message(self) -> bool:
+    def would_send_message(self) -> bool:
+        """Whether the run produced a reply, even if it is a shadow run that must not send it."""
         return self.classification.should_respond and self.response is not None and bool(self.response.message_text)
+
+    @property
+    def should_send_message(self) -> bool:
+        return self.would_send_message and not self.shadow
     
     @property
     def should_schedule_followup(self) -> bool:
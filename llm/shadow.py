@@ -0,0 +1,277 @@
+"""
+Shadow Runs.
+Evaluates a prompt or model change on live traffic without it reaching a lead:
+the same turn is re-run as a shadow pipeline run (every step, Memory included,
+but nothing is sent or saved) and compared with what production did. Each
+comparison goes to the installed ShadowSink.
+
+The worker does this in the background with LLM_SHADOW_MODE=compare, on
+LLM_SHADOW_PROVIDER / LLM_SHADOW_MODEL and the candidate prompts of the shadow
+prompt store (LLM_SHADOW_PROMPT_VERSION / LLM_SHADOW_PROMPT_PATH). Their calls
+use circuit breakers and concurrency slots of their own (SHADOW_POOL), so a
+struggling candidate never slows or trips production. Callers can pass any
+client, e.g. to shadow through a different gateway, or a PromptBundle.
+
+Usage:
+    comparison = run_shadow(context, "How much?", production_result)
+    comparison.matches  # Same action, stage and send decision
+"""
+import logging
+import random
+import threading
+import time
+from abc import ABC, abstractmethod
+from concurrent.futures import Future, ThreadPoolExecutor
+from contextlib import nullcontext
+from typing import List, Optional
+
+from pydantic import BaseModel, Field
+
+from llm.client import LLMClient, PinnedLLMClient
+from llm.config import llm_config
+from llm.pipeline import run_pipeline
+from llm.prompt_store import FilePromptStore, PromptBundle, PromptStore, use_bundle
+from llm.run_context import RunContext
+from llm.schemas import PipelineInput, PipelineResult
+from llm.steps.variation import similarity
+
+logger = logging.getLogger(__name__)
+
+SHADOW_MODES = ("off", "compare")
+SHADOW_POOL = "shadow"  # Breaker/concurrency pool of shadow calls (llm.api_helpers.make_api_call)
+
+
+class ShadowComparison(BaseModel):
+    """How a shadow run differed from the production run of the same turn."""
+    conversation_id: Optional[str] = None
+    request_id: Optional[str] = None  # The production run's
+    user_message: str = ""
+    production_action: str
+    shadow_action: str
+    production_stage: str
+    shadow_stage: str
+    production_sent: bool
+    shadow_would_send: bool
+    production_message: str = ""
+    shadow_message: str = ""
+    message_similarity: float = 1.0  # 0.0-1.0 (llm.steps.variation.similarity); 1.0 when neither replied
+    production_cost_usd: float = 0.0
+    shadow_cost_usd: float = 0.0
+    production_prompt_version: Optional[str] = None
+    shadow_prompt_version: Optional[str] = None
+    differences: List[str] = Field(default_factory=list)
+    created_at: float = Field(default_factory=time.time)
+
+    @property
+    def matches(self) -> bool:
+        return not self.differences
+
+
+def _message(result: PipelineResult) -> str:
+    return result.response.message_text if result.would_send_message else ""
+
+
+def compare_results(
+    production: PipelineResult,
+    shadow: PipelineResult,
+    conversation_id: Optional[str] = None,
+    user_message: str = "",
+) -> ShadowComparison:
+    """Side-by-side of the decisions and replies of two runs of the same turn."""
+    production_message, shadow_message = _message(production), _message(shadow)
+    comparison = ShadowComparison(
+        conversation_id=conversation_id,
+        request_id=production.request_id,
+        user_message=user_message,
+        production_action=production.classification.action.value,
+        shadow_action=shadow.classification.action.value,
+        production_stage=production.classification.new_stage.value,
+        shadow_stage=shadow.classification.new_stage.value,
+        production_sent=production.would_send_message,
+        shadow_would_send=shadow.would_send_message,
+        production_message=production_message,
+        shadow_message=shadow_message,
+        message_similarity=(
+            similarity(production_message, shadow_message) if production_message or shadow_message else 1.0
+        ),
+        production_cost_usd=production.total_cost_usd,
+        shadow_cost_usd=shadow.total_cost_usd,
+        production_prompt_version=production.prompt_version,
+        shadow_prompt_version=shadow.prompt_version,
+    )
+    if comparison.production_action != comparison.shadow_action:
+        comparison.differences.append(f"action: {comparison.production_action} -> {comparison.shadow_action}")
+    if comparison.production_stage != comparison.shadow_stage:
+        comparison.differences.append(f"stage: {comparison.production_stage} -> {comparison.shadow_stage}")
+    if comparison.production_sent != comparison.shadow_would_send:
+        comparison.differences.append(
+            f"send: {comparison.production_sent} -> {comparison.shadow_would_send}"
+        )
+    return comparison
+
+
+class ShadowSink(ABC):
+    """Persists shadow comparisons (log, DB, evaluation dashboard...)."""
+
+    @abstractmethod
+    def record(self, comparison: ShadowComparison) -> None:
+        raise NotImplementedError
+
+
+class LoggingShadowSink(ShadowSink):
+    """Default sink: writes the comparison to the llm log."""
+
+    def record(self, comparison: ShadowComparison) -> None:
+        logging.getLogger("llm").info(
+            f"SHADOW conversation={comparison.conversation_id} [req {comparison.request_id}] "
+            f"{'match' if comparison.matches else 'DIFF ' + '; '.join(comparison.differences)} "
+            f"similarity={comparison.message_similarity:.2f} "
+            f"prompts={comparison.production_prompt_version}->{comparison.shadow_prompt_version}\n"
+            f"production: {comparison.production_message}\nshadow: {comparison.shadow_message}"
+        )
+
+
+_shadow_sink: ShadowSink = LoggingShadowSink()
+
+
+def set_shadow_sink(sink: ShadowSink) -> None:
+    global _shadow_sink
+    _shadow_sink = sink
+
+
+def get_shadow_sink() -> ShadowSink:
+    return _shadow_sink
+
+
+def shadow_client() -> LLMClient:
+    """
+    The client shadow runs use: LLM_SHADOW_PROVIDER / LLM_SHADOW_MODEL, else each
+    step's own, in SHADOW_POOL.
+    """
+    return PinnedLLMClient(llm_config.shadow_provider, llm_config.shadow_model, pool=SHADOW_POOL)
+
+
+_shadow_prompt_store: Optional[PromptStore] = None
+_shadow_prompts: Optional[PromptBundle] = None
+_shadow_prompts_checked: Optional[float] = None
+_shadow_prompts_lock = threading.Lock()
+
+
+def set_shadow_prompt_store(store: Optional[PromptStore]) -> None:
+    """Install where candidate prompts come from (e.g. a published version via the internal API)."""
+    global _shadow_prompt_store, _shadow_prompts_checked
+    with _shadow_prompts_lock:
+        _shadow_prompt_store = store
+        _shadow_prompts_checked = None
+
+
+def get_shadow_prompt_store() -> Optional[PromptStore]:
+    """The installed store, else the file store when LLM_SHADOW_PROMPT_PATH is set, else None."""
+    if _shadow_prompt_store is not None:
+        return _shadow_prompt_store
+    if llm_config.shadow_prompt_path:
+        return FilePromptStore(llm_config.shadow_prompt_path)
+    return None
+
+
+def shadow_prompts() -> Optional[PromptBundle]:
+    """
+    The candidate prompts shadow runs use, or None for production's. Loaded every
+    LLMConfig.prompt_reload_seconds; a failed load keeps the previous bundle.
+    """
+    global _shadow_prompts, _shadow_prompts_checked
+    store = get_shadow_prompt_store()
+    if store is None:
+        return None
+    with _shadow_prompts_lock:
+        now = time.monotonic()
+        if _shadow_prompts_checked is not None and now - _shadow_prompts_checked < llm_config.prompt_reload_seconds:
+            return _shadow_prompts
+        _shadow_prompts_checked = now
+        try:
+            _shadow_prompts = store.load()
+        except Exception as e:
+            logger.error(f"Shadow prompt store load failed, keeping the previous prompts: {e}")
+        return _shadow_prompts
+
+
+def run_shadow(
+    context: PipelineInput,
+    user_message: str,
+    production: PipelineResult,
+    client: Optional[LLMClient] = None,
+    prompts: Optional[PromptBundle] = None,
+) -> ShadowComparison:
+    """
+    Re-run a turn as a shadow run and record its comparison with production.
+    Runs without a deadline (it is not answering anyone) under the production
+    run's request ID plus ":shadow", so both show up together in the logs but
+    the shadow calls never share an idempotency key (and a vendor's cached
+    response) with production's. The comparison carries production's request
+    ID. prompts (default:
+    shadow_prompts()) apply to this run only; an invalid bundle raises
+    PromptTemplateError before anything runs.
+    """
+    prompts = prompts or shadow_prompts()
+    with use_bundle(prompts) if prompts else nullcontext():
+        shadow = run_pipeline(
+            context,
+            user_message,
+            ctx=RunContext(request_id=f"{production.request_id}:shadow"),
+            client=client or shadow_client(),
+            shadow=True,
+        )
+    comparison = compare_results(production, shadow, context.conversation_id, user_message)
+    try:
+        get_shadow_sink().record(comparison)
+    except Exception as e:
+        logger.error(f"Shadow sink failed [req {production.request_id}]: {e}", exc_info=True)
+    return comparison
+
+
+_shadow_executor: Optional[ThreadPoolExecutor] = None
+_shadow_executor_lock = threading.Lock()
+
+
+def _get_shadow_executor() -> ThreadPoolExecutor:
+    global _shadow_executor
+    with _shadow_executor_lock:
+        if _shadow_executor is None:
+            _shadow_executor = ThreadPoolExecutor(
+                max_workers=llm_config.shadow_workers, thread_name_prefix="llm-shadow"
+            )
+        return _shadow_executor
+
+
+def _run_shadow_logged(context: PipelineInput, user_message: str, production: PipelineResult) -> None:
+    try:
+        run_shadow(context, user_message, production)
+    except Exception as e:
+        logger.error(f"Shadow run failed [req {production.request_id}]: {e}", exc_info=True)
+
+
+def validate_shadow_config() -> None:
+    """Raise ValueError on an unknown LLM_SHADOW_MODE; call at startup to fail fast."""
+    if llm_config.shadow_mode not in SHADOW_MODES:
+        raise ValueError(f"Unknown shadow mode {llm_config.shadow_mode!r}; expected one of {SHADOW_MODES}")
+
+
+def maybe_submit_shadow(
+    context: PipelineInput, user_message: str, production: PipelineResult
+) -> Optional[Future]:
+    """
+    Queue a background shadow run of a production turn when LLM_SHADOW_MODE=compare
+    and the turn is sampled (LLMConfig.shadow_sample_rate). Never delays or breaks
+    the reply: an unknown mode or a failed submit is logged and the run skipped.
+    """
+    mode = llm_config.shadow_mode
+    if mode not in SHADOW_MODES:
+        logger.error(f"Unknown shadow mode {mode!r}, skipping shadow run [req {production.request_id}]")
+        return None
+    if mode == "off" or production.shadow or random.random() >= llm_config.shadow_sample_rate:
+        return None
+    try:
+        return _get_shadow_executor().submit(_run_shadow_logged, context, user_message, production)
+    except Exception as e:
+        logger.error(f"Shadow run not submitted [req {production.request_id}]: {e}", exc_info=True)
+        return None
@@ -1,14 +1,26 @@
 """
 Step 1: BRAIN - Analyze and Decide in one step.
+In self-consistency stages (LLMConfig.self_consistency_stages) several
+candidates are sampled and the decision most of them agree on is kept.
 """
+import contextvars
+import json
 import logging
 import time
-from typing import Tuple
-from llm.api_helpers import make_api_call
-from llm.schemas import PipelineInput, ClassifyOutput, RiskFlags
-from llm.prompts import BRAIN_USER_TEMPLATE, BRAIN_USER_HISTORY_TEMPLATE
+from collections import defaultdict
+from concurrent.futures import ThreadPoolExecutor
+from typing import Dict, List, Tuple, Optional
+from llm.client import LLMClient, resolve_client
+from llm.config import llm_config
+from llm.prompt_budget import fit_to_budget
+from llm.cta import build_cta_action, parse_params
+from llm.datetime_parsing import parse_now, resolve_datetime, resolve_minutes, to_rfc3339
+from llm.run_context import RunContext, raise_if_cancelled
+from llm.schemas import PipelineInput, ClassifyOutput, RiskFlags, TokenUsage
+from llm.prompt_templates import BRAIN_USER, BRAIN_USER_HISTORY, VALIDATION_REPAIR
 from llm.prompts_registry import get_brain_system_prompt
 from llm.utils import normalize_enum, get_classify_schema, format_ctas
+from llm.metrics import STEP_FALLBACKS
 from server.enums import (
     ConversationStage, DecisionAction, IntentLevel, 
     UserSentiment, RiskLevel
@@ -44,13 +56,13 @@ def _build_user_prompt(context: PipelineInput, is_opening: bool) -> str:
     # 1. Format History Section (Only for replies)
     history_section = ""
     if not is_opening:
-        history_section = BRAIN_USER_HISTORY_TEMPLATE.format(
+        history_section = BRAIN_USER_HISTORY.render(
             rolling_summary=context.rolling_summary or "No summary yet",
             last_messages=_format_messages(context.last_messages)
         )
     
     # 2. Build Full Prompt
-    return BRAIN_USER_TEMPLATE.format(
+    return BRAIN_USER.render(
         history_section=history_section,
         available_ctas=format_ctas(context.available_ctas),
         conversation_stage=context.conversation_stage.value,
@@ -64,6 +76,29 @@ def _build_user_prompt(context: PipelineInput, is_opening: bool) -> str:
     )
 
 
+def _enum_problem(data: dict, field: str, enum_class) -> Optional[str]:
+    raw = data.get(field)
+    if isinstance(raw, str) and normalize_enum(raw, enum_class, log_corrections=False) is not None:
+        return None
+    return f'{field}: {json.dumps(raw)} is not one of {", ".join(member.value for member in enum_class)}'
+
+
+def _validation_problems(data: dict) -> List[str]:
+    """
+    Critical fields _validate_and_build_output would have to replace with a
+    default, described for the model (VALIDATION_REPAIR).
+    """
+    problems = [
+        problem for problem in (
+            _enum_problem(data, "action", DecisionAction),
+            _enum_problem(data, "new_stage", ConversationStage),
+        ) if problem
+    ]
+    if not isinstance(data.get("should_respond"), bool):
+        problems.append(f'should_respond: {json.dumps(data.get("should_respond"))} must be true or false')
+    return problems
+
+
 def _validate_and_build_output(data: dict, context: PipelineInput) -> ClassifyOutput:
     """Validate and build typed output from raw JSON."""
     
@@ -86,6 +121,18 @@ def _validate_and_build_output(data: dict, context: PipelineInput) -> ClassifyOu
     
     # 3. Action Logic
     action = normalize_enum(data.get("action"), DecisionAction, DecisionAction.WAIT_SCHEDULE)
+
+    # 4. Times: relative ones resolve against now_local (organization timezone); past ones are dropped
+    now = parse_now(context.timing.now_local)
+    scheduled_at = resolve_datetime(data.get("cta_scheduled_at"), now)
+
+    # 5. CTA: only the organization's CTAs, with valid params
+    cta_action = build_cta_action(
+        data.get("selected_cta_id"),
+        context.available_ctas,
+        params=parse_params(data.get("cta_params")),
+        scheduled_at=scheduled_at,
+    )
     
     result = ClassifyOutput(
         thought_process=data.get("thought_process", "No thought provided"),
@@ -98,9 +145,10 @@ def _validate_and_build_output(data: dict, context: PipelineInput) -> ClassifyOu
         new_stage=llm_stage,
         should_respond=data.get("should_respond", False),
         
-        selected_cta_id=data.get("selected_cta_id"),
-        cta_scheduled_at=data.get("cta_scheduled_at"),
-        followup_in_minutes=max(0, data.get("followup_in_minutes", 0)),
+        selected_cta_id=cta_action.cta_id if cta_action else None,
+        cta_scheduled_at=to_rfc3339(scheduled_at) if scheduled_at else None,
+        cta_action=cta_action,
+        followup_in_minutes=resolve_minutes(data.get("followup_in_minutes"), now),
         followup_reason=data.get("followup_reason", ""),
         
         confidence=confidence,
@@ -109,42 +157,161 @@ def _validate_and_build_output(data: dict, context: PipelineInput) -> ClassifyOu
     return result
 
 
-def run_brain(context: PipelineInput) -> Tuple[ClassifyOutput, int, int]:
-    """
-    Run the Brain step.
-    """
+def _build_messages(context: PipelineInput) -> List[Dict[str, str]]:
     is_opening = _is_opening_message(context)
-    user_prompt = _build_user_prompt(context, is_opening)
     system_prompt = get_brain_system_prompt(
         context.conversation_stage, 
         is_opening, 
-        flow_prompt=context.flow_prompt
+        flow_prompt=context.flow_prompt,
+        overrides=context.prompt_overrides,
+    )
+    return [
+        {"role": "system", "content": system_prompt},
+        {"role": "user", "content": _build_user_prompt(context, is_opening)},
+    ]
+
+
+RISK_SCORES = {RiskLevel.LOW: 0, RiskLevel.MEDIUM: 1, RiskLevel.HIGH: 2}
+
+
+def _risk_score(output: ClassifyOutput) -> int:
+    flags = output.risk_flags
+    return sum(RISK_SCORES[level] for level in (flags.spam_risk, flags.policy_risk, flags.hallucination_risk))
+
+
+def _decision_key(output: ClassifyOutput) -> tuple:
+    return (output.action, output.new_stage, output.should_respond, output.selected_cta_id)
+
+
+def pick_consistent(candidates: List[ClassifyOutput]) -> ClassifyOutput:
+    """
+    The candidate whose decision (action, stage, respond, CTA) most candidates
+    share; ties go to the lower-risk, then higher-confidence decision. Within
+    the winning decision, the most confident candidate is returned.
+    """
+    groups: Dict[tuple, List[ClassifyOutput]] = defaultdict(list)
+    for candidate in candidates:
+        groups[_decision_key(candidate)].append(candidate)
+    winner = max(
+        groups.values(),
+        key=lambda group: (
+            len(group),
+            -min(_risk_score(candidate) for candidate in group),
+            max(candidate.confidence for candidate in group),
+        ),
     )
+    chosen = max(winner, key=lambda candidate: candidate.confidence)
+    logger.info(f"Brain self-consistency: {len(winner)}/{len(candidates)} candidates agree on {chosen.action.value} -> {chosen.new_stage.value}")
+    return chosen
+
+
+def _sample_count(context: PipelineInput) -> int:
+    if context.conversation_stage.value in llm_config.self_consistency_stages:
+        return max(1, llm_config.self_consistency_samples)
+    return 1
+
+
+def run_brain(
+    context: PipelineInput,
+    ctx: Optional[RunContext] = None,
+    client: Optional[LLMClient] = None,
+) -> Tuple[ClassifyOutput, int, TokenUsage]:
+    """
+    Run the Brain step.
+    Returns (output, latency_ms, token_usage); with self-consistency the usage
+    covers every sampled candidate.
+    """
+    context = fit_to_budget(context, _build_messages, llm_config.prompt_token_budget, step_name="Brain")
+    messages = _build_messages(context)
     
     start_time = time.time()
-    
-    try:
-        data = make_api_call(
-            messages=[
-                {"role": "system", "content": system_prompt},
-                {"role": "user", "content": user_prompt},
-            ],
+    samples = _sample_count(context)
+
+    sampling = llm_config.sampling_for("Brain")
+
+    def complete(
+        call_messages: List[Dict[str, str]],
+        temperature: float,
+        cache: Optional[bool],
+        idempotency_suffix: Optional[str],
+    ):
+        return resolve_client(client).complete(
+            messages=call_messages,
             response_format={"type": "json_schema", "json_schema": get_classify_schema()},
-            temperature=0.3,
-            step_name="Brain"
+            temperature=temperature,
+            max_tokens=sampling["max_tokens"],
+            step_name="Brain",
+            ctx=ctx,
+            cache=cache,
+            idempotency_suffix=idempotency_suffix,
         )
+
+    def classify(
+        temperature: float,
+        cache: Optional[bool] = None,
+        idempotency_suffix: Optional[str] = None,
+    ) -> Tuple[ClassifyOutput, TokenUsage]:
+        response = complete(messages, temperature, cache, idempotency_suffix)
+        data, usage = response.data, response.usage
+        call_messages = messages
+        for attempt in range(1, llm_config.validation_retries + 1):
+            problems = _validation_problems(data)
+            if not problems:
+                break
+            logger.warning(f"Brain output invalid ({'; '.join(problems)}), re-asking")
+            call_messages = call_messages + [
+                {"role": "assistant", "content": json.dumps(data, ensure_ascii=False)},
+                {"role": "user", "content": VALIDATION_REPAIR.render(problems="\n".join(f"- {p}" for p in problems))},
+            ]
+            reask_suffix = f"{idempotency_suffix}:reask{attempt}" if idempotency_suffix else f"reask{attempt}"
+            try:
+                # Never cached, and keyed apart from the call: the same broken reply would come straight back
+                reasked = complete(call_messages, temperature, cache=False, idempotency_suffix=reask_suffix)
+            except Exception as e:
+                raise_if_cancelled(e)
+                logger.warning(f"Brain validation re-ask failed, using defaults: {e}")
+                break
+            data, usage = reasked.data, usage + reasked.usage
+        return _validate_and_build_output(data, context), usage
+
+    def sample(index: int) -> Optional[Tuple[ClassifyOutput, TokenUsage]]:
+        try:
+            # Cached responses, or one shared idempotency key, would make every candidate identical
+            return classify(llm_config.self_consistency_temperature, cache=False, idempotency_suffix=f"sample{index}")
+        except Exception as e:
+            raise_if_cancelled(e)
+            logger.warning(f"Brain candidate failed: {e}")
+            return None
+    
+    try:
+        if samples > 1:
+            # Candidates render prompts like this run does (e.g. a shadow run's, llm.prompt_store.use_bundle)
+            run_context = contextvars.copy_context()
+            with ThreadPoolExecutor(max_workers=samples) as executor:
+                results = [
+                    result
+                    for result in executor.map(lambda index: run_context.copy().run(sample, index), range(samples))
+                    if result
+                ]
+            if not results:
+                raise RuntimeError(f"all {samples} Brain candidates failed")
+            output = pick_consistent([candidate for candidate, _ in results])
+            usage = sum((candidate_usage for _, candidate_usage in results), TokenUsage())
+        else:
+            output, usage = classify(sampling["temperature"])
         
         latency_ms = int((time.time() - start_time) * 1000)
-        output = _validate_and_build_output(data, context)
         
         logger.info(f"Brain: {output.action.value} -> {output.new_stage.value} (Conf: {output.confidence})")
         if output.needs_human_attention:
             logger.info(f"🚨 Human attention flagged for conversation")
         
-        return output, latency_ms, 0 
+        return output, latency_ms, usage
         
     except Exception as e:
+        raise_if_cancelled(e)
         logger.error(f"Brain failed: {e}")
+        STEP_FALLBACKS.inc(step="brain")
         fallback_output = ClassifyOutput(
             thought_process="System error during classification. Falling back to safe state.",
             situation_summary="Error",
@@ -156,4 +323,4 @@ def run_brain(context: PipelineInput) -> Tuple[ClassifyOutput, int, int]:
             should_respond=False,
             confidence=0.0
         )
-        return fallback_output, int((time.time() - start_time) * 1000), 0
+        return fallback_output, int((time.time() - start_time) * 1000), TokenUsage()
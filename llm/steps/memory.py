@@ -1,69 +1,264 @@
 """
 Step 3: MEMORY - Background Process.
-Updates the rolling summary.
+Updates the rolling summary, compacting it into key facts + a short narrative
+once it grows past LLMConfig.memory_summary_max_chars, and extracts structured
+lead facts into the LeadProfile. LLMConfig.memory_summary_max_tokens is a hard
+cap enforced deterministically (see truncate_summary). If the LLM is unavailable,
+a rule-based line is appended instead so the summary never falls behind.
 """
 
 import logging
+import re
 import time
-from typing import Tuple, Optional
-from llm.schemas import PipelineInput, SummaryOutput, ClassifyOutput
-from llm.prompts import MEMORY_SYSTEM_PROMPT, MEMORY_USER_TEMPLATE
-from llm.api_helpers import make_api_call
+from typing import List, Tuple, Optional
+from llm.config import llm_config
+from llm.schemas import PipelineInput, SummaryOutput, ClassifyOutput, TokenUsage, LeadProfile, StepMetrics
+from llm.prompts_registry import get_memory_system_prompt
+from llm.prompt_templates import MEMORY_USER, MEMORY_COMPACT_SYSTEM, MEMORY_COMPACT_USER
+from llm.client import LLMClient, resolve_client
+from llm.memory_audit import record_summary_revision
+from llm.utils import estimate_tokens
+from llm.run_context import RunContext, raise_if_cancelled
 
 logger = logging.getLogger(__name__)
 
+# Hard limit of SummaryOutput.updated_rolling_summary
+SUMMARY_MAX_LENGTH = 2000
+COMPACT_MAX_FACTS = 12
+COMPACT_MAX_WORDS = 100
+KEY_FACTS_HEADER = "KEY FACTS:"
+SUMMARY_HEADER = "SUMMARY:"
+FALLBACK_MESSAGE_CHARS = 120
+_SENTENCE_BREAK = re.compile(r"(?<=[.!?\u0964])\s+|\n+")  # \u0964: Devanagari danda
+
 
 def run_memory(
     context: PipelineInput,
     user_message: str,
     bot_message: str,
-    classification: ClassifyOutput
-) -> Optional[str]:
+    classification: ClassifyOutput,
+    ctx: Optional[RunContext] = None,
+    client: Optional[LLMClient] = None,
+    raise_errors: bool = False,
+    audit: bool = True,
+) -> Optional[SummaryOutput]:
     """
     Run the Memory step in "background".
-    Returns the new summary string so the worker can save it.
+    Returns the new summary and merged lead profile so the worker can save them;
+    SummaryOutput.metrics carries the step's latency and token usage.
+    On failure the exchange is appended by fallback_summary, unless raise_errors
+    is set (callers that retry, such as llm.memory_queue.MemoryWorker).
+    audit=False skips the memory audit trail (shadow runs, whose summary is never saved).
     """
+    start_time = time.time()
     try:
         # 1. Run LLM
-        output, latency, tokens = _run_memory_llm(context, user_message, bot_message, classification)
-        return output.updated_rolling_summary
+        output, latency, tokens = _run_memory_llm(
+            context, user_message, bot_message, classification, ctx=ctx, client=client
+        )
+        output.metrics = StepMetrics(latency_ms=latency, usage=tokens)
+        if audit:
+            record_summary_revision(context, output, user_message, bot_message, ctx.request_id if ctx else None)
+        return output
         
     except Exception as e:
-        logger.error(f"Memory failed: {e}")
-        return context.rolling_summary or "No summary available"
+        raise_if_cancelled(e)
+        if raise_errors:
+            raise
+        logger.error(f"Memory failed, using fallback summary: {e}")
+        output = fallback_summary(context, user_message, bot_message, classification)
+        output.metrics = StepMetrics(latency_ms=int((time.time() - start_time) * 1000))
+        if audit:
+            record_summary_revision(context, output, user_message, bot_message, ctx.request_id if ctx else None)
+        return output
+
+
+def _clip(text: str, limit: int = FALLBACK_MESSAGE_CHARS) -> str:
+    text = " ".join(text.split())
+    return text if len(text) <= limit else text[:limit - 3].rstrip() + "..."
+
+
+def fallback_summary(
+    context: PipelineInput,
+    user_message: str,
+    bot_message: str,
+    classification: ClassifyOutput,
+) -> SummaryOutput:
+    """
+    Rule-based update used when the Memory LLM call fails: append a compact
+    "[Lead said X / Bot did Y]" line, then enforce the token cap.
+    """
+    if bot_message:
+        bot_part = f"Bot replied ({classification.action.value}): {_clip(bot_message)}"
+    else:
+        bot_part = f"Bot did not reply ({classification.action.value})"
+    line = f"[Lead said: {_clip(user_message)} / {bot_part}]"
+    summary = f"{context.rolling_summary.rstrip()}\n{line}" if context.rolling_summary else line
+    return SummaryOutput(
+        updated_rolling_summary=truncate_summary(summary),
+        lead_profile=context.lead_profile,
+        source="fallback",
+    )
 
 
 def _run_memory_llm(
     context: PipelineInput,
     user_message: str,
     bot_message: str,
-    classification: ClassifyOutput
-) -> Tuple[SummaryOutput, int, int]:
+    classification: ClassifyOutput,
+    ctx: Optional[RunContext] = None,
+    client: Optional[LLMClient] = None,
+) -> Tuple[SummaryOutput, int, TokenUsage]:
     """Core LLM Logic"""
-    user_prompt = MEMORY_USER_TEMPLATE.format(
+    user_prompt = MEMORY_USER.render(
         rolling_summary=context.rolling_summary or "No prior summary",
+        lead_profile=context.lead_profile.format_for_prompt(),
         user_message=user_message,
         bot_message=bot_message or "(No response sent)",
     )
     
     start_time = time.time()
 
-    data = make_api_call(
+    response = resolve_client(client).complete(
         messages=[
-            {"role": "system", "content": MEMORY_SYSTEM_PROMPT},
+            {"role": "system", "content": get_memory_system_prompt(context.memory_prompt, context.memory_fact_fields)},
             {"role": "user", "content": user_prompt},
         ],
         response_format={"type": "json_object"},
-        max_tokens=1000,
-        step_name="Memory"
+        **llm_config.sampling_for("Memory"),
+        step_name="Memory",
+        ctx=ctx,
     )
     
-    summary_text = data.get("updated_rolling_summary", "")
-    
+    summary_text = response.data.get("updated_rolling_summary", "")
+    usage = response.usage
+
+    source = "llm"
+    needs_recursive_summary = len(summary_text) > llm_config.memory_summary_max_chars
+    if needs_recursive_summary:
+        try:
+            summary_text, compact_usage = _compact_summary(summary_text, ctx=ctx, client=client)
+            usage = usage + compact_usage
+            needs_recursive_summary = False
+            source = "compacted"
+        except Exception as e:
+            raise_if_cancelled(e)
+            # Keep the flag set; the next update retries the compaction
+            logger.warning(f"Summary compaction failed: {e}")
+    summary_text = truncate_summary(summary_text)
+
     # Save to Schema
     output = SummaryOutput(
         updated_rolling_summary=summary_text,
-        needs_recursive_summary=False
+        needs_recursive_summary=needs_recursive_summary,
+        source=source,
+        lead_profile=context.lead_profile.merge(
+            _parse_lead_profile(response.data.get("lead_profile"), context.memory_fact_fields)
+        ),
     )
     
-    return output, int((time.time() - start_time) * 1000), 0
+    return output, int((time.time() - start_time) * 1000), usage
+
+
+def _parse_lead_profile(raw: object, fact_fields: Optional[List[str]] = None) -> LeadProfile:
+    """
+    Lenient parse: models sometimes return a string for objections or drop fields.
+    Custom facts are limited to the organization's configured fact fields.
+    """
+    if not isinstance(raw, dict):
+        return LeadProfile()
+    fields = {
+        field: str(raw[field]).strip()
+        for field in ("name", "budget", "location", "product_interest", "timeline")
+        if raw.get(field) not in (None, "", "null")
+    }
+    objections = raw.get("objections") or []
+    if isinstance(objections, str):
+        objections = [objections]
+    custom = raw.get("custom") if isinstance(raw.get("custom"), dict) else {}
+    custom_facts = {
+        field: str(custom[field]).strip()
+        for field in (fact_fields or [])
+        if custom.get(field) not in (None, "", "null")
+    }
+    return LeadProfile(
+        **fields,
+        objections=[str(objection) for objection in objections if objection],
+        custom=custom_facts,
+    )
+
+
+def _compact_summary(
+    rolling_summary: str,
+    ctx: Optional[RunContext] = None,
+    client: Optional[LLMClient] = None,
+) -> Tuple[str, TokenUsage]:
+    """Compress an over-long summary into a pinned key-facts section plus a short narrative."""
+    logger.info(f"Compacting rolling summary ({len(rolling_summary)} chars)")
+    response = resolve_client(client).complete(
+        messages=[
+            {
+                "role": "system",
+                "content": MEMORY_COMPACT_SYSTEM.render(
+                    max_facts=COMPACT_MAX_FACTS, max_words=COMPACT_MAX_WORDS
+                ),
+            },
+            {"role": "user", "content": MEMORY_COMPACT_USER.render(rolling_summary=rolling_summary)},
+        ],
+        response_format={"type": "json_object"},
+        **llm_config.sampling_for("MemoryCompact"),
+        step_name="MemoryCompact",
+        ctx=ctx,
+    )
+    key_facts = [str(fact).strip() for fact in response.data.get("key_facts") or [] if str(fact).strip()]
+    compacted = format_compacted_summary(key_facts[:COMPACT_MAX_FACTS], response.data.get("summary", ""))
+    return compacted, response.usage
+
+
+def format_compacted_summary(key_facts: List[str], narrative: str) -> str:
+    """Render key facts first so later updates (and prompts) see them pinned at the top."""
+    parts = []
+    if key_facts:
+        parts.append(KEY_FACTS_HEADER + "\n" + "\n".join(f"- {fact}" for fact in key_facts))
+    if narrative.strip():
+        parts.append(SUMMARY_HEADER + "\n" + narrative.strip())
+    return "\n\n".join(parts)
+
+
+def _summary_fits(text: str, max_tokens: int) -> bool:
+    return len(text) <= SUMMARY_MAX_LENGTH and estimate_tokens(text) <= max_tokens
+
+
+def truncate_summary(summary: str, max_tokens: Optional[int] = None) -> str:
+    """
+    Deterministically bring a summary under the token cap (default
+    LLMConfig.memory_summary_max_tokens) and SummaryOutput's length limit.
+    The oldest narrative sentences go first; key facts are kept, and only
+    trailing facts are dropped if the facts alone exceed the cap.
+    """
+    max_tokens = max_tokens or llm_config.memory_summary_max_tokens
+    if _summary_fits(summary, max_tokens):
+        return summary
+
+    key_facts: List[str] = []
+    narrative = summary
+    if summary.startswith(KEY_FACTS_HEADER):
+        facts_block, _, narrative = summary.partition(SUMMARY_HEADER)
+        key_facts = [
+            line.strip()[2:] if line.strip().startswith("- ") else line.strip()
+            for line in facts_block[len(KEY_FACTS_HEADER):].splitlines()
+            if line.strip()
+        ]
+
+    sentences = [sentence for sentence in _SENTENCE_BREAK.split(narrative.strip()) if sentence.strip()]
+    while sentences and not _summary_fits(format_compacted_summary(key_facts, " ".join(sentences)), max_tokens):
+        sentences.pop(0)
+    while key_facts and not _summary_fits(format_compacted_summary(key_facts, " ".join(sentences)), max_tokens):
+        key_facts.pop()
+
+    truncated = format_compacted_summary(key_facts, " ".join(sentences)) if key_facts else " ".join(sentences)
+    if not truncated:
+        # A single run-on sentence: keep its most recent part
+        truncated = summary[-min(SUMMARY_MAX_LENGTH, max_tokens * 2):]
+    logger.info(f"Truncated rolling summary from {len(summary)} to {len(truncated)} chars")
+    return truncated
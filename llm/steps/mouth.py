@@ -3,17 +3,46 @@ Step 2: MOUTH - Write the response.
 """
 import json
 import logging
+import re
 import time
-from typing import Tuple, Optional
+from typing import Callable, Dict, List, NamedTuple, Tuple, Optional
 from uuid import UUID
-from llm.schemas import PipelineInput, ClassifyOutput, GenerateOutput
-from llm.prompts import MOUTH_USER_TEMPLATE
+from llm.schemas import (
+    PipelineInput, ClassifyOutput, GenerateOutput, TokenUsage, TemplateOption, TemplateMessage,
+    InteractiveOptions, ReplyOption,
+)
+from llm.config import llm_config
+from llm.prompt_templates import (
+    MOUTH_USER, MOUTH_CHAT_USER, MOUTH_CONSTRAINT_REPAIR, MOUTH_LANGUAGE_REPAIR, MOUTH_GUARDRAIL_REPAIR,
+    MOUTH_TEMPLATE_SYSTEM, VALIDATION_REPAIR,
+)
+from llm.guardrails import find_claim_hits
+from llm.formatting import apply_style
+from llm.language import base_language, language_mismatch, language_name
+from llm.prompt_budget import fit_to_budget
+from llm.datetime_parsing import parse_now, resolve_minutes
+from llm.message_constraints import find_violations, enforce_constraints
 from llm.prompts_registry import get_mouth_system_prompt
-from llm.api_helpers import make_api_call
-from llm.utils import format_ctas
+from llm.client import LLMClient, resolve_client
+from llm.run_context import RunContext, raise_if_cancelled
+from llm.utils import format_ctas, get_generate_schema, normalize_enum
+from llm.metrics import STEP_FALLBACKS
+from server.enums import ConversationStage
 
 logger = logging.getLogger(__name__)
 
+# Lead messages are the user's turns; bot and human-agent replies are ours
+CHAT_ROLES = {"lead": "user", "bot": "assistant", "human": "assistant"}
+
+TEMPLATE_PLACEHOLDER = re.compile(r"\{\{(\d+)\}\}")
+
+# WhatsApp interactive message limits
+MAX_BUTTONS = 3
+MAX_LIST_ROWS = 10
+BUTTON_TITLE_CHARS = 20
+LIST_TITLE_CHARS = 24
+OPTION_ID_CHARS = 200
+
 
 def _format_messages(messages: list) -> str:
     """Format messages for prompt."""
@@ -27,8 +56,8 @@ def _format_messages(messages: list) -> str:
     return "\n".join(lines)
 
 
-def _build_user_prompt(context: PipelineInput, classification: ClassifyOutput) -> str:
-    """Build the user prompt with Brain decision."""
+def _decision_json(classification: ClassifyOutput) -> str:
+    """Compact Brain decision passed to the Mouth."""
     decision_compact = {
         "action": classification.action.value,
         "new_stage": classification.new_stage.value,
@@ -36,16 +65,88 @@ def _build_user_prompt(context: PipelineInput, classification: ClassifyOutput) -
         "selected_cta_id": str(classification.selected_cta_id) if classification.selected_cta_id else None,
         "cta_scheduled_at": classification.cta_scheduled_at
     }
-    
-    return MOUTH_USER_TEMPLATE.format(
+    return json.dumps(decision_compact)
+
+
+def _build_user_prompt(context: PipelineInput, classification: ClassifyOutput) -> str:
+    """Build the user prompt with Brain decision."""
+    return MOUTH_USER.render(
         business_name=context.business_name,
         rolling_summary=context.rolling_summary or "No summary yet",
+        lead_profile=context.lead_profile.format_for_prompt(),
         last_messages=_format_messages(context.last_messages),
         available_ctas=format_ctas(context.available_ctas),
-        decision_json=json.dumps(decision_compact),
+        decision_json=_decision_json(classification),
+        conversation_stage=context.conversation_stage.value,
+    )
+
+
+def _build_chat_messages(
+    context: PipelineInput,
+    classification: ClassifyOutput,
+    system_prompt: str,
+) -> List[Dict[str, str]]:
+    """
+    Build a multi-turn transcript: system prompt, the history as role-tagged
+    turns, then the task/decision as the final user turn. Consecutive turns
+    from the same side are merged since some providers require alternation.
+    """
+    instruction = MOUTH_CHAT_USER.render(
+        business_name=context.business_name,
+        rolling_summary=context.rolling_summary or "No summary yet",
+        lead_profile=context.lead_profile.format_for_prompt(),
+        available_ctas=format_ctas(context.available_ctas),
+        decision_json=_decision_json(classification),
         conversation_stage=context.conversation_stage.value,
     )
 
+    turns: List[Dict[str, str]] = []
+    for msg in context.last_messages:
+        turns.append({"role": CHAT_ROLES[msg.sender], "content": msg.text})
+    turns.append({"role": "user", "content": instruction})
+
+    merged: List[Dict[str, str]] = []
+    for turn in turns:
+        if merged and merged[-1]["role"] == turn["role"]:
+            merged[-1] = {"role": turn["role"], "content": f"{merged[-1]['content']}\n\n{turn['content']}"}
+        else:
+            merged.append(turn)
+    return [{"role": "system", "content": system_prompt}] + merged
+
+
+def _parse_interactive(raw: object, context: PipelineInput) -> Optional[InteractiveOptions]:
+    """
+    Lenient parse of the model's quick replies, clipped to WhatsApp's limits.
+    Options pointing at unknown CTAs lose the link; nothing usable means plain text.
+    """
+    if not isinstance(raw, dict) or not isinstance(raw.get("options"), list):
+        return None
+    kind = "list" if raw.get("type") == "list" or len(raw["options"]) > MAX_BUTTONS else "buttons"
+    title_chars = LIST_TITLE_CHARS if kind == "list" else BUTTON_TITLE_CHARS
+    known_ctas = {str(cta.get("id")) for cta in context.available_ctas}
+
+    options: List[ReplyOption] = []
+    for item in raw["options"]:
+        if not isinstance(item, dict) or not str(item.get("title") or "").strip():
+            continue
+        title = " ".join(str(item["title"]).split())[:title_chars]
+        option_id = str(item.get("id") or title).strip()[:OPTION_ID_CHARS]
+        if any(option.id == option_id or option.title == title for option in options):
+            continue
+        cta_id = str(item.get("cta_id") or "")
+        stage = normalize_enum(item.get("stage"), ConversationStage)
+        options.append(ReplyOption(
+            id=option_id,
+            title=title,
+            cta_id=UUID(cta_id) if cta_id in known_ctas else None,
+            stage=stage,
+        ))
+    options = options[:MAX_LIST_ROWS if kind == "list" else MAX_BUTTONS]
+    if not options:
+        return None
+    button_text = " ".join(str(raw.get("button_text") or "Options").split())[:BUTTON_TITLE_CHARS]
+    return InteractiveOptions(type=kind, button_text=button_text, options=options)
+
 
 def _validate_and_build_output(data: dict, context: PipelineInput) -> GenerateOutput:
     """Validate and build typed output from raw JSON."""
@@ -61,56 +162,385 @@ def _validate_and_build_output(data: dict, context: PipelineInput) -> GenerateOu
             logger.warning(f"Mouth returned invalid UUID for selected_cta_id: {raw_cta_id}. Ignoring.")
             final_cta_id = None
 
+    # A null or non-string reply becomes "" for the "valid" check to re-ask, instead of failing the model
+    message_text = data.get("message_text")
+    if not isinstance(message_text, str):
+        message_text = ""
+
     return GenerateOutput(
-        message_text=data.get("message_text", ""),
-        message_language=data.get("message_language", context.language_pref),
+        message_text=message_text,
+        message_language=data.get("message_language") or context.language_pref,
         selected_cta_id=final_cta_id,
-        next_followup_in_minutes=max(0, data.get("next_followup_in_minutes", 0)),
+        next_followup_in_minutes=resolve_minutes(data.get("next_followup_in_minutes"), parse_now(context.timing.now_local)),
+        interactive=_parse_interactive(data.get("interactive"), context),
         self_check_passed=True, # Pro-forma for now
         violations=[]
     )
 
-def run_mouth(context: PipelineInput, classification: ClassifyOutput) -> Tuple[Optional[GenerateOutput], int, int]:
-    """
-    Run the Mouth step.
-    Only runs if classification.should_respond is True.
-    """
-    if not classification.should_respond:
-        return None, 0, 0
-    
+def _build_messages(context: PipelineInput, classification: ClassifyOutput) -> List[Dict[str, str]]:
     system_prompt = get_mouth_system_prompt(
         stage=classification.new_stage, # Use the NEW stage
         business_name=context.business_name,
         business_description=context.business_description,
         flow_prompt=context.flow_prompt,
-        max_words=context.max_words
+        max_words=context.max_words,
+        overrides=context.prompt_overrides,
+        examples=context.prompt_examples,
     )
+    if llm_config.mouth_chat_history:
+        return _build_chat_messages(context, classification, system_prompt)
+    return [
+        {"role": "system", "content": system_prompt},
+        {"role": "user", "content": _build_user_prompt(context, classification)},
+    ]
+
+
+def _validation_problems(data: dict) -> List[str]:
+    """Critical fields the reply can't go out without, described for the model (VALIDATION_REPAIR)."""
+    text = data.get("message_text")
+    if not isinstance(text, str) or not text.strip():
+        return [f"message_text: {json.dumps(text)}, but a reply to the lead is required"]
+    return []
+
+
+class MouthCheck(NamedTuple):
+    """A check every Mouth reply goes through (see _enforce_checks)."""
+    name: str
+    retries: int  # Re-asks this check may trigger
+    problems: Callable[[GenerateOutput, dict], List[str]]  # Empty when the reply passes
+    correction: Callable[[List[str]], str]  # The corrective instruction for those problems
+
+
+def _bullets(items: List[str]) -> str:
+    return "\n".join(f"- {item}" for item in items)
+
+
+def _mouth_checks(context: PipelineInput) -> List[MouthCheck]:
+    """
+    In order: the reply must be valid (the Mouth only runs when the Brain decided
+    to respond, so an empty reply is a model failure, not a choice), within
+    max_words / questions_per_message, in the lead's language (language_pref;
+    all three only hints to the model), and free of forbidden claims.
+    """
+    max_words, max_questions = context.max_words, context.questions_per_message
+    return [
+        MouthCheck(
+            name="valid",
+            retries=llm_config.validation_retries,
+            problems=lambda output, data: _validation_problems(data),
+            correction=lambda problems: VALIDATION_REPAIR.render(problems=_bullets(problems)),
+        ),
+        MouthCheck(
+            name="constraints",
+            retries=llm_config.mouth_constraint_retries,
+            problems=lambda output, data: find_violations(output.message_text, max_words, max_questions),
+            correction=lambda problems: MOUTH_CONSTRAINT_REPAIR.render(
+                violations=_bullets(problems), max_words=max_words, max_questions=max_questions,
+            ),
+        ),
+        MouthCheck(
+            name="language",
+            retries=llm_config.mouth_language_retries,
+            problems=lambda output, data: _language_problems(output, context),
+            correction=lambda problems: MOUTH_LANGUAGE_REPAIR.render(
+                language=language_name(context.language_pref),
+                language_code=base_language(context.language_pref),
+            ),
+        ),
+        MouthCheck(
+            name="guardrails",
+            retries=llm_config.mouth_guardrail_retries,
+            problems=lambda output, data: [
+                f'"{matched}" (not allowed: {claim})'
+                for claim, matched in find_claim_hits(output.message_text, context.forbidden_claims)
+            ],
+            correction=lambda problems: MOUTH_GUARDRAIL_REPAIR.render(hits=_bullets(problems)),
+        ),
+    ]
+
+
+def _language_problems(output: GenerateOutput, context: PipelineInput) -> List[str]:
+    mismatch = language_mismatch(output.message_text, output.message_language, context.language_pref)
+    return [mismatch] if mismatch else []
+
+
+def _reask(
+    data: dict,
+    messages: List[Dict[str, str]],
+    correction: str,
+    ctx: Optional[RunContext],
+    client: Optional[LLMClient],
+    idempotency_suffix: str,
+) -> Optional[Tuple[dict, List[Dict[str, str]], TokenUsage]]:
+    """
+    Show the model its reply plus a corrective instruction. idempotency_suffix
+    (e.g. "constraints1") keeps the provider from answering with the reply it corrects.
+    Returns (the new reply, messages including this exchange, usage), or None if the call failed.
+    """
+    messages = messages + [
+        {"role": "assistant", "content": json.dumps(data, ensure_ascii=False)},
+        {"role": "user", "content": correction},
+    ]
+    try:
+        response = resolve_client(client).complete(
+            messages=messages,
+            response_format={"type": "json_schema", "json_schema": get_generate_schema()},
+            **llm_config.sampling_for("Mouth"),
+            step_name="Mouth",
+            ctx=ctx,
+            # Never cached: a broken reply would come straight back
+            cache=False,
+            idempotency_suffix=idempotency_suffix,
+        )
+    except Exception as e:
+        raise_if_cancelled(e)
+        logger.warning(f"Mouth re-ask failed: {e}")
+        return None
+    return response.data, messages, response.usage
+
+
+def _enforce_checks(
+    output: GenerateOutput,
+    data: dict,
+    messages: List[Dict[str, str]],
+    context: PipelineInput,
+    ctx: Optional[RunContext],
+    client: Optional[LLMClient],
+    usage: TokenUsage,
+) -> Tuple[GenerateOutput, TokenUsage]:
+    """
+    Every reply, the first and each regenerated one, goes through all checks
+    (_mouth_checks): the first it fails with re-asks left regenerates it, on the
+    transcript so far. What still fails when re-asks run out gets its check's
+    last resort (_finalize). guardrail_hits records every forbidden claim any
+    of the replies made.
+    """
+    checks = _mouth_checks(context)
+    reasks_left = {check.name: check.retries for check in checks}
+    hit_claims: List[str] = []
+
+    while True:
+        hit_claims += [
+            claim for claim, _ in find_claim_hits(output.message_text, context.forbidden_claims)
+            if claim not in hit_claims
+        ]
+        failing = None
+        for check in checks:
+            problems = check.problems(output, data) if reasks_left[check.name] else []
+            if problems:
+                failing = (check, problems)
+                break
+        if failing is None:
+            break
+
+        check, problems = failing
+        reasks_left[check.name] -= 1
+        logger.warning(f"Mouth reply fails {check.name} check ({'; '.join(problems)}), re-asking")
+        attempt = check.retries - reasks_left[check.name]
+        reasked = _reask(data, messages, check.correction(problems), ctx, client, f"{check.name}{attempt}")
+        if reasked is None:
+            break
+        data, messages, reask_usage = reasked
+        usage = usage + reask_usage
+        output = _validate_and_build_output(data, context)
+
+    return _finalize(output, data, context).model_copy(update={"guardrail_hits": hit_claims}), usage
+
+
+def _finalize(output: GenerateOutput, data: dict, context: PipelineInput) -> GenerateOutput:
+    """
+    Last resorts for a reply that still fails a check: an invalid one is recorded
+    as a violation (nothing is sent), one over the limits is truncated
+    deterministically, one in the wrong language is sent anyway with a violation
+    (it beats no reply), and one making a forbidden claim is withheld (empty
+    message_text); the pipeline then flags the conversation for a human. The
+    claims are looked for in the truncated text, so what is scanned is what gets sent.
+    """
+    violations = list(output.violations)
+    update = {}
+
+    violations += [f"invalid_output: {problem}" for problem in _validation_problems(data)]
+
+    limits = find_violations(output.message_text, context.max_words, context.questions_per_message)
+    if limits:
+        update["message_text"] = enforce_constraints(
+            output.message_text, context.max_words, context.questions_per_message
+        )
+        violations += limits
+
+    violations += _language_problems(output, context)
+
+    hits = find_claim_hits(update.get("message_text", output.message_text), context.forbidden_claims)
+    if hits:
+        logger.warning(f"Withholding Mouth reply, still makes forbidden claims {[claim for claim, _ in hits]}")
+        update.update({"message_text": "", "interactive": None})
+        violations += [f"forbidden_claim: {claim}" for claim, _ in hits]
+
+    if violations != output.violations:
+        update.update({"self_check_passed": False, "violations": violations})
+    return output.model_copy(update=update) if update else output
+
+
+def _apply_style(output: GenerateOutput, context: PipelineInput) -> GenerateOutput:
+    """The organization's emoji / formatting preferences, enforced on the final reply text."""
+    overrides = context.prompt_overrides
+    styled = apply_style(output.message_text, overrides.emoji_style, overrides.whatsapp_formatting)
+    if styled == output.message_text:
+        return output
+    logger.info("Mouth reply restyled to the organization's emoji/formatting settings")
+    return output.model_copy(update={"message_text": styled})
+
+
+def _template_schema(templates: List[TemplateOption]) -> Dict:
+    return {
+        "name": "template_selection",
+        "strict": True,
+        "schema": {
+            "type": "object",
+            "properties": {
+                "template_name": {
+                    "type": ["string", "null"],
+                    "enum": [template.name for template in templates] + [None],
+                },
+                "parameters": {"type": "array", "items": {"type": "string"}},
+            },
+            "required": ["template_name", "parameters"],
+            "additionalProperties": False,
+        },
+    }
+
+
+def format_templates(templates: List[TemplateOption]) -> str:
+    return "\n\n".join(
+        f"name: {template.name}\nparameters: {template.parameter_count}\nbody: {template.body}"
+        for template in templates
+    )
+
+
+def render_template_body(body: str, parameters: List[str]) -> str:
+    """The text the lead will see, stored as the message content."""
+    return TEMPLATE_PLACEHOLDER.sub(
+        lambda match: parameters[int(match.group(1)) - 1] if int(match.group(1)) <= len(parameters) else match.group(0),
+        body,
+    )
+
+
+def _clean_parameter(value: object) -> str:
+    # WhatsApp rejects parameters with newlines, tabs or more than 4 consecutive spaces
+    return " ".join(str(value or "").split())
+
+
+def _build_template_output(data: dict, context: PipelineInput) -> GenerateOutput:
+    """Validate the model's template choice; an unusable choice yields an empty (unsendable) output."""
+    templates = {template.name: template for template in context.available_templates}
+    template = templates.get(data.get("template_name") or "")
+    if template is None:
+        return GenerateOutput(self_check_passed=False, violations=["no_matching_template"])
+
+    parameters = [_clean_parameter(value) for value in data.get("parameters") or []]
+    if len(parameters) != template.parameter_count or not all(parameters):
+        logger.warning(
+            f"Mouth filled template {template.name} with {len(parameters)} parameters, "
+            f"expected {template.parameter_count} non-empty"
+        )
+        return GenerateOutput(self_check_passed=False, violations=["invalid_template_parameters"])
+
+    return GenerateOutput(
+        message_text=render_template_body(template.body, parameters),
+        message_language=template.language.split("_")[0],
+        template_message=TemplateMessage(
+            template_name=template.name, language=template.language, parameters=parameters
+        ),
+    )
+
+
+def _run_template_mode(
+    context: PipelineInput,
+    classification: ClassifyOutput,
+    ctx: Optional[RunContext],
+    client: Optional[LLMClient],
+) -> Tuple[GenerateOutput, int, TokenUsage]:
+    """Outside the 24h window only an approved template can be sent: select one and fill it."""
+    start_time = time.time()
+    try:
+        response = resolve_client(client).complete(
+            messages=[
+                {"role": "system", "content": MOUTH_TEMPLATE_SYSTEM.render(
+                    business_name=context.business_name,
+                    templates=format_templates(context.available_templates),
+                )},
+                {"role": "user", "content": _build_user_prompt(context, classification)},
+            ],
+            response_format={"type": "json_schema", "json_schema": _template_schema(context.available_templates)},
+            **llm_config.sampling_for("Mouth"),
+            step_name="Mouth",
+            ctx=ctx,
+        )
+    except Exception as e:
+        raise_if_cancelled(e)
+        logger.error(f"Mouth template selection failed: {e}")
+        return (
+            GenerateOutput(self_check_passed=False, violations=["template_selection_failed"]),
+            int((time.time() - start_time) * 1000),
+            TokenUsage(),
+        )
+
+    output = _build_template_output(response.data, context)
+    logger.info(f"Mouth: template {output.template_message.template_name if output.template_message else None}")
+    return output, int((time.time() - start_time) * 1000), response.usage
+
+
+def run_mouth(
+    context: PipelineInput,
+    classification: ClassifyOutput,
+    ctx: Optional[RunContext] = None,
+    client: Optional[LLMClient] = None,
+) -> Tuple[Optional[GenerateOutput], int, TokenUsage]:
+    """
+    Run the Mouth step.
+    Only runs if classification.should_respond is True. When the WhatsApp
+    window is closed and approved templates exist, selects and fills a template
+    (output.template_message) instead of writing free-form text.
+    Returns (output, latency_ms, token_usage).
+    """
+    if not classification.should_respond:
+        return None, 0, TokenUsage()
+
+    if not context.timing.whatsapp_window_open and context.available_templates:
+        return _run_template_mode(context, classification, ctx, client)
     
-    user_prompt = _build_user_prompt(context, classification)
+    def build(trimmed: PipelineInput) -> List[Dict[str, str]]:
+        return _build_messages(trimmed, classification)
+
+    context = fit_to_budget(context, build, llm_config.prompt_token_budget, step_name="Mouth")
+    messages = build(context)
     
     start_time = time.time()
     
     try:
-        data = make_api_call(
-            messages=[
-                {"role": "system", "content": system_prompt},
-                {"role": "user", "content": user_prompt},
-            ],
-            response_format={"type": "json_object"},
-            step_name="Mouth"
+        response = resolve_client(client).complete(
+            messages=messages,
+            response_format={"type": "json_schema", "json_schema": get_generate_schema()},
+            **llm_config.sampling_for("Mouth"),
+            step_name="Mouth",
+            ctx=ctx,
         )
         
+        output = _validate_and_build_output(response.data, context)
+        output, usage = _enforce_checks(output, response.data, messages, context, ctx, client, response.usage)
+        output = _apply_style(output, context)
         latency_ms = int((time.time() - start_time) * 1000)
-        output = _validate_and_build_output(data, context)
         
         logger.info(f"Mouth: {len(output.message_text)} chars")
-        return output, latency_ms, 0
+        return output, latency_ms, usage
         
     except Exception as e:
+        raise_if_cancelled(e)
         logger.error(f"Mouth failed: {e}")
+        STEP_FALLBACKS.inc(step="mouth")
         # SIMPLE FALLBACK: Maintain continuity without crashing
         fallback_output = GenerateOutput(
             message_text="I'm sorry, I'm having a bit of trouble connecting. Could you please try again in a moment?",
             message_language="en"
         )
-        return fallback_output, int((time.time() - start_time) * 1000), 0
+        return fallback_output, int((time.time() - start_time) * 1000), TokenUsage()
@@ -0,0 +1,104 @@
+"""
+Step 2b: VARIATION - Keep follow-ups from repeating.
+Near-identical nudges trigger WhatsApp spam heuristics. A follow-up that is too
+similar to an earlier bot message is paraphrased with those messages in the
+prompt; if every attempt is still too similar, the follow-up is dropped.
+"""
+import logging
+import re
+import time
+from difflib import SequenceMatcher
+from typing import List, Optional, Tuple
+
+from llm.config import llm_config
+from llm.schemas import PipelineInput, GenerateOutput, TokenUsage
+from llm.prompt_templates import VARIATION_SYSTEM, VARIATION_USER
+from llm.client import LLMClient, resolve_client
+from llm.formatting import apply_style
+from llm.run_context import RunContext, raise_if_cancelled
+
+logger = logging.getLogger(__name__)
+
+_WORD = re.compile(r"\w+")
+
+
+def _words(text: str) -> List[str]:
+    return _WORD.findall(text.lower())
+
+
+def similarity(a: str, b: str) -> float:
+    """
+    0.0-1.0: the higher of word-set overlap (catches reordered sentences) and
+    sequence similarity (catches small edits to the same sentence).
+    """
+    words_a, words_b = _words(a), _words(b)
+    if not words_a or not words_b:
+        return 0.0
+    overlap = len(set(words_a) & set(words_b)) / len(set(words_a) | set(words_b))
+    sequence = SequenceMatcher(None, " ".join(words_a), " ".join(words_b)).ratio()
+    return max(overlap, sequence)
+
+
+def max_similarity(text: str, previous: List[str]) -> float:
+    return max((similarity(text, message) for message in previous), default=0.0)
+
+
+def previous_bot_messages(context: PipelineInput) -> List[str]:
+    return [msg.text for msg in context.last_messages if msg.sender == "bot" and msg.text.strip()]
+
+
+def run_variation(
+    context: PipelineInput,
+    output: GenerateOutput,
+    ctx: Optional[RunContext] = None,
+    client: Optional[LLMClient] = None,
+) -> Tuple[GenerateOutput, int, TokenUsage]:
+    """
+    Run the Variation step on a generated follow-up.
+    Returns (output, latency_ms, token_usage); the output's message_text is
+    emptied (so nothing is sent) when no sufficiently different version was found.
+    """
+    previous = previous_bot_messages(context)
+    threshold = llm_config.followup_max_similarity
+    score = max_similarity(output.message_text, previous)
+    if score <= threshold:
+        return output, 0, TokenUsage()
+
+    start_time = time.time()
+    usage = TokenUsage()
+    draft = output.message_text
+    for _ in range(llm_config.followup_variation_attempts):
+        logger.info(f"Variation: follow-up is {score:.2f} similar to an earlier message, paraphrasing")
+        try:
+            response = resolve_client(client).complete(
+                messages=[
+                    {"role": "system", "content": VARIATION_SYSTEM.render(max_words=context.max_words)},
+                    {"role": "user", "content": VARIATION_USER.render(
+                        previous_messages="\n".join(f"- {message}" for message in previous),
+                        draft=draft,
+                    )},
+                ],
+                response_format={"type": "json_object"},
+                # High by default (LLMConfig.sampling_for): each attempt should explore a different wording
+                **llm_config.sampling_for("Variation"),
+                step_name="Variation",
+                ctx=ctx,
+            )
+        except Exception as e:
+            raise_if_cancelled(e)
+            logger.error(f"Variation failed: {e}")
+            break
+        usage = usage + response.usage
+        draft = str(response.data.get("message_text") or "").strip()
+        draft = apply_style(draft, context.prompt_overrides.emoji_style, context.prompt_overrides.whatsapp_formatting)
+        score = max_similarity(draft, previous)
+        if draft and score <= threshold:
+            return output.model_copy(update={"message_text": draft}), int((time.time() - start_time) * 1000), usage
+
+    logger.warning(f"Variation: no follow-up under {threshold} similarity, dropping it")
+    dropped = output.model_copy(update={
+        "message_text": "",
+        "self_check_passed": False,
+        "violations": output.violations + [f"too_similar: {score:.2f} to a previous message"],
+    })
+    return dropped, int((time.time() - start_time) * 1000), usage
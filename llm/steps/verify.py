@@ -0,0 +1,83 @@
+"""
+Step 2c: VERIFY - Keep replies grounded in what the business told us.
+A reply quoting a price, discount, opening time or delivery time the business
+never gave is worse than no reply. The reply's claims are checked against the
+business information and the conversation (llm.grounding), and with
+LLM_HALLUCINATION_CHECK=llm the model fact-checks it as well. A reply with
+ungrounded claims is withheld and flagged for a human.
+"""
+import logging
+import time
+from typing import Optional, Tuple
+
+from llm.config import llm_config
+from llm.schemas import PipelineInput, GenerateOutput, TokenUsage
+from llm.prompt_templates import VERIFY_SYSTEM, VERIFY_USER
+from llm.client import LLMClient, resolve_client
+from llm.grounding import find_ungrounded, knowledge_text
+from llm.run_context import RunContext, raise_if_cancelled
+
+logger = logging.getLogger(__name__)
+
+HALLUCINATION_CHECK_MODES = ("off", "rules", "llm")
+
+
+def run_verify(
+    context: PipelineInput,
+    output: GenerateOutput,
+    ctx: Optional[RunContext] = None,
+    client: Optional[LLMClient] = None,
+) -> Tuple[GenerateOutput, int, TokenUsage]:
+    """
+    Run the Verify step on a generated reply (per LLMConfig.hallucination_check).
+    Returns (output, latency_ms, token_usage); when claims are ungrounded the
+    output's message_text is emptied (so nothing is sent) and ungrounded_claims lists them.
+    A failed LLM check does not block the reply; the rule check still applies.
+    """
+    mode = llm_config.hallucination_check
+    if mode not in HALLUCINATION_CHECK_MODES:
+        raise ValueError(f"Unknown hallucination check {mode!r}; expected one of {HALLUCINATION_CHECK_MODES}")
+    if mode == "off" or not output.message_text or output.template_message:
+        return output, 0, TokenUsage()
+
+    start_time = time.time()
+    usage = TokenUsage()
+    knowledge = knowledge_text(context)
+    ungrounded = find_ungrounded(output.message_text, knowledge)
+
+    if mode == "llm":
+        try:
+            response = resolve_client(client).complete(
+                messages=[
+                    {"role": "system", "content": VERIFY_SYSTEM.render()},
+                    {"role": "user", "content": VERIFY_USER.render(
+                        knowledge=knowledge or "(none)",
+                        reply=output.message_text,
+                    )},
+                ],
+                response_format={"type": "json_object"},
+                **llm_config.sampling_for("Verify"),
+                step_name="Verify",
+                ctx=ctx,
+            )
+            usage = response.usage
+            claims = response.data.get("unsupported_claims") or []
+            if isinstance(claims, list):
+                ungrounded += [f"unsupported: {claim}" for claim in claims if str(claim).strip()]
+        except Exception as e:
+            raise_if_cancelled(e)
+            logger.error(f"Verify failed: {e}")
+
+    latency_ms = int((time.time() - start_time) * 1000)
+    if not ungrounded:
+        return output, latency_ms, usage
+
+    logger.warning(f"Verify: withholding reply with ungrounded claims: {ungrounded}")
+    withheld = output.model_copy(update={
+        "message_text": "",
+        "interactive": None,
+        "self_check_passed": False,
+        "violations": output.violations + [f"ungrounded_claim: {claim}" for claim in ungrounded],
+        "ungrounded_claims": ungrounded,
+    })
+    return withheld, latency_ms, usage
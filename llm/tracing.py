@@ -0,0 +1,75 @@
+"""
+Tracing.
+OpenTelemetry spans for pipeline runs, each step and every LLM call (model,
+tokens, fallbacks as attributes), so the latency of a conversation turn can be
+broken down in Jaeger/Tempo. Spans are emitted through the opentelemetry-api
+package when it is installed and LLM_TRACING=true; exporting them is up to the
+process's SDK setup (e.g. running under opentelemetry-instrument). Otherwise
+span() costs nothing.
+
+    with span("pipeline.brain", stage="pricing") as current:
+        ...
+        annotate(current, total_tokens=812)
+"""
+import logging
+from contextlib import contextmanager
+from typing import Any, Dict, Iterator
+
+from llm.config import llm_config
+
+try:
+    from opentelemetry import trace
+except ImportError:  # Tracing is optional
+    trace = None
+
+logger = logging.getLogger(__name__)
+
+TRACER_NAME = "whatsapp_funnel.llm"
+
+
+class _NoopSpan:
+    """Stands in for a span when tracing is off."""
+
+    def set_attribute(self, key: str, value: Any) -> None:
+        pass
+
+    def set_attributes(self, attributes: Dict[str, Any]) -> None:
+        pass
+
+    def record_exception(self, exception: BaseException) -> None:
+        pass
+
+
+_NOOP_SPAN = _NoopSpan()
+
+
+def tracing_enabled() -> bool:
+    return llm_config.tracing and trace is not None
+
+
+def _attributes(attributes: Dict[str, Any]) -> Dict[str, Any]:
+    """OTel takes str/bool/int/float values only: None is dropped, anything else stringified."""
+    return {
+        key: value if isinstance(value, (str, bool, int, float)) else str(value)
+        for key, value in attributes.items()
+        if value is not None
+    }
+
+
+@contextmanager
+def span(name: str, **attributes: Any) -> Iterator[Any]:
+    """
+    A span around the block, a child of the current one. An exception escaping
+    the block is recorded on it and marks it as an error.
+    """
+    if not tracing_enabled():
+        yield _NOOP_SPAN
+        return
+    tracer = trace.get_tracer(TRACER_NAME)
+    with tracer.start_as_current_span(name, attributes=_attributes(attributes)) as current:
+        yield current
+
+
+def annotate(current: Any, **attributes: Any) -> None:
+    """Add attributes to a span from span(), e.g. results known only once the block ran."""
+    current.set_attributes(_attributes(attributes))
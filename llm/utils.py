@@ -1,11 +1,13 @@
 """
 LLM Utilities for HTL Pipeline.
-Provides enum normalization, JSON schema generation, and defensive parsing.
+Provides enum normalization, JSON schema generation, defensive parsing and token estimation.
 """
 import logging
 from typing import Type, TypeVar, Optional, Dict, Any
 from enum import Enum
 from difflib import get_close_matches
+from llm.schemas import GenerateOutput, GENERATE_INTERNAL_FIELDS
+from llm.metrics import ENUM_CORRECTIONS
 
 logger = logging.getLogger(__name__)
 
@@ -98,6 +100,7 @@ def normalize_enum(
                 f"Enum correction: '{value}' → '{result.value}' "
                 f"(class={enum_class.__name__})"
             )
+            ENUM_CORRECTIONS.inc(enum=enum_class.__name__, kind="correction")
         return result
     
     # No match found
@@ -106,6 +109,7 @@ def normalize_enum(
             f"Enum fallback: '{value}' not valid for {enum_class.__name__}, "
             f"using default={default.value if default else None}"
         )
+        ENUM_CORRECTIONS.inc(enum=enum_class.__name__, kind="fallback")
     return default
 
 
@@ -120,10 +124,32 @@ def format_ctas(ctas: list) -> str:
     
     lines = []
     for cta in ctas:
-        lines.append(f"- ID: {cta.get('id')} | Name: {cta.get('name')}")
+        line = f"- ID: {cta.get('id')} | Name: {cta.get('name')}"
+        if cta.get("type"):
+            line += f" | Type: {cta['type']}"
+        lines.append(line)
     return "\n".join(lines)
 
 
+# ============================================================
+# Token Estimation
+# ============================================================
+
+# Rough tokenizer-free estimate. English averages ~4 characters per token; Indic
+# scripts and emoji tokenize far worse, so non-ASCII characters are weighted higher.
+ASCII_CHARS_PER_TOKEN = 4.0
+NON_ASCII_CHARS_PER_TOKEN = 1.5
+
+
+def estimate_tokens(text: str) -> int:
+    """Approximate token count of text (errs on the high side for non-Latin scripts)."""
+    if not text:
+        return 0
+    non_ascii = sum(1 for char in text if ord(char) > 127)
+    ascii_count = len(text) - non_ascii
+    return int(ascii_count / ASCII_CHARS_PER_TOKEN + non_ascii / NON_ASCII_CHARS_PER_TOKEN) + 1
+
+
 # ============================================================
 # JSON Schema Definitions for Groq Structured Output
 # ============================================================
@@ -188,7 +214,20 @@ def get_classify_schema() -> Dict[str, Any]:
                 },
                 "cta_scheduled_at": {
                     "type": ["string", "null"],
-                    "description": "ISO 8601 datetime for CTA"
+                    "description": "ISO 8601 datetime with UTC offset for CTA"
+                },
+                "cta_params": {
+                    "type": "array",
+                    "description": "Parameters the user gave for the CTA, e.g. amount or product",
+                    "items": {
+                        "type": "object",
+                        "properties": {
+                            "key": {"type": "string"},
+                            "value": {"type": "string"}
+                        },
+                        "required": ["key", "value"],
+                        "additionalProperties": False
+                    }
                 },
                 "followup_in_minutes": {
                     "type": "integer",
@@ -206,7 +245,7 @@ def get_classify_schema() -> Dict[str, Any]:
             "required": [
                 "thought_process", "situation_summary", "intent_level", "user_sentiment",
                 "risk_flags", "action", "new_stage", "should_respond", "needs_human_attention",
-                "selected_cta_id", "cta_scheduled_at", "followup_in_minutes", "followup_reason", "confidence"
+                "selected_cta_id", "cta_scheduled_at", "cta_params", "followup_in_minutes", "followup_reason", "confidence"
             ],
             "additionalProperties": False
         }
@@ -339,73 +378,69 @@ def get_decision_schema() -> Dict[str, Any]:
 
 
 def get_generate_schema() -> Dict[str, Any]:
-    """JSON Schema for Generate step output."""
-    return {
-        "name": "generate_output",
-        "strict": True,
-        "schema": {
-            "type": "object",
-            "properties": {
-                "message_text": {
-                    "type": "string",
-                    "description": "The message to send"
-                },
-                "message_language": {
-                    "type": "string",
-                    "description": "Language code"
-                },
-                "selected_cta_id": {
-                    "type": ["string", "null"],
-                    "description": "UUID of selected CTA"
-                },
-                "next_stage": {
-                    "type": "string",
-                    "enum": ["greeting", "qualification", "pricing", "cta", "followup", "closed", "lost", "ghosted"],
-                    "description": "Next conversation stage"
-                },
-                "next_followup_in_minutes": {
-                    "type": "integer",
-                    "description": "Minutes until next followup"
-                },
-                "state_patch": {
-                    "type": "object",
-                    "properties": {
-                        "intent_level": {
-                            "type": ["string", "null"],
-                            "enum": ["low", "medium", "high", "very_high", "unknown", None]
-                        },
-                        "user_sentiment": {
-                            "type": ["string", "null"],
-                            "enum": ["annoyed", "distrustful", "confused", "curious", "disappointed", "neutral", "uninterested", None]
-                        },
-                        "conversation_stage": {
-                            "type": ["string", "null"],
-                            "enum": ["greeting", "qualification", "pricing", "cta", "followup", "closed", "lost", "ghosted", None]
-                        }
-                    },
-                    "required": ["intent_level", "user_sentiment", "conversation_stage"],
-                    "additionalProperties": False
-                },
-                "self_check": {
-                    "type": "object",
-                    "properties": {
-                        "guardrails_pass": {"type": "boolean"},
-                        "violations": {
-                            "type": "array",
-                            "items": {"type": "string"}
-                        }
-                    },
-                    "required": ["guardrails_pass", "violations"],
-                    "additionalProperties": False
-                }
-            },
-            "required": [
-                "message_text", "message_language", "selected_cta_id", "next_stage",
-                "next_followup_in_minutes", "state_patch", "self_check"
-            ],
-            "additionalProperties": False
+    """
+    JSON Schema for Generate (Mouth) step output, derived from GenerateOutput
+    so the schema cannot drift from the model. Post-generation fields are excluded.
+    """
+    return strict_json_schema(
+        GenerateOutput,
+        name="generate_output",
+        exclude=GENERATE_INTERNAL_FIELDS,
+    )
+
+
+# Keywords strict structured output rejects or ignores
+_UNSUPPORTED_SCHEMA_KEYS = {
+    "title", "default", "format", "minimum", "maximum", "minLength", "maxLength", "minItems", "maxItems", "examples",
+}
+
+
+def strict_json_schema(
+    model: Type[Any],
+    name: str,
+    exclude: Optional[set] = None,
+) -> Dict[str, Any]:
+    """
+    Build a strict structured-output schema from a pydantic model: $refs are
+    inlined, Optional[X] becomes a nullable type, every property is required
+    and additional properties are forbidden.
+    """
+    raw = model.model_json_schema()
+    defs = raw.get("$defs", {})
+    schema = _strictify(raw, defs)
+    for field in exclude or ():
+        schema["properties"].pop(field, None)
+    schema["required"] = list(schema["properties"])
+    return {"name": name, "strict": True, "schema": schema}
+
+
+def _strictify(node: Dict[str, Any], defs: Dict[str, Any]) -> Dict[str, Any]:
+    if "$ref" in node:
+        resolved = defs[node["$ref"].split("/")[-1]]
+        node = {**resolved, **{k: v for k, v in node.items() if k != "$ref"}}
+
+    if "anyOf" in node:
+        options = [option for option in node["anyOf"] if option.get("type") != "null"]
+        if len(options) == 1 and len(options) < len(node["anyOf"]):
+            nullable = _strictify(options[0], defs)
+            nullable["type"] = [nullable["type"], "null"]
+            if "enum" in nullable:
+                nullable["enum"] = nullable["enum"] + [None]
+            if node.get("description"):
+                nullable["description"] = node["description"]
+            return nullable
+        node = {**node, "anyOf": [_strictify(option, defs) for option in node["anyOf"]]}
+
+    strict = {k: v for k, v in node.items() if k not in _UNSUPPORTED_SCHEMA_KEYS and k != "$defs"}
+    if strict.get("type") == "object" and "properties" in strict:
+        strict["properties"] = {
+            field: _strictify(prop, defs) for field, prop in strict["properties"].items()
         }
-    }
+        strict["required"] = list(strict["properties"])
+        strict["additionalProperties"] = False
+    elif strict.get("type") == "array" and "items" in strict:
+        strict["items"] = _strictify(strict["items"], defs)
+    return strict
 
 
 def get_summarize_schema() -> Dict[str, Any]:
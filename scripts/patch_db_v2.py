@@ -0,0 +1,28 @@
+import sys
+import os
+sys.path.append(os.getcwd())
+
+from sqlalchemy import text
+from server.database import engine
+
+def patch_db():
+    print("🔄 Patching Database Schema (lead profiles)...")
+    
+    commands = [
+        "ALTER TABLE leads ADD COLUMN IF NOT EXISTS profile JSON;",
+    ]
+    
+    with engine.connect() as conn:
+        for cmd in commands:
+            try:
+                print(f"Executing: {cmd}")
+                conn.execute(text(cmd))
+                print("✅ Success")
+            except Exception as e:
+                print(f"⚠️ Error (ignoring): {e}")
+        conn.commit()
+    
+    print("✅ Patch Complete.")
+
+if __name__ == "__main__":
+    patch_db()
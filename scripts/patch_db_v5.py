@@ -0,0 +1,28 @@
+import sys
+import os
+sys.path.append(os.getcwd())
+
+from sqlalchemy import text
+from server.database import engine
+
+def patch_db():
+    print("🔄 Patching Database Schema (prompt examples)...")
+    
+    commands = [
+        "ALTER TABLE organizations ADD COLUMN IF NOT EXISTS prompt_examples JSON;",
+    ]
+    
+    with engine.connect() as conn:
+        for cmd in commands:
+            try:
+                print(f"Executing: {cmd}")
+                conn.execute(text(cmd))
+                print("✅ Success")
+            except Exception as e:
+                print(f"⚠️ Error (ignoring): {e}")
+        conn.commit()
+    
+    print("✅ Patch Complete.")
+
+if __name__ == "__main__":
+    patch_db()
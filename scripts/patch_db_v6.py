@@ -0,0 +1,29 @@
+import sys
+import os
+sys.path.append(os.getcwd())
+
+from sqlalchemy import text
+from server.database import engine
+
+def patch_db():
+    print("🔄 Patching Database Schema (CTA types)...")
+    
+    commands = [
+        "ALTER TABLE ctas ADD COLUMN IF NOT EXISTS cta_type VARCHAR(20) NOT NULL DEFAULT 'booking';",
+        "ALTER TABLE ctas ADD COLUMN IF NOT EXISTS params JSON;",
+    ]
+    
+    with engine.connect() as conn:
+        for cmd in commands:
+            try:
+                print(f"Executing: {cmd}")
+                conn.execute(text(cmd))
+                print("✅ Success")
+            except Exception as e:
+                print(f"⚠️ Error (ignoring): {e}")
+        conn.commit()
+    
+    print("✅ Patch Complete.")
+
+if __name__ == "__main__":
+    patch_db()
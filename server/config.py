@@ -19,5 +19,7 @@ class ServerConfig:
         self.SECRET_KEY = os.getenv("SECRET_KEY")
         self.ALGORITHM = os.getenv("ALGORITHM")
         self.INTERNAL_API_SECRET = os.getenv("INTERNAL_API_SECRET")
+        # Pipeline recordings hold conversations unredacted; older ones are pruned
+        self.PIPELINE_RECORDING_RETENTION_DAYS = int(os.getenv("PIPELINE_RECORDING_RETENTION_DAYS", "14"))
 
 config = ServerConfig()
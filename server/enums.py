@@ -66,6 +66,13 @@ class TemplateStatus(str, Enum):
     APPROVED = "approved"
     REJECTED = "rejected"
 
+class CTAType(str, Enum):
+    """What executing a CTA means: booking a slot, collecting a payment, sharing a link or a catalog."""
+    BOOKING = "booking"
+    PAYMENT = "payment"
+    LINK = "link"
+    CATALOG = "catalog"
+
 class MessageFrom(str, Enum):
     LEAD = "lead"
     BOT = "bot"
@@ -38,6 +38,12 @@ class Organization(Base):
     business_name = Column(Text, nullable=True)  # Chatbot persona name
     business_description = Column(Text, nullable=True)  # Business context for LLM
     flow_prompt = Column(Text, nullable=True)  # Conversation flow instructions
+    memory_prompt = Column(Text, nullable=True)  # What conversation summaries should emphasize
+    memory_fact_fields = Column(JSON, nullable=True)  # Extra lead facts to extract, e.g. ["symptoms"]
+    prompt_overrides = Column(JSON, nullable=True)  # Persona/tone/style/language/forbidden_topics/stage rules/emoji + formatting for the prompts
+    prompt_examples = Column(JSON, nullable=True)  # Example conversations for the Mouth, per stage
+    timezone = Column(String(64), nullable=True)  # IANA name; the bot resolves "tomorrow 5pm" in this zone
+    forbidden_claims = Column(JSON, nullable=True)  # Claims replies must never make, e.g. ["lowest price", "re:\d+% off"]
     
     created_at = Column(DateTime(timezone=True), server_default=func.now())
     updated_at = Column(DateTime(timezone=True), onupdate=func.now())
@@ -128,6 +134,8 @@ class CTA(Base):
     id = Column(UUID(as_uuid=True), primary_key=True, default=uuid.uuid4)
     organization_id = Column(UUID(as_uuid=True), ForeignKey("organizations.id"), nullable=False)
     name = Column(String(255), nullable=False)
+    cta_type = Column(String(20), nullable=False, default="booking")  # CTAType value
+    params = Column(JSON, nullable=True)  # Fixed parameters, e.g. {"url": "https://..."} for a link CTA
     is_active = Column(Boolean, default=True)
     
     created_at = Column(DateTime(timezone=True), server_default=func.now())
@@ -196,6 +204,8 @@ class Lead(Base):
     conversation_stage = Column(SQLEnum(ConversationStage), nullable=True)
     intent_level = Column(SQLEnum(IntentLevel), nullable=True)
     user_sentiment = Column(SQLEnum(UserSentiment), nullable=True)
+
+    profile = Column(JSON, nullable=True)  # Facts extracted by the LLM Memory step (llm.schemas.LeadProfile)
     
     created_at = Column(DateTime(timezone=True), server_default=func.now())
     updated_at = Column(DateTime(timezone=True), onupdate=func.now())
@@ -255,6 +265,20 @@ class AuditLog(Base):
     created_at = Column(DateTime(timezone=True), server_default=func.now())
 
 
+class InboundMessageClaim(Base):
+    """
+    WhatsApp message IDs a worker has taken on (see whatsapp_worker.main), so a
+    redelivered webhook is answered once no matter which worker receives it.
+    """
+    __tablename__ = "inbound_message_claims"
+
+    message_id = Column(String(255), primary_key=True)
+    status = Column(String(20), nullable=False, default="processing")  # processing, replied, done
+
+    created_at = Column(DateTime(timezone=True), server_default=func.now(), index=True)
+    updated_at = Column(DateTime(timezone=True), server_default=func.now(), onupdate=func.now())
+
+
 # --------------------
 # HTL Pipeline
 # --------------------
@@ -280,4 +304,62 @@ class ConversationEvent(Base):
     latency_ms = Column(Integer, nullable=True)  # For performance tracking
     tokens_used = Column(Integer, nullable=True)  # For cost tracking
     
-    created_at = Column(DateTime(timezone=True), server_default=func.now())
\ No newline at end of file
+    created_at = Column(DateTime(timezone=True), server_default=func.now())
+
+
+class SummaryRevision(Base):
+    """
+    Audit trail of rolling-summary updates (see llm.memory_audit).
+    Lets us trace which memory update dropped a fact.
+    """
+    __tablename__ = "summary_revisions"
+
+    id = Column(UUID(as_uuid=True), primary_key=True, default=uuid.uuid4)
+    conversation_id = Column(UUID(as_uuid=True), ForeignKey("conversations.id"), nullable=False, index=True)
+
+    request_id = Column(String(255), nullable=True)  # Pipeline run (WhatsApp message ID)
+    source = Column(String(20), nullable=False)  # llm, compacted, fallback
+    trigger_message = Column(Text, nullable=True)
+    bot_message = Column(Text, nullable=True)
+
+    previous_summary = Column(Text, nullable=True)
+    new_summary = Column(Text, nullable=True)
+    diff = Column(Text, nullable=True)
+
+    created_at = Column(DateTime(timezone=True), server_default=func.now())
+
+
+class PromptVersion(Base):
+    """
+    Published prompt text served to the workers (see llm.prompt_store).
+    Versions are immutable; activating an older one is a rollback.
+    """
+    __tablename__ = "prompt_versions"
+
+    id = Column(UUID(as_uuid=True), primary_key=True, default=uuid.uuid4)
+    version = Column(Integer, nullable=False, unique=True)
+    prompts = Column(JSON, nullable=False)  # Template name -> text; missing templates use the built-in text
+    note = Column(Text, nullable=True)  # What changed
+    is_active = Column(Boolean, default=False, nullable=False, index=True)
+
+    created_at = Column(DateTime(timezone=True), server_default=func.now())
+
+
+class PipelineRecording(Base):
+    """
+    A pipeline run's full input and result (see llm.replay), recorded when
+    LLM_RECORD_RUNS is on so production turns can be replayed while debugging.
+    """
+    __tablename__ = "pipeline_recordings"
+
+    id = Column(UUID(as_uuid=True), primary_key=True, default=uuid.uuid4)
+    conversation_id = Column(UUID(as_uuid=True), ForeignKey("conversations.id"), nullable=False, index=True)
+    organization_id = Column(UUID(as_uuid=True), ForeignKey("organizations.id"), nullable=True)
+
+    request_id = Column(String(255), nullable=True)  # Pipeline run (WhatsApp message ID)
+    user_message = Column(Text, nullable=False)
+    context = Column(JSON, nullable=False)  # llm.schemas.PipelineInput
+    result = Column(JSON, nullable=False)  # llm.schemas.PipelineResult
+    prompt_version = Column(String(50), nullable=True)
+
+    created_at = Column(DateTime(timezone=True), server_default=func.now())
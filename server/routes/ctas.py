@@ -24,6 +24,8 @@ def create_cta(
 ):
     db_cta = CTA(
         name=cta.name,
+        cta_type=cta.cta_type.value,
+        params=cta.params,
         organization_id=auth.organization_id
     )
     db.add(db_cta)
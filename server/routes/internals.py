@@ -11,22 +11,26 @@ from uuid import UUID
 from server.services.websocket_events import emit_conversation_updated
 from server.schemas import ConversationOut
 from fastapi import APIRouter, Depends, HTTPException, Query
+from sqlalchemy.exc import IntegrityError
 from sqlalchemy.orm import Session
+from server.config import config
 from server.dependencies import require_internal_secret, get_db
 import logging
 from server.models import (
-    Conversation, ConversationEvent, Lead, Message, Organization,
-    WhatsAppIntegration, CTA
+    Conversation, ConversationEvent, InboundMessageClaim, Lead, Message, Organization,
+    WhatsAppIntegration, CTA, SummaryRevision, Template, PromptVersion, PipelineRecording
 )
 from server.enums import (
-    ConversationMode, ConversationStage, IntentLevel, MessageFrom, UserSentiment
+    ConversationMode, ConversationStage, IntentLevel, MessageFrom, TemplateStatus, UserSentiment
 )
 from server.schemas import (
     InternalConversationCreate, InternalConversationOut, InternalConversationUpdate,
-    InternalIncomingMessageCreate, InternalIntegrationWithOrgOut,
-    InternalLeadCreate, InternalLeadOut, InternalMessageContext, InternalMessageOut,
+    InternalIncomingMessageCreate, InternalInboundClaimOut, InternalInboundClaimUpdate, InternalIntegrationWithOrgOut,
+    InternalLeadCreate, InternalLeadOut, InternalLeadProfileUpdate, InternalMessageContext, InternalMessageOut,
     InternalOutgoingMessageCreate, InternalPipelineEventCreate, InternalPipelineEventOut, 
-    InternalDueFollowupOut, CTAOut
+    InternalDueFollowupOut, CTAOut, InternalSummaryRevisionCreate, InternalSummaryRevisionOut, TemplateOut,
+    InternalPromptVersionCreate, InternalPromptVersionOut,
+    InternalPipelineRecordingCreate, InternalPipelineRecordingOut,
 )
 
 router = APIRouter()
@@ -129,6 +133,12 @@ def get_integration_with_org(
         business_name=org.business_name,
         business_description=org.business_description,
         flow_prompt=org.flow_prompt,
+        memory_prompt=org.memory_prompt,
+        memory_fact_fields=org.memory_fact_fields,
+        prompt_overrides=org.prompt_overrides,
+        prompt_examples=org.prompt_examples,
+        timezone=org.timezone,
+        forbidden_claims=org.forbidden_claims,
     )
 
 
@@ -146,6 +156,20 @@ def get_organization_ctas(
     )
 
 
+@router.get("/organizations/{organization_id}/templates", response_model=List[TemplateOut])
+def get_organization_templates(
+    organization_id: UUID,
+    _: None = Depends(require_internal_secret),
+    db: Session = Depends(get_db),
+):
+    """Get Meta-approved WhatsApp templates for an organization."""
+    return (
+        db.query(Template)
+        .filter(Template.organization_id == organization_id, Template.status == TemplateStatus.APPROVED)
+        .all()
+    )
+
+
 # ========================================
 # Lead Endpoints
 # ========================================
@@ -161,6 +185,7 @@ def _lead_to_schema(lead: Lead) -> InternalLeadOut:
         conversation_stage=lead.conversation_stage,
         intent_level=lead.intent_level,
         user_sentiment=lead.user_sentiment,
+        profile=lead.profile,
         created_at=lead.created_at,
         updated_at=lead.updated_at,
     )
@@ -234,6 +259,27 @@ def update_lead(
     return _lead_to_schema(lead)
 
 
+@router.put("/leads/{lead_id}/profile", response_model=InternalLeadOut)
+def update_lead_profile(
+    lead_id: UUID,
+    payload: InternalLeadProfileUpdate,
+    _: None = Depends(require_internal_secret),
+    db: Session = Depends(get_db),
+):
+    """Replace the lead's extracted profile (merging happens in the Memory step)."""
+    lead = db.query(Lead).filter(Lead.id == lead_id).first()
+    if not lead:
+        raise HTTPException(status_code=404, detail="Lead not found")
+
+    lead.profile = payload.profile
+    if not lead.name and payload.profile.get("name"):
+        lead.name = payload.profile["name"]
+
+    db.commit()
+    db.refresh(lead)
+    return _lead_to_schema(lead)
+
+
 # ========================================
 # Conversation Endpoints
 # ========================================
@@ -412,6 +458,12 @@ def get_due_followups(
                     business_name=org.business_name,
                     business_description=org.business_description,
                     flow_prompt=org.flow_prompt,
+                    memory_prompt=org.memory_prompt,
+                    memory_fact_fields=org.memory_fact_fields,
+                    prompt_overrides=org.prompt_overrides,
+                    prompt_examples=org.prompt_examples,
+                    timezone=org.timezone,
+                    forbidden_claims=org.forbidden_claims,
                 )
             )
     logger.info(f"Found {results} due follow-ups")
@@ -603,6 +655,89 @@ async def store_outgoing_message(
     return _message_to_schema(message)
 
 
+# ========================================
+# Inbound Message Claim Endpoints
+# ========================================
+
+# Claims outlive any WhatsApp redelivery; older ones are pruned as new ones come in
+INBOUND_CLAIM_RETENTION = timedelta(days=7)
+
+
+@router.post("/inbound-messages/{message_id}/claim", response_model=InternalInboundClaimOut)
+def claim_inbound_message(
+    message_id: str,
+    lease_seconds: int = Query(default=300, ge=1),
+    _: None = Depends(require_internal_secret),
+    db: Session = Depends(get_db),
+):
+    """
+    Take on an inbound WhatsApp message. Only one worker gets the claim; a
+    "processing" claim not updated for lease_seconds is considered abandoned
+    (its worker died) and can be taken over.
+    """
+    now = datetime.now(timezone.utc)
+    # Committed on its own, so a conflicting claim below can't roll the prune back
+    db.query(InboundMessageClaim).filter(
+        InboundMessageClaim.created_at < now - INBOUND_CLAIM_RETENTION
+    ).delete(synchronize_session=False)
+    db.commit()
+    db.add(InboundMessageClaim(message_id=message_id, status="processing", updated_at=now))
+    try:
+        db.commit()
+        return InternalInboundClaimOut(message_id=message_id, claimed=True, status="processing")
+    except IntegrityError:
+        db.rollback()
+
+    # Conditional update, so only one worker takes over an abandoned claim
+    taken_over = (
+        db.query(InboundMessageClaim)
+        .filter(
+            InboundMessageClaim.message_id == message_id,
+            InboundMessageClaim.status == "processing",
+            InboundMessageClaim.updated_at < now - timedelta(seconds=lease_seconds),
+        )
+        .update({InboundMessageClaim.updated_at: now}, synchronize_session=False)
+    )
+    db.commit()
+    claim = db.query(InboundMessageClaim).filter(InboundMessageClaim.message_id == message_id).first()
+    return InternalInboundClaimOut(
+        message_id=message_id,
+        claimed=bool(taken_over),
+        status=claim.status if claim else "processing",
+    )
+
+
+@router.patch("/inbound-messages/{message_id}", response_model=InternalInboundClaimOut)
+def update_inbound_message_claim(
+    message_id: str,
+    payload: InternalInboundClaimUpdate,
+    _: None = Depends(require_internal_secret),
+    db: Session = Depends(get_db),
+):
+    """Mark a claimed message as replied to (never reply again) or done."""
+    claim = db.query(InboundMessageClaim).filter(InboundMessageClaim.message_id == message_id).first()
+    if not claim:
+        raise HTTPException(status_code=404, detail="Inbound message claim not found")
+    claim.status = payload.status
+    claim.updated_at = datetime.now(timezone.utc)
+    db.commit()
+    return InternalInboundClaimOut(message_id=message_id, claimed=True, status=claim.status)
+
+
+@router.delete("/inbound-messages/{message_id}/claim", status_code=204)
+def release_inbound_message(
+    message_id: str,
+    _: None = Depends(require_internal_secret),
+    db: Session = Depends(get_db),
+):
+    """Give up a claim before any reply went out, so a redelivery is processed again."""
+    db.query(InboundMessageClaim).filter(
+        InboundMessageClaim.message_id == message_id,
+        InboundMessageClaim.status == "processing",
+    ).delete(synchronize_session=False)
+    db.commit()
+
+
 # ========================================
 # Pipeline Event Endpoints
 # ========================================
@@ -640,6 +775,224 @@ def create_pipeline_event(
     )
 
 
+def _summary_revision_to_schema(revision: SummaryRevision) -> InternalSummaryRevisionOut:
+    return InternalSummaryRevisionOut(
+        id=revision.id,
+        conversation_id=revision.conversation_id,
+        request_id=revision.request_id,
+        source=revision.source,
+        trigger_message=revision.trigger_message,
+        bot_message=revision.bot_message,
+        previous_summary=revision.previous_summary,
+        new_summary=revision.new_summary,
+        diff=revision.diff,
+        created_at=revision.created_at,
+    )
+
+
+@router.post("/summary-revisions", response_model=InternalSummaryRevisionOut, status_code=201)
+def create_summary_revision(
+    payload: InternalSummaryRevisionCreate,
+    _: None = Depends(require_internal_secret),
+    db: Session = Depends(get_db),
+):
+    """Record a rolling-summary revision."""
+    revision = SummaryRevision(**payload.model_dump())
+    db.add(revision)
+    db.commit()
+    db.refresh(revision)
+    return _summary_revision_to_schema(revision)
+
+
+@router.get(
+    "/conversations/{conversation_id}/summary-revisions",
+    response_model=List[InternalSummaryRevisionOut],
+)
+def get_summary_revisions(
+    conversation_id: UUID,
+    limit: int = Query(default=50, ge=1, le=500),
+    _: None = Depends(require_internal_secret),
+    db: Session = Depends(get_db),
+):
+    """Most recent rolling-summary revisions of a conversation, newest first."""
+    revisions = (
+        db.query(SummaryRevision)
+        .filter(SummaryRevision.conversation_id == conversation_id)
+        .order_by(SummaryRevision.created_at.desc())
+        .limit(limit)
+        .all()
+    )
+    return [_summary_revision_to_schema(revision) for revision in revisions]
+
+
+# ========================================
+# Prompt Store Endpoints
+# ========================================
+
+def _prompt_version_to_schema(prompt_version: PromptVersion) -> InternalPromptVersionOut:
+    return InternalPromptVersionOut(
+        version=prompt_version.version,
+        prompts=prompt_version.prompts or {},
+        note=prompt_version.note,
+        is_active=prompt_version.is_active,
+        created_at=prompt_version.created_at,
+    )
+
+
+def _activate_prompt_version(db: Session, prompt_version: PromptVersion) -> None:
+    db.query(PromptVersion).filter(PromptVersion.id != prompt_version.id).update({"is_active": False})
+    prompt_version.is_active = True
+
+
+@router.get("/prompts/active", response_model=Optional[InternalPromptVersionOut])
+def get_active_prompts(
+    _: None = Depends(require_internal_secret),
+    db: Session = Depends(get_db),
+):
+    """The prompt version workers should use; null means the built-in prompts."""
+    prompt_version = db.query(PromptVersion).filter(PromptVersion.is_active.is_(True)).first()
+    return _prompt_version_to_schema(prompt_version) if prompt_version else None
+
+
+@router.get("/prompts", response_model=List[InternalPromptVersionOut])
+def list_prompt_versions(
+    limit: int = Query(default=20, ge=1, le=200),
+    _: None = Depends(require_internal_secret),
+    db: Session = Depends(get_db),
+):
+    """Published prompt versions, newest first."""
+    versions = db.query(PromptVersion).order_by(PromptVersion.version.desc()).limit(limit).all()
+    return [_prompt_version_to_schema(prompt_version) for prompt_version in versions]
+
+
+@router.get("/prompts/{version}", response_model=InternalPromptVersionOut)
+def get_prompt_version(
+    version: int,
+    _: None = Depends(require_internal_secret),
+    db: Session = Depends(get_db),
+):
+    """A published version, active or not (e.g. a candidate for shadow runs)."""
+    prompt_version = db.query(PromptVersion).filter(PromptVersion.version == version).first()
+    if not prompt_version:
+        raise HTTPException(status_code=404, detail=f"Prompt version {version} not found")
+    return _prompt_version_to_schema(prompt_version)
+
+
+@router.post("/prompts", response_model=InternalPromptVersionOut, status_code=201)
+def publish_prompts(
+    payload: InternalPromptVersionCreate,
+    _: None = Depends(require_internal_secret),
+    db: Session = Depends(get_db),
+):
+    """
+    Publish a new prompt version (and make it active unless activate is false).
+    Workers validate it on reload and keep their current prompts if it is invalid.
+    """
+    latest = db.query(PromptVersion).order_by(PromptVersion.version.desc()).first()
+    prompt_version = PromptVersion(
+        version=(latest.version + 1) if latest else 1,
+        prompts=payload.prompts,
+        note=payload.note,
+        is_active=False,
+    )
+    db.add(prompt_version)
+    db.flush()
+    if payload.activate:
+        _activate_prompt_version(db, prompt_version)
+    db.commit()
+    db.refresh(prompt_version)
+    logger.info(f"Published prompt version {prompt_version.version} (active={prompt_version.is_active})")
+    return _prompt_version_to_schema(prompt_version)
+
+
+@router.post("/prompts/{version}/activate", response_model=InternalPromptVersionOut)
+def activate_prompts(
+    version: int,
+    _: None = Depends(require_internal_secret),
+    db: Session = Depends(get_db),
+):
+    """Make a published version the active one (e.g. to roll back)."""
+    prompt_version = db.query(PromptVersion).filter(PromptVersion.version == version).first()
+    if not prompt_version:
+        raise HTTPException(status_code=404, detail=f"Prompt version {version} not found")
+    _activate_prompt_version(db, prompt_version)
+    db.commit()
+    db.refresh(prompt_version)
+    logger.info(f"Activated prompt version {version}")
+    return _prompt_version_to_schema(prompt_version)
+
+
+# ========================================
+# Pipeline Recording Endpoints
+# ========================================
+
+def _pipeline_recording_to_schema(recording: PipelineRecording) -> InternalPipelineRecordingOut:
+    return InternalPipelineRecordingOut(
+        id=recording.id,
+        conversation_id=recording.conversation_id,
+        organization_id=recording.organization_id,
+        request_id=recording.request_id,
+        user_message=recording.user_message,
+        context=recording.context or {},
+        result=recording.result or {},
+        prompt_version=recording.prompt_version,
+        created_at=recording.created_at,
+    )
+
+
+@router.post("/pipeline-recordings", response_model=InternalPipelineRecordingOut, status_code=201)
+def create_pipeline_recording(
+    payload: InternalPipelineRecordingCreate,
+    _: None = Depends(require_internal_secret),
+    db: Session = Depends(get_db),
+):
+    """
+    Record a pipeline run for replay. Recordings older than
+    PIPELINE_RECORDING_RETENTION_DAYS are pruned as new ones come in.
+    """
+    cutoff = datetime.now(timezone.utc) - timedelta(days=config.PIPELINE_RECORDING_RETENTION_DAYS)
+    db.query(PipelineRecording).filter(PipelineRecording.created_at < cutoff).delete(synchronize_session=False)
+    recording = PipelineRecording(**payload.model_dump(mode="json"))
+    db.add(recording)
+    db.commit()
+    db.refresh(recording)
+    return _pipeline_recording_to_schema(recording)
+
+
+@router.get("/pipeline-recordings/{recording_id}", response_model=InternalPipelineRecordingOut)
+def get_pipeline_recording(
+    recording_id: UUID,
+    _: None = Depends(require_internal_secret),
+    db: Session = Depends(get_db),
+):
+    """A recorded pipeline run."""
+    recording = db.query(PipelineRecording).filter(PipelineRecording.id == recording_id).first()
+    if not recording:
+        raise HTTPException(status_code=404, detail="Pipeline recording not found")
+    return _pipeline_recording_to_schema(recording)
+
+
+@router.get(
+    "/conversations/{conversation_id}/pipeline-recordings",
+    response_model=List[InternalPipelineRecordingOut],
+)
+def get_pipeline_recordings(
+    conversation_id: UUID,
+    limit: int = Query(default=20, ge=1, le=200),
+    _: None = Depends(require_internal_secret),
+    db: Session = Depends(get_db),
+):
+    """Most recent recorded pipeline runs of a conversation, newest first."""
+    recordings = (
+        db.query(PipelineRecording)
+        .filter(PipelineRecording.conversation_id == conversation_id)
+        .order_by(PipelineRecording.created_at.desc())
+        .limit(limit)
+        .all()
+    )
+    return [_pipeline_recording_to_schema(recording) for recording in recordings]
+
+
 # ========================================
 # WebSocket Event Endpoints
 # ========================================
@@ -4,9 +4,10 @@ from typing import List
 from server.dependencies import get_db
 from server.dependencies import get_auth_context
 from server.models import Lead
-from server.schemas import LeadOut, LeadCreate, LeadUpdate, AuthContext
+from server.schemas import LeadOut, LeadCreate, LeadUpdate, AuthContext, ForgetLeadOut
 from uuid import UUID
-from server.models import Conversation, Message
+from server.models import Conversation, Message, PipelineRecording, SummaryRevision
+from server.services.privacy import forget_lead
 
 router = APIRouter()
 
@@ -71,11 +72,35 @@ def delete_lead(
     
     # Delete in correct order to avoid FK constraint violations:
     # 1. Messages (references conversations and leads)
-    # 2. Conversations (references leads)
-    # 3. Lead
+    # 2. Summary revisions (references conversations)
+    # 3. Pipeline recordings (references conversations)
+    # 4. Conversations (references leads)
+    # 5. Lead
     db.query(Message).filter(Message.lead_id == lead_id).delete()
+    conversation_ids = db.query(Conversation.id).filter(Conversation.lead_id == lead_id)
+    db.query(SummaryRevision).filter(SummaryRevision.conversation_id.in_(conversation_ids)).delete(
+        synchronize_session=False
+    )
+    db.query(PipelineRecording).filter(PipelineRecording.conversation_id.in_(conversation_ids)).delete(
+        synchronize_session=False
+    )
     db.query(Conversation).filter(Conversation.lead_id == lead_id).delete()
     
     db.delete(db_lead)
     db.commit()
     return None
+
+@router.post("/{lead_id}/forget", response_model=ForgetLeadOut)
+def forget_lead_memory(
+    lead_id: UUID,
+    db: Session = Depends(get_db),
+    auth: AuthContext = Depends(get_auth_context)
+):
+    """
+    Data-deletion request: wipe conversation summaries, extracted facts and
+    recorded pipeline runs for the lead, keeping messages and aggregate analytics.
+    """
+    result = forget_lead(db, auth.organization_id, lead_id)
+    if result is None:
+        raise HTTPException(status_code=404, detail="Lead not found")
+    return result
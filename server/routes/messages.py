@@ -1,10 +1,11 @@
+import asyncio
 import json
 import logging
 from datetime import datetime, timezone
-from typing import Mapping, Tuple, Optional
+from typing import List, Mapping, Tuple, Optional
 
 import requests
-from fastapi import APIRouter, Depends, HTTPException
+from fastapi import APIRouter, BackgroundTasks, Depends, HTTPException
 from sqlalchemy.orm import Session, joinedload
 from sqlalchemy.sql import func
 
@@ -38,6 +39,65 @@ def _wa_text_payload(recipient: str, text: str) -> str:
     )
 
 
+def _wa_template_payload(recipient: str, template: dict) -> str:
+    parameters = template.get("parameters") or []
+    return json.dumps(
+        {
+            "messaging_product": "whatsapp",
+            "recipient_type": "individual",
+            "to": recipient,
+            "type": "template",
+            "template": {
+                "name": template["template_name"],
+                "language": {"code": template.get("language") or "en_US"},
+                "components": [
+                    {
+                        "type": "body",
+                        "parameters": [{"type": "text", "text": value} for value in parameters],
+                    }
+                ] if parameters else [],
+            },
+        }
+    )
+
+
+def _wa_interactive_payload(recipient: str, text: str, interactive: dict) -> str:
+    options = interactive.get("options") or []
+    if interactive.get("type") == "list":
+        action = {
+            "button": interactive.get("button_text") or "Options",
+            "sections": [{"rows": [{"id": option["id"], "title": option["title"]} for option in options]}],
+        }
+    else:
+        action = {
+            "buttons": [
+                {"type": "reply", "reply": {"id": option["id"], "title": option["title"]}}
+                for option in options
+            ]
+        }
+    return json.dumps(
+        {
+            "messaging_product": "whatsapp",
+            "recipient_type": "individual",
+            "to": recipient,
+            "type": "interactive",
+            "interactive": {
+                "type": "list" if interactive.get("type") == "list" else "button",
+                "body": {"text": text},
+                "action": action,
+            },
+        }
+    )
+
+
+def _wa_payload(recipient: str, message: str, template: Optional[dict], interactive: Optional[dict]) -> str:
+    if template:
+        return _wa_template_payload(recipient, template)
+    if interactive and interactive.get("options"):
+        return _wa_interactive_payload(recipient, message, interactive)
+    return _wa_text_payload(recipient, message)
+
+
 def _send_whatsapp_text(
     *,
     to: str,
@@ -45,9 +105,13 @@ def _send_whatsapp_text(
     access_token: str,
     phone_number_id: str,
     version: str = "v18.0",
+    template: Optional[dict] = None,
+    interactive: Optional[dict] = None,
 ) -> Tuple[Mapping, int]:
     """
     Sends WhatsApp text message using runtime credentials passed in payload.
+    With template, sends that approved template instead (allowed outside the 24h window);
+    with interactive, the text goes out with quick-reply buttons or a list menu.
     """
     # Debug logging
     logger.info(f"[WA Send] to={to}, message_len={len(message) if message else 0}, "
@@ -72,7 +136,7 @@ def _send_whatsapp_text(
     try:
         resp = requests.post(
             _wa_api_url(version, phone_number_id),
-            data=_wa_text_payload(to, message),
+            data=_wa_payload(to, message, template, interactive),
             headers=headers,
             timeout=15,
         )
@@ -93,6 +157,35 @@ def _send_whatsapp_text(
             return {"status": "error", "message": "Failed to send message"}, 500
 
 
+async def _send_remaining_parts(
+    parts: List[str],
+    delays_ms: List[int],
+    *,
+    to: str,
+    access_token: str,
+    phone_number_id: str,
+    version: str,
+    interactive: Optional[dict],
+) -> None:
+    """Send parts[1:] as follow-up bubbles, each after its delay. Stops at the first failure."""
+    for index in range(1, len(parts)):
+        delay_ms = delays_ms[index] if index < len(delays_ms) else 0
+        if delay_ms:
+            await asyncio.sleep(delay_ms / 1000)
+        wa_resp, wa_status = await asyncio.to_thread(
+            _send_whatsapp_text,
+            to=to,
+            message=parts[index],
+            access_token=access_token,
+            phone_number_id=phone_number_id,
+            version=version,
+            interactive=interactive if index == len(parts) - 1 else None,
+        )
+        if not (200 <= wa_status < 300):
+            logger.error(f"WhatsApp send failed for part {index + 1}/{len(parts)}: {wa_status} {wa_resp}")
+            return
+
+
 # ---------------------------
 # NOTE: We need a schema that includes runtime WA credentials.
 # If you already have MessageCreate, extend it to include these fields.
@@ -103,6 +196,10 @@ def _send_whatsapp_text(
 # - access_token: str
 # - phone_number_id: str
 # - version: Optional[str]
+# - template: Optional[dict] {template_name, language, parameters}; content is then the rendered text
+# - interactive: Optional[dict] {type: buttons|list, button_text, options: [{id, title}]}
+# - parts: Optional[list[str]] content as separate bubbles (bot only); content is stored once
+# - part_delays_ms: Optional[list[int]] wait before sending each part; interactive goes on the last
 #
 # Recipient ("to") is derived from Conversation (recommended).
 # If you want "to" also in payload, you can add it and override.
@@ -112,6 +209,7 @@ def _send_whatsapp_text(
 @router.post("/send_bot", response_model=MessageOut)
 async def send_message_bot(
     payload: dict,
+    background_tasks: BackgroundTasks,
     db: Session = Depends(get_db),
     _: None = Depends(require_internal_secret),
 ):
@@ -119,7 +217,9 @@ async def send_message_bot(
     if not org_id:
         raise HTTPException(status_code=400, detail="organization_id is required")
     
-    return await _send_msg(payload, db, UUID(str(org_id)), MessageFrom.BOT, payload.get("assigned_user_id"))
+    return await _send_msg(
+        payload, db, UUID(str(org_id)), MessageFrom.BOT, payload.get("assigned_user_id"), background_tasks
+    )
 
 
 @router.post("/send_human", response_model=MessageOut)
@@ -136,10 +236,13 @@ async def _send_msg(
     db: Session, 
     organization_id: UUID, 
     sender_type: MessageFrom, 
-    user_id: Optional[UUID] = None
+    user_id: Optional[UUID] = None,
+    background_tasks: Optional[BackgroundTasks] = None,
 ):
     """
     Store -> Send on WhatsApp -> Websocket emission
+    With parts, the first one is sent here and the rest after the response,
+    each after its delay.
     """
 
     # 0) Validate required payload fields (runtime creds)
@@ -222,16 +325,32 @@ async def _send_msg(
     db.refresh(db_message)
 
     # 3) Send on WhatsApp
+    parts = [part for part in payload.get("parts") or [] if part]
+    if not parts or payload.get("template") or background_tasks is None:
+        parts = [content]
     wa_resp, wa_status = _send_whatsapp_text(
         to=recipient_phone,
-        message=content,
+        message=parts[0],
         access_token=access_token,
         phone_number_id=phone_number_id,
         version=version,
+        template=payload.get("template"),
+        interactive=payload.get("interactive") if len(parts) == 1 else None,
     )
 
     if 200 <= wa_status < 300:
         db_message.status = "sent"
+        if len(parts) > 1:
+            background_tasks.add_task(
+                _send_remaining_parts,
+                parts,
+                payload.get("part_delays_ms") or [],
+                to=recipient_phone,
+                access_token=access_token,
+                phone_number_id=phone_number_id,
+                version=version,
+                interactive=payload.get("interactive"),
+            )
 
         # Optional: store WA message id if your model supports it
         try:
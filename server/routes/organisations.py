@@ -1,3 +1,5 @@
+import re
+from zoneinfo import ZoneInfo, ZoneInfoNotFoundError
 from fastapi import APIRouter, Depends, HTTPException
 from sqlalchemy.orm import Session
 from server.schemas import OrganizationOut, OrganizationUpdate, AuthContext
@@ -41,6 +43,29 @@ def update_organisation(
         org.business_description = update_data["business_description"]
     if "flow_prompt" in update_data:
         org.flow_prompt = update_data["flow_prompt"]
+    if "memory_prompt" in update_data:
+        org.memory_prompt = update_data["memory_prompt"]
+    if "memory_fact_fields" in update_data:
+        org.memory_fact_fields = update_data["memory_fact_fields"]
+    if "prompt_overrides" in update_data:
+        org.prompt_overrides = update_data["prompt_overrides"]
+    if "prompt_examples" in update_data:
+        org.prompt_examples = update_data["prompt_examples"]
+    if "timezone" in update_data:
+        if update_data["timezone"]:
+            try:
+                ZoneInfo(update_data["timezone"])
+            except (ZoneInfoNotFoundError, ValueError):
+                raise HTTPException(status_code=400, detail=f"Unknown timezone: {update_data['timezone']}")
+        org.timezone = update_data["timezone"]
+    if "forbidden_claims" in update_data:
+        for claim in update_data["forbidden_claims"] or []:
+            if claim.startswith("re:"):
+                try:
+                    re.compile(claim[3:])
+                except re.error as e:
+                    raise HTTPException(status_code=400, detail=f"Invalid forbidden claim pattern {claim!r}: {e}")
+        org.forbidden_claims = update_data["forbidden_claims"]
     if "name" in update_data:
         org.name = update_data["name"]
     
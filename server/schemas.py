@@ -9,6 +9,7 @@ from server.enums import (
     UserSentiment,
     TemplateStatus,
     MessageFrom,
+    CTAType,
 )
 from pydantic import EmailStr
 
@@ -116,12 +117,43 @@ class DashboardStatsOut(BaseModel):
 # User / Org
 # ======================================================
 
+class PromptOverrides(BaseModel):
+    """Organization replacements for sections of the reply prompt. Unset sections keep the defaults."""
+    persona: Optional[str] = None
+    tone: Optional[str] = None
+    style: Optional[str] = None
+    language_style: Optional[str] = None
+    forbidden_topics: List[str] = []
+    stage_rules: Dict[ConversationStage, str] = {}  # Replaces the reply guidance for a stage
+    brain_stage_rules: Dict[ConversationStage, str] = {}  # Replaces the transition rules for a stage
+    emoji_style: Optional[Literal["none", "light", "heavy"]] = None
+    whatsapp_formatting: Optional[bool] = None  # False strips *bold* / _italics_ from replies
+
+
+class PromptExampleTurn(BaseModel):
+    sender: Literal["lead", "bot"]
+    text: str
+
+
+class PromptExample(BaseModel):
+    """Example conversation shown to the bot for a stage (or any stage if stage is unset)."""
+    title: str = ""
+    stage: Optional[ConversationStage] = None
+    turns: List[PromptExampleTurn]
+
+
 class OrganizationOut(BaseModel):
     id: UUID
     name: str
     business_name: Optional[str] = None
     business_description: Optional[str] = None
     flow_prompt: Optional[str] = None
+    memory_prompt: Optional[str] = None
+    memory_fact_fields: Optional[List[str]] = None
+    prompt_overrides: Optional[PromptOverrides] = None
+    prompt_examples: Optional[List[PromptExample]] = None
+    timezone: Optional[str] = None  # IANA name, e.g. "Asia/Kolkata"; UTC if unset
+    forbidden_claims: Optional[List[str]] = None  # Phrases, or "re:<regex>", never allowed in bot replies
     is_active: bool
     created_at: datetime
     updated_at: Optional[datetime]
@@ -133,6 +165,12 @@ class OrganizationUpdate(BaseModel):
     business_name: Optional[str] = None
     business_description: Optional[str] = None
     flow_prompt: Optional[str] = None
+    memory_prompt: Optional[str] = None
+    memory_fact_fields: Optional[List[str]] = None
+    prompt_overrides: Optional[PromptOverrides] = None
+    prompt_examples: Optional[List[PromptExample]] = None
+    timezone: Optional[str] = None  # IANA name, e.g. "Asia/Kolkata"; UTC if unset
+    forbidden_claims: Optional[List[str]] = None  # Phrases, or "re:<regex>", never allowed in bot replies
 
 
 class UserOut(BaseModel):
@@ -208,9 +246,13 @@ class MessageOut(BaseModel):
 
 class CTACreate(BaseModel):
     name: str
+    cta_type: CTAType = CTAType.BOOKING
+    params: Dict[str, str] = {}
 
 class CTAUpdate(BaseModel):
     name: Optional[str] = None
+    cta_type: Optional[CTAType] = None
+    params: Optional[Dict[str, str]] = None
     is_active: Optional[bool] = None
 
 
@@ -218,6 +260,8 @@ class CTAOut(BaseModel):
     id: UUID
     organization_id: UUID
     name: str
+    cta_type: CTAType
+    params: Optional[Dict[str, str]] = None
     is_active: bool
     created_at: datetime
     updated_at: Optional[datetime]
@@ -318,6 +362,14 @@ class LeadOut(BaseModel):
     updated_at: Optional[datetime]
 
 
+class ForgetLeadOut(BaseModel):
+    """Result of wiping a lead's LLM memory."""
+    lead_id: UUID
+    conversations_cleared: int
+    summary_revisions_deleted: int
+    pipeline_recordings_deleted: int
+
+
 # ======================================================
 # Analytics
 # ======================================================
@@ -428,6 +480,12 @@ class InternalIntegrationWithOrgOut(BaseModel):
     business_name: Optional[str] = None
     business_description: Optional[str] = None
     flow_prompt: Optional[str] = None
+    memory_prompt: Optional[str] = None
+    memory_fact_fields: Optional[List[str]] = None
+    prompt_overrides: Optional[PromptOverrides] = None
+    prompt_examples: Optional[List[PromptExample]] = None
+    timezone: Optional[str] = None  # IANA name, e.g. "Asia/Kolkata"; UTC if unset
+    forbidden_claims: Optional[List[str]] = None  # Phrases, or "re:<regex>", never allowed in bot replies
 
 
 class InternalLeadCreate(BaseModel):
@@ -448,10 +506,16 @@ class InternalLeadOut(BaseModel):
     conversation_stage: Optional[ConversationStage]
     intent_level: Optional[IntentLevel]
     user_sentiment: Optional[UserSentiment]
+    profile: Optional[Dict[str, Any]] = None
     created_at: datetime
     updated_at: Optional[datetime]
 
 
+class InternalLeadProfileUpdate(BaseModel):
+    """Replace the lead's extracted profile via internal API."""
+    profile: Dict[str, Any]
+
+
 class InternalConversationCreate(BaseModel):
     """Create a new conversation via internal API."""
     organization_id: UUID
@@ -532,6 +596,18 @@ class InternalMessageOut(BaseModel):
     created_at: datetime
 
 
+class InternalInboundClaimOut(BaseModel):
+    """Outcome of claiming an inbound WhatsApp message ID."""
+    message_id: str
+    claimed: bool  # False: another worker has it, or it was already answered
+    status: Literal["processing", "replied", "done"]
+
+
+class InternalInboundClaimUpdate(BaseModel):
+    """Advance a claimed inbound message."""
+    status: Literal["replied", "done"]
+
+
 class InternalDueFollowupOut(BaseModel):
     """Details for a conversation that is due for a followup."""
     followup_type: ConversationStage  # FOLLOWUP_10M, FOLLOWUP_3H, or FOLLOWUP_6H
@@ -546,6 +622,12 @@ class InternalDueFollowupOut(BaseModel):
     business_name: Optional[str] = None
     business_description: Optional[str] = None
     flow_prompt: Optional[str] = None
+    memory_prompt: Optional[str] = None
+    memory_fact_fields: Optional[List[str]] = None
+    prompt_overrides: Optional[PromptOverrides] = None
+    prompt_examples: Optional[List[PromptExample]] = None
+    timezone: Optional[str] = None  # IANA name, e.g. "Asia/Kolkata"; UTC if unset
+    forbidden_claims: Optional[List[str]] = None  # Phrases, or "re:<regex>", never allowed in bot replies
 
 
 class InternalPipelineEventCreate(BaseModel):
@@ -559,6 +641,57 @@ class InternalPipelineEventCreate(BaseModel):
     tokens_used: Optional[int] = None
 
 
+class InternalSummaryRevisionCreate(BaseModel):
+    """Record a rolling-summary revision."""
+    conversation_id: UUID
+    request_id: Optional[str] = None
+    source: str
+    trigger_message: Optional[str] = None
+    bot_message: Optional[str] = None
+    previous_summary: Optional[str] = None
+    new_summary: Optional[str] = None
+    diff: Optional[str] = None
+
+
+class InternalSummaryRevisionOut(InternalSummaryRevisionCreate):
+    """Rolling-summary revision data."""
+    id: UUID
+    created_at: datetime
+
+
+class InternalPromptVersionCreate(BaseModel):
+    """Publish prompt text (llm.prompt_store.PromptBundle.prompts)."""
+    prompts: Dict[str, str]
+    note: Optional[str] = None
+    activate: bool = True
+
+
+class InternalPromptVersionOut(BaseModel):
+    """A published prompt version."""
+    version: int
+    prompts: Dict[str, str]
+    note: Optional[str] = None
+    is_active: bool
+    created_at: datetime
+
+
+class InternalPipelineRecordingCreate(BaseModel):
+    """Record a pipeline run's input and result (llm.replay.PipelineRecording)."""
+    conversation_id: UUID
+    organization_id: Optional[UUID] = None
+    request_id: Optional[str] = None
+    user_message: str
+    context: Dict[str, Any]
+    result: Dict[str, Any]
+    prompt_version: Optional[str] = None
+
+
+class InternalPipelineRecordingOut(InternalPipelineRecordingCreate):
+    """A recorded pipeline run."""
+    id: UUID
+    created_at: datetime
+
+
 class InternalPipelineEventOut(BaseModel):
     """Pipeline event data."""
     id: UUID
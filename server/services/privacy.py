@@ -0,0 +1,60 @@
+"""
+Privacy operations for data-subject requests (GDPR / DPDP).
+"""
+import logging
+from typing import Optional
+from uuid import UUID
+
+from sqlalchemy.orm import Session
+
+from server.models import Conversation, Lead, PipelineRecording, SummaryRevision
+from server.schemas import ForgetLeadOut
+
+logger = logging.getLogger(__name__)
+
+
+def forget_lead(db: Session, organization_id: UUID, lead_id: UUID) -> Optional[ForgetLeadOut]:
+    """
+    Wipe what the LLM memory has derived about a lead: rolling summaries,
+    the extracted profile and the summary audit trail, along with the
+    recorded pipeline runs of its conversations (which hold the conversation
+    and the summaries). Messages, pipeline events and aggregate analytics
+    are left intact.
+    Returns None if the lead does not belong to the organization.
+    """
+    lead = db.query(Lead).filter(Lead.id == lead_id, Lead.organization_id == organization_id).first()
+    if not lead:
+        return None
+
+    conversation_ids = [
+        conversation_id
+        for (conversation_id,) in db.query(Conversation.id).filter(Conversation.lead_id == lead_id).all()
+    ]
+    revisions_deleted = recordings_deleted = 0
+    if conversation_ids:
+        revisions_deleted = (
+            db.query(SummaryRevision)
+            .filter(SummaryRevision.conversation_id.in_(conversation_ids))
+            .delete(synchronize_session=False)
+        )
+        recordings_deleted = (
+            db.query(PipelineRecording)
+            .filter(PipelineRecording.conversation_id.in_(conversation_ids))
+            .delete(synchronize_session=False)
+        )
+        db.query(Conversation).filter(Conversation.id.in_(conversation_ids)).update(
+            {Conversation.rolling_summary: None}, synchronize_session=False
+        )
+    lead.profile = None
+    db.commit()
+
+    logger.info(
+        f"Forgot lead {lead_id} (org {organization_id}): {len(conversation_ids)} summaries cleared, "
+        f"{revisions_deleted} summary revisions and {recordings_deleted} pipeline recordings deleted"
+    )
+    return ForgetLeadOut(
+        lead_id=lead_id,
+        conversations_cleared=len(conversation_ids),
+        summary_revisions_deleted=revisions_deleted,
+        pipeline_recordings_deleted=recordings_deleted,
+    )
@@ -0,0 +1,41 @@
+import pytest
+
+from llm.schemas import NudgeContext, PipelineInput, TimingContext
+from server.enums import ConversationStage, IntentLevel, UserSentiment
+
+
+@pytest.fixture
+def make_context():
+    """
+    Builds a PipelineInput for a bot-mode conversation at the pricing stage,
+    within the WhatsApp window; keyword arguments override any field.
+    """
+    def make(**overrides) -> PipelineInput:
+        fields = dict(
+            business_name="Acme",
+            conversation_stage=ConversationStage.PRICING,
+            conversation_mode="bot",
+            intent_level=IntentLevel.HIGH,
+            user_sentiment=UserSentiment.CURIOUS,
+            timing=TimingContext(now_local="2024-01-01T12:00:00", whatsapp_window_open=True),
+            nudges=NudgeContext(),
+        )
+        fields.update(overrides)
+        return PipelineInput(**fields)
+
+    return make
+
+
+@pytest.fixture
+def brain_reply():
+    """Brain output answering a pricing question right away; extend with {**brain_reply, ...}."""
+    return {
+        "thought_process": "Lead asked for the price",
+        "situation_summary": "Pricing question",
+        "intent_level": "high",
+        "user_sentiment": "curious",
+        "action": "send_now",
+        "new_stage": "pricing",
+        "should_respond": True,
+        "confidence": 0.9,
+    }
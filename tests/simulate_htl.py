@@ -79,7 +79,7 @@ from llm.steps.mouth import _build_user_prompt as build_mouth_user_prompt
 original_run_brain = brain.run_brain
 original_run_mouth = mouth.run_mouth
 
-def traced_run_brain(context):
+def traced_run_brain(context, **kwargs):
     start = time.time()
     
     # Reconstruct Prompt for Logs
@@ -91,7 +91,7 @@ def traced_run_brain(context):
     except Exception as e:
         print(f"   [Error reconstructing prompt: {e}]")
         
-    result, lat, tokens = original_run_brain(context)
+    result, lat, tokens = original_run_brain(context, **kwargs)
     duration = (time.time() - start) * 1000
     
     # Pretty Print Brain Output
@@ -105,7 +105,7 @@ def traced_run_brain(context):
     
     return result, lat, tokens
 
-def traced_run_mouth(context, classification):
+def traced_run_mouth(context, classification, **kwargs):
     start = time.time()
     
     # Reconstruct Prompts for Logs
@@ -124,7 +124,7 @@ def traced_run_mouth(context, classification):
     except Exception as e:
         print(f"   [Error reconstructing prompt: {e}]")
     
-    result, lat, tokens = original_run_mouth(context, classification)
+    result, lat, tokens = original_run_mouth(context, classification, **kwargs)
     duration = (time.time() - start) * 1000
     
     # Pretty Print Mouth Output
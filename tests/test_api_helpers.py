@@ -0,0 +1,238 @@
+import pytest
+
+from llm import circuit_breaker
+from llm.api_helpers import json_prefill, make_api_call, make_streaming_api_call
+from llm.circuit_breaker import CLOSED, HALF_OPEN, CircuitBreaker
+from llm.errors import BadJSONError, ProviderUnavailableError
+from llm.providers import ChatRequest, ChatResponse, Provider, ToolCall, function_tool, register_provider
+from llm.providers.base import StreamChunk
+from llm.retry import RetryPolicy
+from llm.run_context import RunCancelledError, RunContext
+from llm.schemas import TokenUsage
+
+
+class ScriptedProvider(Provider):
+    """Returns (or raises) queued responses in order and records requests."""
+
+    def __init__(self, name, script):
+        self.name = name
+        self.script = list(script)
+        self.requests = []
+
+    def chat(self, request: ChatRequest) -> ChatResponse:
+        self.requests.append(request)
+        item = self.script.pop(0)
+        if isinstance(item, Exception):
+            raise item
+        if isinstance(item, ChatResponse):
+            return item
+        return ChatResponse(content=item, usage=TokenUsage(prompt_tokens=10, completion_tokens=5, total_tokens=15))
+
+
+class StreamingProvider(Provider):
+    """Streams the given text deltas."""
+
+    def __init__(self, name, deltas):
+        self.name = name
+        self.deltas = deltas
+
+    def chat(self, request: ChatRequest) -> ChatResponse:
+        raise NotImplementedError
+
+    def stream(self, request: ChatRequest):
+        for delta in self.deltas:
+            yield StreamChunk(delta=delta)
+
+
+NO_RETRY = RetryPolicy(max_attempts=1)
+MESSAGES = [{"role": "user", "content": "Hi"}]
+
+
+def _install(name, script):
+    provider = ScriptedProvider(name, script)
+    register_provider(name, lambda: provider)
+    return provider
+
+
+def test_parses_json_and_reports_usage():
+    _install("scripted-ok", ['{"message_text": "Hello"}'])
+    response = make_api_call(MESSAGES, provider="scripted-ok", model="m", fallbacks=[], retry_policy=NO_RETRY)
+    assert response.data == {"message_text": "Hello"}
+    assert response.usage.total_tokens == 15
+
+
+def test_malformed_json_is_repaired():
+    provider = _install("scripted-repair", ['{"message_text": "Hello"', '{"message_text": "Hello"}'])
+    response = make_api_call(MESSAGES, provider="scripted-repair", model="m", fallbacks=[], retry_policy=NO_RETRY)
+
+    assert response.data == {"message_text": "Hello"}
+    assert response.usage.total_tokens == 30
+    repair_messages = provider.requests[1].messages
+    assert repair_messages[-2] == {"role": "assistant", "content": '{"message_text": "Hello"'}
+    assert "could not be parsed" in repair_messages[-1]["content"]
+
+
+def test_unrepairable_json_raises_bad_json():
+    _install("scripted-garbage", ["not json", "still not json"])
+    with pytest.raises(BadJSONError) as exc_info:
+        make_api_call(MESSAGES, provider="scripted-garbage", model="m", fallbacks=[], retry_policy=NO_RETRY)
+    assert exc_info.value.raw_content == "still not json"
+
+
+def test_fails_over_to_next_model():
+    _install("scripted-down", [ProviderUnavailableError("down")])
+    backup = _install("scripted-backup", ['{"ok": true}'])
+    response = make_api_call(
+        MESSAGES,
+        provider="scripted-down",
+        model="primary",
+        fallbacks=[("scripted-backup", "backup-model")],
+        retry_policy=NO_RETRY,
+    )
+    assert response.data == {"ok": True}
+    assert response.provider == "scripted-backup"
+    assert backup.requests[0].model == "backup-model"
+
+
+def test_tool_calls_are_returned_without_json_content():
+    select_cta = function_tool(
+        "select_cta",
+        "Select a CTA for the lead",
+        {"type": "object", "properties": {"cta_id": {"type": "string"}}, "required": ["cta_id"]},
+    )
+    provider = _install("scripted-tools", [
+        ChatResponse(content="", tool_calls=[ToolCall(id="call_1", name="select_cta", arguments={"cta_id": "abc"})]),
+    ])
+    response = make_api_call(
+        MESSAGES,
+        provider="scripted-tools",
+        model="m",
+        fallbacks=[],
+        retry_policy=NO_RETRY,
+        tools=[select_cta],
+        tool_choice="required",
+    )
+
+    assert response.data == {}
+    assert response.tool_calls[0].name == "select_cta"
+    assert response.tool_calls[0].arguments == {"cta_id": "abc"}
+    assert provider.requests[0].tools == [select_cta]
+    assert provider.requests[0].tool_choice == "required"
+
+
+def test_prefill_is_derived_from_the_response_schema():
+    schema = {"type": "json_schema", "json_schema": {"name": "x", "schema": {
+        "type": "object", "properties": {"thought_process": {"type": "string"}, "action": {"type": "string"}},
+    }}}
+    assert json_prefill(schema) == '{"thought_process":'
+    assert json_prefill({"type": "json_object"}) == "{"
+    assert json_prefill(None) is None
+
+    provider = _install("scripted-prefill", ['{"thought_process": "ok"}', '{"thought_process": "ok"}'])
+    make_api_call(MESSAGES, response_format=schema, provider="scripted-prefill", model="m", fallbacks=[], retry_policy=NO_RETRY)
+    make_api_call(MESSAGES, response_format=schema, provider="scripted-prefill", model="m", fallbacks=[],
+                  retry_policy=NO_RETRY, prefill="")
+
+    assert provider.requests[0].prefill == '{"thought_process":'
+    assert provider.requests[1].prefill is None
+
+
+def test_call_log_hook_receives_redacted_record(monkeypatch):
+    from llm.call_log import set_call_log_hook
+    from llm.config import llm_config
+
+    monkeypatch.setattr(llm_config, "log_redact_phones", True)
+    monkeypatch.setattr(llm_config, "log_redact_user_content", True)
+    records = []
+    set_call_log_hook(records.append)
+    try:
+        _install("scripted-logged", ['{"message_text": "Call us on +91 98765 43210"}'])
+        make_api_call(
+            [{"role": "system", "content": "Lead phone: 9876543210"}, {"role": "user", "content": "my secret"}],
+            provider="scripted-logged", model="m", fallbacks=[], retry_policy=NO_RETRY, step_name="Mouth",
+        )
+    finally:
+        set_call_log_hook(None)
+
+    record = records[0]
+    assert record.step_name == "Mouth"
+    assert record.provider == "scripted-logged"
+    assert record.messages[0]["content"] == "Lead phone: [PHONE]"
+    assert record.messages[1]["content"] == "[REDACTED 9 chars]"
+    assert "98765" not in record.response
+    assert record.usage.total_tokens == 15
+
+
+def test_request_id_and_idempotency_key_are_propagated():
+    from llm.run_context import RunContext
+
+    provider = _install("scripted-traced", ['{"a": 1', '{"a": 1}'])
+    make_api_call(
+        MESSAGES, provider="scripted-traced", model="m", fallbacks=[], retry_policy=NO_RETRY,
+        step_name="Brain", ctx=RunContext(request_id="wamid.123"),
+    )
+
+    original, repair = provider.requests
+    assert original.request_id == repair.request_id == "wamid.123"
+    assert original.idempotency_key == "wamid.123:Brain:0"
+    assert repair.idempotency_key != original.idempotency_key
+
+
+def test_idempotency_suffix_sets_calls_of_a_step_apart():
+    from llm.run_context import RunContext
+
+    provider = _install("scripted-reask", ['{"a": 1}'])
+    make_api_call(
+        MESSAGES, provider="scripted-reask", model="m", fallbacks=[], retry_policy=NO_RETRY,
+        step_name="Mouth", ctx=RunContext(request_id="wamid.123"), idempotency_suffix="constraints1",
+    )
+
+    assert provider.requests[0].idempotency_key == "wamid.123:Mouth:constraints1:0"
+
+
+def test_truncated_output_is_regenerated_with_more_tokens():
+    truncated = ChatResponse(
+        content='{"message_text": "Hel',
+        usage=TokenUsage(prompt_tokens=10, completion_tokens=100, total_tokens=110),
+        finish_reason="length",
+    )
+    provider = _install("scripted-truncated", [truncated, '{"message_text": "Hello"}'])
+    response = make_api_call(
+        MESSAGES, provider="scripted-truncated", model="m", fallbacks=[], retry_policy=NO_RETRY, max_tokens=100,
+    )
+
+    assert response.data == {"message_text": "Hello"}
+    assert [request.max_tokens for request in provider.requests] == [100, 200]
+    assert response.usage.total_tokens == 125
+
+
+def test_health_check_reports_auth_failure_and_success():
+    from llm.api_helpers import health_check
+    from llm.errors import AuthError
+
+    _install("scripted-bad-key", [AuthError("invalid key", status_code=401)])
+    status = health_check(provider="scripted-bad-key", model="m")
+    assert not status.healthy
+    assert status.auth_ok is False
+
+    _install("scripted-healthy", ["pong"])
+    status = health_check(provider="scripted-healthy", model="m")
+    assert status.healthy
+    assert status.auth_ok is True
+
+
+def test_cancelled_stream_frees_the_half_open_trial(monkeypatch):
+    breaker = CircuitBreaker("stream-trial", failure_threshold=1, cooldown_seconds=0)
+    monkeypatch.setitem(circuit_breaker._breakers, "stream-trial", breaker)
+    register_provider("stream-trial", lambda: StreamingProvider("stream-trial", ["Hel", "lo"]))
+    breaker.record_failure()
+    assert breaker.state == HALF_OPEN
+
+    ctx = RunContext()
+    with pytest.raises(RunCancelledError):
+        make_streaming_api_call(MESSAGES, on_token=lambda _: ctx.cancel(), ctx=ctx, provider="stream-trial", model="m")
+    assert breaker.state == HALF_OPEN
+
+    result = make_streaming_api_call(MESSAGES, provider="stream-trial", model="m")
+    assert result.content == "Hello"
+    assert breaker.state == CLOSED
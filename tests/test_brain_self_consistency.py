@@ -0,0 +1,66 @@
+from llm.client import CannedLLMClient
+from llm.config import llm_config
+from llm.steps.brain import run_brain
+from server.enums import ConversationStage, DecisionAction
+
+
+def _decision(action, stage, confidence, policy_risk="low"):
+    return {
+        "thought_process": "Lead asked about price",
+        "situation_summary": "Pricing question",
+        "intent_level": "high",
+        "user_sentiment": "curious",
+        "risk_flags": {"spam_risk": "low", "policy_risk": policy_risk, "hallucination_risk": "low"},
+        "action": action,
+        "new_stage": stage,
+        "should_respond": True,
+        "confidence": confidence,
+    }
+
+
+def test_majority_decision_wins(monkeypatch, make_context):
+    monkeypatch.setattr(llm_config, "self_consistency_samples", 3)
+    client = CannedLLMClient({"Brain": [
+        _decision("send_now", "pricing", 0.7),
+        _decision("initiate_cta", "cta", 0.95),
+        _decision("send_now", "pricing", 0.8),
+    ]})
+
+    output, _, _ = run_brain(make_context(), client=client)
+
+    assert client.steps_called() == ["Brain", "Brain", "Brain"]
+    assert output.action == DecisionAction.SEND_NOW
+    assert output.confidence == 0.8
+    assert all(kwargs["cache"] is False for _, _, kwargs in client.calls)
+    assert sorted(kwargs["idempotency_suffix"] for _, _, kwargs in client.calls) == ["sample0", "sample1", "sample2"]
+
+
+def test_tie_goes_to_lower_risk(monkeypatch, make_context):
+    monkeypatch.setattr(llm_config, "self_consistency_samples", 2)
+    client = CannedLLMClient({"Brain": [
+        _decision("initiate_cta", "cta", 0.9, policy_risk="high"),
+        _decision("send_now", "pricing", 0.6),
+    ]})
+
+    output, _, _ = run_brain(make_context(), client=client)
+
+    assert output.action == DecisionAction.SEND_NOW
+
+
+def test_failed_candidates_are_skipped(monkeypatch, make_context):
+    monkeypatch.setattr(llm_config, "self_consistency_samples", 2)
+    client = CannedLLMClient({"Brain": [RuntimeError("provider down"), _decision("send_now", "pricing", 0.7)]})
+
+    output, _, _ = run_brain(make_context(), client=client)
+
+    assert output.action == DecisionAction.SEND_NOW
+    assert output.confidence == 0.7
+
+
+def test_other_stages_make_one_call(monkeypatch, make_context):
+    monkeypatch.setattr(llm_config, "self_consistency_samples", 3)
+    client = CannedLLMClient({"Brain": [_decision("send_now", "qualification", 0.8)]})
+
+    run_brain(make_context(conversation_stage=ConversationStage.GREETING), client=client)
+
+    assert client.steps_called() == ["Brain"]
@@ -0,0 +1,61 @@
+import pytest
+
+from llm.circuit_breaker import CircuitBreaker, CircuitOpenError, CLOSED, OPEN, HALF_OPEN
+
+
+class FakeClock:
+    def __init__(self):
+        self.now = 0.0
+
+    def __call__(self):
+        return self.now
+
+
+@pytest.fixture
+def clock():
+    return FakeClock()
+
+
+@pytest.fixture
+def breaker(clock):
+    return CircuitBreaker("groq", failure_threshold=3, cooldown_seconds=30, clock=clock)
+
+
+def test_trips_after_consecutive_failures(breaker):
+    for _ in range(3):
+        breaker.before_call()
+        breaker.record_failure()
+    assert breaker.state == OPEN
+    with pytest.raises(CircuitOpenError):
+        breaker.before_call()
+
+
+def test_success_resets_failure_count(breaker):
+    breaker.record_failure()
+    breaker.record_failure()
+    breaker.record_success()
+    breaker.record_failure()
+    assert breaker.state == CLOSED
+
+
+def test_half_open_allows_single_trial(breaker, clock):
+    for _ in range(3):
+        breaker.record_failure()
+    clock.now += 31
+    assert breaker.state == HALF_OPEN
+
+    breaker.before_call()  # trial call allowed
+    with pytest.raises(CircuitOpenError):
+        breaker.before_call()  # concurrent calls still rejected
+
+    breaker.record_success()
+    assert breaker.state == CLOSED
+
+
+def test_failed_trial_reopens(breaker, clock):
+    for _ in range(3):
+        breaker.record_failure()
+    clock.now += 31
+    breaker.before_call()
+    breaker.record_failure()
+    assert breaker.state == OPEN
@@ -2,6 +2,7 @@
 import pytest
 from llm.schemas import PipelineInput, MessageContext, TimingContext, NudgeContext
 from llm.schemas import PipelineInput, MessageContext, TimingContext, NudgeContext
+from llm.schemas import PromptOverrides
 from llm.steps.brain import _is_opening_message, _build_user_prompt
 from llm.prompts_registry import get_brain_system_prompt
 from server.enums import ConversationStage, IntentLevel, UserSentiment
@@ -86,3 +87,13 @@ def test_opening_message_forces_greeting_prompt():
     assert "EVALUATING STAGE: GREETING" in prompt
     assert "OPENING message from a new lead" in prompt
     assert "EVALUATING STAGE: PRICING" not in prompt
+
+def test_org_brain_stage_rules_replace_default():
+    overrides = PromptOverrides(brain_stage_rules={ConversationStage.PRICING: "Move to cta once a plan is named."})
+    prompt = get_brain_system_prompt(ConversationStage.PRICING, overrides=overrides)
+    assert "EVALUATING STAGE: PRICING\nMove to cta once a plan is named." in prompt
+    assert "User accepts price" not in prompt
+
+    # Other stages keep the defaults
+    qualification_prompt = get_brain_system_prompt(ConversationStage.QUALIFICATION, overrides=overrides)
+    assert "Requirements partially gathered" in qualification_prompt
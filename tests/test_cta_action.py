@@ -0,0 +1,81 @@
+from uuid import UUID
+
+import pytest
+
+from llm.cta import build_cta_action, parse_params, resolve_cta_action
+from llm.schemas import GenerateOutput
+from llm.steps.brain import _validate_and_build_output
+from server.enums import ConversationStage, CTAType
+
+BOOKING_ID = "7f0c1b6e-3a0e-4c57-9d7a-2b3f4c5d6e7f"
+PAYMENT_ID = "0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+LINK_ID = "5e6f7a8b-9c0d-4e1f-a2b3-c4d5e6f7a8b9"
+
+CTAS = [
+    {"id": BOOKING_ID, "name": "Book a call", "type": "booking"},
+    {"id": PAYMENT_ID, "name": "Pay deposit", "type": "payment"},
+    {"id": LINK_ID, "name": "Brochure", "type": "link", "params": {"url": "https://acme.example/brochure"}},
+]
+
+
+@pytest.fixture
+def context(make_context):
+    return make_context(conversation_stage=ConversationStage.CTA, available_ctas=CTAS)
+
+
+def _brain_data(**overrides):
+    data = {
+        "action": "initiate_cta",
+        "new_stage": "cta",
+        "should_respond": True,
+        "confidence": 0.9,
+        "selected_cta_id": BOOKING_ID,
+        "cta_scheduled_at": "2024-01-02T17:00:00+05:30",
+        "cta_params": [],
+    }
+    data.update(overrides)
+    return data
+
+
+def test_brain_builds_typed_cta_action(context):
+    output = _validate_and_build_output(_brain_data(), context)
+
+    assert output.cta_action.cta_id == UUID(BOOKING_ID)
+    assert output.cta_action.type == CTAType.BOOKING
+    assert output.cta_action.scheduled_at.utcoffset().total_seconds() == 5.5 * 3600
+    assert output.cta_scheduled_at == "2024-01-02T17:00:00+05:30"
+
+
+def test_unknown_cta_is_dropped(context):
+    output = _validate_and_build_output(_brain_data(selected_cta_id="not-a-cta"), context)
+
+    assert output.cta_action is None
+    assert output.selected_cta_id is None
+
+
+def test_params_are_validated_per_type():
+    payment = build_cta_action(PAYMENT_ID, CTAS, params=parse_params([{"key": "amount", "value": "499"}]))
+    assert payment.params == {"amount": "499"}
+
+    assert build_cta_action(PAYMENT_ID, CTAS, params={"amount": "free"}) is None
+    assert build_cta_action(PAYMENT_ID, CTAS, params={"amount": "-10"}) is None
+
+
+def test_configured_link_url_wins_over_model_params():
+    action = build_cta_action(LINK_ID, CTAS, params={"url": "https://elsewhere.example"})
+    assert action.type == CTAType.LINK
+    assert action.params["url"] == "https://acme.example/brochure"
+
+    unconfigured = [{"id": LINK_ID, "name": "Brochure", "type": "link"}]
+    assert build_cta_action(LINK_ID, unconfigured) is None
+
+
+def test_mouth_selection_overrides_brain_and_keeps_time(context):
+    classification = _validate_and_build_output(_brain_data(), context)
+    response = GenerateOutput(message_text="Here's the payment link", selected_cta_id=UUID(PAYMENT_ID))
+
+    action = resolve_cta_action(classification, response, CTAS)
+
+    assert action.cta_id == UUID(PAYMENT_ID)
+    assert action.type == CTAType.PAYMENT
+    assert action.scheduled_at == classification.cta_action.scheduled_at
@@ -0,0 +1,66 @@
+from datetime import datetime
+from zoneinfo import ZoneInfo
+
+from llm.datetime_parsing import resolve_datetime, resolve_minutes, to_rfc3339
+from llm.schemas import TimingContext
+from llm.steps.brain import _validate_and_build_output
+from server.enums import ConversationStage
+
+# Friday evening in the organization's timezone
+NOW = datetime(2024, 1, 5, 18, 30, tzinfo=ZoneInfo("Asia/Kolkata"))
+
+
+def _resolve(value):
+    resolved = resolve_datetime(value, NOW)
+    return to_rfc3339(resolved) if resolved else None
+
+
+def test_relative_times_resolve_against_now_local():
+    assert _resolve("tomorrow 5pm") == "2024-01-06T17:00:00+05:30"
+    assert _resolve("in 2 hours") == "2024-01-05T20:30:00+05:30"
+    assert _resolve("day after tomorrow, 9 am") == "2024-01-07T09:00:00+05:30"
+    assert _resolve("monday morning") == "2024-01-08T10:00:00+05:30"
+    assert _resolve("tonight") == "2024-01-05T20:00:00+05:30"
+
+
+def test_times_that_already_passed_today_roll_forward():
+    assert _resolve("5pm") == "2024-01-06T17:00:00+05:30"
+    assert _resolve("friday at 11:30") == "2024-01-12T11:30:00+05:30"
+
+
+def test_past_and_unparseable_times_are_rejected():
+    assert _resolve("today 3pm") is None
+    assert _resolve("2024-01-01T10:00:00+05:30") is None
+    assert _resolve("whenever works") is None
+    assert _resolve(None) is None
+
+
+def test_iso_without_offset_is_in_org_timezone():
+    assert _resolve("2024-01-06T09:00") == "2024-01-06T09:00:00+05:30"
+    assert _resolve("2024-01-06T09:00:00Z") == "2024-01-06T09:00:00+00:00"
+
+
+def test_followup_minutes():
+    assert resolve_minutes(45, NOW) == 45
+    assert resolve_minutes("30", NOW) == 30
+    assert resolve_minutes("2 hours", NOW) == 120
+    assert resolve_minutes("tomorrow 10am", NOW) == 930
+    assert resolve_minutes(-5, NOW) == 0
+    assert resolve_minutes("soon", NOW) == 0
+
+
+def test_brain_normalizes_scheduled_time(make_context):
+    context = make_context(
+        conversation_stage=ConversationStage.CTA,
+        timing=TimingContext(now_local=NOW.isoformat(), whatsapp_window_open=True),
+    )
+    output = _validate_and_build_output({
+        "action": "wait_schedule",
+        "new_stage": "cta",
+        "confidence": 0.9,
+        "cta_scheduled_at": "tomorrow 5pm",
+        "followup_in_minutes": "in 3 hours",
+    }, context)
+
+    assert output.cta_scheduled_at == "2024-01-06T17:00:00+05:30"
+    assert output.followup_in_minutes == 180
@@ -0,0 +1,75 @@
+import pytest
+
+from llm.client import CannedLLMClient
+from llm.pipeline import run_followup_pipeline
+from llm.schemas import MessageContext
+from llm.steps.variation import similarity
+from server.enums import ConversationStage, IntentLevel, UserSentiment
+
+EARLIER_NUDGE = "Hi Asha, just checking in - did you get a chance to look at our plans?"
+REPEATED_NUDGE = "Hi Asha, just checking in! Did you get a chance to look at the plans?"
+FRESH_NUDGE = "Quick question Asha: would a 10 minute call this week help you decide?"
+
+BRAIN_NUDGE = {
+    "thought_process": "Lead went quiet after pricing",
+    "situation_summary": "Follow-up due",
+    "intent_level": "medium",
+    "user_sentiment": "neutral",
+    "action": "send_now",
+    "new_stage": "followup",
+    "should_respond": True,
+    "confidence": 0.9,
+}
+
+
+@pytest.fixture
+def context(make_context):
+    return make_context(
+        conversation_stage=ConversationStage.FOLLOWUP,
+        intent_level=IntentLevel.MEDIUM,
+        user_sentiment=UserSentiment.NEUTRAL,
+        last_messages=[
+            MessageContext(sender="lead", text="How much is it?", timestamp="2024-01-01T10:00:00"),
+            MessageContext(sender="bot", text=EARLIER_NUDGE, timestamp="2024-01-01T10:10:00"),
+        ],
+    )
+
+
+def test_similarity():
+    assert similarity(EARLIER_NUDGE, REPEATED_NUDGE) > 0.7
+    assert similarity(EARLIER_NUDGE, FRESH_NUDGE) < 0.5
+    assert similarity("", EARLIER_NUDGE) == 0.0
+
+
+def test_distinct_followup_is_sent_unchanged(context):
+    client = CannedLLMClient({"Brain": [BRAIN_NUDGE], "Mouth": [{"message_text": FRESH_NUDGE}]})
+    result = run_followup_pipeline(context, client=client, memory_mode="worker")
+
+    assert client.steps_called() == ["Brain", "Mouth"]
+    assert result.response.message_text == FRESH_NUDGE
+
+
+def test_repeated_followup_is_paraphrased(context):
+    client = CannedLLMClient({
+        "Brain": [BRAIN_NUDGE],
+        "Mouth": [{"message_text": REPEATED_NUDGE}],
+        "Variation": [{"message_text": FRESH_NUDGE}],
+    })
+    result = run_followup_pipeline(context, client=client, memory_mode="worker")
+
+    assert client.steps_called() == ["Brain", "Mouth", "Variation"]
+    assert EARLIER_NUDGE in client.calls[-1][1][1]["content"]
+    assert result.response.message_text == FRESH_NUDGE
+    assert "variation" in result.step_metrics
+
+
+def test_followup_dropped_when_every_paraphrase_repeats(context):
+    client = CannedLLMClient({
+        "Brain": [BRAIN_NUDGE],
+        "Mouth": [{"message_text": REPEATED_NUDGE}],
+        "Variation": [{"message_text": REPEATED_NUDGE}, {"message_text": EARLIER_NUDGE}],
+    })
+    result = run_followup_pipeline(context, client=client, memory_mode="worker")
+
+    assert not result.should_send_message
+    assert result.response.violations
@@ -0,0 +1,35 @@
+from llm.utils import get_generate_schema
+
+
+def test_generate_schema_is_strict_and_complete():
+    spec = get_generate_schema()
+    schema = spec["schema"]
+
+    assert spec["strict"] is True
+    assert schema["additionalProperties"] is False
+    assert set(schema["properties"]) == {
+        "message_text", "message_language", "selected_cta_id", "next_followup_in_minutes", "interactive"
+    }
+    assert schema["required"] == list(schema["properties"])
+
+
+def test_generate_schema_types():
+    properties = get_generate_schema()["schema"]["properties"]
+
+    assert properties["message_text"]["type"] == "string"
+    assert properties["selected_cta_id"]["type"] == ["string", "null"]
+    assert properties["next_followup_in_minutes"]["type"] == "integer"
+    assert all("default" not in prop and "title" not in prop for prop in properties.values())
+    assert properties["message_text"]["description"]
+
+
+def test_generate_schema_nested_interactive_is_strict():
+    interactive = get_generate_schema()["schema"]["properties"]["interactive"]
+    option = interactive["properties"]["options"]["items"]
+
+    assert interactive["type"] == ["object", "null"]
+    assert interactive["additionalProperties"] is False
+    assert interactive["properties"]["type"]["enum"] == ["buttons", "list"]
+    assert option["required"] == ["id", "title", "cta_id", "stage"]
+    assert option["properties"]["stage"]["type"] == ["string", "null"]
+    assert None in option["properties"]["stage"]["enum"]
@@ -0,0 +1,99 @@
+import pytest
+
+from llm.client import CannedLLMClient
+from llm.config import llm_config
+from llm.grounding import find_ungrounded, knowledge_text
+from llm.pipeline import run_pipeline
+from llm.schemas import LeadProfile, MessageContext, RiskLevel
+
+KNOWLEDGE = "Plans: Basic 999/month, Pro ₹1,499/month. Open 10 am to 7:30 pm. Setup takes 3 days."
+
+
+@pytest.fixture
+def context(make_context):
+    return make_context(
+        business_description=KNOWLEDGE,
+        last_messages=[MessageContext(sender="lead", text="My budget is Rs 1200", timestamp="2024-01-01T11:59:00")],
+    )
+
+
+def test_claims_are_matched_after_normalizing():
+    assert find_ungrounded("Pro is Rs. 1499 and Basic ₹999; we open at 10:00 AM, set up in 3 days.", KNOWLEDGE) == []
+    assert find_ungrounded("Pro is Rs 1,999 with 20% off, open till 9 pm", KNOWLEDGE) == [
+        'price "Rs 1,999" is not in the business information',
+        'percentage "20%" is not in the business information',
+        'time "9 pm" is not in the business information',
+    ]
+
+
+def test_24_hour_times_ground_am_pm_claims():
+    assert find_ungrounded("We close at 6 pm and open at 9:30 am", "Hours: 09:30 to 18:00") == []
+    assert find_ungrounded("We close at 19:00", "Hours: 09:30 to 18:00") == [
+        'time "19:00" is not in the business information',
+    ]
+
+
+def test_lead_profile_grounds_but_rolling_summary_does_not(context):
+    knowledge = knowledge_text(context.model_copy(update={
+        "rolling_summary": "Bot offered Pro at Rs 1,299.",
+        "lead_profile": LeadProfile(budget="Rs 2500", timeline="within 2 weeks"),
+    }))
+
+    assert find_ungrounded("Pro at Rs 1,299 fits", knowledge) == ['price "Rs 1,299" is not in the business information']
+    assert find_ungrounded("Within Rs 2,500, live in 2 weeks", knowledge) == []
+
+
+def test_invented_price_is_withheld_and_flagged(monkeypatch, context, brain_reply):
+    monkeypatch.setattr(llm_config, "hallucination_check", "rules")
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Pro is just Rs 1,299 a month! Shall I set it up?"}],
+    })
+
+    result = run_pipeline(context, "How much is Pro?", client=client, memory_mode="worker")
+
+    assert not result.should_send_message
+    assert result.response.ungrounded_claims == ['price "Rs 1,299" is not in the business information']
+    assert result.classification.risk_flags.hallucination_risk == RiskLevel.HIGH
+    assert result.classification.needs_human_attention
+
+
+def test_grounded_reply_is_sent(monkeypatch, context, brain_reply):
+    monkeypatch.setattr(llm_config, "hallucination_check", "rules")
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Within your Rs 1200 budget, Basic at Rs 999/month fits. Want it?"}],
+    })
+
+    result = run_pipeline(context, "How much?", client=client, memory_mode="worker")
+
+    assert result.should_send_message
+    assert result.classification.risk_flags.hallucination_risk == RiskLevel.LOW
+
+
+def test_llm_check_catches_unsupported_availability(monkeypatch, context, brain_reply):
+    monkeypatch.setattr(llm_config, "hallucination_check", "llm")
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Pro is Rs 1,499 and we have slots free tomorrow!"}],
+        "Verify": [{"unsupported_claims": ["we have slots free tomorrow"]}],
+    })
+
+    result = run_pipeline(context, "Can I start tomorrow?", client=client, memory_mode="worker")
+
+    assert client.steps_called() == ["Brain", "Mouth", "Verify"]
+    assert "Pro ₹1,499/month" in client.calls[2][1][1]["content"]
+    assert result.response.ungrounded_claims == ["unsupported: we have slots free tomorrow"]
+    assert not result.should_send_message
+
+
+def test_check_is_off_by_default(context, brain_reply):
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Pro is just Rs 1,299 a month!"}],
+    })
+
+    result = run_pipeline(context, "How much is Pro?", client=client, memory_mode="worker")
+
+    assert result.should_send_message
+    assert client.steps_called() == ["Brain", "Mouth"]
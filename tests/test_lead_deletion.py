@@ -0,0 +1,47 @@
+import os
+import uuid
+
+import pytest
+from sqlalchemy import create_engine, event
+from sqlalchemy.orm import sessionmaker
+
+# server.database creates its engine on import; these tests use their own
+os.environ.setdefault("DATABASE_URL", "postgresql://localhost/whatsapp_funnel")
+
+from server.database import Base
+from server.enums import ConversationMode, ConversationStage
+from server.models import Conversation, Lead, Organization, PipelineRecording
+from server.routes.leads import delete_lead
+from server.schemas import AuthContext
+
+
+@pytest.fixture
+def db():
+    engine = create_engine("sqlite://")
+    # SQLite only enforces foreign keys when asked to, per connection
+    event.listen(engine, "connect", lambda connection, _: connection.execute("PRAGMA foreign_keys=ON"))
+    Base.metadata.create_all(engine)
+    session = sessionmaker(bind=engine)()
+    yield session
+    session.close()
+
+
+def test_deleting_a_recorded_lead_deletes_its_pipeline_recordings(db):
+    org_id, lead_id, conversation_id = uuid.uuid4(), uuid.uuid4(), uuid.uuid4()
+    db.add(Organization(id=org_id, name="Acme"))
+    db.add(Lead(id=lead_id, organization_id=org_id, phone="+919876543210"))
+    db.add(Conversation(
+        id=conversation_id, organization_id=org_id, lead_id=lead_id,
+        stage=ConversationStage.PRICING, mode=ConversationMode.BOT,
+    ))
+    db.add(PipelineRecording(
+        conversation_id=conversation_id, organization_id=org_id, user_message="How much?", context={}, result={},
+    ))
+    db.commit()
+
+    auth = AuthContext(user_id=uuid.uuid4(), organization_id=org_id, email="owner@acme.test", is_active=True)
+    delete_lead(lead_id, db=db, auth=auth)
+
+    assert db.query(Lead).count() == 0
+    assert db.query(Conversation).count() == 0
+    assert db.query(PipelineRecording).count() == 0
@@ -0,0 +1,95 @@
+import pytest
+
+from llm.batch import BatchItem, BatchQueue, submit_batch
+from llm.errors import BadRequestError, ProviderUnavailableError
+from llm.providers import ChatRequest, ChatResponse, Provider, register_provider
+from llm.providers.base import BATCH_COMPLETED, BATCH_PENDING
+from llm.schemas import TokenUsage
+
+
+class FakeBatchProvider(Provider):
+    """Accepts batches and completes them when .finish() is called."""
+
+    name = "fake-batch"
+
+    def __init__(self):
+        self.batches = {}
+        self.finished = set()
+
+    def chat(self, request: ChatRequest) -> ChatResponse:
+        raise AssertionError("batch items must not be sent synchronously")
+
+    def submit_batch(self, requests):
+        batch_id = f"batch_{len(self.batches) + 1}"
+        self.batches[batch_id] = requests
+        return batch_id
+
+    def batch_status(self, batch_id):
+        return BATCH_COMPLETED if batch_id in self.finished else BATCH_PENDING
+
+    def batch_results(self, batch_id):
+        results = {}
+        for custom_id in self.batches[batch_id]:
+            if custom_id == "bad":
+                results[custom_id] = BadRequestError("invalid request")
+            else:
+                results[custom_id] = ChatResponse(
+                    content=f'{{"message_text": "hi {custom_id}"}}',
+                    usage=TokenUsage(prompt_tokens=10, completion_tokens=5, total_tokens=15),
+                )
+        return results
+
+
+def _item(custom_id):
+    return BatchItem(custom_id=custom_id, messages=[{"role": "user", "content": "Follow up"}])
+
+
+def test_queue_submits_full_batches_and_collects_when_finished():
+    provider = FakeBatchProvider()
+    register_provider("fake-batch", lambda: provider)
+    queue = BatchQueue(step_name="Followup", provider="fake-batch", model="m", max_batch_size=2)
+
+    assert queue.enqueue(_item("a")) is None
+    job = queue.enqueue(_item("bad"))
+    assert job is not None and job.custom_ids == ["a", "bad"]
+    queue.enqueue(_item("c"))
+    queue.flush()
+    assert len(provider.batches) == 2
+
+    # Nothing finished yet
+    assert queue.poll() == []
+
+    provider.finished.add(job.batch_id)
+    results = {result.custom_id: result for result in queue.poll()}
+    assert results["a"].response.data == {"message_text": "hi a"}
+    assert "invalid request" in results["bad"].error
+    assert "c" not in results
+
+    # The finished job is not returned twice
+    assert queue.poll() == []
+
+
+class DownBatchProvider(FakeBatchProvider):
+    def submit_batch(self, requests):
+        raise ProviderUnavailableError("down")
+
+
+def test_failed_submit_keeps_the_items_queued():
+    register_provider("fake-batch", DownBatchProvider)
+    queue = BatchQueue(step_name="Followup", provider="fake-batch", model="m")
+    queue.enqueue(_item("a"))
+    queue.enqueue(_item("b"))
+    with pytest.raises(ProviderUnavailableError):
+        queue.flush()
+
+    register_provider("fake-batch", FakeBatchProvider)
+    assert queue.flush().custom_ids == ["a", "b"]
+
+
+def test_duplicate_custom_ids_are_rejected():
+    queue = BatchQueue(step_name="Followup", provider="fake-batch", model="m")
+    queue.enqueue(_item("a"))
+    with pytest.raises(ValueError):
+        queue.enqueue(_item("a"))
+    with pytest.raises(ValueError):
+        submit_batch([_item("a"), _item("a")], provider="fake-batch", model="m")
@@ -0,0 +1,47 @@
+import threading
+
+import pytest
+
+from llm.concurrency import ConcurrencyLimitError, ConcurrencyLimiter, get_provider_limiter, llm_slot
+from llm.config import llm_config
+
+
+def test_unlimited_limiter_always_acquires():
+    limiter = ConcurrencyLimiter("test", 0)
+    assert all(limiter.acquire(timeout=0) for _ in range(100))
+
+
+def test_limiter_blocks_beyond_limit():
+    limiter = ConcurrencyLimiter("test", 2)
+    assert limiter.acquire(timeout=0)
+    assert limiter.acquire(timeout=0)
+    assert not limiter.acquire(timeout=0.01)
+    limiter.release()
+    assert limiter.acquire(timeout=0)
+
+
+def test_slot_times_out_when_provider_is_saturated(monkeypatch):
+    monkeypatch.setenv("LLM_MAX_CONCURRENCY_SATURATED", "1")
+    monkeypatch.setattr(llm_config, "concurrency_wait_timeout", 0.05)
+    held = threading.Event()
+    release = threading.Event()
+
+    def hold_slot():
+        with llm_slot("saturated"):
+            held.set()
+            release.wait(1)
+
+    worker = threading.Thread(target=hold_slot)
+    worker.start()
+    held.wait(1)
+    try:
+        with pytest.raises(ConcurrencyLimitError):
+            with llm_slot("saturated"):
+                pass
+    finally:
+        release.set()
+        worker.join()
+
+    # Slot is released once the holder finishes
+    with llm_slot("saturated"):
+        assert get_provider_limiter("saturated").limit == 1
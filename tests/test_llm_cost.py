@@ -0,0 +1,45 @@
+import pytest
+
+from llm.cost import SpendRecorder, estimate_cost_usd, get_model_pricing, usd_to_inr, USD_TO_INR
+from llm.schemas import TokenUsage
+
+
+def test_prices_known_model_per_million_tokens():
+    usage = TokenUsage(prompt_tokens=1_000_000, completion_tokens=1_000_000, total_tokens=2_000_000)
+    assert estimate_cost_usd("gpt-4o-mini", usage) == pytest.approx(0.75)
+
+
+def test_dated_snapshot_resolves_to_longest_prefix():
+    assert get_model_pricing("gpt-4o-mini-2024-07-18") == get_model_pricing("gpt-4o-mini")
+    assert get_model_pricing("claude-3-5-haiku-20241022") is not None
+
+
+def test_unknown_model_is_free():
+    usage = TokenUsage(prompt_tokens=10, completion_tokens=10, total_tokens=20)
+    assert estimate_cost_usd("some-private-model", usage) == 0.0
+
+
+def test_usage_addition_sums_cost():
+    total = TokenUsage(total_tokens=1, cost_usd=0.25) + TokenUsage(total_tokens=2, cost_usd=0.5)
+    assert total.total_tokens == 3
+    assert total.cost_usd == pytest.approx(0.75)
+    assert usd_to_inr(total.cost_usd) == pytest.approx(0.75 * USD_TO_INR)
+
+
+def test_spend_recorder_is_pluggable():
+    class CollectingRecorder(SpendRecorder):
+        def __init__(self):
+            self.calls = []
+
+        def record(self, organization_id, usage_by_step, conversation_id=None):
+            self.calls.append((organization_id, usage_by_step))
+
+    recorder = CollectingRecorder()
+    recorder.record("org-1", {"brain": TokenUsage(cost_usd=0.1)})
+    assert recorder.calls[0][0] == "org-1"
+
+
+def test_cached_prompt_tokens_are_discounted():
+    full = TokenUsage(prompt_tokens=1_000_000, total_tokens=1_000_000)
+    cached = TokenUsage(prompt_tokens=1_000_000, cached_tokens=1_000_000, total_tokens=1_000_000)
+    assert estimate_cost_usd("gpt-4o", cached) < estimate_cost_usd("gpt-4o", full)
@@ -0,0 +1,80 @@
+import httpx
+import pytest
+
+from llm.errors import (
+    AuthError,
+    BadRequestError,
+    ContextTooLongError,
+    ProviderUnavailableError,
+    RateLimitedError,
+    error_from_status,
+    parse_retry_after,
+)
+from llm.providers import ChatRequest
+from llm.providers.anthropic import AnthropicProvider
+from llm.retry import RetryPolicy
+
+
+@pytest.mark.parametrize("status_code,message,expected", [
+    (429, "Rate limit reached", RateLimitedError),
+    (401, "Invalid API key", AuthError),
+    (403, "Forbidden", AuthError),
+    (400, "This model's maximum context length is 8192 tokens", ContextTooLongError),
+    (400, "prompt is too long: 210000 tokens > 200000 maximum", ContextTooLongError),
+    (400, "Unsupported parameter", BadRequestError),
+    (503, "Service unavailable", ProviderUnavailableError),
+])
+def test_error_from_status(status_code, message, expected):
+    error = error_from_status(status_code, message, "groq")
+    assert type(error) is expected
+    assert error.status_code == status_code
+    assert error.provider_message == message
+    assert error.provider == "groq"
+
+
+def test_retry_policy_uses_typed_status():
+    policy = RetryPolicy()
+    assert policy.is_retryable(error_from_status(429, "slow down"))
+    assert policy.is_retryable(ProviderUnavailableError("timed out"))
+    assert not policy.is_retryable(error_from_status(401, "bad key"))
+    assert not policy.is_retryable(error_from_status(400, "maximum context length exceeded"))
+
+
+def test_anthropic_http_error_is_typed():
+    def handler(request: httpx.Request) -> httpx.Response:
+        return httpx.Response(401, json={
+            "type": "error",
+            "error": {"type": "authentication_error", "message": "invalid x-api-key"},
+        })
+
+    provider = AnthropicProvider(api_key="bad")
+    provider.client = httpx.Client(base_url="https://api.anthropic.com", transport=httpx.MockTransport(handler))
+
+    with pytest.raises(AuthError) as exc_info:
+        provider.chat(ChatRequest(model="claude-test", messages=[{"role": "user", "content": "Hi"}]))
+    assert exc_info.value.provider_message == "invalid x-api-key"
+    assert "authentication_error" in exc_info.value.body
+
+
+def test_rate_limit_captures_retry_after():
+    def handler(request: httpx.Request) -> httpx.Response:
+        return httpx.Response(
+            429,
+            headers={"retry-after": "7"},
+            json={"error": {"type": "rate_limit_error", "message": "Too many requests"}},
+        )
+
+    provider = AnthropicProvider(api_key="key")
+    provider.client = httpx.Client(base_url="https://api.anthropic.com", transport=httpx.MockTransport(handler))
+
+    with pytest.raises(RateLimitedError) as exc_info:
+        provider.chat(ChatRequest(model="claude-test", messages=[{"role": "user", "content": "Hi"}]))
+    assert exc_info.value.retry_after == 7.0
+    assert exc_info.value.status_code == 429
+
+
+def test_parse_retry_after_variants():
+    assert parse_retry_after({"retry-after": "3"}) == 3.0
+    assert parse_retry_after({"retry-after-ms": "1500"}) == 1.5
+    assert parse_retry_after({"retry-after": "Wed, 21 Oct 2015 07:28:00 GMT"}) == 0.0
+    assert parse_retry_after({}) is None
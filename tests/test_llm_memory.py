@@ -0,0 +1,138 @@
+import pytest
+
+from llm.client import CannedLLMClient
+from llm.schemas import ClassifyOutput, LeadProfile, RiskFlags
+from llm.steps.memory import run_memory
+from server.enums import ConversationStage, DecisionAction, IntentLevel, UserSentiment
+
+
+@pytest.fixture
+def context(make_context):
+    return make_context(
+        rolling_summary="Lead wants a 2BHK.",
+        lead_profile=LeadProfile(product_interest="2BHK", objections=["Price"]),
+        conversation_stage=ConversationStage.QUALIFICATION,
+        intent_level=IntentLevel.MEDIUM,
+        user_sentiment=UserSentiment.NEUTRAL,
+    )
+
+
+@pytest.fixture
+def classification():
+    return ClassifyOutput(
+        thought_process="",
+        situation_summary="",
+        intent_level=IntentLevel.MEDIUM,
+        user_sentiment=UserSentiment.NEUTRAL,
+        risk_flags=RiskFlags(),
+        action=DecisionAction.SEND_NOW,
+        new_stage=ConversationStage.QUALIFICATION,
+        confidence=0.8,
+    )
+
+
+def test_short_summary_is_not_compacted(context, classification):
+    client = CannedLLMClient({"Memory": [{"updated_rolling_summary": "Lead wants a 2BHK in Pune."}]})
+    summary = run_memory(context, "In Pune", "Noted!", classification, client=client)
+
+    assert summary.updated_rolling_summary == "Lead wants a 2BHK in Pune."
+    assert client.steps_called() == ["Memory"]
+
+
+def test_long_summary_is_compacted_into_key_facts(monkeypatch, context, classification):
+    from llm.config import llm_config
+
+    monkeypatch.setattr(llm_config, "memory_summary_max_chars", 50)
+    client = CannedLLMClient({
+        "Memory": [{"updated_rolling_summary": "Lead wants a 2BHK in Pune. " * 10}],
+        "MemoryCompact": [{"key_facts": ["Wants 2BHK", "Location: Pune"], "summary": "Exploring options."}],
+    })
+    summary = run_memory(context, "In Pune", "Noted!", classification, client=client)
+
+    assert client.steps_called() == ["Memory", "MemoryCompact"]
+    assert summary.updated_rolling_summary == "KEY FACTS:\n- Wants 2BHK\n- Location: Pune\n\nSUMMARY:\nExploring options."
+
+
+def test_extracted_facts_are_merged_into_lead_profile(context, classification):
+    client = CannedLLMClient({"Memory": [{
+        "updated_rolling_summary": "Lead wants a 2BHK in Pune within 3 months.",
+        "lead_profile": {"location": "Pune", "timeline": "3 months", "budget": None, "objections": ["price", "Location"]},
+    }]})
+    summary = run_memory(context, "Pune, in 3 months", "Noted!", classification, client=client)
+
+    profile = summary.lead_profile
+    assert profile.product_interest == "2BHK"
+    assert profile.location == "Pune"
+    assert profile.timeline == "3 months"
+    assert profile.budget is None
+    assert profile.objections == ["Price", "Location"]
+
+
+def test_memory_failure_appends_fallback_line(context, classification):
+    from llm.errors import ProviderUnavailableError
+
+    client = CannedLLMClient({"Memory": [ProviderUnavailableError("down")]})
+    summary = run_memory(context, "Is parking included?", "Yes, one covered spot.", classification, client=client)
+
+    assert summary.updated_rolling_summary == (
+        "Lead wants a 2BHK.\n"
+        "[Lead said: Is parking included? / Bot replied (send_now): Yes, one covered spot.]"
+    )
+    assert summary.lead_profile == context.lead_profile
+
+
+def test_truncate_summary_drops_oldest_narrative_and_keeps_facts():
+    from llm.steps.memory import format_compacted_summary, truncate_summary
+
+    narrative = " ".join(f"Turn {i} happened." for i in range(50))
+    summary = format_compacted_summary(["Wants 2BHK", "Budget 80L"], narrative)
+    truncated = truncate_summary(summary, max_tokens=40)
+
+    assert truncated.startswith("KEY FACTS:\n- Wants 2BHK\n- Budget 80L")
+    assert "Turn 49 happened." in truncated
+    assert "Turn 0 happened." not in truncated
+    assert truncate_summary(truncated, max_tokens=40) == truncated
+
+
+def test_summary_revision_is_recorded_with_diff(context, classification):
+    from llm.memory_audit import MemoryAuditSink, get_memory_audit_sink, set_memory_audit_sink
+
+    class ListSink(MemoryAuditSink):
+        def __init__(self):
+            self.revisions = []
+
+        def record(self, revision):
+            self.revisions.append(revision)
+
+    sink = ListSink()
+    previous_sink = get_memory_audit_sink()
+    set_memory_audit_sink(sink)
+    try:
+        client = CannedLLMClient({"Memory": [{"updated_rolling_summary": "Lead wants a 3BHK."}]})
+        run_memory(context.model_copy(update={"conversation_id": "c1"}), "Actually 3BHK", "Sure!", classification, client=client)
+    finally:
+        set_memory_audit_sink(previous_sink)
+
+    revision = sink.revisions[0]
+    assert revision.conversation_id == "c1"
+    assert revision.trigger_message == "Actually 3BHK"
+    assert revision.source == "llm"
+    assert revision.diff == "-Lead wants a 2BHK.\n+Lead wants a 3BHK."
+
+
+def test_org_memory_settings_shape_prompt_and_custom_facts(context, classification):
+    org_context = context.model_copy(update={
+        "memory_prompt": "Track symptoms and appointment preferences.",
+        "memory_fact_fields": ["symptoms"],
+    })
+    client = CannedLLMClient({"Memory": [{
+        "updated_rolling_summary": "Lead has a knee injury.",
+        "lead_profile": {"custom": {"symptoms": "knee pain", "blood_group": "O+"}},
+    }]})
+    summary = run_memory(org_context, "My knee hurts", "Sorry to hear that!", classification, client=client)
+
+    system_prompt = client.calls[0][1][0]["content"]
+    assert "Track symptoms and appointment preferences." in system_prompt
+    assert "- symptoms" in system_prompt
+    # Only configured fields are kept
+    assert summary.lead_profile.custom == {"symptoms": "knee pain"}
@@ -0,0 +1,107 @@
+import pytest
+
+from llm.client import CannedLLMClient
+from llm.errors import ProviderUnavailableError
+from llm.memory_queue import InMemoryMemoryQueue, MemoryExchange, MemoryJob, MemoryWorker
+from llm.schemas import ClassifyOutput, RiskFlags
+from server.enums import ConversationStage, DecisionAction, IntentLevel, UserSentiment
+
+
+@pytest.fixture
+def context(make_context):
+    return make_context(
+        rolling_summary="Start.",
+        conversation_stage=ConversationStage.QUALIFICATION,
+        intent_level=IntentLevel.MEDIUM,
+        user_sentiment=UserSentiment.NEUTRAL,
+    )
+
+
+def _job(context, conversation_id, request_id, user_message):
+    classification = ClassifyOutput(
+        thought_process="",
+        situation_summary="",
+        intent_level=IntentLevel.MEDIUM,
+        user_sentiment=UserSentiment.NEUTRAL,
+        risk_flags=RiskFlags(),
+        action=DecisionAction.SEND_NOW,
+        new_stage=ConversationStage.QUALIFICATION,
+        confidence=0.8,
+    )
+    return MemoryJob(
+        conversation_id=conversation_id,
+        request_id=request_id,
+        context=context,
+        exchanges=[MemoryExchange(user_message=user_message, classification=classification)],
+    )
+
+
+def test_duplicate_request_ids_are_dropped(context):
+    queue = InMemoryMemoryQueue()
+    assert queue.enqueue(_job(context, "c1", "wamid.1", "Hi"))
+    assert not queue.enqueue(_job(context, "c1", "wamid.1", "Hi"))
+    assert len(queue) == 1
+
+
+def test_pending_exchanges_are_coalesced_and_folded_in_order(context):
+    queue = InMemoryMemoryQueue()
+    queue.enqueue(_job(context, "c1", "wamid.1", "Hi"))
+    queue.enqueue(_job(context, "c1", "wamid.2", "Price?"))
+    client = CannedLLMClient({"Memory": [
+        {"updated_rolling_summary": "Said hi."},
+        {"updated_rolling_summary": "Said hi, asked price."},
+    ]})
+    saved = []
+    worker = MemoryWorker(queue, handler=lambda job, summary: saved.append(summary.updated_rolling_summary), client=client)
+
+    assert worker.run_once(timeout=0)
+    assert not worker.run_once(timeout=0)
+    assert saved == ["Said hi, asked price."]
+    # The second exchange was summarized on top of the first one's result
+    assert "Said hi." in client.calls[1][1][1]["content"]
+
+
+def test_conversation_is_not_claimed_while_in_flight(context):
+    queue = InMemoryMemoryQueue()
+    queue.enqueue(_job(context, "c1", "wamid.1", "Hi"))
+    first = queue.claim(timeout=0)
+    queue.enqueue(_job(context, "c1", "wamid.2", "Price?"))
+
+    assert queue.claim(timeout=0) is None
+    queue.complete(first, summary=_summary("Said hi."))
+    second = queue.claim(timeout=0)
+    assert second.context.rolling_summary == "Said hi."
+
+
+def test_job_enqueued_with_a_stale_summary_is_rebased(context):
+    queue = InMemoryMemoryQueue()
+    queue.enqueue(_job(context, "c1", "wamid.1", "Hi"))
+    first = queue.claim(timeout=0)
+    queue.complete(first, summary=_summary("Said hi."))
+    # The next run loaded the conversation before the first update was saved
+    queue.enqueue(_job(context, "c1", "wamid.2", "Price?"))
+
+    assert queue.claim(timeout=0).context.rolling_summary == "Said hi."
+
+def test_failed_job_is_retried_then_dropped(context):
+    queue = InMemoryMemoryQueue()
+    queue.enqueue(_job(context, "c1", "wamid.1", "Hi"))
+    client = CannedLLMClient({"Memory": [ProviderUnavailableError("down"), ProviderUnavailableError("down")]})
+    saved = []
+    worker = MemoryWorker(queue, handler=lambda job, summary: saved.append(summary), client=client, max_attempts=2)
+
+    worker.run_once(timeout=0)
+    assert len(queue) == 1  # re-queued with backoff
+    assert saved == []
+    job = queue._pending["c1"]
+    job.not_before = 0
+    worker.run_once(timeout=0)
+    assert len(queue) == 0
+    # Out of attempts: the exchange is still recorded by the fallback summarizer
+    assert saved[0].updated_rolling_summary.endswith("[Lead said: Hi / Bot did not reply (send_now)]")
+
+
+def _summary(text):
+    from llm.schemas import SummaryOutput
+
+    return SummaryOutput(updated_rolling_summary=text)
@@ -0,0 +1,64 @@
+import urllib.request
+
+from llm.client import CannedLLMClient
+from llm.metrics import (
+    ENUM_CORRECTIONS, PIPELINE_RUNS, STEP_LATENCY, MetricsRegistry, start_metrics_server,
+)
+from llm.pipeline import run_pipeline
+from llm.utils import normalize_enum
+from server.enums import ConversationStage
+
+
+def test_registry_renders_prometheus_text():
+    registry = MetricsRegistry()
+    runs = registry.counter("runs_total", "Runs.", ["org"])
+    latency = registry.histogram("latency_seconds", "Latency.", buckets=[1, 5])
+    runs.inc(org="acme")
+    runs.inc(2, org="acme")
+    latency.observe(0.5)
+    latency.observe(3)
+
+    assert registry.render().splitlines() == [
+        "# HELP runs_total Runs.",
+        "# TYPE runs_total counter",
+        'runs_total{org="acme"} 3',
+        "# HELP latency_seconds Latency.",
+        "# TYPE latency_seconds histogram",
+        'latency_seconds_bucket{le="1"} 1',
+        'latency_seconds_bucket{le="5"} 2',
+        'latency_seconds_bucket{le="+Inf"} 2',
+        "latency_seconds_sum 3.5",
+        "latency_seconds_count 2",
+    ]
+
+
+def test_pipeline_run_is_counted_per_organization(make_context, brain_reply):
+    context = make_context(organization_id="org-metrics")
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Plans start at Rs 999. Want the details?"}],
+    })
+    brain_runs = STEP_LATENCY.count(step="brain")
+
+    run_pipeline(context, "How much?", client=client, memory_mode="worker")
+
+    assert PIPELINE_RUNS.value(organization_id="org-metrics", outcome="sent") == 1
+    assert STEP_LATENCY.count(step="brain") == brain_runs + 1
+
+
+def test_enum_corrections_are_counted():
+    corrections = ENUM_CORRECTIONS.value(enum="ConversationStage", kind="correction")
+
+    assert normalize_enum("pricng", ConversationStage) == ConversationStage.PRICING
+    assert ENUM_CORRECTIONS.value(enum="ConversationStage", kind="correction") == corrections + 1
+
+
+def test_metrics_endpoint():
+    server = start_metrics_server(port=0, host="127.0.0.1")
+    try:
+        with urllib.request.urlopen(f"http://127.0.0.1:{server.server_address[1]}/metrics") as response:
+            body = response.read().decode()
+    finally:
+        server.shutdown()
+
+    assert "# TYPE htl_pipeline_runs_total counter" in body
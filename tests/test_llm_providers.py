@@ -0,0 +1,324 @@
+import json
+
+import httpx
+import pytest
+
+from llm.errors import BadRequestError, ProviderUnavailableError
+from llm import providers
+from llm.providers import ChatRequest, Provider, function_tool, get_provider, register_provider, verify_configured_models
+from llm.providers.base import BATCH_COMPLETED, BATCH_FAILED, BATCH_PENDING
+from llm.providers.anthropic import AnthropicProvider
+from llm.providers.gemini import GeminiProvider
+
+
+def _mock_client(base_url, handler):
+    return httpx.Client(base_url=base_url, transport=httpx.MockTransport(handler))
+
+
+@pytest.fixture
+def request_with_system():
+    return ChatRequest(
+        model="test-model",
+        messages=[
+            {"role": "system", "content": "You are a bot."},
+            {"role": "user", "content": "Hi"},
+        ],
+        temperature=0.3,
+        response_format={"type": "json_object"},
+    )
+
+
+def test_anthropic_translates_request_and_response(request_with_system):
+    seen = {}
+
+    def handler(request: httpx.Request) -> httpx.Response:
+        seen["path"] = request.url.path
+        seen["body"] = json.loads(request.content)
+        return httpx.Response(200, json={
+            "model": "claude-test",
+            "content": [{"type": "text", "text": '{"ok": true}'}],
+            "usage": {"input_tokens": 12, "output_tokens": 4},
+            "stop_reason": "end_turn",
+        })
+
+    provider = AnthropicProvider(api_key="key")
+    provider.client = _mock_client("https://api.anthropic.com", handler)
+    response = provider.chat(request_with_system)
+
+    assert seen["path"] == "/v1/messages"
+    assert seen["body"]["system"] == "You are a bot."
+    assert seen["body"]["messages"] == [{"role": "user", "content": "Hi"}]
+    assert seen["body"]["max_tokens"] > 0
+    assert response.content == '{"ok": true}'
+    assert response.usage.total_tokens == 16
+    assert response.finish_reason == "end_turn"
+
+
+def test_gemini_translates_request_and_response(request_with_system):
+    seen = {}
+
+    def handler(request: httpx.Request) -> httpx.Response:
+        seen["path"] = request.url.path
+        seen["body"] = json.loads(request.content)
+        return httpx.Response(200, json={
+            "candidates": [{
+                "content": {"parts": [{"text": '{"ok": true}'}], "role": "model"},
+                "finishReason": "STOP",
+            }],
+            "usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 3, "totalTokenCount": 13},
+        })
+
+    provider = GeminiProvider(api_key="key")
+    provider.client = _mock_client("https://generativelanguage.googleapis.com/v1beta", handler)
+    response = provider.chat(request_with_system)
+
+    assert seen["path"].endswith("/models/test-model:generateContent")
+    assert seen["body"]["systemInstruction"]["parts"][0]["text"] == "You are a bot."
+    assert seen["body"]["contents"] == [{"role": "user", "parts": [{"text": "Hi"}]}]
+    assert seen["body"]["generationConfig"]["responseMimeType"] == "application/json"
+    assert response.content == '{"ok": true}'
+    assert response.usage.total_tokens == 13
+    assert response.finish_reason == "STOP"
+
+
+def test_unknown_provider_is_rejected():
+    with pytest.raises(ValueError):
+        get_provider("does-not-exist")
+
+
+def test_anthropic_stream_yields_deltas_and_usage(request_with_system):
+    sse = (
+        'event: message_start\n'
+        'data: {"type": "message_start", "message": {"model": "claude-test", "usage": {"input_tokens": 9}}}\n\n'
+        'event: content_block_delta\n'
+        'data: {"type": "content_block_delta", "delta": {"type": "text_delta", "text": "Hel"}}\n\n'
+        'event: content_block_delta\n'
+        'data: {"type": "content_block_delta", "delta": {"type": "text_delta", "text": "lo"}}\n\n'
+        'event: message_delta\n'
+        'data: {"type": "message_delta", "delta": {"stop_reason": "end_turn"}, "usage": {"output_tokens": 2}}\n\n'
+        'event: message_stop\n'
+        'data: {"type": "message_stop"}\n\n'
+    )
+
+    def handler(request: httpx.Request) -> httpx.Response:
+        assert json.loads(request.content)["stream"] is True
+        return httpx.Response(200, content=sse.encode(), headers={"content-type": "text/event-stream"})
+
+    provider = AnthropicProvider(api_key="key")
+    provider.client = _mock_client("https://api.anthropic.com", handler)
+    chunks = list(provider.stream(request_with_system))
+
+    assert "".join(chunk.delta for chunk in chunks) == "Hello"
+    assert chunks[-1].usage.total_tokens == 11
+    assert chunks[-1].finish_reason == "end_turn"
+
+
+def test_anthropic_tool_use_round_trip():
+    seen = {}
+
+    def handler(request: httpx.Request) -> httpx.Response:
+        seen["body"] = json.loads(request.content)
+        return httpx.Response(200, json={
+            "model": "claude-test",
+            "content": [{"type": "tool_use", "id": "toolu_1", "name": "lookup_price", "input": {"product": "basic"}}],
+            "usage": {"input_tokens": 5, "output_tokens": 5},
+            "stop_reason": "tool_use",
+        })
+
+    provider = AnthropicProvider(api_key="key")
+    provider.client = _mock_client("https://api.anthropic.com", handler)
+    tool = function_tool("lookup_price", "Price of a product", {"type": "object", "properties": {"product": {"type": "string"}}})
+    response = provider.chat(ChatRequest(
+        model="claude-test",
+        messages=[{"role": "user", "content": "How much is basic?"}],
+        tools=[tool],
+        tool_choice={"type": "function", "function": {"name": "lookup_price"}},
+    ))
+
+    assert seen["body"]["tools"][0]["name"] == "lookup_price"
+    assert seen["body"]["tools"][0]["input_schema"]["properties"]["product"]["type"] == "string"
+    assert seen["body"]["tool_choice"] == {"type": "tool", "name": "lookup_price"}
+    assert response.tool_calls[0].name == "lookup_price"
+    assert response.tool_calls[0].arguments == {"product": "basic"}
+
+
+def test_providers_share_injected_http_client(monkeypatch, request_with_system):
+    from llm.config import llm_config
+    from llm.http_client import get_http_client
+
+    seen = {}
+
+    def handler(request: httpx.Request) -> httpx.Response:
+        seen["url"] = str(request.url)
+        seen["api_key"] = request.headers.get("x-api-key")
+        return httpx.Response(200, json={
+            "model": "claude-test",
+            "content": [{"type": "text", "text": "{}"}],
+            "usage": {"input_tokens": 1, "output_tokens": 1},
+        })
+
+    injected = httpx.Client(transport=httpx.MockTransport(handler))
+    monkeypatch.setattr(llm_config, "http_client", injected)
+
+    provider = AnthropicProvider(api_key="key", base_url="https://proxy.internal/anthropic/")
+    provider.chat(request_with_system)
+
+    assert get_http_client() is injected
+    assert provider.client is injected
+    assert seen["url"] == "https://proxy.internal/anthropic/v1/messages"
+    assert seen["api_key"] == "key"
+
+
+def test_anthropic_batch_status_and_failed_results():
+    batches = {
+        "running": {"processing_status": "in_progress"},
+        "canceling": {"processing_status": "canceling"},
+        "expired": {"processing_status": "ended", "request_counts": {"succeeded": 0, "expired": 2}},
+        "done": {
+            "processing_status": "ended",
+            "request_counts": {"succeeded": 1, "errored": 1, "expired": 1},
+            "results_url": "https://api.anthropic.com/v1/messages/batches/done/results",
+        },
+    }
+    results = [
+        {"custom_id": "a", "result": {"type": "succeeded", "message": {
+            "model": "claude", "content": [{"type": "text", "text": "{}"}], "usage": {"input_tokens": 1, "output_tokens": 1},
+        }}},
+        {"custom_id": "b", "result": {"type": "errored", "error": {
+            "type": "error", "error": {"type": "invalid_request_error", "message": "bad schema"},
+        }}},
+        {"custom_id": "c", "result": {"type": "expired"}},
+    ]
+
+    def handler(request):
+        if request.url.path.endswith("/results"):
+            return httpx.Response(200, text="\n".join(json.dumps(item) for item in results))
+        return httpx.Response(200, json=batches[request.url.path.rsplit("/", 1)[-1]])
+
+    provider = AnthropicProvider(api_key="key", http_client=_mock_client("https://api.anthropic.com", handler))
+
+    assert provider.batch_status("running") == BATCH_PENDING
+    assert provider.batch_status("canceling") == BATCH_FAILED
+    assert provider.batch_status("expired") == BATCH_FAILED
+    assert provider.batch_status("done") == BATCH_COMPLETED
+    outcomes = provider.batch_results("done")
+    assert outcomes["a"].content == "{}"
+    assert isinstance(outcomes["b"], BadRequestError)
+    assert isinstance(outcomes["c"], ProviderUnavailableError)
+
+def test_anthropic_prompt_caching_marks_prefix_and_reads_cache_usage():
+    seen = {}
+
+    def handler(request: httpx.Request) -> httpx.Response:
+        seen["body"] = json.loads(request.content)
+        return httpx.Response(200, json={
+            "model": "claude-test",
+            "content": [{"type": "text", "text": "{}"}],
+            "usage": {"input_tokens": 20, "cache_read_input_tokens": 1500, "output_tokens": 5},
+        })
+
+    provider = AnthropicProvider(api_key="key", http_client=_mock_client("https://api.anthropic.com", handler))
+    response = provider.chat(ChatRequest(
+        model="claude-test",
+        messages=[
+            {"role": "system", "content": "You are a bot."},
+            {"role": "user", "content": "Hi"},
+            {"role": "assistant", "content": "Hello!"},
+            {"role": "user", "content": "Write the reply."},
+        ],
+        cache_prompt=True,
+    ))
+
+    assert seen["body"]["system"][0]["cache_control"] == {"type": "ephemeral"}
+    assert seen["body"]["messages"][1]["content"][0]["cache_control"] == {"type": "ephemeral"}
+    assert seen["body"]["messages"][2]["content"] == "Write the reply."
+    assert response.usage.prompt_tokens == 1520
+    assert response.usage.cached_tokens == 1500
+
+
+def test_anthropic_prefill_seeds_assistant_turn_and_is_rejoined():
+    seen = {}
+
+    def handler(request: httpx.Request) -> httpx.Response:
+        seen["body"] = json.loads(request.content)
+        return httpx.Response(200, json={
+            "model": "claude-test",
+            "content": [{"type": "text", "text": ' "Lead asked for price"}'}],
+            "usage": {"input_tokens": 20, "output_tokens": 5},
+        })
+
+    provider = AnthropicProvider(api_key="key", http_client=_mock_client("https://api.anthropic.com", handler))
+    response = provider.chat(ChatRequest(
+        model="claude-test",
+        messages=[{"role": "system", "content": "You are a bot."}, {"role": "user", "content": "Hi"}],
+        prefill='{"thought_process": ',
+    ))
+
+    assert seen["body"]["messages"][-1] == {"role": "assistant", "content": '{"thought_process":'}
+    assert json.loads(response.content) == {"thought_process": "Lead asked for price"}
+
+
+def test_ollama_translates_request_and_checks_models():
+    from llm.providers.ollama import ModelNotAvailableError, OllamaProvider
+
+    seen = {}
+
+    def handler(request: httpx.Request) -> httpx.Response:
+        if request.url.path == "/api/tags":
+            return httpx.Response(200, json={"models": [{"name": "llama3.1:8b"}, {"name": "qwen2.5:latest"}]})
+        seen["body"] = json.loads(request.content)
+        return httpx.Response(200, json={
+            "model": "llama3.1:8b",
+            "message": {"role": "assistant", "content": '{"ok": true}'},
+            "done": True,
+            "done_reason": "stop",
+            "prompt_eval_count": 30,
+            "eval_count": 6,
+        })
+
+    provider = OllamaProvider(http_client=_mock_client("http://localhost:11434", handler))
+    response = provider.chat(ChatRequest(
+        model="llama3.1:8b",
+        messages=[{"role": "user", "content": "Hi"}],
+        max_tokens=50,
+        response_format={"type": "json_object"},
+    ))
+
+    assert seen["body"]["format"] == "json"
+    assert seen["body"]["options"]["num_predict"] == 50
+    assert seen["body"]["stream"] is False
+    assert response.content == '{"ok": true}'
+    assert response.usage.total_tokens == 36
+
+    provider.ensure_model_available("llama3.1:8b")
+    provider.ensure_model_available("qwen2.5")
+    with pytest.raises(ModelNotAvailableError):
+        provider.ensure_model_available("mistral")
+
+
+def test_startup_check_covers_every_step_and_fallback(monkeypatch):
+    class LocalProvider(Provider):
+        name = "local-check"
+
+        def __init__(self):
+            self.checked = []
+
+        def chat(self, request):
+            raise NotImplementedError
+
+        def ensure_model_available(self, model):
+            self.checked.append(model)
+
+    local = LocalProvider()
+    register_provider("local-check", lambda: local)
+    monkeypatch.setattr(providers, "SELF_HOSTED_PROVIDERS", {"local-check"})
+    monkeypatch.setenv("LLM_PROVIDER_VERIFY", "local-check")
+    monkeypatch.setenv("LLM_MODEL_VERIFY", "verify-model")
+    monkeypatch.setenv("LLM_PROVIDER_MEMORYCOMPACT", "local-check")
+    monkeypatch.setenv("LLM_MODEL_MEMORYCOMPACT", "verify-model")
+    monkeypatch.setenv("LLM_FALLBACKS_MOUTH", "local-check:fallback-model")
+
+    verify_configured_models()
+
+    # Mouth's fallback, then Verify's model; MemoryCompact's (the same one) is checked once
+    assert local.checked == ["fallback-model", "verify-model"]
@@ -0,0 +1,90 @@
+from llm.api_helpers import make_api_call
+from llm.providers import ChatRequest, ChatResponse, Provider, register_provider
+from llm.response_cache import InMemoryResponseCache, prompt_cache_key, set_response_cache
+from llm.retry import RetryPolicy
+from llm.schemas import TokenUsage
+
+
+class CountingProvider(Provider):
+    name = "cache-counting"
+
+    def __init__(self):
+        self.calls = 0
+
+    def chat(self, request: ChatRequest) -> ChatResponse:
+        self.calls += 1
+        return ChatResponse(content='{"answer": 42}', usage=TokenUsage(prompt_tokens=10, completion_tokens=5, total_tokens=15))
+
+
+class FailingProvider(Provider):
+    name = "cache-failing"
+
+    def chat(self, request: ChatRequest) -> ChatResponse:
+        raise RuntimeError("primary down")
+
+
+class FakeClock:
+    def __init__(self):
+        self.now = 0.0
+
+    def __call__(self):
+        return self.now
+
+
+def test_cache_key_ignores_whitespace_case_and_timestamps():
+    a = [{"role": "user", "content": "What are your  prices?\nNow: 2025-01-01T10:00:00Z"}]
+    b = [{"role": "user", "content": "what are your prices? now: 2025-06-30T18:45:12+05:30"}]
+    assert prompt_cache_key(a, "groq", "m", 0.2) == prompt_cache_key(b, "groq", "m", 0.2)
+    assert prompt_cache_key(a, "groq", "m", 0.2) != prompt_cache_key(a, "groq", "m", 0.7)
+    assert prompt_cache_key(a, "groq", "m", 0.2, scope="org-1") != prompt_cache_key(a, "groq", "m", 0.2, scope="org-2")
+
+
+def test_in_memory_cache_expires_entries():
+    clock = FakeClock()
+    cache = InMemoryResponseCache(clock=clock)
+    cache.set("k", {"data": {}}, ttl_seconds=60)
+    assert cache.get("k") == {"data": {}}
+    clock.now = 61
+    assert cache.get("k") is None
+
+
+def test_make_api_call_reuses_cached_response(monkeypatch):
+    from llm.config import llm_config
+
+    monkeypatch.setattr(llm_config, "response_cache_backend", "memory")
+    provider = CountingProvider()
+    register_provider("cache-counting", lambda: provider)
+    set_response_cache(InMemoryResponseCache())
+    try:
+        kwargs = dict(provider="cache-counting", model="m", fallbacks=[], retry_policy=RetryPolicy(max_attempts=1), cache=True)
+        first = make_api_call([{"role": "user", "content": "Hi"}], **kwargs)
+        second = make_api_call([{"role": "user", "content": "  hi "}], **kwargs)
+    finally:
+        set_response_cache(None)
+
+    assert provider.calls == 1
+    assert not first.cached and second.cached
+    assert second.data == {"answer": 42}
+    assert second.usage.total_tokens == 0
+
+
+def test_fallback_responses_are_not_cached(monkeypatch):
+    from llm.config import llm_config
+
+    monkeypatch.setattr(llm_config, "response_cache_backend", "memory")
+    provider = CountingProvider()
+    register_provider("cache-counting", lambda: provider)
+    register_provider("cache-failing", lambda: FailingProvider())
+    set_response_cache(InMemoryResponseCache())
+    try:
+        kwargs = dict(
+            provider="cache-failing", model="m", fallbacks=[("cache-counting", "m")],
+            retry_policy=RetryPolicy(max_attempts=1), cache=True,
+        )
+        first = make_api_call([{"role": "user", "content": "Hi"}], **kwargs)
+        second = make_api_call([{"role": "user", "content": "Hi"}], **kwargs)
+    finally:
+        set_response_cache(None)
+
+    assert provider.calls == 2
+    assert not first.cached and not second.cached
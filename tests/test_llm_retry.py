@@ -0,0 +1,79 @@
+import httpx
+import openai
+import pytest
+
+from llm.retry import RetryPolicy, call_with_retry
+
+
+def _status_error(status_code: int) -> openai.APIStatusError:
+    request = httpx.Request("POST", "https://api.test/v1/chat/completions")
+    response = httpx.Response(status_code, request=request)
+    return openai.APIStatusError("error", response=response, body=None)
+
+
+@pytest.fixture
+def policy():
+    return RetryPolicy(max_attempts=3, base_delay=0.1, max_delay=1.0)
+
+
+def test_backoff_delay_is_capped(policy):
+    for attempt in range(10):
+        delay = policy.backoff_delay(attempt)
+        assert 0 <= delay <= min(policy.max_delay, policy.base_delay * (2 ** attempt))
+
+
+def test_retries_transient_status_then_succeeds(policy):
+    calls = []
+    sleeps = []
+
+    def fn():
+        calls.append(1)
+        if len(calls) < 3:
+            raise _status_error(429)
+        return "ok"
+
+    assert call_with_retry(fn, policy, sleep=sleeps.append) == "ok"
+    assert len(calls) == 3
+    assert len(sleeps) == 2
+
+
+def test_does_not_retry_non_retryable_status(policy):
+    calls = []
+
+    def fn():
+        calls.append(1)
+        raise _status_error(401)
+
+    with pytest.raises(openai.APIStatusError):
+        call_with_retry(fn, policy, sleep=lambda _: None)
+    assert len(calls) == 1
+
+
+def test_gives_up_after_max_attempts(policy):
+    calls = []
+
+    def fn():
+        calls.append(1)
+        raise openai.APITimeoutError(request=httpx.Request("POST", "https://api.test"))
+
+    with pytest.raises(openai.APITimeoutError):
+        call_with_retry(fn, policy, sleep=lambda _: None)
+    assert len(calls) == policy.max_attempts
+
+
+def test_does_not_sleep_past_run_budget():
+    from llm.errors import RateLimitedError
+    from llm.run_context import RunContext
+
+    calls = []
+    sleeps = []
+
+    def fn():
+        calls.append(1)
+        raise RateLimitedError("slow down", status_code=429, retry_after=5)
+
+    policy = RetryPolicy(max_attempts=3, base_delay=0.1, max_delay=1.0)
+    with pytest.raises(RateLimitedError):
+        call_with_retry(fn, policy, sleep=sleeps.append, ctx=RunContext(timeout=2))
+    assert len(calls) == 1
+    assert sleeps == []
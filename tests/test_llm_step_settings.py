@@ -0,0 +1,38 @@
+import json
+
+from llm.client import CannedLLMClient
+from llm.config import LLMConfig, llm_config
+from llm.steps.brain import run_brain
+from server.enums import ConversationStage
+
+
+def test_defaults_per_step(monkeypatch):
+    monkeypatch.delenv("LLM_STEP_SETTINGS_FILE", raising=False)
+    config = LLMConfig()
+
+    assert config.sampling_for("Brain") == {"temperature": 0.3, "max_tokens": None}
+    assert config.sampling_for("Memory") == {"temperature": 0.7, "max_tokens": 1000}
+    assert config.sampling_for("Unknown") == {"temperature": 0.7, "max_tokens": None}
+
+
+def test_env_wins_over_file(monkeypatch, tmp_path):
+    settings = tmp_path / "steps.json"
+    settings.write_text(json.dumps({"mouth": {"temperature": 0.4, "max_tokens": 300}, "Memory": {"max_tokens": 0}}))
+    monkeypatch.setenv("LLM_STEP_SETTINGS_FILE", str(settings))
+    monkeypatch.setenv("LLM_TEMPERATURE_MOUTH", "0.2")
+    config = LLMConfig()
+
+    assert config.sampling_for("Mouth") == {"temperature": 0.2, "max_tokens": 300}
+    assert config.sampling_for("Memory") == {"temperature": 0.7, "max_tokens": None}
+
+
+def test_brain_call_uses_configured_sampling(monkeypatch, make_context):
+    monkeypatch.setenv("LLM_TEMPERATURE_BRAIN", "0.1")
+    monkeypatch.setenv("LLM_MAX_TOKENS_BRAIN", "600")
+    client = CannedLLMClient({"Brain": [{"action": "send_now", "new_stage": "greeting", "should_respond": True, "confidence": 0.9}]})
+    run_brain(make_context(conversation_stage=ConversationStage.GREETING), client=client)
+
+    _, _, kwargs = client.calls[0]
+    assert kwargs["temperature"] == 0.1
+    assert kwargs["max_tokens"] == 600
+    assert llm_config.temperature_for("Brain") == 0.1
@@ -0,0 +1,50 @@
+from llm.client import CannedLLMClient
+from llm.message_constraints import count_questions, enforce_constraints, find_violations
+from llm.pipeline import run_pipeline
+
+TWO_QUESTIONS = "Our plans start at Rs 9.99 a day. Would you like a demo? Or should I send the brochure?? Thanks."
+
+
+def test_counts_and_violations():
+    assert count_questions(TWO_QUESTIONS) == 2
+    assert find_violations(TWO_QUESTIONS, max_words=80, max_questions=1) == [
+        "questions_per_message: 2 questions, limit is 1"
+    ]
+    assert find_violations("Sure, noted.", max_words=80, max_questions=1) == []
+
+
+def test_enforce_drops_extra_questions_and_trailing_sentences():
+    assert enforce_constraints(TWO_QUESTIONS, max_words=80, max_questions=1) == (
+        "Our plans start at Rs 9.99 a day. Would you like a demo? Thanks."
+    )
+    assert enforce_constraints(TWO_QUESTIONS, max_words=10, max_questions=1) == "Our plans start at Rs 9.99 a day."
+
+
+def test_enforce_cuts_a_single_long_sentence():
+    assert enforce_constraints("one two three four five six", max_words=3, max_questions=1) == "one two three..."
+
+
+def test_mouth_re_asks_then_accepts_corrected_reply(make_context, brain_reply):
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": TWO_QUESTIONS}, {"message_text": "Plans start at Rs 999. Want a demo?"}],
+    })
+    result = run_pipeline(make_context(), "How much?", client=client)
+
+    assert client.steps_called() == ["Brain", "Mouth", "Mouth"]
+    assert "questions_per_message" in client.calls[-1][1][-1]["content"]
+    assert client.calls[-1][2]["idempotency_suffix"] == "constraints1"
+    assert result.response.message_text == "Plans start at Rs 999. Want a demo?"
+    assert result.response.self_check_passed
+
+
+def test_mouth_truncates_when_re_ask_still_violates(make_context, brain_reply):
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": TWO_QUESTIONS}, {"message_text": TWO_QUESTIONS}],
+    })
+    result = run_pipeline(make_context(), "How much?", client=client)
+
+    assert count_questions(result.response.message_text) == 1
+    assert not result.response.self_check_passed
+    assert result.response.violations
@@ -0,0 +1,50 @@
+from llm.client import CannedLLMClient
+from llm.formatting import apply_style, count_emoji, strip_markup
+from llm.pipeline import run_pipeline
+from llm.prompts_registry import get_mouth_system_prompt
+from llm.schemas import PromptOverrides
+from server.enums import ConversationStage
+
+
+def test_emoji_styles():
+    text = "Great choice 🎉 Our plan is Rs 999 👍🏽 per month 🙂"
+
+    assert apply_style(text, "none", None) == "Great choice Our plan is Rs 999 per month"
+    assert apply_style(text, "light", None) == "Great choice 🎉 Our plan is Rs 999 per month"
+    assert apply_style(text, "heavy", None) == text
+    assert count_emoji("🇮🇳 👨‍👩‍👧 ❤️") == 3
+
+
+def test_markup_is_stripped_without_touching_urls_or_math():
+    text = "Our *Pro* plan is _really_ popular. See https://acme.example/pro_plan or pay 2*499."
+
+    assert strip_markup(text) == "Our Pro plan is really popular. See https://acme.example/pro_plan or pay 2*499."
+
+
+def test_markdown_is_normalized_to_whatsapp_markup():
+    assert apply_style("## Plans\nThe **Pro** plan", None, True) == "*Plans*\nThe *Pro* plan"
+    assert apply_style("The **Pro** plan", None, False) == "The Pro plan"
+
+
+def test_style_rules_added_to_prompt():
+    overrides = PromptOverrides(emoji_style="none", whatsapp_formatting=False)
+    prompt = get_mouth_system_prompt(ConversationStage.PRICING, business_name="Acme", overrides=overrides)
+
+    assert "- Do not use any emoji." in prompt
+    assert "- Plain text only" in prompt
+    assert "Do not use any emoji" not in get_mouth_system_prompt(ConversationStage.PRICING, business_name="Acme")
+
+
+def test_formal_org_reply_is_cleaned_before_sending(make_context, brain_reply):
+    context = make_context(
+        business_name="Acme Legal",
+        prompt_overrides=PromptOverrides(emoji_style="none", whatsapp_formatting=False),
+    )
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Consultations are *Rs 2,000* 😊 Shall I book one?"}],
+    })
+
+    result = run_pipeline(context, "What do you charge?", client=client, memory_mode="worker")
+
+    assert result.response.message_text == "Consultations are Rs 2,000 Shall I book one?"
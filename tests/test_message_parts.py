@@ -0,0 +1,55 @@
+from llm.client import CannedLLMClient
+from llm.config import llm_config
+from llm.message_parts import split_message, split_reply
+from llm.pipeline import run_pipeline
+
+LONG_REPLY = (
+    "Thanks for asking! Our Basic plan is Rs 999 a month and covers one WhatsApp number with the "
+    "bot replying around the clock. The Pro plan at Rs 1,499 adds follow-ups, CTAs and analytics "
+    "for your whole team. Which one sounds closer to what you need?"
+)
+
+
+def test_short_reply_stays_one_bubble():
+    assert split_message("Sure, Rs 999 a month. Want it?", max_parts=3, min_chars=160) == [
+        "Sure, Rs 999 a month. Want it?"
+    ]
+
+
+def test_long_reply_splits_on_sentences_into_at_most_three_bubbles():
+    parts = split_message(LONG_REPLY, max_parts=3, min_chars=160)
+
+    assert len(parts) == 3
+    assert " ".join(parts) == LONG_REPLY
+    assert parts[-1] == "Which one sounds closer to what you need?"
+
+
+def test_paragraphs_are_kept_and_lists_not_broken():
+    text = "Here are our plans:\n- Basic: Rs 999\n- Pro: Rs 1,499\n\nBoth include setup. Want a demo this week?"
+
+    assert split_message(text, max_parts=3, min_chars=20) == [
+        "Here are our plans:\n- Basic: Rs 999\n- Pro: Rs 1,499",
+        "Both include setup. Want a demo this week?",
+    ]
+    assert split_message("Plans:\n- Basic: Rs 999\n- Pro: Rs 1,499", max_parts=3, min_chars=10) == [
+        "Plans:\n- Basic: Rs 999\n- Pro: Rs 1,499"
+    ]
+
+
+def test_delays_follow_bubble_length():
+    parts, delays_ms = split_reply(LONG_REPLY)
+
+    assert len(delays_ms) == len(parts)
+    assert delays_ms[0] == 0
+    assert all(800 <= delay <= 3000 for delay in delays_ms[1:])
+
+
+def test_pipeline_returns_parts_with_full_text_kept(monkeypatch, make_context, brain_reply):
+    monkeypatch.setattr(llm_config, "split_messages", True)
+    client = CannedLLMClient({"Brain": [brain_reply], "Mouth": [{"message_text": LONG_REPLY}]})
+
+    result = run_pipeline(make_context(), "What are your plans?", client=client, memory_mode="worker")
+
+    assert result.response.message_text == LONG_REPLY
+    assert len(result.response.message_parts) == 3
+    assert result.response.message_part_delays_ms[0] == 0
@@ -0,0 +1,53 @@
+import pytest
+
+from llm.schemas import MessageContext, ClassifyOutput, RiskFlags
+from llm.steps.mouth import _build_chat_messages
+from server.enums import ConversationStage, DecisionAction, IntentLevel, UserSentiment
+
+
+@pytest.fixture
+def context(make_context):
+    return make_context(
+        conversation_stage=ConversationStage.QUALIFICATION,
+        intent_level=IntentLevel.MEDIUM,
+        user_sentiment=UserSentiment.NEUTRAL,
+        last_messages=[
+            MessageContext(sender="lead", text="Hi", timestamp="..."),
+            MessageContext(sender="bot", text="Hello! How can I help?", timestamp="..."),
+            MessageContext(sender="human", text="This is Priya from sales.", timestamp="..."),
+            MessageContext(sender="lead", text="What does it cost?", timestamp="..."),
+        ],
+    )
+
+
+@pytest.fixture
+def classification():
+    return ClassifyOutput(
+        thought_process="Lead asks for pricing",
+        situation_summary="Pricing question",
+        intent_level=IntentLevel.MEDIUM,
+        user_sentiment=UserSentiment.NEUTRAL,
+        risk_flags=RiskFlags(),
+        action=DecisionAction.SEND_NOW,
+        new_stage=ConversationStage.QUALIFICATION,
+        should_respond=True,
+        confidence=0.9,
+    )
+
+
+def test_history_is_sent_as_alternating_turns(context, classification):
+    messages = _build_chat_messages(context, classification, "SYSTEM")
+
+    assert messages[0] == {"role": "system", "content": "SYSTEM"}
+    assert [m["role"] for m in messages[1:]] == ["user", "assistant", "user"]
+    assert messages[1]["content"] == "Hi"
+    # Bot and human-agent replies merge into one assistant turn
+    assert messages[2]["content"] == "Hello! How can I help?\n\nThis is Priya from sales."
+    # The latest lead message is followed by the task and Brain decision
+    assert messages[3]["content"].startswith("What does it cost?")
+    assert "=== BRAIN DECISION ===" in messages[3]["content"]
+
+
+def test_history_is_not_repeated_in_instruction(context, classification):
+    messages = _build_chat_messages(context, classification, "SYSTEM")
+    assert "Hello! How can I help?" not in messages[-1]["content"]
@@ -0,0 +1,73 @@
+import pytest
+
+from llm.client import CannedLLMClient
+from llm.guardrails import find_claim_hits
+from llm.pipeline import run_pipeline
+
+CLAIMS = ["lowest price", "guaranteed cure", r"re:\d+\s*% off"]
+
+
+@pytest.fixture
+def context(make_context):
+    return make_context(business_name="Acme Clinic", forbidden_claims=CLAIMS)
+
+
+def test_claims_are_matched_as_phrases_and_patterns():
+    hits = find_claim_hits("We have the LOWEST  price in town, and 20 % off today!", CLAIMS)
+    assert hits == [("lowest price", "LOWEST  price"), (r"re:\d+\s*% off", "20 % off")]
+    assert find_claim_hits("Our prices are the lowest-priced... no, fair", CLAIMS) == []
+    assert find_claim_hits("anything", ["re:(unclosed"]) == []
+
+
+def test_regenerated_reply_is_sent_and_hit_recorded(context, brain_reply):
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [
+            {"message_text": "Book today for 30% off!"},
+            {"message_text": "Our plans start at Rs 999 - want the details?"},
+        ],
+    })
+    result = run_pipeline(context, "Any discount?", client=client, memory_mode="worker")
+
+    assert client.steps_called() == ["Brain", "Mouth", "Mouth"]
+    assert "30% off" in client.calls[2][1][-1]["content"]
+    assert client.calls[2][2]["idempotency_suffix"] == "guardrails1"
+    assert result.response.message_text.startswith("Our plans")
+    assert result.response.guardrail_hits == [r"re:\d+\s*% off"]
+    assert not result.should_escalate
+
+
+def test_reply_still_violating_is_withheld_and_escalated(context, brain_reply):
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [
+            {"message_text": "Guaranteed cure in 3 sessions!"},
+            {"message_text": "It's a guaranteed  cure, trust us."},
+        ],
+    })
+    result = run_pipeline(context, "Will it work?", client=client, memory_mode="worker")
+
+    assert result.response.message_text == ""
+    assert result.response.violations == ["forbidden_claim: guaranteed cure"]
+    assert not result.should_send_message
+    assert result.should_escalate
+
+
+def test_regenerated_reply_is_checked_again_on_the_updated_transcript(context, brain_reply):
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [
+            {"message_text": "Book today for 30% off!"},
+            {"message_text": "Plans start at Rs 999. Want the details? Shall I book a demo?"},
+            {"message_text": "Plans start at Rs 999. Want the details?"},
+        ],
+    })
+    result = run_pipeline(context, "Any discount?", client=client, memory_mode="worker")
+
+    assert client.steps_called() == ["Brain", "Mouth", "Mouth", "Mouth"]
+    constraint_reask = client.calls[3][1]
+    assert "questions_per_message" in constraint_reask[-1]["content"]
+    # Builds on the guardrail re-ask, not on the original prompt
+    assert "30% off" in constraint_reask[-3]["content"]
+    assert result.response.message_text == "Plans start at Rs 999. Want the details?"
+    assert result.response.self_check_passed
@@ -0,0 +1,42 @@
+import pytest
+
+from llm.steps.mouth import _parse_interactive
+from server.enums import ConversationStage
+
+CTA_ID = "7f0c1b6e-3a0e-4c57-9d7a-2b3f4c5d6e7f"
+
+
+@pytest.fixture
+def context(make_context):
+    return make_context(available_ctas=[{"id": CTA_ID, "name": "Book a demo"}])
+
+
+def test_buttons_are_parsed_and_linked(context):
+    interactive = _parse_interactive({
+        "type": "buttons",
+        "options": [
+            {"id": "demo", "title": "Book a demo", "cta_id": CTA_ID, "stage": "cta"},
+            {"id": "price", "title": "Send me the price list please", "cta_id": "not-a-cta", "stage": None},
+        ],
+    }, context)
+
+    assert interactive.type == "buttons"
+    assert str(interactive.options[0].cta_id) == CTA_ID
+    assert interactive.options[0].stage == ConversationStage.CTA
+    assert interactive.options[1].cta_id is None
+    assert len(interactive.options[1].title) == 20
+
+
+def test_more_than_three_buttons_become_a_list(context):
+    interactive = _parse_interactive({
+        "type": "buttons",
+        "options": [{"id": f"plan_{n}", "title": f"Plan {n}"} for n in range(12)],
+    }, context)
+
+    assert interactive.type == "list"
+    assert len(interactive.options) == 10
+
+
+def test_unusable_interactive_is_dropped(context):
+    assert _parse_interactive(None, context) is None
+    assert _parse_interactive({"type": "buttons", "options": [{"id": "x", "title": "  "}]}, context) is None
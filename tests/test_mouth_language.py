@@ -0,0 +1,90 @@
+import pytest
+
+from llm.client import CannedLLMClient
+from llm.language import detect_script, infer_language, language_mismatch
+from llm.schemas import ClassifyOutput, MessageContext, RiskFlags
+from llm.steps.mouth import run_mouth
+from server.enums import ConversationStage, DecisionAction, IntentLevel, UserSentiment
+
+HINDI_QUESTION = "इसकी कीमत क्या है?"
+HINDI_REPLY = "हमारा प्लान ₹999 से शुरू होता है। क्या मैं डिटेल्स भेजूँ?"
+
+
+@pytest.fixture
+def context(make_context):
+    return make_context(
+        last_messages=[MessageContext(sender="lead", text=HINDI_QUESTION, timestamp="2024-01-01T11:59:00")],
+        language_pref="hi",
+    )
+
+
+def _classification():
+    return ClassifyOutput(
+        thought_process="Lead asked for the price",
+        situation_summary="Pricing question",
+        intent_level=IntentLevel.HIGH,
+        user_sentiment=UserSentiment.CURIOUS,
+        risk_flags=RiskFlags(),
+        action=DecisionAction.SEND_NOW,
+        new_stage=ConversationStage.PRICING,
+        should_respond=True,
+        confidence=0.9,
+    )
+
+
+def test_script_detection():
+    assert detect_script(HINDI_REPLY) == "devanagari"
+    assert detect_script("Plans start at Rs 999") == "latin"
+    assert detect_script("👍 999") is None
+    assert infer_language(["Hello", HINDI_QUESTION]) == "hi"
+    assert infer_language(["नमस्ते", "ok 👍"]) == "en"
+    assert infer_language(["👍"]) == "en"
+
+
+def test_romanized_reply_passes_only_when_declared():
+    assert language_mismatch("Haan ji, plan 999 se shuru hota hai", "hi", "hi") is None
+    assert language_mismatch("Yes, plans start at 999", "en", "hi") is not None
+    assert language_mismatch(HINDI_REPLY, "hi", "en") is not None
+    assert language_mismatch("Yes!", "en", "xx") is None
+
+
+def test_english_reply_to_hindi_lead_is_regenerated(context):
+    client = CannedLLMClient({"Mouth": [
+        {"message_text": "Our plans start at Rs 999. Shall I send details?", "message_language": "en"},
+        {"message_text": HINDI_REPLY, "message_language": "hi"},
+    ]})
+
+    output, _, _ = run_mouth(context, _classification(), client=client)
+
+    assert client.steps_called() == ["Mouth", "Mouth"]
+    assert "Hindi" in client.calls[1][1][-1]["content"]
+    assert client.calls[1][2]["idempotency_suffix"] == "language1"
+    assert output.message_text == HINDI_REPLY
+    assert output.self_check_passed
+
+
+def test_persistent_mismatch_is_sent_with_violation(context):
+    english = {"message_text": "Our plans start at Rs 999.", "message_language": "en"}
+    client = CannedLLMClient({"Mouth": [english, english]})
+
+    output, _, _ = run_mouth(context, _classification(), client=client)
+
+    assert output.message_text == english["message_text"]
+    assert not output.self_check_passed
+    assert output.violations[0].startswith("language:")
+
+
+def test_regenerated_reply_is_checked_against_the_limits_too(context):
+    two_questions = "हमारा प्लान ₹999 से शुरू होता है। डिटेल्स भेजूँ? डेमो बुक करूँ?"
+    client = CannedLLMClient({"Mouth": [
+        {"message_text": "Our plans start at Rs 999. Shall I send details?", "message_language": "en"},
+        {"message_text": two_questions, "message_language": "hi"},
+        {"message_text": HINDI_REPLY, "message_language": "hi"},
+    ]})
+
+    output, _, _ = run_mouth(context, _classification(), client=client)
+
+    assert client.steps_called() == ["Mouth", "Mouth", "Mouth"]
+    assert "questions_per_message" in client.calls[2][1][-1]["content"]
+    assert output.message_text == HINDI_REPLY
+    assert output.self_check_passed
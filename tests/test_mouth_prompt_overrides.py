@@ -0,0 +1,88 @@
+from llm.prompts import MOUTH_DEFAULT_TONE, MOUTH_DEFAULT_LANGUAGE_STYLE
+from llm.prompts_registry import get_mouth_system_prompt, select_examples
+from llm.schemas import ExampleTurn, PromptExample, PromptOverrides
+from server.enums import ConversationStage
+
+
+def test_defaults_without_overrides():
+    prompt = get_mouth_system_prompt(ConversationStage.GREETING, business_name="Acme")
+
+    assert "You are Acme's Top Sales and Customer Support Representative." in prompt
+    assert MOUTH_DEFAULT_TONE in prompt
+    assert "NEVER discuss these topics" not in prompt
+
+
+def test_overrides_replace_only_their_sections():
+    overrides = PromptOverrides(
+        persona="You are Riya, the friendly front-desk assistant of Acme Dental.",
+        tone="Warm and reassuring, never pushy.",
+        forbidden_topics=["medical diagnosis", " ", "competitor pricing"],
+    )
+    prompt = get_mouth_system_prompt(ConversationStage.PRICING, business_name="Acme", overrides=overrides)
+
+    assert prompt.lstrip().startswith("You are Riya")
+    assert "Top Sales and Customer Support Representative" not in prompt
+    assert "Warm and reassuring, never pushy." in prompt
+    assert MOUTH_DEFAULT_TONE not in prompt
+    assert MOUTH_DEFAULT_LANGUAGE_STYLE in prompt
+    assert "  - medical diagnosis\n  - competitor pricing" in prompt
+
+
+def test_blank_override_keeps_default():
+    prompt = get_mouth_system_prompt(
+        ConversationStage.GREETING, business_name="Acme", overrides=PromptOverrides(tone="  ")
+    )
+
+    assert MOUTH_DEFAULT_TONE in prompt
+
+
+def _example(title, stage=None):
+    return PromptExample(
+        title=title,
+        stage=stage,
+        turns=[ExampleTurn(sender="lead", text="How much?"), ExampleTurn(sender="bot", text="Plans start at Rs 999.")],
+    )
+
+
+def test_examples_for_current_stage_come_first():
+    examples = [
+        _example("General"),
+        _example("Good CTA push", ConversationStage.CTA),
+        _example("Good pricing answer", ConversationStage.PRICING),
+    ]
+
+    selected = select_examples(examples, ConversationStage.PRICING, limit=2)
+
+    assert [example.title for example in selected] == ["Good pricing answer", "General"]
+
+
+def test_examples_rendered_into_prompt():
+    prompt = get_mouth_system_prompt(
+        ConversationStage.PRICING, business_name="Acme", examples=[_example("Good pricing answer")]
+    )
+
+    assert "=== EXAMPLE CONVERSATIONS ===" in prompt
+    assert "--- Example 1: Good pricing answer ---\nLead: How much?\nYou: Plans start at Rs 999." in prompt
+
+
+def test_no_examples_section_without_examples():
+    prompt = get_mouth_system_prompt(ConversationStage.PRICING, business_name="Acme")
+
+    assert "EXAMPLE CONVERSATIONS" not in prompt
+
+
+def test_org_stage_rules_replace_only_that_stage():
+    overrides = PromptOverrides(stage_rules={ConversationStage.PRICING: "Quote the Starter plan first."})
+
+    pricing = get_mouth_system_prompt(ConversationStage.PRICING, business_name="Acme", overrides=overrides)
+    assert "=== CURRENT STAGE: PRICING ===\nQuote the Starter plan first." in pricing
+    assert "Do not be defensive about price." not in pricing
+
+    cta = get_mouth_system_prompt(ConversationStage.CTA, business_name="Acme", overrides=overrides)
+    assert "Quote the Starter plan first." not in cta
+    assert "=== CURRENT STAGE: CALL TO ACTION (CTA) ===" in cta
+
+
+def test_quick_replies_only_in_answerable_stages():
+    assert "=== QUICK REPLIES ===" in get_mouth_system_prompt(ConversationStage.PRICING, business_name="Acme")
+    assert "=== QUICK REPLIES ===" not in get_mouth_system_prompt(ConversationStage.LOST, business_name="Acme")
@@ -0,0 +1,82 @@
+import pytest
+
+from llm.client import CannedLLMClient
+from llm.schemas import ClassifyOutput, RiskFlags, TemplateOption, TimingContext
+from llm.steps.mouth import render_template_body, run_mouth
+from server.enums import ConversationStage, DecisionAction, IntentLevel, UserSentiment
+from whatsapp_worker.processors.context import template_option
+
+REMINDER = TemplateOption(
+    name="demo_reminder",
+    language="en_US",
+    body="Hi {{1}}, your {{2}} demo slot is still open. Reply YES to confirm.",
+    parameter_count=2,
+)
+
+
+@pytest.fixture
+def context(make_context):
+    return make_context(
+        conversation_stage=ConversationStage.FOLLOWUP,
+        intent_level=IntentLevel.MEDIUM,
+        user_sentiment=UserSentiment.NEUTRAL,
+        timing=TimingContext(now_local="2024-01-02T12:00:00", whatsapp_window_open=False),
+        available_templates=[REMINDER],
+    )
+
+
+def _decision():
+    return ClassifyOutput(
+        thought_process="Nudge the lead about the demo",
+        situation_summary="Lead went quiet",
+        intent_level=IntentLevel.MEDIUM,
+        user_sentiment=UserSentiment.NEUTRAL,
+        risk_flags=RiskFlags(),
+        action=DecisionAction.SEND_NOW,
+        new_stage=ConversationStage.FOLLOWUP,
+        should_respond=True,
+        confidence=0.9,
+    )
+
+
+def test_closed_window_selects_and_fills_template(context):
+    client = CannedLLMClient({"Mouth": [{"template_name": "demo_reminder", "parameters": ["Asha", "CRM\nPro"]}]})
+    output, _, _ = run_mouth(context, _decision(), client=client)
+
+    assert output.template_message.template_name == "demo_reminder"
+    assert output.template_message.parameters == ["Asha", "CRM Pro"]
+    assert output.message_text == "Hi Asha, your CRM Pro demo slot is still open. Reply YES to confirm."
+    schema = client.calls[0][2]["response_format"]["json_schema"]["schema"]
+    assert schema["properties"]["template_name"]["enum"] == ["demo_reminder", None]
+
+
+def test_wrong_parameter_count_is_not_sent(context):
+    client = CannedLLMClient({"Mouth": [{"template_name": "demo_reminder", "parameters": ["Asha"]}]})
+    output, _, _ = run_mouth(context, _decision(), client=client)
+
+    assert output.template_message is None
+    assert output.message_text == ""
+    assert output.violations == ["invalid_template_parameters"]
+
+
+def test_open_window_writes_free_form_text(context):
+    timing = TimingContext(now_local="2024-01-02T12:00:00", whatsapp_window_open=True)
+    client = CannedLLMClient({"Mouth": [{"message_text": "Hi Asha, still keen on the demo?"}]})
+    output, _, _ = run_mouth(context.model_copy(update={"timing": timing}), _decision(), client=client)
+
+    assert output.template_message is None
+    assert output.message_text == "Hi Asha, still keen on the demo?"
+
+
+def test_template_option_from_meta_components():
+    option = template_option({
+        "name": "demo_reminder",
+        "language": "en_US",
+        "components": [
+            {"type": "HEADER", "format": "TEXT", "text": "Reminder"},
+            {"type": "BODY", "text": REMINDER.body},
+        ],
+    })
+
+    assert option == REMINDER
+    assert render_template_body(option.body, ["Asha"]) == "Hi Asha, your {{2}} demo slot is still open. Reply YES to confirm."
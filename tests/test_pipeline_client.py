@@ -0,0 +1,140 @@
+import pytest
+
+from llm.client import CannedLLMClient
+from llm.errors import ProviderUnavailableError
+from llm.pipeline import run_pipeline
+from llm.run_context import DeadlineExceededError, RunCancelledError
+from server.enums import ConversationStage, DecisionAction, IntentLevel, UserSentiment
+
+
+@pytest.fixture
+def context(make_context):
+    return make_context(
+        conversation_stage=ConversationStage.QUALIFICATION,
+        intent_level=IntentLevel.MEDIUM,
+        user_sentiment=UserSentiment.NEUTRAL,
+    )
+
+
+def test_brain_decision_drives_mouth(context, brain_reply):
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Our plans start at Rs 999."}],
+    })
+    result = run_pipeline(context, "How much?", client=client)
+
+    assert client.steps_called() == ["Brain", "Mouth"]
+    assert result.classification.action == DecisionAction.SEND_NOW
+    assert result.classification.new_stage == ConversationStage.PRICING
+    assert result.should_send_message
+    assert result.response.message_text == "Our plans start at Rs 999."
+
+
+def test_mouth_skipped_when_brain_waits(context, brain_reply):
+    client = CannedLLMClient({"Brain": [{**brain_reply, "action": "wait_schedule", "should_respond": False}]})
+    result = run_pipeline(context, "ok", client=client)
+
+    assert client.steps_called() == ["Brain"]
+    assert result.response is None
+    assert not result.should_send_message
+
+
+def test_brain_failure_falls_back_to_safe_wait(context):
+    client = CannedLLMClient({"Brain": [ProviderUnavailableError("down")]})
+    result = run_pipeline(context, "Hi", client=client)
+
+    assert result.classification.action == DecisionAction.WAIT_SCHEDULE
+    assert result.classification.new_stage == ConversationStage.QUALIFICATION
+    assert not result.should_send_message
+
+
+def test_deadline_falls_back_instead_of_aborting(context, brain_reply):
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [DeadlineExceededError("Pipeline run deadline exceeded")],
+    })
+    result = run_pipeline(context, "How much?", client=client)
+
+    assert result.should_send_message
+    assert result.response.message_text.startswith("I'm sorry")
+
+
+def test_explicit_cancellation_aborts_the_run(context):
+    client = CannedLLMClient({"Brain": [RunCancelledError("Pipeline run cancelled")]})
+
+    with pytest.raises(RunCancelledError):
+        run_pipeline(context, "How much?", client=client)
+
+def test_inline_memory_populates_summary(context, brain_reply):
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Our plans start at Rs 999."}],
+        "Memory": [{"updated_rolling_summary": "Lead asked about pricing."}],
+    })
+    saved = []
+    result = run_pipeline(context, "How much?", client=client, memory_mode="inline", on_summary=saved.append)
+
+    assert client.steps_called() == ["Brain", "Mouth", "Memory"]
+    assert result.summary.updated_rolling_summary == "Lead asked about pricing."
+    assert not result.needs_background_summary
+    assert saved == [result.summary]
+
+
+def test_inline_memory_metrics_are_attributed(context, brain_reply):
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Our plans start at Rs 999."}],
+        "Memory": [{"updated_rolling_summary": "Lead asked about pricing."}],
+    })
+    result = run_pipeline(context, "How much?", client=client, memory_mode="inline")
+
+    assert set(result.step_metrics) == {"brain", "mouth", "memory"}
+    assert set(result.token_usage) == {"brain", "mouth", "memory"}
+    assert result.step_metrics["memory"] == result.summary.metrics
+    assert result.pipeline_latency_ms == sum(m.latency_ms for m in result.step_metrics.values())
+
+
+def test_async_memory_calls_back_after_returning(context, brain_reply):
+    import threading
+
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Our plans start at Rs 999."}],
+        "Memory": [{"updated_rolling_summary": "Lead asked about pricing."}],
+    })
+    done = threading.Event()
+    saved = []
+
+    def on_summary(summary):
+        saved.append(summary)
+        done.set()
+
+    result = run_pipeline(context, "How much?", client=client, memory_mode="async", on_summary=on_summary)
+
+    assert result.summary is None
+    assert not result.needs_background_summary
+    assert done.wait(timeout=5)
+    assert saved[0].updated_rolling_summary == "Lead asked about pricing."
+
+
+def test_raw_capture_records_prompts_and_completions(context, brain_reply):
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [ProviderUnavailableError("mouth down")],
+    })
+    result = run_pipeline(context, "How much?", client=client, capture_raw=True)
+
+    brain, mouth = result.raw_captures
+    assert brain.step == "Brain"
+    assert brain.messages == client.calls[0][1]
+    assert '"action": "send_now"' in brain.raw_response
+    assert mouth.step == "Mouth"
+    assert mouth.error == "mouth down"
+    assert mouth.raw_response is None
+
+
+def test_raw_capture_is_off_by_default(context, brain_reply):
+    client = CannedLLMClient({"Brain": [brain_reply], "Mouth": [{"message_text": "Hi"}]})
+    result = run_pipeline(context, "How much?", client=client)
+
+    assert result.raw_captures == []
@@ -0,0 +1,80 @@
+import pytest
+
+from llm.client import CannedLLMClient
+from llm.hooks import PipelineMiddleware, add_middleware, clear_middleware
+from llm.pipeline import run_pipeline
+
+
+@pytest.fixture
+def make_client(brain_reply):
+    def make(message_text="Plans start at Rs 999. Want the details?"):
+        return CannedLLMClient({"Brain": [brain_reply], "Mouth": [{"message_text": message_text}]})
+
+    return make
+
+
+class Recorder(PipelineMiddleware):
+    def __init__(self):
+        self.events = []
+
+    def before_step(self, step, context, inputs):
+        self.events.append(("before", step, sorted(inputs)))
+
+    def after_step(self, step, context, inputs, output):
+        self.events.append(("after", step, type(output).__name__))
+
+
+def test_hooks_see_each_step_in_order(make_context, make_client):
+    recorder = Recorder()
+
+    run_pipeline(make_context(), "How much?", client=make_client(), memory_mode="worker", middleware=[recorder])
+
+    assert recorder.events == [
+        ("before", "brain", ["user_message"]),
+        ("after", "brain", "ClassifyOutput"),
+        ("before", "mouth", ["classification", "user_message"]),
+        ("after", "mouth", "GenerateOutput"),
+        ("before", "verify", ["classification", "response"]),
+        ("after", "verify", "GenerateOutput"),
+    ]
+
+
+def test_before_step_can_change_the_context(make_context, make_client):
+    class Enrich(PipelineMiddleware):
+        def before_step(self, step, context, inputs):
+            if step == "brain":
+                return context.model_copy(update={"business_description": "Plans: Basic Rs 999"})
+
+    client = make_client()
+    run_pipeline(make_context(), "How much?", client=client, memory_mode="worker", middleware=[Enrich()])
+
+    mouth_prompt = " ".join(message["content"] for message in client.calls[1][1])
+    assert "Plans: Basic Rs 999" in mouth_prompt
+
+
+def test_after_step_can_block_a_reply(make_context, make_client):
+    class BlockCompetitors(PipelineMiddleware):
+        def after_step(self, step, context, inputs, output):
+            if step == "mouth" and "CompetitorCo" in output.message_text:
+                return output.model_copy(update={"message_text": ""})
+
+    add_middleware(BlockCompetitors())
+    try:
+        client = make_client("Unlike CompetitorCo, we reply 24/7.")
+        result = run_pipeline(make_context(), "Are you better?", client=client, memory_mode="worker")
+    finally:
+        clear_middleware()
+
+    assert not result.should_send_message
+
+
+def test_failing_middleware_does_not_break_the_run(make_context, make_client):
+    class Broken(PipelineMiddleware):
+        def before_step(self, step, context, inputs):
+            raise RuntimeError("boom")
+
+    result = run_pipeline(
+        make_context(), "How much?", client=make_client(), memory_mode="worker", middleware=[Broken()]
+    )
+
+    assert result.should_send_message
@@ -0,0 +1,99 @@
+import pytest
+
+from llm.client import CannedLLMClient
+from llm.config import llm_config
+from llm.pipeline import run_pipeline
+from llm.replay import (
+    RECORDING_LOG_MARKER, LoggingRecordingSink, PipelineRecording, RecordingSink, parse_recordings, record_run,
+    replay, set_recording_sink,
+)
+
+MEMORY_REPLY = {"updated_rolling_summary": "Lead asked for the price."}
+
+
+class ListSink(RecordingSink):
+    def __init__(self):
+        self.recordings = []
+
+    def record(self, recording):
+        self.recordings.append(recording)
+
+
+@pytest.fixture
+def context(make_context):
+    return make_context(conversation_id="conv-1", organization_id="org-1")
+
+
+@pytest.fixture
+def production(context, brain_reply):
+    return run_pipeline(context, "How much?", memory_mode="worker", client=CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Plans start at Rs 999. Want the details?"}],
+    }))
+
+
+def test_runs_are_not_recorded_by_default(context, production):
+    assert record_run(context, "How much?", production) is None
+
+
+def test_recorded_run_replays_with_current_prompts(monkeypatch, context, production, brain_reply):
+    monkeypatch.setattr(llm_config, "record_runs", True)
+    sink = ListSink()
+    set_recording_sink(sink)
+    try:
+        record_run(context, "How much?", production)
+    finally:
+        set_recording_sink(LoggingRecordingSink())
+
+    # Stored and loaded as JSON, as the internal API does
+    recording = PipelineRecording.model_validate_json(sink.recordings[0].model_dump_json())
+    assert recording.organization_id == "org-1"
+    assert recording.context.timing.now_local == "2024-01-01T12:00:00"
+
+    client = CannedLLMClient({
+        "Brain": [{**brain_reply, "action": "wait_schedule", "should_respond": False}],
+        "Memory": [MEMORY_REPLY],
+    })
+    replayed = replay(recording, client=client)
+
+    assert client.steps_called() == ["Brain", "Memory"]
+    assert replayed.result.shadow and not replayed.result.should_send_message
+    assert replayed.result.request_id != recording.request_id
+    assert replayed.comparison.request_id == recording.request_id
+    assert replayed.recorded_prompt_version == replayed.replayed_prompt_version
+    assert replayed.comparison.differences == ["action: send_now -> wait_schedule", "send: True -> False"]
+
+
+def test_shadow_runs_are_never_recorded(monkeypatch, context, brain_reply):
+    monkeypatch.setattr(llm_config, "record_runs", True)
+    sink = ListSink()
+    set_recording_sink(sink)
+    try:
+        replayed = run_pipeline(context, "How much?", shadow=True, client=CannedLLMClient({
+            "Brain": [{**brain_reply, "should_respond": False}],
+            "Memory": [MEMORY_REPLY],
+        }))
+        record_run(context, "How much?", replayed)
+    finally:
+        set_recording_sink(LoggingRecordingSink())
+
+    assert sink.recordings == []
+
+
+def test_recordings_are_read_from_json_or_log_lines(monkeypatch, context, production):
+    monkeypatch.setattr(llm_config, "record_runs", True)
+    sink = ListSink()
+    set_recording_sink(sink)
+    try:
+        record_run(context, "How much?", production)
+    finally:
+        set_recording_sink(LoggingRecordingSink())
+    data = sink.recordings[0].model_dump_json()
+    log = (
+        "2024-01-01 12:00:00 - llm - INFO - Brain decided send_now\n"
+        f"2024-01-01 12:00:01 - llm - INFO - {RECORDING_LOG_MARKER}{data}\n"
+        f"2024-01-01 12:00:02 - llm - INFO - {RECORDING_LOG_MARKER}{data}\n"
+    )
+
+    assert [r.user_message for r in parse_recordings(data)] == ["How much?"]
+    assert [r.conversation_id for r in parse_recordings(log)] == ["conv-1", "conv-1"]
@@ -0,0 +1,59 @@
+import pytest
+
+from llm.prompt_budget import MIN_RECENT_MESSAGES, estimate_messages, fit_to_budget
+from llm.schemas import ExampleTurn, MessageContext, PromptExample
+
+FLOW = "Always ask for the city before quoting a price."
+
+
+@pytest.fixture
+def context(make_context):
+    return make_context(
+        business_description="We sell solar panels. " * 200,
+        flow_prompt=FLOW,
+        rolling_summary="Key facts: lead is in Pune. " + "They compared three vendors. " * 100,
+        prompt_examples=[
+            PromptExample(title=f"Example {n}", turns=[ExampleTurn(sender="lead", text="How much? " * 50)])
+            for n in range(3)
+        ],
+        last_messages=[
+            MessageContext(sender="lead", text=f"Message {n} " * 40, timestamp="2024-01-01T10:00:00")
+            for n in range(8)
+        ],
+    )
+
+
+def _build(context):
+    """Stand-in for a step's prompt builder: everything trimmable plus the flow."""
+    examples = "\n".join(turn.text for example in context.prompt_examples for turn in example.turns)
+    history = "\n".join(msg.text for msg in context.last_messages)
+    return [
+        {"role": "system", "content": f"{context.flow_prompt}\n{context.business_description}\n{examples}"},
+        {"role": "user", "content": f"{context.rolling_summary}\n{history}"},
+    ]
+
+
+def test_prompt_under_budget_is_untouched(context):
+    assert fit_to_budget(context, _build, 100_000) is context
+    assert fit_to_budget(context, _build, 0) is context
+
+
+def test_knowledge_is_trimmed_before_messages(context):
+    budget = estimate_messages(_build(context)) - 300
+
+    trimmed = fit_to_budget(context, _build, budget)
+
+    assert estimate_messages(_build(trimmed)) <= budget
+    assert len(trimmed.prompt_examples) < 3
+    assert len(trimmed.last_messages) == 8
+    assert trimmed.rolling_summary == context.rolling_summary
+
+
+def test_tight_budget_keeps_recent_messages_and_flow(context):
+    trimmed = fit_to_budget(context, _build, 200)
+
+    assert trimmed.prompt_examples == []
+    assert trimmed.business_description == ""
+    assert trimmed.last_messages == context.last_messages[-MIN_RECENT_MESSAGES:]
+    assert trimmed.flow_prompt == FLOW
+    assert trimmed.rolling_summary == ""
@@ -0,0 +1,53 @@
+import json
+
+import pytest
+
+from llm.prompt_store import BUILTIN_VERSION, FilePromptStore, active_prompt_version, reload_prompts, set_prompt_store
+from llm.prompt_templates import MOUTH_STAGE_RULES
+from llm.prompts_registry import get_brain_system_prompt, get_mouth_system_prompt
+from server.enums import ConversationStage
+
+
+@pytest.fixture
+def prompt_file(tmp_path):
+    path = tmp_path / "prompts.json"
+    set_prompt_store(FilePromptStore(str(path)))
+    yield path
+    # Back to the built-in prompts for the other tests
+    set_prompt_store(FilePromptStore(str(tmp_path / "missing.json")))
+    reload_prompts()
+    set_prompt_store(None)
+
+
+def _publish(path, version, prompts):
+    path.write_text(json.dumps({"version": version, "prompts": prompts}))
+
+
+def test_published_prompts_replace_builtin_and_revert(prompt_file):
+    _publish(prompt_file, "v2", {"mouth_stage_pricing": "\n=== CURRENT STAGE: PRICING ===\nLead with the annual plan.\n"})
+
+    assert reload_prompts() == "v2"
+    pricing = get_mouth_system_prompt(ConversationStage.PRICING, business_name="Acme")
+    assert "Lead with the annual plan." in pricing
+    assert "Do not be defensive about price." not in pricing
+
+    # Templates a later version leaves out go back to the built-in text
+    _publish(prompt_file, "v3", {})
+    assert reload_prompts() == "v3"
+    assert "Do not be defensive about price." in get_mouth_system_prompt(ConversationStage.PRICING, business_name="Acme")
+
+
+def test_invalid_bundle_keeps_current_prompts(prompt_file):
+    _publish(prompt_file, "v2", {"brain_system": "Decide. Guidelines: {flow_prompt}"})
+    assert reload_prompts() == "v2"
+
+    # Missing the declared {flow_prompt} field, and an unknown template
+    _publish(prompt_file, "v3", {"brain_system": "Decide.", "no_such_template": "x"})
+    assert reload_prompts() == "v2"
+    assert active_prompt_version() == "v2"
+    assert get_brain_system_prompt(ConversationStage.PRICING, flow_prompt="Be brief").startswith("Decide. Guidelines: Be brief")
+
+
+def test_missing_file_means_builtin(prompt_file):
+    assert reload_prompts() == BUILTIN_VERSION
+    assert MOUTH_STAGE_RULES[ConversationStage.CTA].render().strip().startswith("=== CURRENT STAGE: CALL TO ACTION")
@@ -0,0 +1,46 @@
+import pytest
+
+from llm.prompt_templates import PromptTemplate, PromptTemplateError, TEMPLATES, validate_templates
+
+
+def test_shipped_templates_are_valid():
+    validate_templates()
+
+
+def test_render_fills_named_fields():
+    template = PromptTemplate("greeting", "Hi {name}, welcome to {business}. {{json}}", ["name", "business"])
+
+    assert template.render(business="Acme", name="Asha") == "Hi Asha, welcome to Acme. {json}"
+
+
+def test_render_rejects_missing_and_unknown_fields():
+    template = PromptTemplate("greeting", "Hi {name}", ["name"])
+
+    with pytest.raises(PromptTemplateError, match="missing fields"):
+        template.render()
+    with pytest.raises(PromptTemplateError, match="unknown fields"):
+        template.render(name="Asha", typo="x")
+
+
+def test_validate_catches_drift_between_text_and_fields():
+    with pytest.raises(PromptTemplateError, match="undeclared placeholders"):
+        PromptTemplate("drift", "Hi {name} from {city}", ["name"]).validate()
+    with pytest.raises(PromptTemplateError, match="positional"):
+        PromptTemplate("positional", "Hi {}", []).validate()
+    with pytest.raises(PromptTemplateError):
+        PromptTemplate("broken", "Hi {name", ["name"]).validate()
+
+
+def test_mouth_user_template_renders():
+    prompt = TEMPLATES["mouth_user"].render(
+        business_name="Acme",
+        rolling_summary="Asked about price",
+        lead_profile="- budget: 5000",
+        last_messages="[lead] How much?",
+        available_ctas="None",
+        decision_json="{}",
+        conversation_stage="pricing",
+    )
+
+    assert "Business: Acme" in prompt
+    assert "- budget: 5000" in prompt
@@ -0,0 +1,117 @@
+import pytest
+
+from llm.circuit_breaker import get_breaker
+from llm.client import CannedLLMClient
+from llm.config import llm_config
+from llm.pipeline import run_pipeline
+from llm.prompt_store import PromptBundle
+from llm.shadow import (
+    SHADOW_POOL, ShadowSink, LoggingShadowSink, maybe_submit_shadow, run_shadow, set_shadow_sink,
+    shadow_client, validate_shadow_config,
+)
+
+MEMORY_REPLY = {"updated_rolling_summary": "Lead asked for the price; bot quoted Rs 999."}
+
+
+@pytest.fixture
+def context(make_context):
+    return make_context(conversation_id="conv-1")
+
+
+class ListSink(ShadowSink):
+    def __init__(self):
+        self.comparisons = []
+
+    def record(self, comparison):
+        self.comparisons.append(comparison)
+
+
+def test_shadow_run_never_sends_or_saves(context, brain_reply):
+    saved = []
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Plans start at Rs 999. Want the details?"}],
+        "Memory": [MEMORY_REPLY],
+    })
+
+    result = run_pipeline(context, "How much?", client=client, memory_mode="queue", on_summary=saved.append,
+                          conversation_id="conv-1", shadow=True)
+
+    assert client.steps_called() == ["Brain", "Mouth", "Memory"]
+    assert result.shadow
+    assert result.would_send_message and not result.should_send_message
+    assert result.summary.updated_rolling_summary == MEMORY_REPLY["updated_rolling_summary"]
+    assert not result.needs_background_summary
+    assert saved == []
+
+
+def test_shadow_run_is_compared_with_production(context, brain_reply):
+    production = run_pipeline(context, "How much?", memory_mode="worker", client=CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Plans start at Rs 999. Want the details?"}],
+    }))
+    sink = ListSink()
+    set_shadow_sink(sink)
+    try:
+        comparison = run_shadow(context, "How much?", production, client=CannedLLMClient({
+            "Brain": [{**brain_reply, "action": "initiate_cta", "new_stage": "cta"}],
+            "Mouth": [{"message_text": "Rs 999 a month. Shall I book you a demo?"}],
+            "Memory": [MEMORY_REPLY],
+        }))
+    finally:
+        set_shadow_sink(LoggingShadowSink())
+
+    assert sink.comparisons == [comparison]
+    assert comparison.conversation_id == "conv-1"
+    assert comparison.request_id == production.request_id
+    assert comparison.differences == ["action: send_now -> initiate_cta", "stage: pricing -> cta"]
+    assert not comparison.matches
+    assert 0 < comparison.message_similarity < 1
+
+
+def test_no_shadow_run_when_off(monkeypatch, context, brain_reply):
+    monkeypatch.setattr(llm_config, "shadow_mode", "off")
+    production = run_pipeline(context, "How much?", memory_mode="worker", client=CannedLLMClient({
+        "Brain": [{**brain_reply, "should_respond": False}],
+    }))
+
+    assert maybe_submit_shadow(context, "How much?", production) is None
+
+
+def test_shadow_run_uses_candidate_prompts_only_for_itself(context, brain_reply):
+    production = run_pipeline(context, "How much?", memory_mode="worker", client=CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Plans start at Rs 999. Want the details?"}],
+    }))
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Plans start at Rs 999. Want the details?"}],
+        "Memory": [MEMORY_REPLY],
+    })
+    candidate = PromptBundle(version="candidate-1", prompts={"mouth_stage_pricing": "CANDIDATE PRICING RULES"})
+
+    comparison = run_shadow(context, "How much?", production, client=client, prompts=candidate)
+    after = CannedLLMClient({"Brain": [brain_reply], "Mouth": [{"message_text": "Rs 999. Details?"}]})
+    run_pipeline(context, "How much?", memory_mode="worker", client=after)
+
+    assert client.calls[0][2]["ctx"].request_id == f"{production.request_id}:shadow"
+    assert "CANDIDATE PRICING RULES" in client.calls[1][1][0]["content"]
+    assert "CANDIDATE PRICING RULES" not in after.calls[1][1][0]["content"]
+    assert comparison.shadow_prompt_version == "candidate-1"
+    assert comparison.production_prompt_version == production.prompt_version
+
+
+def test_shadow_calls_have_their_own_breakers_and_slots():
+    assert shadow_client().pool == SHADOW_POOL
+    assert get_breaker("groq", SHADOW_POOL) is not get_breaker("groq")
+
+
+def test_unknown_shadow_mode_skips_the_run(monkeypatch, context, brain_reply):
+    monkeypatch.setattr(llm_config, "shadow_mode", "comapre")
+    production = run_pipeline(context, "How much?", memory_mode="worker", client=CannedLLMClient({
+        "Brain": [{**brain_reply, "should_respond": False}],
+    }))
+
+    assert maybe_submit_shadow(context, "How much?", production) is None
+    with pytest.raises(ValueError):
+        validate_shadow_config()
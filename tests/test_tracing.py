@@ -0,0 +1,78 @@
+from contextlib import contextmanager
+from uuid import uuid4
+
+from llm import tracing
+from llm.client import CannedLLMClient
+from llm.config import llm_config
+from llm.pipeline import run_pipeline
+
+
+class FakeSpan:
+    def __init__(self, name, attributes):
+        self.name = name
+        self.attributes = dict(attributes)
+        self.exceptions = []
+
+    def set_attribute(self, key, value):
+        self.attributes[key] = value
+
+    def set_attributes(self, attributes):
+        self.attributes.update(attributes)
+
+    def record_exception(self, exception):
+        self.exceptions.append(exception)
+
+
+class FakeTrace:
+    """Stands in for opentelemetry.trace, recording spans in the order they start."""
+
+    def __init__(self):
+        self.spans = []
+
+    def get_tracer(self, name):
+        return self
+
+    @contextmanager
+    def start_as_current_span(self, name, attributes=None):
+        current = FakeSpan(name, attributes or {})
+        self.spans.append(current)
+        yield current
+
+
+def test_spans_are_noops_when_tracing_is_off(monkeypatch):
+    fake = FakeTrace()
+    monkeypatch.setattr(tracing, "trace", fake)
+    monkeypatch.setattr(llm_config, "tracing", False)
+
+    with tracing.span("pipeline.run", stage="pricing") as current:
+        tracing.annotate(current, total_tokens=10)
+
+    assert fake.spans == []
+
+
+def test_pipeline_run_and_steps_are_traced(monkeypatch, make_context, brain_reply):
+    fake = FakeTrace()
+    monkeypatch.setattr(tracing, "trace", fake)
+    monkeypatch.setattr(llm_config, "tracing", True)
+    client = CannedLLMClient({
+        "Brain": [brain_reply],
+        "Mouth": [{"message_text": "Plans start at Rs 999. Want the details?"}],
+    })
+
+    run_pipeline(make_context(), "How much?", client=client, memory_mode="worker", conversation_id="conv-1")
+
+    assert [span.name for span in fake.spans] == [
+        "pipeline.run", "pipeline.brain", "pipeline.mouth", "pipeline.verify",
+    ]
+    run_span = fake.spans[0]
+    assert run_span.attributes["conversation_id"] == "conv-1"
+    assert run_span.attributes["stage"] == "pricing"
+    assert run_span.attributes["action"] == "send_now"
+    assert run_span.attributes["should_send"] is True
+    assert fake.spans[2].attributes["action"] == "send_now"
+
+
+def test_attributes_are_otel_safe():
+    conversation_id = uuid4()
+
+    assert tracing._attributes({"a": None, "b": 1, "c": conversation_id}) == {"b": 1, "c": str(conversation_id)}
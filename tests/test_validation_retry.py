@@ -0,0 +1,98 @@
+import pytest
+
+from llm.client import CannedLLMClient
+from llm.schemas import ClassifyOutput, RiskFlags
+from llm.steps.brain import run_brain
+from llm.steps.mouth import run_mouth
+from server.enums import ConversationStage, DecisionAction, IntentLevel, UserSentiment
+
+
+@pytest.fixture
+def demo_reply(brain_reply):
+    return {
+        **brain_reply,
+        "thought_process": "Lead asked for a demo",
+        "situation_summary": "Demo request",
+        "intent_level": "very_high",
+        "action": "initiate_cta",
+        "new_stage": "cta",
+    }
+
+
+def _classification():
+    return ClassifyOutput(
+        thought_process="Lead asked for the price",
+        situation_summary="Pricing question",
+        intent_level=IntentLevel.HIGH,
+        user_sentiment=UserSentiment.CURIOUS,
+        risk_flags=RiskFlags(),
+        action=DecisionAction.SEND_NOW,
+        new_stage=ConversationStage.PRICING,
+        should_respond=True,
+        confidence=0.9,
+    )
+
+
+def test_brain_is_reasked_with_what_was_invalid(make_context, demo_reply):
+    client = CannedLLMClient({"Brain": [
+        {**demo_reply, "action": "book_the_meeting", "should_respond": "yes"},
+        demo_reply,
+    ]})
+
+    output, _, _ = run_brain(make_context(), client=client)
+
+    assert client.steps_called() == ["Brain", "Brain"]
+    feedback = client.calls[1][1][-1]["content"]
+    assert 'action: "book_the_meeting" is not one of send_now, wait_schedule, initiate_cta' in feedback
+    assert "should_respond" in feedback
+    assert client.calls[1][2]["cache"] is False
+    assert client.calls[1][2]["idempotency_suffix"] == "reask1"
+    assert output.action == DecisionAction.INITIATE_CTA
+    assert output.should_respond is True
+
+
+def test_valid_brain_output_is_not_reasked(make_context, demo_reply):
+    client = CannedLLMClient({"Brain": [{**demo_reply, "new_stage": "Pricing"}]})
+
+    output, _, _ = run_brain(make_context(), client=client)
+
+    assert client.steps_called() == ["Brain"]
+    assert output.new_stage == ConversationStage.PRICING
+
+
+def test_empty_mouth_reply_is_regenerated(make_context):
+    client = CannedLLMClient({"Mouth": [
+        {"message_text": "  "},
+        {"message_text": "Plans start at Rs 999. Want the details?"},
+    ]})
+
+    output, _, _ = run_mouth(make_context(), _classification(), client=client)
+
+    assert client.steps_called() == ["Mouth", "Mouth"]
+    assert "a reply to the lead is required" in client.calls[1][1][-1]["content"]
+    assert client.calls[1][2]["idempotency_suffix"] == "valid1"
+    assert output.message_text.startswith("Plans start")
+    assert output.violations == []
+
+
+def test_null_mouth_reply_is_regenerated(make_context):
+    client = CannedLLMClient({"Mouth": [
+        {"message_text": None, "message_language": None},
+        {"message_text": "Plans start at Rs 999. Want the details?"},
+    ]})
+
+    output, _, _ = run_mouth(make_context(), _classification(), client=client)
+
+    assert client.steps_called() == ["Mouth", "Mouth"]
+    assert "message_text: null" in client.calls[1][1][-1]["content"]
+    assert output.message_text.startswith("Plans start")
+
+
+def test_still_empty_reply_is_recorded(make_context):
+    client = CannedLLMClient({"Mouth": [{"message_text": ""}, {}]})
+
+    output, _, _ = run_mouth(make_context(), _classification(), client=client)
+
+    assert output.message_text == ""
+    assert not output.self_check_passed
+    assert output.violations == ["invalid_output: message_text: null, but a reply to the lead is required"]
@@ -13,10 +13,24 @@ from uuid import UUID
 import boto3
 from whatsapp_worker.config import config
 from whatsapp_worker.processors.context import build_pipeline_context
-from whatsapp_worker.processors.actions import handle_pipeline_result
+from whatsapp_worker.processors.actions import (
+    handle_pipeline_result, record_llm_spend, record_memory_spend, send_reply,
+    ApiMemoryAuditSink, ApiPromptStore, ApiRecordingSink,
+)
 from whatsapp_worker.processors.api_client import api_client
 from whatsapp_worker.security import validate_signature
 from llm.pipeline import run_pipeline
+from llm.run_context import RunContext, RunCancelledError, DeadlineExceededError
+from llm.schemas import SummaryOutput, LeadProfile
+from llm.memory_queue import MemoryJob, MemoryWorker, get_memory_queue
+from llm.memory_audit import set_memory_audit_sink
+from llm.config import llm_config
+from llm.providers import verify_configured_models
+from llm.prompt_templates import validate_templates
+from llm.prompt_store import reload_prompts, set_prompt_store
+from llm.metrics import start_metrics_server
+from llm.shadow import maybe_submit_shadow, set_shadow_prompt_store, validate_shadow_config
+from llm.replay import record_run, set_recording_sink
 from server.enums import ConversationMode
 from logging_config import setup_logging
 
@@ -39,6 +53,69 @@ _message_buffer: dict = defaultdict(list)
 _buffer_lock = Lock()
 DEBOUNCE_SECONDS = 5  # Wait 5 seconds for additional messages
 
+# --- Duplicate Delivery Guard ---
+# WhatsApp redelivers webhooks it considers failed, and SQS redelivers messages
+# that were not deleted in time. Message IDs are claimed through the internal API
+# (shared by all workers) before processing and marked "replied" as soon as the
+# reply goes out, so a redelivery never generates a second reply.
+# A "processing" claim older than this is taken over (its worker died); longer
+# than the SQS visibility timeout, so a slow worker keeps its claim.
+CLAIM_LEASE_SECONDS = 300
+
+
+def _claim_message(message_id: Optional[str]) -> Tuple[bool, str]:
+    """(claimed, status) for a message ID; messages without one are always processed."""
+    if not message_id:
+        return True, "processing"
+    claim = api_client.claim_inbound_message(message_id, lease_seconds=CLAIM_LEASE_SECONDS)
+    return claim["claimed"], claim["status"]
+
+
+def _mark_message(message_id: Optional[str], status: str) -> None:
+    if not message_id:
+        return
+    try:
+        api_client.update_inbound_message_claim(message_id, status)
+    except Exception as e:
+        logger.error(f"Failed to mark message {message_id} {status}: {e}")
+
+
+def _release_message(message_id: Optional[str]) -> None:
+    """Let a redelivery process the message again (no-op once it was replied to)."""
+    if not message_id:
+        return
+    try:
+        api_client.release_inbound_message(message_id)
+    except Exception as e:
+        logger.error(f"Failed to release message {message_id}: {e}")
+
+
+def save_summary(
+    conversation_id: UUID,
+    lead_id: Optional[UUID],
+    summary: SummaryOutput,
+    previous_profile: Optional[LeadProfile] = None,
+) -> None:
+    """Persist a Memory step result: the rolling summary, and the lead profile if it changed."""
+    # We only update the summary here. Other fields handled by handle_pipeline_result.
+    try:
+        api_client.update_conversation(conversation_id, rolling_summary=summary.updated_rolling_summary)
+        logger.info(f"Updated rolling summary for {conversation_id}")
+    except Exception as e:
+        logger.error(f"Failed to save summary to DB: {e}")
+    if lead_id and summary.lead_profile != previous_profile:
+        try:
+            api_client.update_lead_profile(lead_id, summary.lead_profile.model_dump())
+        except Exception as e:
+            logger.error(f"Failed to save lead profile: {e}")
+
+
+def _save_queued_summary(job: MemoryJob, summary: SummaryOutput) -> None:
+    lead_id = job.metadata.get("lead_id")
+    save_summary(UUID(job.conversation_id), UUID(lead_id) if lead_id else None, summary)
+    if job.metadata.get("organization_id"):
+        record_memory_spend(UUID(job.metadata["organization_id"]), UUID(job.conversation_id), summary)
+
 
 def start_worker():
     """
@@ -46,6 +123,33 @@ def start_worker():
     """
     logger.info(f"HTL Worker started. Listening on: {config.QUEUE_URL}")
 
+    # Fail fast on a broken prompt template rather than on the first message
+    validate_templates()
+
+    # Self-hosted models must be pulled before we take traffic
+    verify_configured_models()
+
+    # A mistyped LLM_SHADOW_MODE fails here, not silently on every message
+    validate_shadow_config()
+
+    set_memory_audit_sink(ApiMemoryAuditSink())
+    if llm_config.record_runs:
+        set_recording_sink(ApiRecordingSink())
+
+    # Published prompts (llm.prompt_store); an invalid version is logged and the built-in ones kept
+    if llm_config.prompt_store_backend == "api":
+        set_prompt_store(ApiPromptStore())
+    logger.info(f"Using prompts {reload_prompts()}")
+    # Candidate prompts for shadow runs (llm.shadow)
+    if llm_config.shadow_prompt_version:
+        set_shadow_prompt_store(ApiPromptStore(version=llm_config.shadow_prompt_version))
+
+    if llm_config.memory_mode == "queue":
+        MemoryWorker(get_memory_queue(), handler=_save_queued_summary).start()
+
+    if llm_config.metrics_port:
+        start_metrics_server()
+
     while True:
         try:
             # Long Polling: Wait up to 20 seconds for a message
@@ -135,6 +239,7 @@ def handle_webhook(body: Mapping) -> Tuple[Mapping, int]:
 
         # Process first message (usually only one)
         msg = messages[0]
+        message_id = msg.get("id")
         
         # Get sender info
         contacts = value.get("contacts", [])
@@ -149,10 +254,15 @@ def handle_webhook(body: Mapping) -> Tuple[Mapping, int]:
             logger.warning("Missing sender_phone or phone_number_id")
             return {"status": "error", "message": "Missing required fields"}, 400
         
-        # Extract message text
+        # Extract message text (a tapped quick reply counts as its title)
         text_body = None
         if msg.get("type") == "text":
             text_body = msg["text"]["body"]
+        elif msg.get("type") == "interactive":
+            reply = msg["interactive"].get("button_reply") or msg["interactive"].get("list_reply") or {}
+            text_body = reply.get("title")
+        elif msg.get("type") == "button":
+            text_body = msg["button"].get("text")
         
         if not text_body:
             logger.info(f"Non-text message from {sender_phone}, type: {msg.get('type')}")
@@ -160,13 +270,32 @@ def handle_webhook(body: Mapping) -> Tuple[Mapping, int]:
 
         logger.info(f"Received from {sender_phone}: {text_body[:100]}...")
         
+        claimed, claim_status = _claim_message(message_id)
+        if not claimed:
+            if claim_status == "processing":
+                # Another worker is on it; leave this delivery on the queue in case that one fails
+                logger.info(f"Message {message_id} is being processed by another worker")
+                return {"status": "error", "message": "Message is being processed"}, 409
+            logger.info(f"Skipping duplicate delivery of message {message_id}")
+            return {"status": "ok", "type": "duplicate"}, 200
+
         # Process through HTL pipeline
-        return process_message(
-            phone_number_id=phone_number_id,
-            sender_phone=sender_phone,
-            sender_name=sender_name,
-            message_text=text_body,
-        )
+        try:
+            result_body, status_code = process_message(
+                phone_number_id=phone_number_id,
+                sender_phone=sender_phone,
+                sender_name=sender_name,
+                message_text=text_body,
+                message_id=message_id,
+            )
+        except Exception:
+            _release_message(message_id)
+            raise
+        if status_code == 200:
+            _mark_message(message_id, "done")
+        else:
+            _release_message(message_id)
+        return result_body, status_code
         
     except Exception as e:
         logger.error(f"Webhook handling error: {e}", exc_info=True)
@@ -178,10 +307,15 @@ def process_message(
     sender_phone: str,
     sender_name: Optional[str],
     message_text: str,
+    message_id: Optional[str] = None,
 ) -> Tuple[Mapping, int]:
     """
     Process a message through the Router-Agent pipeline.
+    The WhatsApp message ID doubles as the run's request ID, so every LLM call
+    made for it can be traced back from the logs.
+    LLM retries and fallbacks share a budget of LLMConfig.inbound_budget_seconds.
     """
+    ctx = RunContext(timeout=llm_config.inbound_budget_seconds, request_id=message_id)
     try:
         # ========================================
         # Step 1: Gather Information via API
@@ -228,12 +362,31 @@ def process_message(
                 "business_name": org_result.get("business_name"),
                 "business_description": org_result.get("business_description"),
                 "flow_prompt": org_result.get("flow_prompt"),
+                "memory_prompt": org_result.get("memory_prompt"),
+                "memory_fact_fields": org_result.get("memory_fact_fields"),
+                "prompt_overrides": org_result.get("prompt_overrides"),
+                "prompt_examples": org_result.get("prompt_examples"),
+                "timezone": org_result.get("timezone"),
+                "forbidden_claims": org_result.get("forbidden_claims"),
             }, 
             conversation, 
             lead
         )
         
-        pipeline_result = run_pipeline(pipeline_context, message_text)
+        def on_summary(new_summary: SummaryOutput) -> None:
+            save_summary(conversation_id, lead_id, new_summary, pipeline_context.lead_profile)
+            record_memory_spend(organization_id, conversation_id, new_summary)
+
+        # In "inline"/"async" memory modes the pipeline runs Memory and calls on_summary;
+        # in "queue" mode the MemoryWorker started with the worker persists it
+        pipeline_result = run_pipeline(
+            pipeline_context,
+            message_text,
+            ctx=ctx,
+            on_summary=on_summary,
+            conversation_id=str(conversation_id),
+            memory_metadata={"lead_id": str(lead_id), "organization_id": str(organization_id)},
+        )
         
         # ========================================
         # Step 4: Immediate Action (Send Message)
@@ -243,11 +396,11 @@ def process_message(
         if pipeline_result.should_send_message and pipeline_result.response:
             response_text = pipeline_result.response.message_text
             try:
-                # SEND TO WHATSAPP FIRST (Low Latency)
-                api_client.send_bot_message(
+                # SEND TO WHATSAPP FIRST (Low Latency); long replies go out as several bubbles
+                send_reply(
+                    pipeline_result,
                     organization_id=organization_id,
                     conversation_id=conversation_id,
-                    content=response_text,
                     access_token=access_token,
                     phone_number_id=phone_number_id,
                     version=version,
@@ -256,6 +409,8 @@ def process_message(
             except Exception as e:
                 logger.error(f"Failed to send WhatsApp message: {e}", exc_info=True)
                 # We continue to update state even if send failed, to record intention
+            # Whatever happens below, a redelivery of this message must not reply again
+            _mark_message(message_id, "replied")
 
         # ========================================
         # Step 5: Update State & Background Tasks
@@ -263,6 +418,13 @@ def process_message(
 
         # Update Conversation State (Stage, Intent, etc.)
         handle_pipeline_result(conversation, lead_id, pipeline_result)
+        record_llm_spend(organization_id, conversation_id, pipeline_result)
+
+        # Keep the turn for replay (LLM_RECORD_RUNS)
+        record_run(pipeline_context, message_text, pipeline_result)
+
+        # Evaluate the shadow model on this turn in the background (LLM_SHADOW_MODE=compare)
+        maybe_submit_shadow(pipeline_context, message_text, pipeline_result)
         
         # Background Summary (The Memory)
         if pipeline_result.needs_background_summary:
@@ -273,17 +435,14 @@ def process_message(
                 pipeline_context, 
                 user_message=message_text,
                 bot_message=response_text or "",
-                classification=pipeline_result.classification
+                classification=pipeline_result.classification,
+                # Background work: not bound by the reply budget
+                ctx=RunContext(request_id=ctx.request_id),
             )
             
             # Update DB with new summary if generated
             if new_summary:
-                try:
-                    # We only update the summary here. Other fields handled by handle_pipeline_result.
-                    api_client.update_conversation(conversation_id, rolling_summary=new_summary)
-                    logger.info(f"Updated rolling summary for {conversation_id}")
-                except Exception as e:
-                    logger.error(f"Failed to save summary to DB: {e}")
+                on_summary(new_summary)
 
         return {
             "status": "ok",
@@ -292,6 +451,15 @@ def process_message(
             "stage": pipeline_result.classification.new_stage.value,
         }, 200
 
+    except DeadlineExceededError as e:
+        # Steps fall back when out of budget, so this is rare; a redelivery would
+        # only store the lead's message again and reply later still
+        logger.warning(f"Message {ctx.request_id} not processed in time, staying silent: {e}")
+        return {"status": "ok", "send": False, "message": "LLM budget exceeded"}, 200
+    except RunCancelledError as e:
+        # Explicitly cancelled; leave the message on the queue for redelivery
+        logger.warning(f"Message {ctx.request_id} cancelled: {e}")
+        return {"status": "error", "message": "Run cancelled"}, 503
     except Exception as e:
         logger.error(f"Message processing error: {e}", exc_info=True)
         return {"status": "error", "message": str(e)}, 500
@@ -6,7 +6,11 @@ import logging
 from datetime import datetime, timezone
 from typing import Dict, Optional
 from uuid import UUID
-from llm.schemas import PipelineResult
+from llm.schemas import PipelineResult, SummaryOutput
+from llm.cost import get_spend_recorder
+from llm.memory_audit import MemoryAuditSink, SummaryRevision
+from llm.prompt_store import PromptBundle, PromptStore
+from llm.replay import PipelineRecording, RecordingSink
 from whatsapp_worker.processors.api_client import api_client
 
 logger = logging.getLogger(__name__)
@@ -59,15 +63,13 @@ def handle_pipeline_result(
 
     # Collect CTA fields (INDEPENDENT - CTA can be triggered even when sending a message)
     # e.g., "Let's book a call!" message + CTA initiation
-    selected_cta_id = classification.selected_cta_id
-    if result.response and result.response.selected_cta_id:
-        selected_cta_id = result.response.selected_cta_id
-        
-    if selected_cta_id:
-        updates["cta_id"] = str(selected_cta_id)
-        if classification.cta_scheduled_at:
-            updates["cta_scheduled_at"] = classification.cta_scheduled_at
-        logger.info(f"📋 CTA selected: {selected_cta_id} for conversation {conversation_id}")
+    # result.cta_action is already checked against the organization's CTAs
+    cta_action = result.cta_action
+    if cta_action:
+        updates["cta_id"] = str(cta_action.cta_id)
+        if cta_action.scheduled_at:
+            updates["cta_scheduled_at"] = cta_action.scheduled_at.isoformat()
+        logger.info(f"📋 CTA selected: {cta_action.cta_id} ({cta_action.type.value}) for conversation {conversation_id}")
 
     # Handle message sending
     if result.should_send_message and result.response:
@@ -117,15 +119,14 @@ def handle_pipeline_result(
             logger.error(f"Failed to emit human attention event: {e}")
 
     # Emit CTA initiation if flagged
-    if "cta_id" in updates:
+    if cta_action:
         try:
             # Fetch CTA Name for the event
             cta_name = "CTA"
-            selected_cta_id = updates["cta_id"]
             try:
                 raw_ctas = api_client.get_organization_ctas(UUID(conversation["organization_id"]))
                 for cta in raw_ctas:
-                    if str(cta["id"]) == str(selected_cta_id):
+                    if str(cta["id"]) == str(cta_action.cta_id):
                         cta_name = cta["name"]
                         break
             except Exception as e:
@@ -134,7 +135,7 @@ def handle_pipeline_result(
             api_client.emit_cta_initiated(
                 conversation_id=conversation_id,
                 organization_id=UUID(conversation["organization_id"]),
-                cta_type=cta_name,
+                cta_type=cta_action.type.value,
                 cta_name=cta_name,
                 scheduled_time=updates.get("cta_scheduled_at") or datetime.now(timezone.utc).isoformat(),
             )
@@ -147,6 +148,38 @@ def handle_pipeline_result(
     return message_to_send
 
 
+def send_reply(
+    result: PipelineResult,
+    organization_id: UUID,
+    conversation_id: UUID,
+    access_token: str,
+    phone_number_id: str,
+    version: str,
+    to: Optional[str],
+) -> None:
+    """
+    Send the pipeline's reply via API, or a template when the Mouth selected one.
+    The reply is stored once; its message_parts go out as separate bubbles, paced
+    by the server so this worker doesn't wait out the typing delays.
+    """
+    response = result.response
+    template = response.template_message.model_dump() if response.template_message else None
+    interactive = response.interactive.model_dump(mode="json") if response.interactive else None
+    api_client.send_bot_message(
+        organization_id=organization_id,
+        conversation_id=conversation_id,
+        content=response.message_text,
+        access_token=access_token,
+        phone_number_id=phone_number_id,
+        version=version,
+        to=to,
+        template=template,
+        interactive=interactive,
+        parts=response.message_parts or None,
+        part_delays_ms=response.message_part_delays_ms or None,
+    )
+
+
 def log_pipeline_event(
     conversation_id: UUID,
     result: PipelineResult,
@@ -164,3 +197,85 @@ def log_pipeline_event(
         tokens_used=result.total_tokens_used,
     )
 
+
+def record_llm_spend(
+    organization_id: UUID,
+    conversation_id: UUID,
+    result: PipelineResult,
+) -> None:
+    """
+    Persist the pipeline's LLM spend. Accounting failures never block messaging.
+    Memory spend is recorded with the summary (record_memory_spend), whichever
+    memory mode produced it.
+    """
+    usage_by_step = {step: usage for step, usage in result.token_usage.items() if step != "memory"}
+    if not usage_by_step:
+        return
+    try:
+        get_spend_recorder().record(organization_id, usage_by_step, conversation_id=conversation_id)
+    except Exception as e:
+        logger.error(f"Failed to record LLM spend for org {organization_id}: {e}")
+
+
+def record_memory_spend(
+    organization_id: UUID,
+    conversation_id: UUID,
+    summary: SummaryOutput,
+) -> None:
+    """Persist the Memory step's LLM spend. Fallback summaries cost nothing and are skipped."""
+    if not summary.metrics.usage.total_tokens:
+        return
+    try:
+        get_spend_recorder().record(
+            organization_id, {"memory": summary.metrics.usage}, conversation_id=conversation_id
+        )
+    except Exception as e:
+        logger.error(f"Failed to record memory spend for org {organization_id}: {e}")
+
+
+class ApiPromptStore(PromptStore):
+    """
+    Serves the prompt version activated through the internal API, or with
+    version, that published version (e.g. shadow runs' candidate).
+    """
+
+    def __init__(self, version: Optional[str] = None) -> None:
+        self.version = version
+
+    def load(self) -> Optional[PromptBundle]:
+        published = api_client.get_prompt_version(self.version) if self.version else api_client.get_active_prompts()
+        if not published:
+            return None
+        return PromptBundle(version=str(published["version"]), prompts=published.get("prompts") or {})
+
+
+class ApiRecordingSink(RecordingSink):
+    """Stores pipeline recordings through the internal API."""
+
+    def record(self, recording: PipelineRecording) -> None:
+        if not recording.conversation_id:
+            return
+        api_client.create_pipeline_recording(recording.model_dump(mode="json", exclude={"id", "created_at"}))
+
+
+def recording_from_api(data: Dict) -> PipelineRecording:
+    """A stored recording (InternalPipelineRecordingOut) as a PipelineRecording to replay."""
+    return PipelineRecording(
+        id=str(data["id"]),
+        conversation_id=data.get("conversation_id"),
+        organization_id=data.get("organization_id"),
+        request_id=data.get("request_id"),
+        user_message=data["user_message"],
+        context=data["context"],
+        result=data["result"],
+        prompt_version=data.get("prompt_version"),
+    )
+
+
+class ApiMemoryAuditSink(MemoryAuditSink):
+    """Stores summary revisions through the internal API."""
+
+    def record(self, revision: SummaryRevision) -> None:
+        if not revision.conversation_id:
+            return
+        api_client.record_summary_revision(revision.model_dump(exclude={"created_at"}))
@@ -105,6 +105,13 @@ class InternalsAPIClient:
             f"/internals/organizations/{organization_id}/ctas"
         )
         return self._handle_response(response)
+
+    def get_organization_templates(self, organization_id: UUID) -> List[Dict]:
+        """Get approved WhatsApp templates for an organization."""
+        response = self.client.get(
+            f"/internals/organizations/{organization_id}/templates"
+        )
+        return self._handle_response(response)
     
     # ========================================
     # Lead Methods
@@ -164,6 +171,14 @@ class InternalsAPIClient:
         )
         return self._handle_response(response)
     
+    def update_lead_profile(self, lead_id: UUID, profile: Dict) -> Dict:
+        """Replace the lead's extracted profile."""
+        response = self.client.put(
+            f"/internals/leads/{lead_id}/profile",
+            json={"profile": profile}
+        )
+        return self._handle_response(response)
+    
     def get_or_create_lead(
         self,
         organization_id: UUID,
@@ -261,6 +276,27 @@ class InternalsAPIClient:
         )
         return self._handle_response(response)
     
+    # ========================================
+    # Inbound Message Claim Methods
+    # ========================================
+
+    def claim_inbound_message(self, message_id: str, lease_seconds: int = 300) -> Dict:
+        """Take on an inbound WhatsApp message; {"claimed": bool, "status": ...}."""
+        response = self.client.post(
+            f"/internals/inbound-messages/{message_id}/claim", params={"lease_seconds": lease_seconds}
+        )
+        return self._handle_response(response)
+
+    def update_inbound_message_claim(self, message_id: str, status: str) -> Dict:
+        """Mark a claimed message "replied" or "done"."""
+        response = self.client.patch(f"/internals/inbound-messages/{message_id}", json={"status": status})
+        return self._handle_response(response)
+
+    def release_inbound_message(self, message_id: str) -> None:
+        """Give up a claim nothing was sent for, so a redelivery is processed again."""
+        response = self.client.delete(f"/internals/inbound-messages/{message_id}/claim")
+        return self._handle_response(response)
+
     # ========================================
     # Message Methods
     # ========================================
@@ -309,11 +345,20 @@ class InternalsAPIClient:
         access_token: str,
         phone_number_id: str,
         version: str = "v18.0",
-        to: Optional[str] = None
+        to: Optional[str] = None,
+        template: Optional[Dict] = None,
+        interactive: Optional[Dict] = None,
+        parts: Optional[List[str]] = None,
+        part_delays_ms: Optional[List[int]] = None,
     ) -> Dict:
         """
         Send a WhatsApp message via the server's /message/send_bot endpoint.
         This handles both sending to WhatsApp and storing in the DB.
+        With template ({template_name, language, parameters}) an approved template
+        is sent instead, and content is stored as its rendered text. interactive
+        ({type, button_text, options}) adds quick-reply buttons or a list menu.
+        With parts, content is stored as one message but sent as those bubbles,
+        part_delays_ms[i] apart, with interactive on the last one.
         """
         payload = {
             "organization_id": str(organization_id),
@@ -325,6 +370,13 @@ class InternalsAPIClient:
         }
         if to:
             payload["to"] = to
+        if template:
+            payload["template"] = template
+        if interactive:
+            payload["interactive"] = interactive
+        if parts:
+            payload["parts"] = parts
+            payload["part_delays_ms"] = part_delays_ms or []
             
         response = self.client.post("/messages/send_bot", json=payload)
         return self._handle_response(response)
@@ -367,6 +419,46 @@ class InternalsAPIClient:
         )
         return self._handle_response(response)
     
+    def record_summary_revision(self, revision: Dict) -> Dict:
+        """Persist a rolling-summary revision (llm.memory_audit.SummaryRevision fields)."""
+        response = self.client.post("/internals/summary-revisions", json=revision)
+        return self._handle_response(response)
+    
+    # ========================================
+    # Prompt Store Methods
+    # ========================================
+
+    def get_active_prompts(self) -> Optional[Dict]:
+        """The active published prompt version, or None for the built-in prompts."""
+        response = self.client.get("/internals/prompts/active")
+        return self._handle_response(response)
+
+    def get_prompt_version(self, version: str) -> Dict:
+        """A published prompt version, active or not."""
+        response = self.client.get(f"/internals/prompts/{version}")
+        return self._handle_response(response)
+
+    # ========================================
+    # Pipeline Recording Methods
+    # ========================================
+
+    def create_pipeline_recording(self, recording: Dict) -> Dict:
+        """Persist a pipeline run for replay (llm.replay.PipelineRecording fields)."""
+        response = self.client.post("/internals/pipeline-recordings", json=recording)
+        return self._handle_response(response)
+
+    def get_pipeline_recording(self, recording_id: UUID) -> Dict:
+        """A recorded pipeline run."""
+        response = self.client.get(f"/internals/pipeline-recordings/{recording_id}")
+        return self._handle_response(response)
+
+    def get_pipeline_recordings(self, conversation_id: UUID, limit: int = 20) -> List[Dict]:
+        """Most recent recorded pipeline runs of a conversation, newest first."""
+        response = self.client.get(
+            f"/internals/conversations/{conversation_id}/pipeline-recordings", params={"limit": limit}
+        )
+        return self._handle_response(response)
+
     # ========================================
     # WebSocket Event Methods
     # ========================================
@@ -3,12 +3,16 @@ Context Builder for HTL Pipeline.
 Gathers all necessary context via API calls to build pipeline input.
 """
 import logging
+import re
 from datetime import datetime, timedelta, timezone
 from typing import Dict, List, Optional, Tuple
 from uuid import UUID
+from zoneinfo import ZoneInfo, ZoneInfoNotFoundError
 
+from llm.language import infer_language
 from llm.schemas import (
-    PipelineInput, MessageContext, TimingContext, NudgeContext
+    PipelineInput, MessageContext, TimingContext, NudgeContext, LeadProfile, PromptOverrides, PromptExample,
+    TemplateOption,
 )
 from server.enums import (
     ConversationStage, ConversationMode, IntentLevel, UserSentiment
@@ -17,6 +21,8 @@ from whatsapp_worker.processors.api_client import api_client
 
 logger = logging.getLogger(__name__)
 
+TEMPLATE_PLACEHOLDER = re.compile(r"\{\{(\d+)\}\}")
+
 def get_last_messages(
     conversation_id: UUID,
     limit: int = 10
@@ -36,6 +42,17 @@ def get_last_messages(
     ]
 
 
+def org_timezone(name: Optional[str]):
+    """The organization's timezone, falling back to UTC when unset or unknown."""
+    if not name:
+        return timezone.utc
+    try:
+        return ZoneInfo(name)
+    except (ZoneInfoNotFoundError, ValueError):
+        logger.warning(f"Unknown organization timezone {name!r}, using UTC")
+        return timezone.utc
+
+
 def calculate_whatsapp_window(last_user_message_at: Optional[str]) -> bool:
     """
     Check if WhatsApp 24-hour messaging window is open.
@@ -62,6 +79,38 @@ def calculate_whatsapp_window(last_user_message_at: Optional[str]) -> bool:
     return now < window_end
 
 
+def template_option(template: Dict) -> Optional[TemplateOption]:
+    """
+    Reduce an approved template to what the Mouth needs: its body text and
+    parameter count. Templates without a body are skipped.
+    """
+    body = next(
+        (
+            component.get("text", "")
+            for component in template.get("components") or []
+            if str(component.get("type", "")).upper() == "BODY"
+        ),
+        template.get("content") or "",
+    )
+    if not body:
+        return None
+    return TemplateOption(
+        name=template["name"],
+        language=template.get("language") or "en_US",
+        body=body,
+        parameter_count=len(set(TEMPLATE_PLACEHOLDER.findall(body))),
+    )
+
+
+def get_available_templates(organization_id: UUID) -> List[TemplateOption]:
+    try:
+        templates = api_client.get_organization_templates(organization_id)
+    except Exception as e:
+        logger.error(f"Failed to fetch templates for context: {e}")
+        return []
+    return [option for option in map(template_option, templates) if option]
+
+
 def build_pipeline_context(
     org_config: Dict,
     conversation: Dict,
@@ -76,6 +125,13 @@ def build_pipeline_context(
             - business_name: Optional[str]
             - business_description: Optional[str]
             - flow_prompt: Optional[str]
+            - memory_prompt: Optional[str]
+            - memory_fact_fields: Optional[List[str]]
+            - prompt_overrides: Optional[Dict] (persona, tone, style, language_style, forbidden_topics, stage_rules,
+                brain_stage_rules, emoji_style, whatsapp_formatting)
+            - prompt_examples: Optional[List[Dict]] (title, stage, turns)
+            - timezone: Optional[str] (IANA name, UTC if unset)
+            - forbidden_claims: Optional[List[str]] (phrases or "re:<regex>")
         conversation: Conversation data from API
         lead: Lead data from API
     """
@@ -84,9 +140,9 @@ def build_pipeline_context(
     # Get last messages
     last_messages = get_last_messages(conversation_id, limit=10)
     
-    # Get current time in ISO format
-    now = datetime.now(timezone.utc)
-    now_local = now.isoformat()
+    # Current time in the organization's timezone; relative times ("tomorrow 5pm") resolve against it
+    now = datetime.now(org_timezone(org_config.get("timezone")))
+    now_local = now.isoformat(timespec="seconds")
     
     # Calculate WhatsApp window
     whatsapp_window = calculate_whatsapp_window(conversation.get("last_user_message_at"))
@@ -120,26 +176,40 @@ def build_pipeline_context(
     try:
         raw_ctas = api_client.get_organization_ctas(UUID(org_config["organization_id"]))
         available_ctas = [
-            {"id": str(cta["id"]), "name": cta["name"]}
+            {"id": str(cta["id"]), "name": cta["name"], "type": cta.get("cta_type") or "booking", "params": cta.get("params") or {}}
             for cta in raw_ctas
         ]
     except Exception as e:
         logger.error(f"Failed to fetch CTAs for context: {e}")
         available_ctas = []
 
+    # Approved templates are only needed once the window has closed
+    available_templates = [] if whatsapp_window else get_available_templates(UUID(org_config["organization_id"]))
+
     # Build pipeline input
     context = PipelineInput(
+        conversation_id=str(conversation["id"]),
+        organization_id=str(org_config["organization_id"]),
+
         # Business context (from organization config)
         business_name=business_name,
         business_description=business_description,
         flow_prompt=flow_prompt,
+        memory_prompt=org_config.get("memory_prompt") or "",
+        memory_fact_fields=org_config.get("memory_fact_fields") or [],
+        # Read from the organization on every message, so edits apply to the next reply
+        prompt_overrides=PromptOverrides(**(org_config.get("prompt_overrides") or {})),
+        prompt_examples=[PromptExample(**example) for example in org_config.get("prompt_examples") or []],
+        forbidden_claims=org_config.get("forbidden_claims") or [],
         
         # CTAs
         available_ctas=available_ctas,
+        available_templates=available_templates,
         
         # Conversation context  
         rolling_summary=conversation.get("rolling_summary", ""),
         last_messages=last_messages,
+        lead_profile=LeadProfile(**(lead.get("profile") or {})),
         
         # Current state
         conversation_stage=stage,
@@ -155,7 +225,7 @@ def build_pipeline_context(
         # Constraints (defaults for now)
         max_words=80,
         questions_per_message=1,
-        language_pref="en",
+        language_pref=infer_language(msg.text for msg in last_messages if msg.sender == "lead"),
     )
     
     return context
\ No newline at end of file
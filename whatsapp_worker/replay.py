@@ -0,0 +1,72 @@
+"""
+Replay recorded pipeline runs (llm.replay) with the current prompts and models.
+
+    python -m whatsapp_worker.replay <recording_id>
+    python -m whatsapp_worker.replay --conversation <conversation_id> --limit 5
+    python -m whatsapp_worker.replay --file recording.json
+    python -m whatsapp_worker.replay --file logs/llm.log
+
+Recordings are fetched through the internal API (runs are recorded with
+LLM_RECORD_RUNS=true), or read from a file: a JSON recording or an llm log,
+whose PIPELINE RECORDING lines are all replayed. Nothing is sent or saved. Exits non-zero when any
+replay decided differently from production.
+"""
+import argparse
+import sys
+from typing import List
+from uuid import UUID
+
+from llm.replay import PipelineRecording, ReplayResult, parse_recordings, replay
+from whatsapp_worker.processors.actions import recording_from_api
+from whatsapp_worker.processors.api_client import api_client
+
+
+def load_recordings(args: argparse.Namespace) -> List[PipelineRecording]:
+    if args.file:
+        with open(args.file) as f:
+            return parse_recordings(f.read())
+    if args.conversation:
+        # Oldest first, so the conversation replays in order
+        recordings = api_client.get_pipeline_recordings(UUID(args.conversation), limit=args.limit)
+        return [recording_from_api(data) for data in reversed(recordings)]
+    return [recording_from_api(api_client.get_pipeline_recording(UUID(args.recording_id)))]
+
+
+def print_replay(recording: PipelineRecording, replayed: ReplayResult) -> None:
+    comparison = replayed.comparison
+    print(f"=== Recording {recording.id or '(file)'} [req {recording.request_id}], "
+          f"replayed as [req {replayed.result.request_id}]")
+    print(f"Prompts: {replayed.recorded_prompt_version} -> {replayed.replayed_prompt_version}")
+    print(f"Lead: {recording.user_message}")
+    print(f"Production ({comparison.production_action}, {comparison.production_stage}): "
+          f"{comparison.production_message or '(no reply)'}")
+    print(f"Replay     ({comparison.shadow_action}, {comparison.shadow_stage}): "
+          f"{comparison.shadow_message or '(no reply)'}")
+    print(f"Similarity: {comparison.message_similarity:.2f}")
+    print("Match" if comparison.matches else "DIFF: " + "; ".join(comparison.differences))
+    print()
+
+
+def main() -> int:
+    parser = argparse.ArgumentParser(description="Replay recorded pipeline runs")
+    source = parser.add_mutually_exclusive_group(required=True)
+    source.add_argument("recording_id", nargs="?", help="Recording to replay")
+    source.add_argument("--conversation", help="Replay a conversation's most recent recordings")
+    source.add_argument("--file", help="Replay a JSON recording or the recordings in an llm log")
+    parser.add_argument("--limit", type=int, default=20, help="Recordings to replay with --conversation")
+    parser.add_argument("--json", action="store_true", help="Print the replay results as JSON lines")
+    args = parser.parse_args()
+
+    mismatches = 0
+    for recording in load_recordings(args):
+        replayed = replay(recording)
+        if args.json:
+            print(replayed.model_dump_json())
+        else:
+            print_replay(recording, replayed)
+        mismatches += not replayed.comparison.matches
+    return 1 if mismatches else 0
+
+
+if __name__ == "__main__":
+    sys.exit(main())
@@ -7,8 +7,14 @@ from uuid import UUID
 from celery import Celery
 from whatsapp_worker.processors.api_client import api_client
 from whatsapp_worker.processors.context import build_pipeline_context
-from whatsapp_worker.processors.actions import handle_pipeline_result
-from llm.pipeline import run_followup_pipeline
+from whatsapp_worker.processors.actions import (
+    handle_pipeline_result, record_llm_spend, send_reply, ApiPromptStore, ApiRecordingSink
+)
+from llm.pipeline import FOLLOWUP_TRIGGER_MESSAGE, run_followup_pipeline
+from llm.run_context import RunContext
+from llm.config import llm_config
+from llm.prompt_store import set_prompt_store
+from llm.replay import record_run, set_recording_sink
 from server.enums import ConversationStage
 from whatsapp_worker.config import config
 from logging_config import setup_logging
@@ -18,6 +24,12 @@ setup_logging()
 
 logger = logging.getLogger(__name__)
 
+# Follow-ups use the same published prompts as inbound replies
+if llm_config.prompt_store_backend == "api":
+    set_prompt_store(ApiPromptStore())
+if llm_config.record_runs:
+    set_recording_sink(ApiRecordingSink())
+
 
 CELERY_BROKER_URL = config.CELERY_BROKER_URL
 CELERY_RESULT_BACKEND = config.CELERY_RESULT_BACKEND
@@ -104,10 +116,17 @@ def process_realtime_followup(context: dict):
     
     # Build org config dict from context
     org_config = {
+        "organization_id": str(context["organization_id"]),
         "organization_name": context["organization_name"],
         "business_name": context.get("business_name"),
         "business_description": context.get("business_description"),
         "flow_prompt": context.get("flow_prompt"),
+        "memory_prompt": context.get("memory_prompt"),
+        "memory_fact_fields": context.get("memory_fact_fields"),
+        "prompt_overrides": context.get("prompt_overrides"),
+        "prompt_examples": context.get("prompt_examples"),
+        "timezone": context.get("timezone"),
+        "forbidden_claims": context.get("forbidden_claims"),
     }
     
     # Build pipeline context
@@ -117,21 +136,25 @@ def process_realtime_followup(context: dict):
         lead
     )
     
-    # Run followup pipeline
-    pipeline_result = run_followup_pipeline(pipeline_context)
+    # Run followup pipeline (retries and fallbacks share the follow-up budget)
+    ctx = RunContext(timeout=llm_config.followup_budget_seconds)
+    # Follow-ups are not folded into the rolling summary
+    pipeline_result = run_followup_pipeline(pipeline_context, ctx=ctx, memory_mode="worker")
     
     # Handle result
     response_message = handle_pipeline_result(
         conversation, UUID(lead["id"]), pipeline_result
     )
+    record_llm_spend(UUID(context["organization_id"]), UUID(conversation["id"]), pipeline_result)
+    record_run(pipeline_context, FOLLOWUP_TRIGGER_MESSAGE, pipeline_result)
     
-    # Send and store message via API if needed
+    # Send and store message via API if needed (a template when the 24h window is closed)
     if response_message:
         try:
-            api_client.send_bot_message(
+            send_reply(
+                pipeline_result,
                 organization_id=UUID(context["organization_id"]),
                 conversation_id=UUID(conversation["id"]),
-                content=response_message,
                 access_token=context["access_token"],
                 phone_number_id=context["phone_number_id"],
                 version=context["version"],